@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/archive"
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// batchOp describes one operation in a batch file
+type batchOp struct {
+	Action      string `json:"action"`
+	Input       string `json:"input"`
+	Output      string `json:"output"`
+	Format      string `json:"format"`
+	Password    string `json:"password"`
+	Compression string `json:"compression"`
+}
+
+// loadBatch reads operations from path. The file may hold a JSON array or
+// a sequence of JSON objects (one per line).
+func loadBatch(path string) ([]batchOp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var ops []batchOp
+		if err := json.Unmarshal(trimmed, &ops); err != nil {
+			return nil, fmt.Errorf("parse batch file: %w", err)
+		}
+		return ops, nil
+	}
+
+	var ops []batchOp
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var op batchOp
+		if err := dec.Decode(&op); err == io.EOF {
+			return ops, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("parse batch file: operation %d: %w", len(ops)+1, err)
+		}
+		ops = append(ops, op)
+	}
+}
+
+// runBatch executes every operation in the batch file sequentially on one
+// shared worker pool. Each operation starts from the command-line
+// arguments with the batch fields layered on top; a failure is recorded
+// and the remaining operations still run. A wrong password stops the
+// batch, since a shared -password would fail every archive after it,
+// unless ContinueOnDecryptError is set; archives that failed that way are
+// listed at the end. It returns an error if any operation failed.
+func runBatch(base *models.CLIArgs) error {
+	ops, err := loadBatch(base.Batch)
+	if err != nil {
+		return err
+	}
+
+	workers := base.Workers
+	if workers <= models.WorkersAuto {
+		workers = archive.AutoWorkers()
+	}
+	pool := models.NewWorkerPool(workers)
+	defer pool.Close()
+
+	var failed, wrongPassword []string
+	run := 0
+	for i, op := range ops {
+		args := *base
+		args.Batch = ""
+		args.Action = op.Action
+		args.Input = op.Input
+		args.Output = op.Output
+		if op.Format != "" {
+			args.Format = op.Format
+			args.FormatSet = true
+		}
+		if op.Password != "" {
+			args.Password = op.Password
+		}
+		if op.Compression != "" {
+			args.Compression = op.Compression
+		}
+
+		label := fmt.Sprintf("#%d %s %s", i+1, op.Action, op.Input)
+		run++
+		if err := runBatchOp(&args, pool); err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", label, err)
+			failed = append(failed, label)
+			if !errors.Is(err, crypto.ErrWrongPassword) {
+				continue
+			}
+			wrongPassword = append(wrongPassword, label)
+			if !base.ContinueOnDecryptError {
+				fmt.Fprintf(os.Stderr, "Stopping batch after a wrong password (use -continue-on-decrypt-error to keep going)\n")
+				break
+			}
+			continue
+		}
+		if args.Verbose {
+			fmt.Printf("OK   %s\n", label)
+		}
+	}
+
+	fmt.Printf("Batch complete: %d succeeded, %d failed", run-len(failed), len(failed))
+	if skipped := len(ops) - run; skipped > 0 {
+		fmt.Printf(", %d not run", skipped)
+	}
+	fmt.Println()
+	if len(wrongPassword) > 0 {
+		fmt.Printf("Wrong password or corrupted archive:\n")
+		for _, label := range wrongPassword {
+			fmt.Printf("  %s\n", label)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d batch operations failed", len(failed), len(ops))
+	}
+	return nil
+}
+
+// runBatchOp validates and runs a single batch operation on pool
+func runBatchOp(args *models.CLIArgs, pool *models.WorkerPool) error {
+	if args.Action == "" || args.Input == "" {
+		return fmt.Errorf("action and input are required")
+	}
+
+	opts, err := buildOptions(args)
+	if err != nil {
+		return err
+	}
+	opts.Pool = pool
+
+	if err := runAction(args, opts); err != nil {
+		if errors.Is(err, errUnknownAction) {
+			return fmt.Errorf("unknown action: %s", args.Action)
+		}
+		return err
+	}
+	return nil
+}
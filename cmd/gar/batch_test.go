@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// writeBatch writes ops as one JSON object per line
+func writeBatch(t *testing.T, dir string, ops []batchOp) string {
+	t.Helper()
+
+	var lines []string
+	for _, op := range ops {
+		line, err := json.Marshal(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(line))
+	}
+	path := filepath.Join(dir, "ops.json")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunBatchCompressAndExtract(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "alpha", "sub/b.txt": "beta"}
+	writeTree(t, filepath.Join(dir, "src"), files)
+
+	ops := []batchOp{
+		{Action: "compress", Input: filepath.Join(dir, "src"), Output: filepath.Join(dir, "out.zip")},
+		{Action: "compress", Input: filepath.Join(dir, "src"), Output: filepath.Join(dir, "out.tar.gz"), Format: "tar.gz"},
+		{Action: "extract", Input: filepath.Join(dir, "out.zip"), Output: filepath.Join(dir, "x1")},
+		{Action: "extract", Input: filepath.Join(dir, "out.tar.gz"), Output: filepath.Join(dir, "x2")},
+	}
+	args := &models.CLIArgs{Batch: writeBatch(t, dir, ops), Compression: "normal", Workers: 2}
+	if err := runBatch(args); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, out := range []string{"x1", "x2"} {
+		for name, want := range files {
+			got, err := os.ReadFile(filepath.Join(dir, out, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("%s/%s = %q, want %q", out, name, got, want)
+			}
+		}
+	}
+}
+
+func TestRunBatchReportsFailures(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, filepath.Join(dir, "src"), map[string]string{"a.txt": "alpha"})
+
+	ops := []batchOp{
+		{Action: "extract", Input: filepath.Join(dir, "missing.zip"), Output: filepath.Join(dir, "x")},
+		{Action: "compress", Input: filepath.Join(dir, "src"), Output: filepath.Join(dir, "out.zip")},
+	}
+	args := &models.CLIArgs{Batch: writeBatch(t, dir, ops), Compression: "normal"}
+	if err := runBatch(args); err == nil {
+		t.Fatal("batch with a failed operation returned no error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.zip")); err != nil {
+		t.Errorf("operation after the failure did not run: %v", err)
+	}
+}
+
+func TestLoadBatchFormats(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]int{
+		`[{"action":"list","input":"a.zip"},{"action":"list","input":"b.zip"}]`:                  2,
+		"{\"action\":\"list\",\"input\":\"a.zip\"}\n{\"action\":\"list\",\"input\":\"b.zip\"}\n": 2,
+		"": 0,
+	}
+	for content, want := range tests {
+		path := filepath.Join(dir, "ops.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ops, err := loadBatch(path)
+		if err != nil {
+			t.Fatalf("loadBatch(%q): %v", content, err)
+		}
+		if len(ops) != want {
+			t.Errorf("loadBatch(%q) = %d operations, want %d", content, len(ops), want)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBatch(filepath.Join(dir, "bad.json")); err == nil {
+		t.Error("loadBatch accepted malformed JSON")
+	}
+}
+
+func TestRunBatchWrongPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		continueOn bool
+		// ran reports whether the extract after the wrong password ran
+		ran bool
+	}{
+		{"stop by default", false, false},
+		{"continue on request", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, filepath.Join(dir, "src"), map[string]string{"a.txt": "alpha"})
+			src := filepath.Join(dir, "src")
+
+			ops := []batchOp{
+				{Action: "compress", Input: src, Output: filepath.Join(dir, "a.tar.gz"), Format: "tar.gz", Password: "right"},
+				{Action: "compress", Input: src, Output: filepath.Join(dir, "b.zip"), Password: "other"},
+				{Action: "extract", Input: filepath.Join(dir, "a.tar.gz"), Output: filepath.Join(dir, "before"), Password: "right"},
+				{Action: "extract", Input: filepath.Join(dir, "b.zip"), Output: filepath.Join(dir, "wrong"), Password: "right"},
+				{Action: "extract", Input: filepath.Join(dir, "a.tar.gz"), Output: filepath.Join(dir, "after"), Password: "right"},
+			}
+			args := &models.CLIArgs{Batch: writeBatch(t, dir, ops), Compression: "normal", ContinueOnDecryptError: tt.continueOn}
+			err := runBatch(args)
+			if err == nil || !strings.Contains(err.Error(), "1 of 5") {
+				t.Fatalf("error = %v, want one failed operation", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, "before", "a.txt")); err != nil {
+				t.Errorf("extract before the wrong password: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "wrong", "a.txt")); err == nil {
+				t.Error("the wrong password extracted a file")
+			}
+			_, statErr := os.Stat(filepath.Join(dir, "after", "a.txt"))
+			if ran := statErr == nil; ran != tt.ran {
+				t.Errorf("operation after the wrong password ran = %v, want %v", ran, tt.ran)
+			}
+		})
+	}
+}
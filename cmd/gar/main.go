@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/cubetiqlabs/gar/internal/archive"
 	"github.com/cubetiqlabs/gar/internal/cli"
 	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/progress"
 	"github.com/cubetiqlabs/gar/pkg/version"
 )
 
@@ -36,6 +40,32 @@ func main() {
 		return
 	}
 
+	// Buffers are shared by every operation, including batched ones
+	if args.BufferSize != "" {
+		size, err := archive.ParseSize(args.BufferSize)
+		if err == nil {
+			err = archive.SetBufferSize(size)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := readPasswordSource(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Run a batch of operations from a file
+	if args.Batch != "" {
+		if err := runBatch(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Validate required arguments
 	if args.Action == "" || args.Input == "" {
 		parser.PrintUsage(Version)
@@ -43,26 +73,189 @@ func main() {
 	}
 
 	// Build archive options from parsed arguments
+	opts, err := buildOptions(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Execute action
+	if err := runAction(args, opts); err != nil {
+		if errors.Is(err, errNotContained) {
+			os.Exit(1)
+		}
+		if errors.Is(err, errUnknownAction) {
+			fmt.Fprintf(os.Stderr, "Unknown action: %s\n", args.Action)
+			parser.PrintUsage(Version)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// errUnknownAction is returned by runAction for unrecognized actions
+var errUnknownAction = errors.New("unknown action")
+
+// errNotContained is returned by runAction when -action=contains finds no
+// matching entry; it exits 1 without a message, like grep
+var errNotContained = errors.New("entry not found")
+
+// buildOptions converts parsed CLI arguments into archive options
+func buildOptions(args *models.CLIArgs) (*models.ArchiveOptions, error) {
+	// A level given with the format (e.g. zip:store, tar.gz:9) overrides -compression
+	format, level := args.Format, args.Compression
+	if name, formatLevel, ok := strings.Cut(format, ":"); ok {
+		format, level = name, formatLevel
+	}
+
 	opts := &models.ArchiveOptions{
-		Format:   archive.ParseFormat(args.Format),
-		Password: args.Password,
-		Workers:  args.Workers,
-		Verbose:  args.Verbose,
+		Format:                archive.ParseFormat(format),
+		ForceFormat:           args.FormatSet,
+		Password:              args.Password,
+		Workers:               args.Workers,
+		Verbose:               args.Verbose,
+		AllowUnsafeLinks:      args.AllowUnsafeLinks,
+		MergePolicy:           args.MergePolicy,
+		Stream:                args.Stream,
+		TempDir:               args.TempDir,
+		PreserveBirthTime:     args.PreserveBirthTime,
+		NoFollowRoot:          args.NoFollowRoot,
+		DerefDepth:            args.DerefDepth,
+		MaxRatio:              args.MaxRatio,
+		NoRecursion:           args.NoRecursion,
+		FastGzip:              args.FastGzip,
+		ACLs:                  args.ACLs,
+		StripExtendedHeaders:  args.StripExtendedHeaders,
+		ExcludeBackups:        args.ExcludeBackups,
+		Manifest:              args.Manifest,
+		Hash:                  args.Hash,
+		DryRun:                args.DryRun,
+		JSON:                  args.JSON,
+		Sparse:                args.Sparse,
+		Snapshot:              args.Snapshot,
+		LowMemory:             args.LowMemory,
+		SignKey:               args.SignKey,
+		RequireSignature:      args.RequireSignature,
+		PublicKey:             args.PublicKey,
+		AllowSymlinkOverwrite: args.AllowSymlinkOverwrite,
+		Update:                args.Update,
+		Sync:                  args.Sync,
+		Index:                 args.Index,
+		CasePolicy:            args.CasePolicy,
+		RawTar:                args.RawTar,
+		MaxDepth:              args.MaxDepth,
+		OrderFrom:             args.OrderFrom,
+		Recover:               args.Recover,
+		ParallelGzip:          args.ParallelGzip,
+		OnConflict:            args.OnConflict,
+		RenameTemplate:        args.RenameTemplate,
+		PreserveFlags:         args.PreserveFlags,
+		TextConvert:           args.TextConvert,
+		Resume:                args.Resume,
+		Serial:                args.Serial,
+		PreserveOrder:         args.PreserveOrder,
+		SkipEmpty:             args.SkipEmpty,
+		Strict:                args.Strict,
+		DoneMarker:            args.DoneMarker,
+		Mmap:                  args.Mmap,
+		KDFIterations:         args.KDFIterations,
+		KDF:                   args.KDF,
+		Cipher:                args.Cipher,
+		AttrRules:             args.AttrRules,
+		SymlinkFallback:       args.SymlinkFallback,
+		Merkle:                args.Merkle,
+		MerkleRoot:            args.MerkleRoot,
+	}
+
+	if args.Exclude != "" {
+		opts.Exclude = strings.Split(args.Exclude, ",")
+	}
+	if args.EncryptPattern != "" {
+		opts.EncryptPattern = strings.Split(args.EncryptPattern, ",")
+	}
+	if args.TextPattern != "" {
+		opts.TextPattern = strings.Split(args.TextPattern, ",")
+	}
+	if args.PartSize != "" {
+		size, err := archive.ParseSize(args.PartSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -part-size: %w", err)
+		}
+		opts.PartSize = size
+	}
+	if args.Umask != "" {
+		umask, err := strconv.ParseUint(args.Umask, 8, 32)
+		if err != nil || umask > 0777 {
+			return nil, fmt.Errorf("invalid -umask value %q: want octal permission bits such as 022", args.Umask)
+		}
+		opts.Umask = os.FileMode(umask)
+	}
+	switch {
+	case opts.TextConvert != "" && opts.TextConvert != archive.TextLF && opts.TextConvert != archive.TextCRLF:
+		return nil, fmt.Errorf("invalid -text-convert value %q: want lf or crlf", opts.TextConvert)
+	case opts.TextConvert != "" && len(opts.TextPattern) == 0:
+		// Converting every file would corrupt binaries
+		return nil, fmt.Errorf("-text-convert needs -text-pattern to select the text files")
+	}
+	if len(args.Transform) > 0 {
+		transform, err := archive.ParseTransforms(args.Transform)
+		if err != nil {
+			return nil, err
+		}
+		// A rule that empties a name drops the entry, as with tar
+		opts.EntryFilter = func(e models.Entry) (bool, string) {
+			name := transform(e.Name)
+			return name != "", name
+		}
+	}
+
+	// Pin entry times for reproducible output
+	var err error
+	if opts.ModTime, err = archive.ParseModTime(args.ModTime); err != nil {
+		return nil, err
+	}
+
+	// Passwords may live in the OS keyring rather than on the command line
+	if opts.Password, err = resolvePassword(args); err != nil {
+		return nil, err
+	}
+	if args.Keyfile != "" {
+		if opts.Keyfile, err = readKeyfile(args.Keyfile); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Verbose {
+		opts.Stats = &models.RunStats{}
+	}
+
+	// Set up progress reporting
+	opts.Progress, err = progress.New(args.Progress, os.Stderr, args.ProgressInterval)
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse compression level
-	switch args.Compression {
-	case "fastest":
-		opts.CompressionLevel = models.LevelFastest
-	case "best":
-		opts.CompressionLevel = models.LevelBest
-	default:
-		opts.CompressionLevel = models.LevelNormal
+	opts.CompressionLevel, opts.CodecLevel, err = archive.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts.NormalLevels = map[models.Codec]int{
+		models.CodecFlate: args.FlateLevel,
+		models.CodecGzip:  args.GzipLevel,
+		models.CodecZstd:  args.ZstdLevel,
+	}
+	if err := archive.CheckNormalLevels(opts.NormalLevels); err != nil {
+		return nil, err
 	}
 
-	// Execute action
+	return opts, nil
+}
+
+// runAction executes the action named in args
+func runAction(args *models.CLIArgs, opts *models.ArchiveOptions) error {
 	operator := archive.NewOperator(opts)
-	var actionErr error
 
 	switch args.Action {
 	case "compress", "c":
@@ -70,34 +263,95 @@ func main() {
 		if output == "" {
 			output = args.Input + archive.GetExtension(opts.Format)
 		}
-		actionErr = archive.TimeOperation(
-			func() error { return operator.Compress(args.Input, output) },
-			opts.Verbose,
-			"Compression",
-		)
+		return withInterrupt(opts, func() error {
+			return archive.TimeOperation(
+				func() error { return operator.Compress(args.Input, output) },
+				opts.Verbose,
+				"Compression",
+				opts.Stats,
+			)
+		})
 
 	case "extract", "x":
 		output := args.Output
 		if output == "" {
 			output = "."
 		}
-		actionErr = archive.TimeOperation(
+		return archive.TimeOperation(
 			func() error { return operator.Extract(args.Input, output) },
 			opts.Verbose,
 			"Extraction",
+			opts.Stats,
 		)
 
 	case "list", "l":
-		actionErr = operator.List(args.Input)
+		return operator.List(args.Input)
 
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown action: %s\n", args.Action)
-		parser.PrintUsage(Version)
-		os.Exit(1)
-	}
+	case "count":
+		count, err := operator.Count(args.Input)
+		if err != nil {
+			return err
+		}
+		fmt.Println(count)
+		return nil
 
-	if actionErr != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", actionErr)
-		os.Exit(1)
+	case "merge", "m":
+		output := args.Output
+		if output == "" {
+			output = "merged" + archive.GetExtension(opts.Format)
+		}
+		return archive.TimeOperation(
+			func() error { return operator.Merge(strings.Split(args.Input, ","), output) },
+			opts.Verbose,
+			"Merge",
+			opts.Stats,
+		)
+
+	case "info":
+		if args.EmptyDirs {
+			return operator.ListEmptyDirs(args.Input)
+		}
+		if args.Duplicates {
+			return operator.ListDuplicates(args.Input)
+		}
+		return operator.Info(args.Input)
+
+	case "verify":
+		if args.Entry != "" {
+			return operator.VerifyEntry(args.Input, args.Entry)
+		}
+		if info, err := os.Stat(args.Input); err == nil && info.IsDir() {
+			return operator.VerifyDir(args.Input)
+		}
+		return operator.Verify(args.Input)
+
+	case "cat":
+		if args.Entry == "" {
+			return fmt.Errorf("cat needs -entry")
+		}
+		return operator.ExtractEntryTo(args.Input, args.Entry, os.Stdout)
+
+	case "contains":
+		if args.Entry == "" {
+			return fmt.Errorf("contains needs -entry")
+		}
+		found, err := operator.Contains(args.Input, args.Entry)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errNotContained
+		}
+		return nil
+
+	case "repack":
+		output := args.Output
+		if output == "" {
+			output = "-"
+		}
+		return operator.Repack(args.Input, output)
+
+	default:
+		return errUnknownAction
 	}
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/archive"
+	"github.com/cubetiqlabs/gar/internal/cli"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestBuildOptionsFormatLevel(t *testing.T) {
+	tests := []struct {
+		format, compression string
+		wantFormat          models.ArchiveFormat
+		wantLevel           models.CompressionLevel
+		wantCodecLevel      int
+		wantErr             string
+	}{
+		{format: "zip", compression: "normal", wantFormat: models.FormatZip, wantLevel: models.LevelNormal},
+		{format: "zip:store", compression: "best", wantFormat: models.FormatZip, wantLevel: models.LevelStore},
+		{format: "tar.gz:best", compression: "fastest", wantFormat: models.FormatTarGz, wantLevel: models.LevelBest},
+		{format: "tar.gz:fastest", wantFormat: models.FormatTarGz, wantLevel: models.LevelFastest},
+		{format: "tar.gz:huffman", wantFormat: models.FormatTarGz, wantLevel: models.LevelHuffman},
+		{format: "tar.zst:19", compression: "store", wantFormat: models.FormatTarZstd, wantLevel: models.LevelNormal, wantCodecLevel: 19},
+		{format: "tar.xz:9", wantFormat: models.FormatTarXz, wantLevel: models.LevelNormal, wantCodecLevel: 9},
+		{format: "tar.bz2", compression: "1", wantFormat: models.FormatTarBz2, wantLevel: models.LevelNormal, wantCodecLevel: 1},
+		{format: "zip:fast", wantErr: "invalid compression level: fast"},
+		{format: "tar.gz:-1", wantErr: "invalid compression level: -1"},
+		{format: "tar.gz:0", wantErr: "invalid compression level: 0"},
+	}
+	for _, tt := range tests {
+		args := &models.CLIArgs{Format: tt.format, Compression: tt.compression}
+		opts, err := buildOptions(args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("-format=%s -compression=%s: error = %v, want %q", tt.format, tt.compression, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("-format=%s -compression=%s: %v", tt.format, tt.compression, err)
+			continue
+		}
+		if opts.Format != tt.wantFormat || opts.CompressionLevel != tt.wantLevel || opts.CodecLevel != tt.wantCodecLevel {
+			t.Errorf("-format=%s -compression=%s: format %d level %d codec level %d, want %d %d %d",
+				tt.format, tt.compression, opts.Format, opts.CompressionLevel, opts.CodecLevel,
+				tt.wantFormat, tt.wantLevel, tt.wantCodecLevel)
+		}
+	}
+}
+
+func TestBuildOptionsNormalLevels(t *testing.T) {
+	args := &models.CLIArgs{Format: "zip", Compression: "normal", GzipLevel: 6, ZstdLevel: 19, FlateLevel: 3}
+	opts, err := buildOptions(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[models.Codec]int{models.CodecFlate: 3, models.CodecGzip: 6, models.CodecZstd: 19}
+	if !maps.Equal(opts.NormalLevels, want) {
+		t.Errorf("NormalLevels = %v, want %v", opts.NormalLevels, want)
+	}
+
+	args = &models.CLIArgs{Format: "tar.zst", Compression: "normal", ZstdLevel: 23}
+	if _, err := buildOptions(args); err == nil || !strings.Contains(err.Error(), "invalid zstd level 23") {
+		t.Errorf("-zstd-level=23: error = %v", err)
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	want := time.Unix(1700000000, 0)
+
+	dir := t.TempDir()
+	writeTree(t, filepath.Join(dir, "src"), map[string]string{"a.txt": "alpha", "sub/b.txt": "beta"})
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			outputPath := filepath.Join(dir, "out."+format)
+			p := cli.NewParser()
+			args, err := p.Parse([]string{"-cf", outputPath, "-format=" + format, filepath.Join(dir, "src")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, err := buildOptions(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := archive.NewOperator(opts).Compress(args.Input, outputPath); err != nil {
+				t.Fatal(err)
+			}
+
+			var times []time.Time
+			switch format {
+			case "zip":
+				zr, err := zip.OpenReader(outputPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer zr.Close()
+				for _, f := range zr.File {
+					times = append(times, f.Modified)
+				}
+			case "tar.gz":
+				file, err := os.Open(outputPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				gz, err := gzip.NewReader(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				times = append(times, gz.ModTime)
+				tr := tar.NewReader(gz)
+				for {
+					header, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					times = append(times, header.ModTime)
+				}
+			}
+
+			if len(times) < 3 {
+				t.Fatalf("read %d times, want at least 3", len(times))
+			}
+			for i, got := range times {
+				if !got.Equal(want) {
+					t.Errorf("time %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTransformChain(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTree(t, src, map[string]string{"lib/util.go": "package lib", "tmp/cache": "drop"})
+
+	// Rules apply left to right: lib/ becomes pkg/, then .go becomes .txt
+	rules := []string{"-transform", `s/^lib\//pkg\//`, "-transform", `s/\.go$/.txt/`, "-transform", `s/^tmp.*//`}
+
+	archivePath := filepath.Join(dir, "out.zip")
+	args, err := cli.NewParser().Parse(append([]string{"-cf", archivePath}, append(rules, src)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := buildOptions(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.NewOperator(opts).Compress(args.Input, archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, "/") {
+			names = append(names, f.Name)
+		}
+	}
+	zr.Close()
+	if want := []string{"pkg/util.txt"}; !slices.Equal(names, want) {
+		t.Errorf("compressed names = %q, want %q", names, want)
+	}
+
+	// On extract too, each rule sees the name the previous one produced
+	output := filepath.Join(dir, "out")
+	args, err = cli.NewParser().Parse([]string{"-xf", archivePath, "-transform", `s/^pkg/src/`, "-transform", `s/^src\/util/src\/main/`, output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts, err = buildOptions(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.NewOperator(opts).Extract(archivePath, output); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(output, "src", "main.txt")); err != nil || string(got) != "package lib" {
+		t.Errorf("src/main.txt = %q, %v", got, err)
+	}
+
+	args.Transform = []string{`s/a/b/`, `s/[/x/`}
+	if _, err := buildOptions(args); err == nil || !strings.Contains(err.Error(), `s/[/x/`) {
+		t.Errorf("invalid second rule: err = %v", err)
+	}
+}
+
+func TestRunActionContains(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, filepath.Join(dir, "src"), map[string]string{"docs/guide.md": "guide"})
+	input := filepath.Join(dir, "in.zip")
+	if err := archive.NewOperator(&models.ArchiveOptions{}).Compress(filepath.Join(dir, "src"), input); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		entry string
+		want  error
+	}{
+		{"docs/guide.md", nil},
+		{"docs/*.md", nil},
+		{"docs/*.txt", errNotContained},
+	}
+	for _, tt := range tests {
+		args := &models.CLIArgs{Action: "contains", Input: input, Entry: tt.entry}
+		if err := runAction(args, &models.ArchiveOptions{}); !errors.Is(err, tt.want) {
+			t.Errorf("-entry=%s: err = %v, want %v", tt.entry, err, tt.want)
+		}
+	}
+	args := &models.CLIArgs{Action: "contains", Input: input}
+	if err := runAction(args, &models.ArchiveOptions{}); err == nil || errors.Is(err, errNotContained) {
+		t.Errorf("without -entry: err = %v, want a usage error", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// fifoPrefix marks a password value naming a named pipe the password is
+// read from ("fifo:/run/secrets/gar.pipe")
+const fifoPrefix = "fifo:"
+
+// resolvePassword returns the password to use for args. A
+// "keyring:service/account" value is looked up in the OS keyring, or with
+// SavePassword prompted for and stored there first, and a "fifo:path"
+// value is read from the named pipe.
+func resolvePassword(args *models.CLIArgs) (string, error) {
+	if fifoPath, ok := strings.CutPrefix(args.Password, fifoPrefix); ok {
+		if args.SavePassword {
+			return "", fmt.Errorf("-save-password requires -password=%sservice/account", crypto.KeyringPrefix)
+		}
+		return readPasswordFIFO(fifoPath)
+	}
+
+	ref, ok, err := crypto.ParseKeyringRef(args.Password)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		if args.SavePassword {
+			return "", fmt.Errorf("-save-password requires -password=%sservice/account", crypto.KeyringPrefix)
+		}
+		return args.Password, nil
+	}
+
+	if !args.SavePassword {
+		return crypto.KeyringPassword(ref)
+	}
+
+	password, err := promptNewPassword()
+	if err != nil {
+		return "", err
+	}
+	if err := crypto.SaveKeyringPassword(ref, password); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// readPasswordFIFO reads one line from the named pipe at path, waiting for
+// a writer if there is none yet. Anything but a named pipe is refused, so
+// the password never comes from a file left on disk.
+func readPasswordFIFO(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("password pipe: %w", err)
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return "", fmt.Errorf("password pipe: %s is not a named pipe", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("password pipe: %w", err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("password pipe: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password pipe: %s gave an empty password", path)
+	}
+	return password, nil
+}
+
+// readPasswordSource fills args.Password from -password-env or
+// -password-stdin. It runs once before any operation, so a batch reads
+// stdin only once.
+func readPasswordSource(args *models.CLIArgs) error {
+	switch {
+	case args.PasswordEnv != "":
+		password := os.Getenv(args.PasswordEnv)
+		if password == "" {
+			return fmt.Errorf("-password-env: %s is not set", args.PasswordEnv)
+		}
+		args.Password = password
+	case args.PasswordStdin:
+		password, err := readPasswordStdin()
+		if err != nil {
+			return fmt.Errorf("-password-stdin: %w", err)
+		}
+		args.Password = password
+	}
+	return nil
+}
+
+// readPasswordStdin prompts for a password without echo when stdin is a
+// terminal, and otherwise reads one line from it
+func readPasswordStdin() (string, error) {
+	var password string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		password = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		return "", fmt.Errorf("empty password")
+	}
+	return password, nil
+}
+
+// readKeyfile reads the key material in path. An empty file is refused,
+// since it would add nothing to the key.
+func readKeyfile(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("keyfile: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("keyfile: %s is empty", path)
+	}
+	return key, nil
+}
+
+// promptNewPassword reads a password twice from the terminal without
+// echoing it
+func promptNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("-save-password needs a terminal to prompt for the password")
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if len(first) == 0 {
+		return "", fmt.Errorf("empty password")
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(first), nil
+}
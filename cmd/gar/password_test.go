@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/cubetiqlabs/gar/internal/archive"
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestResolvePasswordKeyring(t *testing.T) {
+	keyring.MockInit()
+	if err := keyring.Set("gar-test", "backup", "from keyring"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args    models.CLIArgs
+		want    string
+		wantErr string
+	}{
+		{args: models.CLIArgs{Password: "plain"}, want: "plain"},
+		{args: models.CLIArgs{Password: "keyring:gar-test/backup"}, want: "from keyring"},
+		{args: models.CLIArgs{Password: "keyring:gar-test/other"}, wantErr: "no password stored at keyring:gar-test/other"},
+		{args: models.CLIArgs{Password: "keyring:gar-test"}, wantErr: "want keyring:service/account"},
+		{args: models.CLIArgs{Password: "plain", SavePassword: true}, wantErr: "-save-password requires -password=keyring:"},
+		// Tests run without a terminal to prompt on
+		{args: models.CLIArgs{Password: "keyring:gar-test/new", SavePassword: true}, wantErr: "needs a terminal"},
+	}
+	for _, tt := range tests {
+		got, err := resolvePassword(&tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("-password=%s -save-password=%v: err = %v, want %q", tt.args.Password, tt.args.SavePassword, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("-password=%s: resolvePassword = %q, %v; want %q", tt.args.Password, got, err, tt.want)
+		}
+	}
+}
+
+// withStdin runs fn with standard input reading input from a pipe
+func withStdin(t *testing.T, input string, fn func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	saved := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = saved }()
+	fn()
+}
+
+func TestReadPasswordSource(t *testing.T) {
+	t.Setenv("GAR_TEST_PASSWORD", "from env")
+	t.Setenv("GAR_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		args    models.CLIArgs
+		stdin   string
+		want    string
+		wantErr string
+	}{
+		{name: "env", args: models.CLIArgs{PasswordEnv: "GAR_TEST_PASSWORD"}, want: "from env"},
+		{name: "unset env", args: models.CLIArgs{PasswordEnv: "GAR_TEST_EMPTY"}, wantErr: "GAR_TEST_EMPTY is not set"},
+		{name: "stdin", args: models.CLIArgs{PasswordStdin: true}, stdin: "from stdin\nignored\n", want: "from stdin"},
+		{name: "stdin crlf", args: models.CLIArgs{PasswordStdin: true}, stdin: "from stdin\r\n", want: "from stdin"},
+		{name: "stdin without newline", args: models.CLIArgs{PasswordStdin: true}, stdin: "from stdin", want: "from stdin"},
+		{name: "empty stdin", args: models.CLIArgs{PasswordStdin: true}, stdin: "", wantErr: "empty password"},
+		{name: "none", args: models.CLIArgs{Password: "plain"}, want: "plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			withStdin(t, tt.stdin, func() { err = readPasswordSource(&tt.args) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.args.Password != tt.want {
+				t.Errorf("password = %q, want %q", tt.args.Password, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyfileOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, filepath.Join(dir, "src"), map[string]string{"a.txt": "alpha"})
+	writeTree(t, dir, map[string]string{"key": "0123456789abcdef", "other": "fedcba9876543210", "empty": ""})
+	input := filepath.Join(dir, "out.tar.gz")
+
+	compress := &models.CLIArgs{Action: "compress", Input: filepath.Join(dir, "src"), Format: "tar.gz", FormatSet: true, Compression: "normal", Keyfile: filepath.Join(dir, "key")}
+	opts, err := buildOptions(compress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.NewOperator(opts).Compress(compress.Input, input); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keyfile string
+		want    string
+	}{
+		{"key", ""},
+		{"other", crypto.ErrWrongPassword.Error()},
+		{"empty", "is empty"},
+		{"missing", "keyfile:"},
+	}
+	for _, tt := range tests {
+		err := func() error {
+			opts, err := buildOptions(&models.CLIArgs{Action: "extract", Input: input, Keyfile: filepath.Join(dir, tt.keyfile)})
+			if err != nil {
+				return err
+			}
+			return archive.NewOperator(opts).Extract(input, filepath.Join(dir, "out-"+tt.keyfile))
+		}()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("-keyfile=%s: %v", tt.keyfile, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("-keyfile=%s: err = %v, want %q", tt.keyfile, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/archive"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestPasswordFIFO(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, filepath.Join(dir, "src"), map[string]string{"a.txt": "alpha"})
+	archivePath := filepath.Join(dir, "out.zip")
+
+	if err := archive.NewOperator(&models.ArchiveOptions{Password: "s3cret"}).Compress(filepath.Join(dir, "src"), archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	pipe := filepath.Join(dir, "gar.pipe")
+	if err := syscall.Mkfifo(pipe, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Opening the pipe for writing blocks until gar opens it to read
+	written := make(chan error, 1)
+	go func() {
+		f, err := os.OpenFile(pipe, os.O_WRONLY, 0)
+		if err != nil {
+			written <- err
+			return
+		}
+		_, err = f.WriteString("s3cret\n")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		written <- err
+	}()
+
+	opts, err := buildOptions(&models.CLIArgs{Action: "extract", Input: archivePath, Password: fifoPrefix + pipe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out")
+	if err := archive.NewOperator(opts).Extract(archivePath, output); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(output, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "alpha" {
+		t.Errorf("a.txt = %q, want %q", data, "alpha")
+	}
+
+	// A regular file is refused, so the password never comes from disk
+	regular := filepath.Join(dir, "password.txt")
+	if err := os.WriteFile(regular, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPasswordFIFO(regular); err == nil {
+		t.Error("readPasswordFIFO accepted a regular file")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// withInterrupt runs fn with opts.Context done once the process receives
+// SIGTERM or an interrupt. Compression then stops before the next entry
+// and keeps what it has written as a .partial archive. Only compression
+// watches the context, so other actions keep the default handling and
+// stop at once. After the first signal the default handling is restored,
+// so a second one terminates immediately.
+func withInterrupt(opts *models.ArchiveOptions, fn func() error) error {
+	saved := opts.Context
+	parent := saved
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(parent, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	opts.Context = ctx
+	defer func() { opts.Context = saved }()
+	return fn()
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestWithInterrupt(t *testing.T) {
+	opts := &models.ArchiveOptions{}
+	err := withInterrupt(opts, func() error {
+		if opts.Context == nil || opts.Context.Err() != nil {
+			t.Fatal("no live context while running")
+		}
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGINT); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-opts.Context.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("context not done after SIGINT")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The caller's options are left as they were
+	if opts.Context != nil {
+		t.Errorf("Context = %v after the run, want nil", opts.Context)
+	}
+}
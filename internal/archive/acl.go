@@ -0,0 +1,65 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// paxXattrPrefix is the PAX record prefix for extended attributes, as
+// written by GNU tar and libarchive
+const paxXattrPrefix = "SCHILY.xattr."
+
+// POSIX ACLs are stored by Linux as these extended attributes
+var aclXattrs = []string{"system.posix_acl_access", "system.posix_acl_default"}
+
+var aclWarning sync.Once
+
+// warnACLsUnsupported notes once that ACLs are skipped on this platform
+func warnACLsUnsupported() {
+	aclWarning.Do(func() {
+		fmt.Fprintln(os.Stderr, "Warning: -acls is not supported on this platform; ACLs are ignored")
+	})
+}
+
+// storeACLs adds the ACLs of path to e as PAX records
+func storeACLs(path string, e *archiveEntry) error {
+	acls, err := readACLs(path)
+	if err != nil {
+		return err
+	}
+	for name, value := range acls {
+		e.setPAXRecord(paxXattrPrefix+name, value)
+	}
+	return nil
+}
+
+// restoreACLs applies ACLs stored in header to destPath
+func restoreACLs(destPath string, header *tar.Header) error {
+	if header.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	acls := make(map[string]string)
+	for key, value := range header.PAXRecords {
+		if name, ok := strings.CutPrefix(key, paxXattrPrefix); ok && isACLXattr(name) {
+			acls[name] = value
+		}
+	}
+	if len(acls) == 0 {
+		return nil
+	}
+	return writeACLs(destPath, acls)
+}
+
+func isACLXattr(name string) bool {
+	for _, acl := range aclXattrs {
+		if name == acl {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+//go:build linux
+
+package archive
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// readACLs returns the raw POSIX ACL extended attributes of path
+func readACLs(path string) (map[string]string, error) {
+	acls := make(map[string]string)
+	for _, name := range aclXattrs {
+		size, err := unix.Lgetxattr(path, name, nil)
+		if isNoACL(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size)
+		n, err := unix.Lgetxattr(path, name, buf)
+		if err != nil {
+			return nil, err
+		}
+		acls[name] = string(buf[:n])
+	}
+	return acls, nil
+}
+
+// writeACLs sets the raw POSIX ACL extended attributes on path
+func writeACLs(path string, acls map[string]string) error {
+	for name, value := range acls {
+		if err := unix.Lsetxattr(path, name, []byte(value), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isNoACL reports whether err means the file or filesystem has no ACL
+func isNoACL(err error) bool {
+	return errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP)
+}
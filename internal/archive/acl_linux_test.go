@@ -0,0 +1,90 @@
+//go:build linux
+
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// posixACL encodes an access ACL in the system.posix_acl_access format:
+// the owner, user 1234 and the group may read, the owner may also write
+func posixACL() []byte {
+	const undefinedID = 0xffffffff
+	acl := binary.LittleEndian.AppendUint32(nil, 2)
+	for _, e := range []struct {
+		tag, perm uint16
+		id        uint32
+	}{
+		{0x01, 6, undefinedID}, // user::rw-
+		{0x02, 4, 1234},        // user:1234:r--
+		{0x04, 4, undefinedID}, // group::r--
+		{0x10, 4, undefinedID}, // mask::r--
+		{0x20, 0, undefinedID}, // other::---
+	} {
+		acl = binary.LittleEndian.AppendUint16(acl, e.tag)
+		acl = binary.LittleEndian.AppendUint16(acl, e.perm)
+		acl = binary.LittleEndian.AppendUint32(acl, e.id)
+	}
+	return acl
+}
+
+func TestACLsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(src, "a.txt")
+	if err := os.WriteFile(path, []byte("acl"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	acl := posixACL()
+	if err := unix.Lsetxattr(path, "system.posix_acl_access", acl, 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+			t.Skipf("the filesystem does not take ACLs: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "out.tar.gz")
+	opts := &models.ArchiveOptions{Format: models.FormatTarGz, ACLs: true}
+	if err := NewOperator(opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	header := readTarGzHeaders(t, output)["a.txt"]
+	if header == nil || header.PAXRecords[paxXattrPrefix+"system.posix_acl_access"] != string(acl) {
+		t.Fatal("the ACL was not stored as a PAX xattr record")
+	}
+
+	for _, tt := range []struct {
+		acls bool
+		want bool
+	}{
+		{acls: true, want: true},
+		{acls: false, want: false},
+	} {
+		dest := t.TempDir()
+		if err := NewOperator(&models.ArchiveOptions{ACLs: tt.acls}).Extract(output, dest); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readACLs(filepath.Join(dest, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, restored := got["system.posix_acl_access"]
+		if restored != tt.want {
+			t.Errorf("-acls=%v: ACL restored %v, want %v", tt.acls, restored, tt.want)
+		}
+		if restored && got["system.posix_acl_access"] != string(acl) {
+			t.Errorf("restored ACL %x, want %x", got["system.posix_acl_access"], acl)
+		}
+	}
+}
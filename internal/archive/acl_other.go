@@ -0,0 +1,15 @@
+//go:build !linux
+
+package archive
+
+// readACLs is unsupported on this platform
+func readACLs(string) (map[string]string, error) {
+	warnACLsUnsupported()
+	return nil, nil
+}
+
+// writeACLs is unsupported on this platform
+func writeACLs(string, map[string]string) error {
+	warnACLsUnsupported()
+	return nil
+}
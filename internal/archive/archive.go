@@ -2,10 +2,14 @@
 package archive
 
 import (
+	"compress/flate"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,52 +22,361 @@ type Operator struct {
 	opts *models.ArchiveOptions
 }
 
-// NewOperator creates a new archive operator
+// NewOperator creates a new archive operator. opts is not modified: a
+// Workers value of models.WorkersAuto is resolved by each operation that
+// runs workers, from a sample of its own workload.
 func NewOperator(opts *models.ArchiveOptions) *Operator {
 	return &Operator{opts: opts}
 }
 
+// workerPool returns the pool to run parallel work on and a function to
+// call when done with it: the shared opts.Pool, or a pool of workers
+// started for the caller
+func workerPool(opts *models.ArchiveOptions, workers int) (*models.WorkerPool, func()) {
+	if opts.Pool != nil {
+		return opts.Pool, func() {}
+	}
+	pool := models.NewWorkerPool(workers)
+	return pool, pool.Close
+}
+
+// finishProgress tells the progress reporter (if any) the operation ended
+func (op *Operator) finishProgress() {
+	if op.opts.Progress != nil {
+		op.opts.Progress.Finish()
+	}
+}
+
 // Compress creates an archive from input path
 func (op *Operator) Compress(inputPath, outputPath string) error {
+	var markers []string
+	if op.opts.DoneMarker {
+		markers = compressMarkers(outputPath)
+		if err := clearMarkers(markers); err != nil {
+			return err
+		}
+	}
+
+	if err := op.compress(inputPath, outputPath); err != nil {
+		return err
+	}
+	return writeMarkers(markers)
+}
+
+// compress creates the archive (or archives) for Compress
+func (op *Operator) compress(inputPath, outputPath string) error {
+	defer op.finishProgress()
+
 	if op.opts.Verbose {
 		fmt.Printf("Compressing %s to %s...\n", inputPath, outputPath)
 	}
 
+	outputPaths := splitOutputs(outputPath)
+	if op.opts.RawTar {
+		if len(outputPaths) > 1 {
+			return fmt.Errorf("-raw-tar writes a single output")
+		}
+		return op.compressRawTar(inputPath, outputPath)
+	}
+
+	// A symlinked root is followed by default; optionally store the link
+	// itself, as also happens to a chain longer than DerefDepth
+	stat := os.Stat
+	if op.opts.NoFollowRoot || op.rootChainTooLong(inputPath) {
+		stat = os.Lstat
+	}
+
 	// Check if input exists
-	info, err := os.Stat(inputPath)
+	info, err := stat(inputPath)
 	if err != nil {
 		return fmt.Errorf("input path error: %w", err)
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	if op.opts.Resume {
+		if len(outputPaths) > 1 {
+			return fmt.Errorf("-resume writes a single output")
+		}
+		return op.compressResumable(inputPath, info, outputPath)
+	}
+
+	// Incremental runs archive only what changed since the snapshot
+	var snap *snapshotTracker
+	if op.opts.Snapshot != "" {
+		if snap, err = loadSnapshot(op.opts.Snapshot); err != nil {
+			return fmt.Errorf("load snapshot: %w", err)
+		}
+	}
+
+	formats := []models.ArchiveFormat{op.opts.Format}
+	if len(outputPaths) > 1 {
+		formats = formats[:0]
+		for _, path := range outputPaths {
+			formats = append(formats, formatFromPath(path))
+		}
+	}
+	fill := func(ew entryWriter) error {
+		return compressEntries(inputPath, info, ew, op.opts, snap, newHardLinks(op.opts, formats...))
+	}
+	if len(outputPaths) > 1 {
+		err = op.writeArchives(outputPaths, fill)
+	} else {
+		err = op.writeArchive(outputPath, fill)
+	}
+	if err != nil || snap == nil {
+		return err
+	}
+	if err := snap.save(); err != nil {
+		return fmt.Errorf("save snapshot: %w", err)
+	}
+	return nil
+}
+
+// writeArchive creates outputPath (locally or remotely), sets up encryption
+// and the format writer, and lets fill add the entries. When fill is
+// interrupted, the entries written so far are kept as a .partial archive.
+func (op *Operator) writeArchive(outputPath string, fill func(ew entryWriter) error) error {
+	a, err := op.createArchive(outputPath)
 	if err != nil {
-		return fmt.Errorf("create output file: %w", err)
+		return err
 	}
-	defer outFile.Close()
+	tally := &entryTally{entryWriter: a.ew}
+	if err := fill(tally); err != nil {
+		if errors.Is(err, errInterrupted) {
+			return a.finishPartial(outputPath, tally)
+		}
+		a.abort()
+		return err
+	}
+	return a.finish()
+}
 
-	var writer io.Writer = outFile
+// pendingArchive is an archive being written: its destination and the
+// entry writer stack on top of it
+type pendingArchive struct {
+	out *archiveOutput
+	// enc is the whole-archive encryption layer, if any, which holds the
+	// last chunk until it is closed
+	enc    *crypto.EncryptedWriter
+	ew     entryWriter
+	signer *archiveSigner
+}
 
-	// Add encryption if password is provided
-	if op.opts.Password != "" {
-		writer, err = crypto.NewEncryptedWriter(writer, op.opts.Password)
+// createArchive opens outputPath and stacks the configured encryption,
+// format writer and manifest on top of it
+func (op *Operator) createArchive(outputPath string) (*pendingArchive, error) {
+	var signer *archiveSigner
+	if op.opts.SignKey != "" {
+		s, err := newArchiveSigner(outputPath, op.opts.SignKey)
 		if err != nil {
-			return fmt.Errorf("encryption setup: %w", err)
+			return nil, err
 		}
+		signer = s
 	}
 
-	switch op.opts.Format {
-	case models.FormatZip:
-		return compressZip(inputPath, info, writer, op.opts)
-	case models.FormatTarGz:
-		return compressTarGz(inputPath, info, writer, op.opts)
-	default:
-		return fmt.Errorf("unsupported format")
+	out, err := op.openOutput(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("create output file: %w", err)
+	}
+
+	var writer io.Writer = out
+	if signer != nil {
+		writer = io.MultiWriter(out, signer.hash)
+	}
+
+	enc, ew, err := op.newArchiveWriter(writer)
+	if err != nil {
+		out.Abort()
+		return nil, err
+	}
+	return &pendingArchive{out: out, enc: enc, ew: ew, signer: signer}, nil
+}
+
+// newArchiveWriter stacks the entry writer for op's options on w: whole-
+// archive encryption below the format writer, and per-entry encryption and
+// the manifest above it. enc is nil unless the whole archive is encrypted
+// and must be closed after ew.
+func (op *Operator) newArchiveWriter(w io.Writer) (enc *crypto.EncryptedWriter, ew entryWriter, err error) {
+	perEntry := len(op.opts.EncryptPattern) > 0
+	if perEntry && op.opts.Password == "" {
+		return nil, nil, fmt.Errorf("-encrypt-pattern requires a password")
+	}
+	if perEntry {
+		// Entries are sealed with their own fixed scheme, so the settings of
+		// whole-archive encryption would be silently ignored
+		var flag string
+		switch {
+		case len(op.opts.Keyfile) > 0:
+			flag = "-keyfile"
+		case op.opts.KDF != "":
+			flag = "-kdf"
+		case op.opts.KDFIterations != 0:
+			flag = "-kdf-iterations"
+		case op.opts.Cipher != "":
+			flag = "-cipher"
+		}
+		if flag != "" {
+			return nil, nil, fmt.Errorf("%s applies to whole-archive encryption; it cannot be combined with -encrypt-pattern", flag)
+		}
+	}
+	// Offsets into an encrypted stream cannot be seeked to
+	if op.opts.Index && hasArchiveKey(op.opts) && !perEntry {
+		return nil, nil, fmt.Errorf("-index cannot be combined with whole-archive encryption; use -encrypt-pattern")
+	}
+
+	// Add encryption if a password or keyfile is provided, unless only
+	// selected entries are encrypted
+	if hasArchiveKey(op.opts) && !perEntry {
+		enc, err = crypto.NewEncryptedWriter(w, op.opts.Password, crypto.StreamOptions{
+			KDF:           op.opts.KDF,
+			KDFIterations: op.opts.KDFIterations,
+			Cipher:        op.opts.Cipher,
+			Keyfile:       op.opts.Keyfile,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("encryption setup: %w", err)
+		}
+		w = enc
+	}
+
+	if ew, err = newEntryWriter(w, op.opts); err != nil {
+		return nil, nil, err
+	}
+
+	if op.opts.AttrRules != "" {
+		rules, err := loadAttrRules(op.opts.AttrRules)
+		if err != nil {
+			return nil, nil, err
+		}
+		ew = &attrRuleWriter{entryWriter: ew, rules: rules}
+	}
+
+	if perEntry {
+		if ew, err = newEntryEncrypter(ew, op.opts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The manifest wraps the encrypter so it records plaintext digests
+	if op.opts.Manifest || op.opts.Merkle {
+		if ew, err = newManifestWriter(ew, op.opts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return enc, ew, nil
+}
+
+// finish completes the archive and writes its signature, if any
+func (a *pendingArchive) finish() error {
+	if err := a.ew.Close(); err != nil {
+		a.out.Abort()
+		return err
+	}
+	if a.enc != nil {
+		if err := a.enc.Close(); err != nil {
+			a.out.Abort()
+			return err
+		}
+	}
+	if err := a.out.Close(); err != nil {
+		return err
+	}
+	if a.signer != nil {
+		return a.signer.write()
 	}
+	return nil
+}
+
+// abort discards the archive after a failed operation
+func (a *pendingArchive) abort() {
+	a.ew.Close()
+	if a.enc != nil {
+		a.enc.Close()
+	}
+	a.out.Abort()
 }
 
 // Extract extracts an archive to output path
 func (op *Operator) Extract(inputPath, outputPath string) error {
+	defer op.finishProgress()
+
+	var markers []string
+	if op.opts.DoneMarker && !op.opts.DryRun {
+		markers = []string{filepath.Join(outputPath, extractedMarker)}
+		if err := clearMarkers(markers); err != nil {
+			return err
+		}
+	}
+
+	if err := op.checkExtension(inputPath); err != nil {
+		return err
+	}
+
+	if op.opts.RequireSignature {
+		verified, err := op.verifiedCopy(inputPath, op.opts.PublicKey)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(verified)
+		inputPath = verified
+	}
+
+	var guard *caseGuard
+	if op.opts.CasePolicy != "" {
+		var err error
+		if guard, err = newCaseGuard(op.opts.CasePolicy); err != nil {
+			return err
+		}
+		op = NewOperator(guard.options(op.opts))
+	}
+
+	switch op.opts.OnConflict {
+	case "", ConflictOverwrite:
+	case ConflictRename:
+		// Renamed copies would never be found up to date or kept by sync
+		if op.opts.Update || op.opts.Sync {
+			return fmt.Errorf("-on-conflict=rename cannot be combined with -update or -sync")
+		}
+		renamer, err := newConflictRenamer(outputPath, op.opts.RenameTemplate)
+		if err != nil {
+			return err
+		}
+		op = NewOperator(renamer.options(op.opts))
+	default:
+		return fmt.Errorf("unknown conflict policy: %s", op.opts.OnConflict)
+	}
+
+	if err := checkSymlinkFallback(op.opts.SymlinkFallback); err != nil {
+		return err
+	}
+
+	var err error
+	if op.opts.Update || op.opts.Sync {
+		err = op.extractSync(inputPath, outputPath)
+	} else {
+		err = op.extract(inputPath, outputPath)
+	}
+	if err == nil && guard != nil {
+		err = guard.err()
+	}
+
+	// Parallel zip extraction counts each failing entry; everything else
+	// stops at the first one
+	if err != nil && op.opts.Stats != nil && op.opts.Stats.Failed.Load() == 0 {
+		countFailed(op.opts)
+	}
+	if err != nil {
+		return err
+	}
+	return writeMarkers(markers)
+}
+
+// extract extracts an archive (or plans the extraction with DryRun)
+func (op *Operator) extract(inputPath, outputPath string) error {
+	if op.opts.DryRun {
+		return op.planExtract(inputPath, outputPath, os.Stdout)
+	}
+
 	if op.opts.Verbose {
 		fmt.Printf("Extracting %s to %s...\n", inputPath, outputPath)
 	}
@@ -77,62 +390,339 @@ func (op *Operator) Extract(inputPath, outputPath string) error {
 	var reader io.Reader = inFile
 
 	// Check for encryption
-	if op.opts.Password != "" {
-		reader, err = crypto.NewEncryptedReader(reader, op.opts.Password)
+	if err := checkArchivePassword(inputPath, op.opts); err != nil {
+		return err
+	}
+	encrypted := archiveEncrypted(inputPath, op.opts)
+	if encrypted {
+		reader, err = crypto.NewEncryptedReader(reader, op.opts.Password, op.opts.Keyfile)
+		if errors.Is(err, crypto.ErrWrongPassword) || errors.Is(err, crypto.ErrKeyfileRequired) {
+			return err
+		}
 		if err != nil {
 			return fmt.Errorf("decryption setup: %w", err)
 		}
 	}
 
 	// Detect format from extension
-	ext := strings.ToLower(filepath.Ext(inputPath))
-	if ext == ".gz" {
-		return extractTarGz(reader, outputPath, op.opts)
+	switch format := detectFormat(inputPath, op.opts); format {
+	case models.FormatTar, models.FormatTarGz, models.FormatTarBz2, models.FormatTarZstd, models.FormatTarXz:
+		if op.opts.Recover {
+			return fmt.Errorf("-recover applies to zip archives")
+		}
+		switch format {
+		case models.FormatTar:
+			return extractTar(reader, outputPath, op.opts)
+		case models.FormatTarBz2:
+			return extractTarBz2(reader, inputPath, outputPath, op.opts)
+		case models.FormatTarZstd:
+			return extractTarZstd(reader, inputPath, outputPath, op.opts)
+		case models.FormatTarXz:
+			return extractTarXz(reader, inputPath, outputPath, op.opts)
+		}
+		return extractTarGz(reader, inputPath, outputPath, op.opts)
+	case models.FormatSevenZip:
+		if op.opts.Recover {
+			return fmt.Errorf("-recover applies to zip archives")
+		}
+		if encrypted {
+			return fmt.Errorf("%s: 7z archives cannot be encrypted by gar", inputPath)
+		}
+		return extractSevenZip(inputPath, outputPath, op.opts)
+	}
+	if op.opts.Recover {
+		return recoverZip(reader, outputPath, op.opts)
+	}
+	if op.opts.Stream {
+		return extractZipStream(reader, outputPath, op.opts)
+	}
+	if encrypted {
+		// zip needs random access, so buffer the decrypted archive first
+		tmpPath, err := op.bufferToTemp(reader, "gar-*.zip")
+		if err != nil {
+			return fmt.Errorf("buffer decrypted archive: %w", err)
+		}
+		defer os.Remove(tmpPath)
+		return extractZip(tmpPath, outputPath, op.opts)
 	}
 	return extractZip(inputPath, outputPath, op.opts)
 }
 
+// createTemp creates a temporary file in the configured temp directory
+// (or the system default when none is set)
+func (op *Operator) createTemp(pattern string) (*os.File, error) {
+	return os.CreateTemp(op.opts.TempDir, pattern)
+}
+
+// bufferToTemp copies r into a new temporary file and returns its path.
+// The caller is responsible for removing the file.
+func (op *Operator) bufferToTemp(r io.Reader, pattern string) (string, error) {
+	tmp, err := op.createTemp(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := copyPooled(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
 // List lists archive contents
 func (op *Operator) List(inputPath string) error {
-	ext := strings.ToLower(filepath.Ext(inputPath))
+	if err := op.checkExtension(inputPath); err != nil {
+		return err
+	}
+	if !isArchiveExt(inputPath) && !op.opts.ForceFormat {
+		if _, err := sniffFile(inputPath); err != nil && !errors.Is(err, ErrEncryptedArchive) {
+			return fmt.Errorf("unsupported archive format: %s", strings.ToLower(filepath.Ext(inputPath)))
+		}
+	}
 
-	switch ext {
-	case ".zip":
-		return listZip(inputPath)
-	case ".gz":
-		return listTarGz(inputPath)
+	format := detectFormat(inputPath, op.opts)
+	if hasEncryptionHeader(inputPath) {
+		return listEncrypted(inputPath, format, op.opts)
 	}
 
-	return fmt.Errorf("unsupported archive format: %s", ext)
+	switch format {
+	case models.FormatTar, models.FormatTarGz, models.FormatTarBz2, models.FormatTarZstd, models.FormatTarXz:
+		if op.opts.Recover {
+			return fmt.Errorf("-recover applies to zip archives")
+		}
+		switch format {
+		case models.FormatTar:
+			return listPlainTar(inputPath)
+		case models.FormatTarBz2:
+			return listTarBz2(inputPath)
+		case models.FormatTarZstd:
+			return listTarZstd(inputPath)
+		case models.FormatTarXz:
+			return listTarXz(inputPath)
+		}
+		return listTarGz(inputPath, op.opts)
+	case models.FormatSevenZip:
+		return listSevenZip(inputPath)
+	}
+	if op.opts.Recover {
+		return listRecoveredZip(inputPath)
+	}
+	return listZip(inputPath)
+}
+
+// listEncrypted lists an archive encrypted as a whole, which is decrypted
+// on the fly (or to a temporary file, for zip)
+func listEncrypted(inputPath string, format models.ArchiveFormat, opts *models.ArchiveOptions) error {
+	if opts.Recover {
+		return fmt.Errorf("-recover does not apply to encrypted archives")
+	}
+	if err := checkArchivePassword(inputPath, opts); err != nil {
+		return err
+	}
+
+	fmt.Println("Archive contents:")
+	return forEachEntry(inputPath, format, opts, func(e *archiveEntry, _ io.Reader) error {
+		name := e.Name
+		if e.Info.IsDir() {
+			name += "/"
+		}
+		fmt.Printf("  %s (%d bytes)%s\n", name, e.Info.Size(), encryptedSuffix(e.Encrypted))
+		return nil
+	})
+}
+
+// Count returns the number of entries in an archive without extracting
+// them. Zip archives only need their central directory; tar archives are
+// scanned header by header, skipping entry bodies.
+func (op *Operator) Count(inputPath string) (int, error) {
+	format := detectFormat(inputPath, op.opts)
+	if format == models.FormatZip {
+		return countZip(inputPath)
+	}
+
+	count := 0
+	err := forEachEntry(inputPath, format, op.opts, func(*archiveEntry, io.Reader) error {
+		count++
+		return nil
+	})
+	return count, err
 }
 
 // ParseFormat converts string to ArchiveFormat
 func ParseFormat(format string) models.ArchiveFormat {
 	switch strings.ToLower(format) {
+	case "tar":
+		return models.FormatTar
 	case "tar.gz", "tgz":
 		return models.FormatTarGz
+	case "tar.bz2", "tbz2", "tbz", "bzip2", "bz2":
+		return models.FormatTarBz2
+	case "tar.zst", "tzst", "zstd", "zst":
+		return models.FormatTarZstd
+	case "tar.xz", "txz", "xz":
+		return models.FormatTarXz
+	case "7z", "7zip":
+		return models.FormatSevenZip
 	default:
 		return models.FormatZip
 	}
 }
 
+// ParseLevel converts a compression level name (fastest, normal, best,
+// store) or an exact codec level number into options. The returned codec
+// level is zero for named presets.
+func ParseLevel(level string) (models.CompressionLevel, int, error) {
+	switch strings.ToLower(level) {
+	case "", "normal":
+		return models.LevelNormal, 0, nil
+	case "fastest":
+		return models.LevelFastest, 0, nil
+	case "best":
+		return models.LevelBest, 0, nil
+	case "store":
+		return models.LevelStore, 0, nil
+	case "huffman":
+		return models.LevelHuffman, 0, nil
+	}
+
+	n, err := strconv.Atoi(level)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid compression level: %s", level)
+	}
+	return models.LevelNormal, n, nil
+}
+
+// ParseModTime parses a fixed entry modification time given as Unix
+// seconds (as in SOURCE_DATE_EPOCH) or RFC 3339. An empty value means no
+// override and returns the zero time.
+func ParseModTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid mtime %q: want Unix seconds or RFC 3339", value)
+	}
+	return t, nil
+}
+
+// ParseSize parses a byte size given as a plain number or with a K, M or
+// G suffix (binary multiples, optionally followed by B or iB), e.g. 256K
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q: want bytes or a K, M or G suffix", value)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q: too large", value)
+	}
+	return n * multiplier, nil
+}
+
+// flateLevel maps the configured compression to a compress/flate level,
+// which gzip shares; codec picks the normal level override that applies
+func flateLevel(opts *models.ArchiveOptions, codec models.Codec) int {
+	if level := exactLevel(opts, codec); level != 0 {
+		return level
+	}
+
+	switch opts.CompressionLevel {
+	case models.LevelFastest:
+		return flate.BestSpeed
+	case models.LevelBest:
+		return flate.BestCompression
+	case models.LevelStore:
+		return flate.NoCompression
+	case models.LevelHuffman:
+		return flate.HuffmanOnly
+	default:
+		return flate.DefaultCompression
+	}
+}
+
+// formatFromPath guesses the archive format from the file extension,
+// defaulting to zip
+func formatFromPath(path string) models.ArchiveFormat {
+	lower := strings.ToLower(path)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		return models.FormatTarGz
+	}
+	if strings.HasSuffix(lower, ".bz2") || strings.HasSuffix(lower, ".tbz2") || strings.HasSuffix(lower, ".tbz") {
+		return models.FormatTarBz2
+	}
+	if strings.HasSuffix(lower, ".zst") || strings.HasSuffix(lower, ".tzst") {
+		return models.FormatTarZstd
+	}
+	if strings.HasSuffix(lower, ".xz") || strings.HasSuffix(lower, ".txz") {
+		return models.FormatTarXz
+	}
+	if strings.HasSuffix(lower, ".7z") {
+		return models.FormatSevenZip
+	}
+	if strings.HasSuffix(lower, ".tar") {
+		return models.FormatTar
+	}
+	return models.FormatZip
+}
+
 // GetExtension returns the file extension for a given format
 func GetExtension(format models.ArchiveFormat) string {
 	switch format {
+	case models.FormatTar:
+		return ".tar"
 	case models.FormatTarGz:
 		return ".tar.gz"
+	case models.FormatTarBz2:
+		return ".tar.bz2"
+	case models.FormatTarZstd:
+		return ".tar.zst"
+	case models.FormatTarXz:
+		return ".tar.xz"
+	case models.FormatSevenZip:
+		return ".7z"
 	default:
 		return ".zip"
 	}
 }
 
 // TimeOperation measures the time taken for an operation
-func TimeOperation(fn func() error, verbose bool, operationName string) error {
+// and, when verbose, prints a summary of the counts in stats (if any)
+// whether or not the operation succeeded
+func TimeOperation(fn func() error, verbose bool, operationName string, stats *models.RunStats) error {
 	start := time.Now()
 	err := fn()
+	elapsed := time.Since(start)
 
 	if verbose && err == nil {
-		fmt.Printf("%s completed in %v\n", operationName, time.Since(start))
+		fmt.Printf("%s completed in %v\n", operationName, elapsed)
+	}
+	if verbose && stats != nil {
+		fmt.Println(formatSummary(operationName, stats, elapsed))
 	}
 
 	return err
@@ -0,0 +1,297 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// readTree maps the regular files under root to their content
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"256K", 256 << 10, false},
+		{"4mb", 4 << 20, false},
+		{"2GiB", 2 << 30, false},
+		{" 1G ", 1 << 30, false},
+		{strconv.FormatInt(math.MaxInt64, 10), math.MaxInt64, false},
+		{strconv.FormatInt(math.MaxInt64>>30, 10) + "G", (math.MaxInt64 >> 30) << 30, false},
+		{strconv.FormatInt(math.MaxInt64>>30+1, 10) + "G", 0, true},
+		{"9223372036854775807K", 0, true},
+		{"99999999999999999999", 0, true},
+		{"0", 0, true},
+		{"-1K", 0, true},
+		{"K", 0, true},
+		{"1T", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseModTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"0", time.Unix(0, 0), false},
+		{"1700000000", time.Unix(1700000000, 0), false},
+		{"2023-11-14T22:13:20Z", time.Unix(1700000000, 0), false},
+		{"2023-11-14T23:13:20+01:00", time.Unix(1700000000, 0), false},
+		{"2023-11-14", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseModTime(tt.in)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseModTime(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func FuzzParseSize(f *testing.F) {
+	for _, s := range []string{"1", "256K", "4MiB", "8589934591G", "-3", "x"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := ParseSize(s)
+		if err == nil && n <= 0 {
+			t.Errorf("ParseSize(%q) = %d without an error", s, n)
+		}
+	})
+}
+
+func TestNewArchiveWriterEncryptPattern(t *testing.T) {
+	base := models.ArchiveOptions{Format: models.FormatZip, Password: "secret", EncryptPattern: []string{"*.key"}}
+
+	tests := []struct {
+		name   string
+		change func(*models.ArchiveOptions)
+		want   string
+	}{
+		{"entries only", func(*models.ArchiveOptions) {}, ""},
+		{"no password", func(o *models.ArchiveOptions) { o.Password = "" }, "requires a password"},
+		{"keyfile", func(o *models.ArchiveOptions) { o.Keyfile = []byte("key") }, "-keyfile applies to whole-archive encryption"},
+		{"kdf", func(o *models.ArchiveOptions) { o.KDF = crypto.KDFArgon2id }, "-kdf applies to whole-archive encryption"},
+		{"kdf iterations", func(o *models.ArchiveOptions) { o.KDFIterations = 200000 }, "-kdf-iterations applies to whole-archive encryption"},
+		{"cipher", func(o *models.ArchiveOptions) { o.Cipher = crypto.CipherChaCha20Poly1305 }, "-cipher applies to whole-archive encryption"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := base
+			tt.change(&opts)
+			_, _, err := NewOperator(&opts).newArchiveWriter(io.Discard)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedArchiveRoundTrip(t *testing.T) {
+	files := map[string]string{"a.txt": "alpha", "dir/b.txt": "beta"}
+	tests := []struct {
+		name string
+		opts models.ArchiveOptions
+	}{
+		{"kdf iterations", models.ArchiveOptions{Password: "secret", KDFIterations: 2500}},
+		{"argon2id", models.ArchiveOptions{Password: "secret", KDF: crypto.KDFArgon2id}},
+		{"chacha20poly1305", models.ArchiveOptions{Password: "secret", Cipher: crypto.CipherChaCha20Poly1305}},
+		{"keyfile only", models.ArchiveOptions{Keyfile: []byte("0123456789abcdef0123456789abcdef")}},
+		{"password and keyfile", models.ArchiveOptions{Password: "secret", Keyfile: []byte("0123456789abcdef0123456789abcdef")}},
+	}
+	for _, tt := range tests {
+		for _, format := range []models.ArchiveFormat{models.FormatZip, models.FormatTarGz} {
+			t.Run(tt.name+"/"+formatName(format), func(t *testing.T) {
+				src := writeTestTree(t, files)
+				input := filepath.Join(t.TempDir(), "out"+GetExtension(format))
+				opts := tt.opts
+				opts.Format = format
+				if err := NewOperator(&opts).Compress(src, input); err != nil {
+					t.Fatal(err)
+				}
+
+				// Reading needs only the key; the settings come from the header
+				output := t.TempDir()
+				read := &models.ArchiveOptions{Password: tt.opts.Password, Keyfile: tt.opts.Keyfile}
+				if err := NewOperator(read).Extract(input, output); err != nil {
+					t.Fatal(err)
+				}
+				if got := readTree(t, output); !maps.Equal(got, files) {
+					t.Errorf("extracted %v, want %v", got, files)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractWrongPassword(t *testing.T) {
+	for _, format := range []models.ArchiveFormat{models.FormatZip, models.FormatTarGz} {
+		t.Run(formatName(format), func(t *testing.T) {
+			src := writeTestTree(t, map[string]string{"a.txt": "alpha", "big.bin": strings.Repeat("x", 1<<20)})
+			input := filepath.Join(t.TempDir(), "out"+GetExtension(format))
+			if err := NewOperator(&models.ArchiveOptions{Format: format, Password: "secret"}).Compress(src, input); err != nil {
+				t.Fatal(err)
+			}
+
+			output := filepath.Join(t.TempDir(), "out")
+			err := NewOperator(&models.ArchiveOptions{Password: "wrong"}).Extract(input, output)
+			if !errors.Is(err, crypto.ErrWrongPassword) {
+				t.Fatalf("err = %v, want crypto.ErrWrongPassword", err)
+			}
+			if entries, _ := os.ReadDir(output); len(entries) != 0 {
+				t.Errorf("wrong password left %d files in the output", len(entries))
+			}
+		})
+	}
+}
+
+func TestTempDir(t *testing.T) {
+	tempDir := t.TempDir()
+	op := NewOperator(&models.ArchiveOptions{TempDir: tempDir})
+	tmpPath, err := op.bufferToTemp(strings.NewReader("buffered"), "gar-*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(tmpPath) != tempDir {
+		t.Errorf("temp file %s is not in %s", tmpPath, tempDir)
+	}
+	if err := os.Remove(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// An encrypted zip is buffered to the temp dir before extraction
+	input := compressTree(t, map[string]string{"a.txt": "alpha"}, models.ArchiveOptions{Password: "secret"})
+	missing := filepath.Join(t.TempDir(), "missing")
+	err = NewOperator(&models.ArchiveOptions{Password: "secret", TempDir: missing}).Extract(input, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("extract with a missing temp dir: error = %v, want it to name %s", err, missing)
+	}
+
+	output := t.TempDir()
+	if err := NewOperator(&models.ArchiveOptions{Password: "secret", TempDir: tempDir}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, output); got["a.txt"] != "alpha" {
+		t.Errorf("extracted %v", got)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("temp dir holds %d files after extraction, want none", len(entries))
+	}
+}
+
+func TestCount(t *testing.T) {
+	files := map[string][]byte{"a.txt": []byte("a"), "b.txt": bytes.Repeat([]byte("b"), 4096), "dir/c.txt": nil}
+	order := []string{"a.txt", "b.txt", "dir/c.txt"}
+
+	// Overwrite the deflate stream of b.txt: counting must not read it
+	corrupt := buildZip(t, zip.Deflate, files, order)
+	at := bytes.Index(corrupt, []byte("b.txt")) + len("b.txt")
+	copy(corrupt[at:], bytes.Repeat([]byte{0xff}, 16))
+
+	tests := []struct {
+		name  string
+		input func(t *testing.T) string
+		want  int
+	}{
+		{"zip", func(t *testing.T) string {
+			return writeFile(t, t.TempDir(), "in.zip", buildZip(t, zip.Deflate, files, order))
+		}, 3},
+		{"zip with corrupt content", func(t *testing.T) string {
+			return writeFile(t, t.TempDir(), "in.zip", corrupt)
+		}, 3},
+		{"zip with manifest", func(t *testing.T) string {
+			// The root directory entry and the two files, but no manifest
+			return compressTree(t, map[string]string{"a.txt": "a", "b.txt": "b"}, models.ArchiveOptions{Manifest: true})
+		}, 3},
+		{"tar.gz", func(t *testing.T) string {
+			return writeTarGz(t, t.TempDir(), []tarMember{
+				{name: "d", typeflag: tar.TypeDir},
+				{name: "d/a.txt", body: "a"},
+				{name: "d/b.txt", body: "b"},
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "d/a.txt"},
+			})
+		}, 4},
+		{"empty tar.gz", func(t *testing.T) string {
+			return writeTarGz(t, t.TempDir(), nil)
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewOperator(&models.ArchiveOptions{}).Count(tt.input(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Count = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// The corruption is real
+	input := writeFile(t, t.TempDir(), "in.zip", corrupt)
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, t.TempDir()); err == nil {
+		t.Error("extracting the corrupt zip succeeded")
+	}
+}
+
+// writeFile writes data to dir/name and returns its path
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
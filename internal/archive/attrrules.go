@@ -0,0 +1,142 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// attrRule overrides the stored attributes of entries matching pattern.
+// Fields left at -1 keep the value taken from the file.
+type attrRule struct {
+	pattern string
+	mode    int64
+	uid     int
+	gid     int
+}
+
+// loadAttrRules reads an -attr-rules file. Each line holds a pattern, as
+// for -exclude, followed by any of mode=<octal>, uid=<n> and gid=<n>.
+// Blank lines and lines starting with # are ignored.
+func loadAttrRules(path string) ([]attrRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("attr rules: %w", err)
+	}
+	defer f.Close()
+
+	var rules []attrRule
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		rule, err := parseAttrRule(fields)
+		if err != nil {
+			return nil, fmt.Errorf("attr rules: %s:%d: %w", path, lineNo, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("attr rules: %w", err)
+	}
+	return rules, nil
+}
+
+// parseAttrRule parses the fields of one rule line
+func parseAttrRule(fields []string) (attrRule, error) {
+	rule := attrRule{pattern: fields[0], mode: -1, uid: -1, gid: -1}
+	if len(fields) == 1 {
+		return rule, fmt.Errorf("%s: no attributes to set", rule.pattern)
+	}
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return rule, fmt.Errorf("invalid attribute %q: want key=value", field)
+		}
+		switch key {
+		case "mode":
+			mode, err := strconv.ParseInt(value, 8, 32)
+			if err != nil || mode > 0777 {
+				return rule, fmt.Errorf("invalid mode %q: want octal permissions such as 0644", value)
+			}
+			rule.mode = mode
+		case "uid", "gid":
+			id, err := strconv.Atoi(value)
+			if err != nil || id < 0 {
+				return rule, fmt.Errorf("invalid %s %q", key, value)
+			}
+			if key == "uid" {
+				rule.uid = id
+			} else {
+				rule.gid = id
+			}
+		default:
+			return rule, fmt.Errorf("unknown attribute %q: want mode, uid or gid", key)
+		}
+	}
+	return rule, nil
+}
+
+// entryOwner replaces the owner stored for an entry. An id of -1 keeps the
+// file's own.
+type entryOwner struct {
+	uid int
+	gid int
+}
+
+// attrRuleWriter applies attribute rules to every entry before passing it
+// on. Matching rules apply in file order, so a later rule overrides an
+// earlier one.
+type attrRuleWriter struct {
+	entryWriter
+	rules []attrRule
+}
+
+// WriteEntry writes e with the attributes of the rules matching its name
+func (w *attrRuleWriter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	mode := int64(-1)
+	owner := entryOwner{uid: -1, gid: -1}
+	for _, rule := range w.rules {
+		if !matchesAny([]string{rule.pattern}, e.Name) {
+			continue
+		}
+		if rule.mode >= 0 {
+			mode = rule.mode
+		}
+		if rule.uid >= 0 {
+			owner.uid = rule.uid
+		}
+		if rule.gid >= 0 {
+			owner.gid = rule.gid
+		}
+	}
+	if mode < 0 && owner.uid < 0 && owner.gid < 0 {
+		return w.entryWriter.WriteEntry(e, r)
+	}
+
+	ruled := *e
+	if mode >= 0 {
+		ruled.Info = modeFileInfo{FileInfo: e.Info, mode: e.Info.Mode()&^os.ModePerm | os.FileMode(mode)}
+	}
+	if owner.uid >= 0 || owner.gid >= 0 {
+		ruled.Owner = &owner
+	}
+	return w.entryWriter.WriteEntry(&ruled, r)
+}
+
+// modeFileInfo reports a replaced mode and passes everything else,
+// including the owner in Sys, through from the wrapped FileInfo
+type modeFileInfo struct {
+	os.FileInfo
+	mode os.FileMode
+}
+
+func (fi modeFileInfo) Mode() os.FileMode { return fi.mode }
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestAttrRules(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"run.sh":         "#!/bin/sh",
+		"notes.txt":      "notes",
+		"secret/key.pem": "key",
+	})
+	rules := writeFile(t, t.TempDir(), "rules.txt", []byte(strings.Join([]string{
+		"# executables",
+		"*.sh mode=0755",
+		"",
+		"secret/* mode=0600 uid=0 gid=0",
+		"* uid=1000",
+		// A later rule overrides an earlier one
+		"secret/* uid=0",
+	}, "\n")))
+
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	opts := &models.ArchiveOptions{Format: models.FormatTarGz, AttrRules: rules}
+	if err := NewOperator(opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	headers := readTarGzHeaders(t, output)
+	tests := []struct {
+		name     string
+		mode     int64
+		uid, gid int
+	}{
+		{"run.sh", 0755, 1000, os.Getgid()},
+		{"notes.txt", 0644, 1000, os.Getgid()},
+		{"secret/key.pem", 0600, 0, 0},
+	}
+	for _, tt := range tests {
+		h := headers[tt.name]
+		if h == nil {
+			t.Fatalf("%s is not in the archive", tt.name)
+		}
+		if h.Mode&0777 != tt.mode || h.Uid != tt.uid || h.Gid != tt.gid {
+			t.Errorf("%s: mode %o uid %d gid %d, want %o %d %d", tt.name, h.Mode&0777, h.Uid, h.Gid, tt.mode, tt.uid, tt.gid)
+		}
+	}
+
+	// Zip stores the mode
+	output = filepath.Join(t.TempDir(), "out.zip")
+	opts = &models.ArchiveOptions{Format: models.FormatZip, AttrRules: rules}
+	if err := NewOperator(opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		want := map[string]os.FileMode{"run.sh": 0755, "notes.txt": 0644, "secret/key.pem": 0600}[f.Name]
+		if want != 0 && f.Mode().Perm() != want {
+			t.Errorf("zip %s mode = %o, want %o", f.Name, f.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestLoadAttrRulesErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"*.sh", "no attributes to set"},
+		{"*.sh mode", "want key=value"},
+		{"*.sh mode=999", "invalid mode"},
+		{"*.sh mode=01777", "invalid mode"},
+		{"*.sh uid=-1", "invalid uid"},
+		{"*.sh gid=root", "invalid gid"},
+		{"*.sh owner=0", "unknown attribute"},
+	}
+	for _, tt := range tests {
+		path := writeFile(t, t.TempDir(), "rules.txt", []byte("# header\n"+tt.line+"\n"))
+		_, err := loadAttrRules(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), "rules.txt:2") {
+			t.Errorf("%q: err = %v, want %q at line 2", tt.line, err, tt.want)
+		}
+	}
+}
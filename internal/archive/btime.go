@@ -0,0 +1,40 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paxCreationTime is the PAX record libarchive uses for file creation time
+const paxCreationTime = "LIBARCHIVE.creationtime"
+
+// formatPAXTime encodes t as a PAX "seconds.nanoseconds" timestamp
+func formatPAXTime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+// parsePAXTime decodes a PAX "seconds[.fraction]" timestamp
+func parsePAXTime(value string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(value, ".")
+
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid PAX time %q", value)
+	}
+
+	var ns int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		frac += strings.Repeat("0", 9-len(frac))
+		if ns, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid PAX time %q", value)
+		}
+	}
+
+	return time.Unix(s, ns), nil
+}
@@ -0,0 +1,32 @@
+//go:build darwin
+
+package archive
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// birthTime returns the creation time recorded by the filesystem
+func birthTime(_ string, fi os.FileInfo) (time.Time, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(st.Birthtimespec.Unix()), true
+}
+
+// setBirthTime sets the creation time of path via setattrlist
+func setBirthTime(path string, t time.Time) error {
+	attrs := unix.Attrlist{
+		Bitmapcount: unix.ATTR_BIT_MAP_COUNT,
+		Commonattr:  unix.ATTR_CMN_CRTIME,
+	}
+	ts := unix.NsecToTimespec(t.UnixNano())
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))
+	return unix.Setattrlist(path, &attrs, buf, unix.FSOPT_NOFOLLOW)
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package archive
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// birthTime returns the creation time of path using statx, when the
+// filesystem records one
+func birthTime(path string, _ os.FileInfo) (time.Time, bool) {
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW, unix.STATX_BTIME, &stx); err != nil {
+		return time.Time{}, false
+	}
+	if stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+}
+
+// setBirthTime is a no-op: Linux offers no API to change creation time
+func setBirthTime(string, time.Time) error {
+	return nil
+}
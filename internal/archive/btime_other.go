@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package archive
+
+import (
+	"os"
+	"time"
+)
+
+// birthTime is unsupported on this platform
+func birthTime(string, os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// setBirthTime is unsupported on this platform
+func setBirthTime(string, time.Time) error {
+	return nil
+}
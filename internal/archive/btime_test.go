@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestParsePAXTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"1700000000", time.Unix(1700000000, 0), false},
+		{"1700000000.5", time.Unix(1700000000, 500000000), false},
+		{"1700000000.000000001", time.Unix(1700000000, 1), false},
+		{"1700000000.1234567899", time.Unix(1700000000, 123456789), false},
+		{"-1.5", time.Unix(-1, 500000000), false},
+		{"", time.Time{}, true},
+		{"x.5", time.Time{}, true},
+		{"1.x", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePAXTime(tt.in)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parsePAXTime(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func FuzzPAXTime(f *testing.F) {
+	f.Add(int64(1700000000), int64(5))
+	f.Add(int64(0), int64(999999999))
+	f.Fuzz(func(t *testing.T, secs, nsecs int64) {
+		if secs < 0 || nsecs < 0 || nsecs >= 1e9 {
+			return
+		}
+		want := time.Unix(secs, nsecs)
+		got, err := parsePAXTime(formatPAXTime(want))
+		if err != nil || !got.Equal(want) {
+			t.Errorf("round trip of %v = %v, %v", want, got, err)
+		}
+	})
+}
+
+func TestPreserveBirthTime(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(src, "a.txt")
+	if err := os.WriteFile(path, []byte("created"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	btime, ok := birthTime(path, fi)
+	if !ok {
+		t.Skip("the filesystem records no creation time")
+	}
+
+	output := filepath.Join(dir, "out.tar.gz")
+	opts := &models.ArchiveOptions{Format: models.FormatTarGz, PreserveBirthTime: true}
+	if err := NewOperator(opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	header := readTarGzHeaders(t, output)["a.txt"]
+	if header == nil {
+		t.Fatal("a.txt missing from the archive")
+	}
+	if got := header.PAXRecords[paxCreationTime]; got != formatPAXTime(btime) {
+		t.Errorf("%s = %q, want %q", paxCreationTime, got, formatPAXTime(btime))
+	}
+
+	// Only macOS and Windows can set a creation time
+	if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		return
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := NewOperator(opts).Extract(output, dest); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(dest, "a.txt")
+	fi, err = os.Lstat(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := birthTime(restored, fi); !ok || !got.Equal(btime) {
+		t.Errorf("restored creation time = %v (ok %v), want %v", got, ok, btime)
+	}
+}
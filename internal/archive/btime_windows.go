@@ -0,0 +1,36 @@
+//go:build windows
+
+package archive
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// birthTime returns the NTFS creation time of a file
+func birthTime(_ string, fi os.FileInfo) (time.Time, bool) {
+	data, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, data.CreationTime.Nanoseconds()), true
+}
+
+// setBirthTime sets the NTFS creation time of path
+func setBirthTime(path string, t time.Time) error {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	h, err := syscall.CreateFile(p, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+
+	ft := syscall.NsecToFiletime(t.UnixNano())
+	return syscall.SetFileTime(h, &ft, nil, nil)
+}
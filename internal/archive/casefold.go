@@ -0,0 +1,109 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Policies for entries whose names differ only in case, which collide on
+// case-insensitive filesystems
+const (
+	// CaseError refuses the later entry and fails the extraction
+	CaseError = "error"
+	// CaseRename extracts the later entry under a numbered name
+	CaseRename = "rename"
+	// CaseSkip keeps the first entry and drops later ones
+	CaseSkip = "skip"
+)
+
+// caseGuard tracks extracted file names by their lowercased form
+type caseGuard struct {
+	policy string
+
+	mu   sync.Mutex
+	seen map[string]string
+	// renamed holds the keys of names made up by CaseRename, which a
+	// later entry of the same name must not overwrite
+	renamed    map[string]bool
+	collisions []string
+}
+
+func newCaseGuard(policy string) (*caseGuard, error) {
+	switch policy {
+	case CaseError, CaseRename, CaseSkip:
+		return &caseGuard{policy: policy, seen: make(map[string]string), renamed: make(map[string]bool)}, nil
+	}
+	return nil, fmt.Errorf("unknown case policy: %s", policy)
+}
+
+// options returns a copy of opts whose EntryFilter runs the configured
+// filter and then applies the case policy to the resulting name
+func (g *caseGuard) options(opts *models.ArchiveOptions) *models.ArchiveOptions {
+	guarded := *opts
+	inner := opts.EntryFilter
+	guarded.EntryFilter = func(e models.Entry) (bool, string) {
+		name := e.Name
+		if inner != nil {
+			include, newName := inner(e)
+			if !include {
+				return false, ""
+			}
+			if newName != "" {
+				name = newName
+			}
+		}
+
+		// Directories that differ in case merge rather than clobber
+		if e.IsDir {
+			return true, name
+		}
+		return g.check(name)
+	}
+	return &guarded
+}
+
+// check applies the policy to a file name
+func (g *caseGuard) check(name string) (bool, string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := strings.ToLower(path.Clean(name))
+	first, ok := g.seen[key]
+	if !ok || (first == name && !g.renamed[key]) {
+		g.seen[key] = name
+		return true, name
+	}
+
+	switch g.policy {
+	case CaseSkip:
+		return false, ""
+	case CaseRename:
+		ext := path.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for i := 1; ; i++ {
+			renamed := fmt.Sprintf("%s~%d%s", stem, i, ext)
+			renamedKey := strings.ToLower(path.Clean(renamed))
+			if _, taken := g.seen[renamedKey]; !taken {
+				g.seen[renamedKey] = renamed
+				g.renamed[renamedKey] = true
+				return true, renamed
+			}
+		}
+	default:
+		g.collisions = append(g.collisions, fmt.Sprintf("%s (collides with %s)", name, first))
+		return false, ""
+	}
+}
+
+// err reports the collisions refused under CaseError
+func (g *caseGuard) err() error {
+	if len(g.collisions) == 0 {
+		return nil
+	}
+	return fmt.Errorf("entries differ only in case: %s", strings.Join(g.collisions, ", "))
+}
@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"archive/tar"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestCasePolicy(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTarGz(t, dir, []tarMember{
+		{name: "Docs/", typeflag: tar.TypeDir},
+		{name: "Docs/README", body: "first"},
+		{name: "docs/", typeflag: tar.TypeDir},
+		{name: "docs/readme", body: "second"},
+		{name: "docs/readme~1", body: "third"},
+		{name: "other.txt", body: "other"},
+	})
+
+	tests := []struct {
+		policy  string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			policy: CaseSkip,
+			want:   map[string]string{"Docs/README": "first", "docs/readme~1": "third", "other.txt": "other"},
+		},
+		{
+			// A later entry of the numbered name does not overwrite the
+			// renamed one but is renamed in turn
+			policy: CaseRename,
+			want:   map[string]string{"Docs/README": "first", "docs/readme~1": "second", "docs/readme~1~1": "third", "other.txt": "other"},
+		},
+		{
+			policy:  CaseError,
+			want:    map[string]string{"Docs/README": "first", "docs/readme~1": "third", "other.txt": "other"},
+			wantErr: "entries differ only in case: docs/readme (collides with Docs/README)",
+		},
+		{
+			policy:  "fold",
+			wantErr: "unknown case policy: fold",
+		},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, "out-"+tt.policy)
+		err := NewOperator(&models.ArchiveOptions{CasePolicy: tt.policy}).Extract(input, output)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.policy, err, tt.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.policy, err)
+		}
+		if tt.want == nil {
+			continue
+		}
+		if got := readTree(t, output); !maps.Equal(got, tt.want) {
+			t.Errorf("%s: tree = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
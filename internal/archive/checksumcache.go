@@ -0,0 +1,124 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// checksumCacheName is the file in the output directory that keeps the
+// digests of destination files between -update and -sync runs
+const checksumCacheName = ".gar-cache"
+
+// cachedDigest is the digest of a destination file as it was when hashed
+type cachedDigest struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Digest  string    `json:"digest"`
+}
+
+// checksumCache maps destination names to their digests, so files whose
+// size and modification time are unchanged are not hashed again. It is
+// safe for concurrent use.
+type checksumCache struct {
+	path      string
+	algorithm string
+
+	mu    sync.Mutex
+	files map[string]cachedDigest
+	dirty bool
+}
+
+// checksumCacheFile is the on-disk form of a checksumCache
+type checksumCacheFile struct {
+	Algorithm string                  `json:"algorithm"`
+	Files     map[string]cachedDigest `json:"files"`
+}
+
+// loadChecksumCache reads the cache in outputPath. A missing or unreadable
+// cache, or one kept for another algorithm, starts empty: it only saves
+// work, so nothing in it is needed.
+func loadChecksumCache(outputPath, algorithm string) *checksumCache {
+	c := &checksumCache{
+		path:      filepath.Join(outputPath, checksumCacheName),
+		algorithm: algorithm,
+		files:     make(map[string]cachedDigest),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	var f checksumCacheFile
+	if json.Unmarshal(data, &f) == nil && f.Algorithm == algorithm && f.Files != nil {
+		c.files = f.Files
+	}
+	return c
+}
+
+// lookup returns the digest recorded for name if fi still has the size
+// and modification time it had when hashed
+func (c *checksumCache) lookup(name string, fi os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.files[name]
+	if !ok || cached.Size != fi.Size() || !cached.ModTime.Equal(fi.ModTime()) {
+		return "", false
+	}
+	return cached.Digest, true
+}
+
+// store records the digest of name, whose file is described by fi
+func (c *checksumCache) store(name string, fi os.FileInfo, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files[name] = cachedDigest{Size: fi.Size(), ModTime: fi.ModTime(), Digest: digest}
+	c.dirty = true
+}
+
+// save atomically writes the entries for the names keep reports, dropping
+// files that are no longer part of the tree. An unchanged cache is not
+// rewritten.
+func (c *checksumCache) save(keep func(name string) bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name := range c.files {
+		if !keep(name) {
+			delete(c.files, name)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(checksumCacheFile{Algorithm: c.algorithm, Files: c.files})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".gar-cache-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,341 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/sevenzip"
+)
+
+// codecHeadSize is how much of a compressed stream is read to describe
+// it; it covers the gzip, xz and zstd headers, including a gzip file name
+// of reasonable length
+const codecHeadSize = 4096
+
+// compressionInfo describes, as far as the headers tell, how the archive
+// at inputPath is compressed: the method of each zip entry, or the
+// parameters recorded at the start of a compressed tar stream. Levels are
+// hints; most formats do not record the level they were written with.
+func compressionInfo(inputPath string, format models.ArchiveFormat, opts *models.ArchiveOptions) (string, error) {
+	switch format {
+	case models.FormatZip:
+		return zipCompressionInfo(inputPath, opts)
+	case models.FormatTar:
+		return "none (plain tar)", nil
+	case models.FormatSevenZip:
+		z, err := sevenzip.OpenReader(inputPath)
+		if err != nil {
+			return "", err
+		}
+		defer z.Close()
+		if methods := z.Methods(); len(methods) > 0 {
+			return "7z, " + strings.Join(methods, ", "), nil
+		}
+		return "7z, no compressed content", nil
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if archiveEncrypted(inputPath, opts) {
+		if reader, err = crypto.NewEncryptedReader(reader, opts.Password, opts.Keyfile); err != nil {
+			return "", err
+		}
+	}
+	head := make([]byte, codecHeadSize)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch format {
+	case models.FormatTarGz:
+		return describeGzip(head), nil
+	case models.FormatTarBz2:
+		return describeBzip2(head), nil
+	case models.FormatTarZstd:
+		return describeZstd(head), nil
+	case models.FormatTarXz:
+		return describeXz(head), nil
+	}
+	return "unknown", nil
+}
+
+// zipCompressionInfo counts the file entries of a zip by method. Deflate
+// entries carry a level hint in their flags when the writer set one.
+func zipCompressionInfo(inputPath string, opts *models.ArchiveOptions) (string, error) {
+	if archiveEncrypted(inputPath, opts) {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		reader, err := crypto.NewEncryptedReader(file, opts.Password, opts.Keyfile)
+		if err != nil {
+			return "", err
+		}
+		tmpPath, err := NewOperator(opts).bufferToTemp(reader, "gar-*.zip")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tmpPath)
+		inputPath = tmpPath
+	}
+
+	zr, err := openZip(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	var methods []string
+	counts := make(map[string]int)
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		method := zipMethodName(f.Method)
+		if f.Method == zip.Deflate {
+			// Bits 1 and 2 of the flags; zero means normal, or that the
+			// writer did not say
+			switch f.Flags & 0x6 {
+			case 0x2:
+				method += " (maximum)"
+			case 0x4:
+				method += " (fast)"
+			case 0x6:
+				method += " (super fast)"
+			}
+		}
+		if counts[method] == 0 {
+			methods = append(methods, method)
+		}
+		counts[method]++
+	}
+	if len(methods) == 0 {
+		return "zip, no files", nil
+	}
+
+	parts := make([]string, len(methods))
+	for i, method := range methods {
+		parts[i] = fmt.Sprintf("%s: %d %s", method, counts[method], plural(counts[method], "file", "files"))
+	}
+	return "zip, " + strings.Join(parts, ", "), nil
+}
+
+// plural picks the word for n things
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// gzipOS names the operating systems a gzip header commonly records
+var gzipOS = map[byte]string{
+	0:  "FAT",
+	3:  "Unix",
+	7:  "Macintosh",
+	10: "TOPS-20",
+	11: "NTFS",
+}
+
+// describeGzip reads the level hint of a gzip header (XFL is 2 after the
+// slowest and 4 after the fastest compression) and the first deflate
+// block, which is stored when nothing was compressed
+func describeGzip(head []byte) string {
+	if len(head) < 10 || !bytes.HasPrefix(head, gzipMagic) {
+		return "gzip, unreadable header"
+	}
+	flags, xfl, osByte := head[3], head[8], head[9]
+
+	level := "level ~6"
+	switch xfl {
+	case 2:
+		level = "level 9"
+	case 4:
+		level = "level 1"
+	}
+
+	// Skip the optional fields to find the first deflate block
+	p := 10
+	if flags&0x04 != 0 && p+2 <= len(head) {
+		p += 2 + int(binary.LittleEndian.Uint16(head[p:]))
+	}
+	for _, bit := range []byte{0x08, 0x10} {
+		if flags&bit != 0 {
+			if i := bytes.IndexByte(head[min(p, len(head)):], 0); i >= 0 {
+				p += i + 1
+			} else {
+				p = len(head)
+			}
+		}
+	}
+	if flags&0x02 != 0 {
+		p += 2
+	}
+	if p < len(head) && head[p]>>1&3 == 0 {
+		level = "stored, level 0"
+	}
+
+	desc := "gzip, deflate (" + level + ")"
+	if name, ok := gzipOS[osByte]; ok {
+		desc += ", written on " + name
+	}
+	return desc
+}
+
+// describeBzip2 reads the block size, which is the level bzip2 was run with
+func describeBzip2(head []byte) string {
+	if len(head) < 4 || !bytes.HasPrefix(head, bzip2Magic) || head[3] < '1' || head[3] > '9' {
+		return "bzip2, unreadable header"
+	}
+	return fmt.Sprintf("bzip2, %c00 kB blocks (level %c)", head[3], head[3])
+}
+
+// describeZstd reads the parameters of the first zstd frame. The level is
+// not recorded; the window size grows with it.
+func describeZstd(head []byte) string {
+	var h zstd.Header
+	if err := h.Decode(head); err != nil {
+		return "zstd, unreadable header"
+	}
+
+	desc := "zstd"
+	if h.SingleSegment {
+		desc += fmt.Sprintf(", single segment of %s", sizeLabel(h.FrameContentSize))
+	} else {
+		desc += fmt.Sprintf(", window %s", sizeLabel(h.WindowSize))
+	}
+	if h.DictionaryID != 0 {
+		desc += fmt.Sprintf(", dictionary %d", h.DictionaryID)
+	}
+	if h.HasCheckSum {
+		desc += ", checksummed"
+	}
+	return desc
+}
+
+// xzFilters names the filters of xz block headers
+var xzFilters = map[uint64]string{
+	0x03: "delta",
+	0x04: "x86 BCJ",
+	0x05: "PowerPC BCJ",
+	0x06: "IA-64 BCJ",
+	0x07: "ARM BCJ",
+	0x08: "ARM-Thumb BCJ",
+	0x09: "SPARC BCJ",
+	0x0a: "ARM64 BCJ",
+	0x21: "LZMA2",
+}
+
+// xzChecks names the integrity checks of the xz stream flags
+var xzChecks = map[byte]string{
+	0x00: "no check",
+	0x01: "CRC32 check",
+	0x04: "CRC64 check",
+	0x0a: "SHA-256 check",
+}
+
+// describeXz reads the check type from the stream header and the filter
+// chain from the first block header. The LZMA2 dictionary size points at
+// the preset, since each xz preset has its own.
+func describeXz(head []byte) string {
+	const streamHeaderSize = 12
+	if len(head) < streamHeaderSize+2 || !bytes.HasPrefix(head, xzMagic) {
+		return "xz, unreadable header"
+	}
+	check, ok := xzChecks[head[7]&0x0f]
+	if !ok {
+		check = "unknown check"
+	}
+
+	var filters []string
+	block := head[streamHeaderSize:]
+	if size := (int(block[0]) + 1) * 4; block[0] != 0 && size <= len(block) {
+		block = block[:size]
+		flags := block[1]
+		p := 2
+		vli := func() uint64 {
+			var v uint64
+			for shift := 0; p < len(block) && shift < 63; shift += 7 {
+				b := block[p]
+				p++
+				v |= uint64(b&0x7f) << shift
+				if b&0x80 == 0 {
+					break
+				}
+			}
+			return v
+		}
+		if flags&0x40 != 0 {
+			vli()
+		}
+		if flags&0x80 != 0 {
+			vli()
+		}
+		for range int(flags&3) + 1 {
+			id, propsSize := vli(), vli()
+			if p > len(block) || propsSize > uint64(len(block)-p) {
+				// The properties run past the block header
+				filters = append(filters, "unknown")
+				break
+			}
+			props := block[p : p+int(propsSize)]
+			p += int(propsSize)
+
+			name, ok := xzFilters[id]
+			if !ok {
+				name = fmt.Sprintf("filter %#x", id)
+			}
+			if id == 0x21 && len(props) == 1 && props[0] < 40 {
+				dict := (2 | uint64(props[0])&1) << (props[0]/2 + 11)
+				name += fmt.Sprintf(" (dictionary %s%s)", sizeLabel(dict), xzPresetHint(dict))
+			}
+			filters = append(filters, name)
+		}
+	}
+	if len(filters) == 0 {
+		return "xz, " + check
+	}
+	return "xz, " + strings.Join(filters, " + ") + ", " + check
+}
+
+// xzPresetHint names the highest xz preset using dictionary size dict
+func xzPresetHint(dict uint64) string {
+	for preset := len(xzPresetDicts) - 1; preset > 0; preset-- {
+		if uint64(xzPresetDicts[preset]) == dict {
+			return fmt.Sprintf(", preset ~%d", preset)
+		}
+	}
+	return ""
+}
+
+// sizeLabel renders a power-of-two friendly byte count, e.g. 8 MiB
+func sizeLabel(n uint64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%d GiB", n>>30)
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KiB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,70 @@
+package archive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// xzHead compresses data as tar.xz would at preset and returns the start of
+// the stream
+func xzHead(t testing.TB, preset int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newTarXzEntryWriter(&buf, &models.ArchiveOptions{CodecLevel: preset})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// xzStreamHeader is an xz stream header with a CRC64 check; its own CRC is
+// not verified by describeXz
+var xzStreamHeader = append(append([]byte{}, xzMagic...), 'Z', 0x00, 0x00, 0x04, 0, 0, 0, 0)
+
+func TestDescribeXz(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"preset 1", xzHead(t, 1), "xz, LZMA2 (dictionary 1 MiB, preset ~1), CRC64 check"},
+		{"preset 6", xzHead(t, 6), "xz, LZMA2 (dictionary 8 MiB, preset ~6), CRC64 check"},
+		{"too short", xzMagic, "xz, unreadable header"},
+		{"not xz", bytes.Repeat([]byte{0}, 32), "xz, unreadable header"},
+		{"no block", append(bytes.Clone(xzStreamHeader), 0, 0), "xz, CRC64 check"},
+		{"large properties", append(bytes.Clone(xzStreamHeader), 0x02, 0x00, 0x21, 0xff, 0xff, 0xff, 0xff, 0x0f, 0, 0, 0, 0), "xz, unknown, CRC64 check"},
+		// A size of 1<<63-1 overflows the offset after it
+		{"huge properties", append(bytes.Clone(xzStreamHeader), 0x03, 0x00, 0x21, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0), "xz, unknown, CRC64 check"},
+		{"properties past the header", append(bytes.Clone(xzStreamHeader), 0x01, 0x00, 0x21, 0x05, 0, 0, 0, 0), "xz, unknown, CRC64 check"},
+		{"unknown filter", append(bytes.Clone(xzStreamHeader), 0x01, 0x00, 0x42, 0x00, 0, 0, 0, 0), "xz, filter 0x42, CRC64 check"},
+	}
+	for _, tt := range tests {
+		if got := describeXz(tt.head); got != tt.want {
+			t.Errorf("%s: describeXz = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func FuzzDescribeHeaders(f *testing.F) {
+	f.Add(xzHead(f, 6))
+	f.Add(gzipMember(f, []byte("seed"), "seed.tar"))
+	f.Add(gzipMemberHeaderCRC(f, []byte("seed"), "seed.tar"))
+	f.Add([]byte("BZh91AY&SY"))
+	f.Add(append(bytes.Clone(xzStreamHeader), 0x02, 0x03, 0x80, 0x80, 0x21, 0x01, 0x16, 0, 0, 0, 0, 0))
+	f.Fuzz(func(t *testing.T, head []byte) {
+		// Headers of any shape are described, never a panic
+		for name, describe := range map[string]func([]byte) string{
+			"gzip": describeGzip, "bzip2": describeBzip2, "zstd": describeZstd, "xz": describeXz,
+		} {
+			if got := describe(head); !strings.HasPrefix(got, name+",") && got != name {
+				t.Errorf("%s description %q", name, got)
+			}
+		}
+	})
+}
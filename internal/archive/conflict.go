@@ -0,0 +1,114 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Policies for extracted files whose destination already exists
+const (
+	// ConflictOverwrite replaces the existing file
+	ConflictOverwrite = "overwrite"
+	// ConflictRename extracts the entry under the first free name the
+	// rename template produces
+	ConflictRename = "rename"
+)
+
+// DefaultRenameTemplate numbers a renamed file before its extension
+// (file.1.txt, file.2.txt, ...)
+const DefaultRenameTemplate = "{name}.{n}{ext}"
+
+// conflictRenamer renames extracted files whose destination exists
+type conflictRenamer struct {
+	outputPath string
+	template   string
+
+	mu    sync.Mutex
+	taken map[string]bool
+}
+
+func newConflictRenamer(outputPath, template string) (*conflictRenamer, error) {
+	if template == "" {
+		template = DefaultRenameTemplate
+	}
+	// Without the counter every attempt would produce the same name
+	if !strings.Contains(template, "{n}") {
+		return nil, fmt.Errorf("rename template %q must contain {n}", template)
+	}
+	if strings.Contains(template, "/") {
+		return nil, fmt.Errorf("rename template %q must not contain /", template)
+	}
+	return &conflictRenamer{outputPath: outputPath, template: template, taken: make(map[string]bool)}, nil
+}
+
+// options returns a copy of opts whose EntryFilter runs the configured
+// filter and then renames files whose destination is taken
+func (c *conflictRenamer) options(opts *models.ArchiveOptions) *models.ArchiveOptions {
+	renaming := *opts
+	inner := opts.EntryFilter
+	renaming.EntryFilter = func(e models.Entry) (bool, string) {
+		name := e.Name
+		if inner != nil {
+			include, newName := inner(e)
+			if !include {
+				return false, ""
+			}
+			if newName != "" {
+				name = newName
+			}
+		}
+
+		// Existing directories are merged into, as without the policy
+		if e.IsDir {
+			return true, name
+		}
+		return true, c.rename(name)
+	}
+	return &renaming
+}
+
+// rename returns name, or the first templated alternative in the same
+// directory that neither exists nor was handed out earlier in this run
+func (c *conflictRenamer) rename(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.exists(name) {
+		c.taken[name] = true
+		return name
+	}
+
+	dir, base := path.Split(name)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for n := 1; ; n++ {
+		renamed := dir + expandRenameTemplate(c.template, stem, ext, n)
+		if !c.exists(renamed) {
+			c.taken[renamed] = true
+			return renamed
+		}
+	}
+}
+
+// exists reports whether name is already used at the destination
+func (c *conflictRenamer) exists(name string) bool {
+	if c.taken[name] {
+		return true
+	}
+	_, err := os.Lstat(filepath.Join(c.outputPath, filepath.FromSlash(name)))
+	return err == nil
+}
+
+// expandRenameTemplate fills in {name} (the file name without its
+// extension), {ext} (the extension with its dot) and {n} (the counter)
+func expandRenameTemplate(template, stem, ext string, n int) string {
+	return strings.NewReplacer("{name}", stem, "{ext}", ext, "{n}", strconv.Itoa(n)).Replace(template)
+}
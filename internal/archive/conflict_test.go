@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestConflictRename(t *testing.T) {
+	input := writeZipFile(t, t.TempDir(), map[string]string{
+		"file.txt":       "content",
+		"dir/notes":      "notes",
+		"archive.tar.gz": "tgz",
+	}, []string{"file.txt", "dir/notes", "archive.tar.gz"})
+
+	tests := []struct {
+		template string
+		want     map[string]string
+	}{
+		{"", map[string]string{
+			"file.txt": "content", "file.1.txt": "content", "file.2.txt": "content",
+			"dir/notes": "notes", "dir/notes.1": "notes", "dir/notes.2": "notes",
+			"archive.tar.gz": "tgz", "archive.tar.1.gz": "tgz", "archive.tar.2.gz": "tgz",
+		}},
+		{"{name} ({n}){ext}", map[string]string{
+			"file.txt": "content", "file (1).txt": "content", "file (2).txt": "content",
+			"dir/notes": "notes", "dir/notes (1)": "notes", "dir/notes (2)": "notes",
+			"archive.tar.gz": "tgz", "archive.tar (1).gz": "tgz", "archive.tar (2).gz": "tgz",
+		}},
+	}
+	for _, tt := range tests {
+		output := t.TempDir()
+		opts := &models.ArchiveOptions{OnConflict: ConflictRename, RenameTemplate: tt.template}
+		for range 3 {
+			if err := NewOperator(opts).Extract(input, output); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := readTree(t, output); !maps.Equal(got, tt.want) {
+			t.Errorf("template %q: tree = %v, want %v", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestConflictPolicyErrors(t *testing.T) {
+	input := writeZipFile(t, t.TempDir(), map[string]string{"a.txt": "a"}, []string{"a.txt"})
+	tests := []struct {
+		opts models.ArchiveOptions
+		want string
+	}{
+		{models.ArchiveOptions{OnConflict: "keep"}, "unknown conflict policy: keep"},
+		{models.ArchiveOptions{OnConflict: ConflictRename, RenameTemplate: "{name}{ext}"}, "must contain {n}"},
+		{models.ArchiveOptions{OnConflict: ConflictRename, RenameTemplate: "old/{name}.{n}"}, "must not contain /"},
+		{models.ArchiveOptions{OnConflict: ConflictRename, Sync: true}, "cannot be combined with -update or -sync"},
+	}
+	for _, tt := range tests {
+		err := NewOperator(&tt.opts).Extract(input, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("-on-conflict=%s -rename-template=%q: err = %v, want %q", tt.opts.OnConflict, tt.opts.RenameTemplate, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Contains reports whether the archive at inputPath holds an entry named
+// pattern, which may be a glob (path.Match syntax). Zip archives only need
+// their central directory; tar archives are scanned header by header,
+// skipping entry bodies, until the first match.
+func (op *Operator) Contains(inputPath, pattern string) (bool, error) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	matches := func(name string) bool {
+		ok, _ := path.Match(pattern, strings.TrimSuffix(name, "/"))
+		return ok
+	}
+
+	if detectFormat(inputPath, op.opts) == models.FormatZip && !archiveEncrypted(inputPath, op.opts) {
+		zr, err := openZip(inputPath)
+		if err != nil {
+			return false, err
+		}
+		defer zr.Close()
+
+		for _, f := range zr.File {
+			if matches(f.Name) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	err := forEachEntry(inputPath, detectFormat(inputPath, op.opts), op.opts, func(e *archiveEntry, _ io.Reader) error {
+		if matches(e.Name) {
+			return errEntryFound
+		}
+		return nil
+	})
+	if err == errEntryFound {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,51 @@
+package archive
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestContains(t *testing.T) {
+	src := writeTestTree(t, map[string]string{"a.txt": "a", "docs/guide.md": "guide", "docs/img/logo.png": "png"})
+
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"a.txt", true},
+		{"docs/guide.md", true},
+		{"docs", true},
+		{"docs/", true},
+		{"b.txt", false},
+		{"guide.md", false},
+		{"docs/*.md", true},
+		{"docs/*.png", false},
+		{"docs/*/*.png", true},
+		{"*.txt", true},
+		{"?.txt", true},
+		{"[ab].txt", true},
+		{"[bc].txt", false},
+	}
+	for _, format := range []models.ArchiveFormat{models.FormatZip, models.FormatTarGz, models.FormatTar} {
+		input := filepath.Join(t.TempDir(), "in"+GetExtension(format))
+		if err := NewOperator(&models.ArchiveOptions{Format: format}).Compress(src, input); err != nil {
+			t.Fatal(err)
+		}
+		op := NewOperator(&models.ArchiveOptions{})
+		for _, tt := range tests {
+			got, err := op.Contains(input, tt.pattern)
+			if err != nil {
+				t.Errorf("%s %q: %v", formatName(format), tt.pattern, err)
+				continue
+			}
+			if got != tt.want {
+				t.Errorf("%s: Contains(%q) = %v, want %v", formatName(format), tt.pattern, got, tt.want)
+			}
+		}
+		if _, err := op.Contains(input, "[a-"); err == nil {
+			t.Errorf("%s: invalid pattern accepted", formatName(format))
+		}
+	}
+}
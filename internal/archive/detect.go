@@ -0,0 +1,242 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/sevenzip"
+)
+
+// Leading and trailing signatures used to recognize archives by content
+var (
+	zipLocalMagic = []byte("PK\x03\x04")
+	zipEOCDMagic  = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1f, 0x8b}
+	bzip2Magic    = []byte("BZh")
+	zstdMagic     = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic       = []byte{0xfd, '7', 'z', 'X'}
+)
+
+// zipTailSize bounds the search for the end of central directory record:
+// the fixed 22-byte record plus a comment of at most 65535 bytes
+const zipTailSize = 22 + 65535
+
+// ErrUnknownFormat is returned by DetectFormat when the content is not an
+// archive gar recognizes
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+// ErrEncryptedArchive is returned by DetectFormat for archives encrypted
+// as a whole, whose format is only visible after decryption
+var ErrEncryptedArchive = errors.New("encrypted archive")
+
+// detectFormat picks the archive format for inputPath. An explicitly
+// requested format (opts.ForceFormat) always wins. Otherwise the content
+// is sniffed, which also recognizes zips with arbitrary leading bytes
+// (self-extracting or polyglot files) by their end of central directory
+// record, and a mislabelled extension gives way to it. An encrypted
+// archive is read as its extension says or, without a known extension,
+// as the decrypted content shows when a password or keyfile is set.
+// Anything else unrecognized is read as its extension says, and as zip
+// without one.
+func detectFormat(inputPath string, opts *models.ArchiveOptions) models.ArchiveFormat {
+	if opts != nil && opts.ForceFormat {
+		return opts.Format
+	}
+
+	format, err := sniffFile(inputPath)
+	switch {
+	case err == nil:
+		return format
+	case errors.Is(err, ErrEncryptedArchive):
+		if format, ok := extensionFormat(inputPath); ok {
+			return format
+		}
+		if opts != nil && hasArchiveKey(opts) {
+			if format, err := sniffDecrypted(inputPath, opts); err == nil {
+				return format
+			}
+		}
+	}
+	return formatFromPath(inputPath)
+}
+
+// extensionFormat returns the format the extension of inputPath names
+func extensionFormat(inputPath string) (models.ArchiveFormat, bool) {
+	lower := strings.ToLower(inputPath)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return models.FormatZip, true
+	case strings.HasSuffix(lower, ".gz"), strings.HasSuffix(lower, ".tgz"):
+		return models.FormatTarGz, true
+	case strings.HasSuffix(lower, ".bz2"), strings.HasSuffix(lower, ".tbz2"), strings.HasSuffix(lower, ".tbz"):
+		return models.FormatTarBz2, true
+	case strings.HasSuffix(lower, ".zst"), strings.HasSuffix(lower, ".tzst"):
+		return models.FormatTarZstd, true
+	case strings.HasSuffix(lower, ".xz"), strings.HasSuffix(lower, ".txz"):
+		return models.FormatTarXz, true
+	case strings.HasSuffix(lower, ".7z"):
+		return models.FormatSevenZip, true
+	case strings.HasSuffix(lower, ".tar"):
+		return models.FormatTar, true
+	}
+	return 0, false
+}
+
+// checkExtension warns when the content of inputPath is an archive of a
+// different format than its extension names; detectFormat then goes by
+// the content. With Strict the mismatch is an error instead.
+func (op *Operator) checkExtension(inputPath string) error {
+	if op.opts.ForceFormat {
+		return nil
+	}
+	named, ok := extensionFormat(inputPath)
+	if !ok {
+		return nil
+	}
+	content, ok := sniffFormat(inputPath)
+	if !ok || content == named {
+		return nil
+	}
+
+	if op.opts.Strict {
+		return fmt.Errorf("%s is named as %s but contains %s (-strict)", inputPath, formatName(named), formatName(content))
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s is named as %s but contains %s; reading it as %s\n",
+		inputPath, formatName(named), formatName(content), formatName(content))
+	return nil
+}
+
+// formatName names format in messages
+func formatName(format models.ArchiveFormat) string {
+	return strings.TrimPrefix(GetExtension(format), ".")
+}
+
+// sniffFormat recognizes an archive from its leading or trailing bytes
+func sniffFormat(inputPath string) (models.ArchiveFormat, bool) {
+	format, err := sniffFile(inputPath)
+	return format, err == nil
+}
+
+// sniffFile runs DetectFormat on the file at inputPath
+func sniffFile(inputPath string) (models.ArchiveFormat, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return DetectFormat(file)
+}
+
+// sniffDecrypted recognizes the archive inside the encrypted file at
+// inputPath from its leading bytes. The trailing zip record is out of
+// reach without decrypting everything, so a decrypted zip must start with
+// a zip header.
+func sniffDecrypted(inputPath string, opts *models.ArchiveOptions) (models.ArchiveFormat, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader, err := crypto.NewEncryptedReader(file, opts.Password, opts.Keyfile)
+	if err != nil {
+		return 0, err
+	}
+	head := make([]byte, blockSize)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	return DetectFormat(bytes.NewReader(head[:n]))
+}
+
+// DetectFormat recognizes an archive from its content: the magic bytes
+// at the start (PK\x03\x04 for zip, \x1f\x8b for gzip and so on), the
+// first header block of a plain tar, and, when the size of r is known
+// (through a Size or Stat method, as bytes.Reader and os.File have), the
+// end of central directory record of a zip with leading bytes. An archive
+// encrypted as a whole yields ErrEncryptedArchive, and anything else
+// ErrUnknownFormat.
+func DetectFormat(r io.ReaderAt) (models.ArchiveFormat, error) {
+	head := make([]byte, blockSize)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte(crypto.StreamMagic)):
+		return 0, ErrEncryptedArchive
+	case bytes.HasPrefix(head, zipLocalMagic), bytes.HasPrefix(head, zipEOCDMagic):
+		return models.FormatZip, nil
+	case bytes.HasPrefix(head, gzipMagic):
+		return models.FormatTarGz, nil
+	case bytes.HasPrefix(head, bzip2Magic) && len(head) >= 4 && head[3] >= '1' && head[3] <= '9':
+		// The fourth byte is the block size, 1-9
+		return models.FormatTarBz2, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		return models.FormatTarZstd, nil
+	case bytes.HasPrefix(head, xzMagic):
+		return models.FormatTarXz, nil
+	case bytes.HasPrefix(head, sevenzip.Signature[:4]):
+		return models.FormatSevenZip, nil
+	}
+
+	// A plain tar has no magic at the start, but its first header block
+	// is recognizable; check it before the zip tail, since a tar can end
+	// with a zip file
+	if len(head) == blockSize && isTarStream(bufio.NewReaderSize(bytes.NewReader(head), blockSize)) {
+		return models.FormatTar, nil
+	}
+
+	if size, ok := readerSize(r); ok && hasZipTail(r, size) {
+		return models.FormatZip, nil
+	}
+	return 0, ErrUnknownFormat
+}
+
+// readerSize returns the size of r when it can tell
+func readerSize(r io.ReaderAt) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		if info, err := r.Stat(); err == nil {
+			return info.Size(), true
+		}
+	}
+	return 0, false
+}
+
+// hasZipTail reports whether the last bytes of r, which holds size bytes,
+// are a zip end of central directory record
+func hasZipTail(r io.ReaderAt, size int64) bool {
+	n := min(size, zipTailSize)
+	tail := make([]byte, n)
+	if _, err := r.ReadAt(tail, size-n); err != nil && err != io.EOF {
+		return false
+	}
+
+	// The record is at least 22 bytes, so the signature cannot be later
+	i := bytes.LastIndex(tail, zipEOCDMagic)
+	return i >= 0 && len(tail)-i >= 22
+}
+
+// isArchiveExt reports whether name has an extension gar recognizes
+func isArchiveExt(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".zip", ".gz", ".tgz", ".bz2", ".tbz2", ".tbz", ".zst", ".tzst", ".xz", ".txz", ".7z", ".tar":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestDetectFormatPrefixedZip(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":     []byte("alpha"),
+		"dir/b.txt": bytes.Repeat([]byte("beta "), 1000),
+	}
+	zipData := buildZip(t, zip.Deflate, files, []string{"a.txt", "dir/b.txt"})
+
+	// A stub executable in front, as a self-extracting archive has
+	stub := append([]byte("MZ\x90\x00"), bytes.Repeat([]byte{0xcc}, 4096)...)
+	prefixed := append(bytes.Clone(stub), zipData...)
+
+	format, err := DetectFormat(bytes.NewReader(prefixed))
+	if err != nil || format != models.FormatZip {
+		t.Fatalf("DetectFormat = %v, %v, want zip", format, err)
+	}
+
+	// Without a known size only the leading bytes count
+	if _, err := DetectFormat(onlyReaderAt{bytes.NewReader(prefixed)}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("DetectFormat without size = %v, want ErrUnknownFormat", err)
+	}
+
+	// A stub without the zip is not an archive
+	if _, err := DetectFormat(bytes.NewReader(stub)); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("DetectFormat of stub = %v, want ErrUnknownFormat", err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"setup.exe", "setup"} {
+		t.Run(name, func(t *testing.T) {
+			inputPath := writeFile(t, dir, name, prefixed)
+			if got := detectFormat(inputPath, &models.ArchiveOptions{}); got != models.FormatZip {
+				t.Fatalf("detectFormat = %s, want zip", formatName(got))
+			}
+
+			outputPath := filepath.Join(dir, name+".out")
+			if err := NewOperator(&models.ArchiveOptions{}).Extract(inputPath, outputPath); err != nil {
+				t.Fatal(err)
+			}
+			got := readTree(t, outputPath)
+			for file, want := range files {
+				if got[file] != string(want) {
+					t.Errorf("%s = %q, want %q", file, got[file], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectFormatZipComment(t *testing.T) {
+	// The record can be followed by a comment of up to 65535 bytes
+	var buf bytes.Buffer
+	buf.WriteString("#!/bin/sh\nexit 0\n")
+	zw := zip.NewWriter(&buf)
+	zw.SetComment(string(bytes.Repeat([]byte("c"), 65535)))
+	w, _ := zw.Create("a.txt")
+	w.Write([]byte("a"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	format, err := DetectFormat(bytes.NewReader(buf.Bytes()))
+	if err != nil || format != models.FormatZip {
+		t.Fatalf("DetectFormat = %v, %v, want zip", format, err)
+	}
+}
+
+// onlyReaderAt hides the size of a reader
+type onlyReaderAt struct{ r *bytes.Reader }
+
+func (o onlyReaderAt) ReadAt(p []byte, off int64) (int, error) { return o.r.ReadAt(p, off) }
+
+func TestMislabelledArchive(t *testing.T) {
+	dir := t.TempDir()
+	tarGz := writeTarGz(t, dir, []tarMember{{name: "a.txt", body: "alpha"}})
+	input := filepath.Join(dir, "mislabelled.zip")
+	if err := os.Rename(tarGz, input); err != nil {
+		t.Fatal(err)
+	}
+	const warning = "is named as zip but contains tar.gz; reading it as tar.gz"
+
+	// Extraction warns and goes by the content
+	output := filepath.Join(dir, "out")
+	stderr := captureStderr(t, func() error {
+		return NewOperator(&models.ArchiveOptions{}).Extract(input, output)
+	})
+	if !strings.Contains(stderr, warning) {
+		t.Errorf("extract stderr = %q, want %q", stderr, warning)
+	}
+	data, err := os.ReadFile(filepath.Join(output, "a.txt"))
+	if err != nil || string(data) != "alpha" {
+		t.Errorf("a.txt = %q, %v; want %q", data, err, "alpha")
+	}
+
+	stderr = captureStderr(t, func() error {
+		return NewOperator(&models.ArchiveOptions{}).List(input)
+	})
+	if !strings.Contains(stderr, warning) {
+		t.Errorf("list stderr = %q, want %q", stderr, warning)
+	}
+
+	// -strict refuses it
+	err = NewOperator(&models.ArchiveOptions{Strict: true}).Extract(input, filepath.Join(dir, "strict"))
+	if err == nil || !strings.Contains(err.Error(), "is named as zip but contains tar.gz (-strict)") {
+		t.Errorf("-strict extract: err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "strict")); !os.IsNotExist(err) {
+		t.Errorf("-strict extract created its output: %v", err)
+	}
+}
+
+// TestDetectFormatByContent renames archives of every writable format to
+// a misleading extension and to none, and checks each is still read by
+// its content
+func TestDetectFormatByContent(t *testing.T) {
+	formats := []models.ArchiveFormat{
+		models.FormatZip, models.FormatTarGz, models.FormatTarBz2,
+		models.FormatTarZstd, models.FormatTarXz, models.FormatTar,
+	}
+	for _, format := range formats {
+		t.Run(formatName(format), func(t *testing.T) {
+			src := writeTestTree(t, formatTree)
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "out"+GetExtension(format))
+			if err := NewOperator(&models.ArchiveOptions{Format: format}).Compress(src, archive); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := DetectFormat(bytes.NewReader(data)); err != nil || got != format {
+				t.Errorf("DetectFormat = %v, %v, want %s", got, err, formatName(format))
+			}
+
+			for _, name := range []string{"backup.bak", "backup"} {
+				input := writeFile(t, dir, name, data)
+				if got := detectFormat(input, &models.ArchiveOptions{}); got != format {
+					t.Errorf("%s detected as %s", name, formatName(got))
+				}
+				output := filepath.Join(dir, name+".out")
+				if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if got := readTree(t, output); !maps.Equal(got, formatTree) {
+					t.Errorf("%s extracted %v, want %v", name, got, formatTree)
+				}
+			}
+		})
+	}
+}
+
+// TestDetectEncryptedFormat checks that an encrypted archive is reported
+// as such rather than misdetected, and that without an extension the
+// format is taken from the decrypted content
+func TestDetectEncryptedFormat(t *testing.T) {
+	src := writeTestTree(t, formatTree)
+	dir := t.TempDir()
+	for _, format := range []models.ArchiveFormat{models.FormatZip, models.FormatTarZstd} {
+		t.Run(formatName(format), func(t *testing.T) {
+			archive := filepath.Join(dir, "out"+GetExtension(format))
+			if err := NewOperator(&models.ArchiveOptions{Format: format, Password: "secret"}).Compress(src, archive); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DetectFormat(bytes.NewReader(data)); !errors.Is(err, ErrEncryptedArchive) {
+				t.Errorf("DetectFormat = %v, want ErrEncryptedArchive", err)
+			}
+
+			input := writeFile(t, dir, "sealed-"+formatName(format), data)
+			opts := &models.ArchiveOptions{Password: "secret"}
+			if got := detectFormat(input, opts); got != format {
+				t.Errorf("extensionless archive detected as %s", formatName(got))
+			}
+			output := filepath.Join(dir, formatName(format)+".out")
+			if err := NewOperator(opts).Extract(input, output); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, output); !maps.Equal(got, formatTree) {
+				t.Errorf("extracted %v, want %v", got, formatTree)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pendingDirs collects the mode and modification time of each directory
+// entry and applies them once every entry is extracted. Applied as the
+// entry arrives, a read-only mode would stop the files that follow it from
+// being created (archives may list a directory after its contents) and
+// creating those files would reset the modification time.
+type pendingDirs struct {
+	mu   sync.Mutex
+	dirs []pendingDir
+}
+
+type pendingDir struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// add queues the attributes of the directory at path. It is safe for
+// concurrent use by extraction workers.
+func (p *pendingDirs) add(path string, mode os.FileMode, modTime time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirs = append(p.dirs, pendingDir{path: path, mode: mode.Perm(), modTime: modTime})
+}
+
+// apply restores the queued attributes, deepest directories first so
+// restoring a child's time cannot change its parent's. A directory listed
+// more than once takes its last entry.
+func (p *pendingDirs) apply() error {
+	sort.SliceStable(p.dirs, func(i, j int) bool {
+		return strings.Count(p.dirs[i].path, string(os.PathSeparator)) >
+			strings.Count(p.dirs[j].path, string(os.PathSeparator))
+	})
+
+	var firstErr error
+	for _, d := range p.dirs {
+		if err := os.Chmod(d.path, d.mode); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if d.modTime.IsZero() {
+			continue
+		}
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
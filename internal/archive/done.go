@@ -0,0 +1,57 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/cubetiqlabs/gar/internal/remote"
+)
+
+// extractedMarker is the file DoneMarker creates in the output directory
+// once an extraction succeeds
+const extractedMarker = ".gar-extracted"
+
+// compressMarkers returns the <output>.done markers for the local outputs
+// named by outputPath; standard output and remote outputs get none
+func compressMarkers(outputPath string) []string {
+	var markers []string
+	for _, p := range splitOutputs(outputPath) {
+		if p != stdoutPath && !remote.IsRemote(p) {
+			markers = append(markers, p+".done")
+		}
+	}
+	return markers
+}
+
+// clearMarkers removes markers left by an earlier run, so a run that fails
+// never leaves one behind
+func clearMarkers(markers []string) error {
+	for _, m := range markers {
+		if err := os.Remove(m); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMarkers creates each empty marker under a temporary name and renames
+// it into place, so watchers never see a marker before the run ended
+func writeMarkers(markers []string) error {
+	for _, m := range markers {
+		tmp, err := os.CreateTemp(filepath.Dir(m), "."+filepath.Base(m)+".tmp-*")
+		if err != nil {
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := os.Rename(tmp.Name(), m); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
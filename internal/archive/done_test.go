@@ -0,0 +1,59 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestDoneMarker(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestTree(t, map[string]string{"a.txt": "alpha"})
+	opts := &models.ArchiveOptions{Format: models.FormatZip, DoneMarker: true}
+	exists := func(p string) bool {
+		_, err := os.Stat(p)
+		return err == nil
+	}
+
+	output := filepath.Join(dir, "out.zip")
+	if err := NewOperator(opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(output + ".done") {
+		t.Fatal("compress left no .done marker")
+	}
+	// A failed run removes the marker of the earlier one
+	if err := NewOperator(opts).Compress(filepath.Join(dir, "missing"), output); err == nil {
+		t.Fatal("compressing a missing input succeeded")
+	}
+	if exists(output + ".done") {
+		t.Error("failed compress left a .done marker")
+	}
+
+	target := filepath.Join(dir, "target")
+	if err := NewOperator(opts).Extract(output, target); err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(target, extractedMarker)
+	if !exists(marker) {
+		t.Fatal("extract left no marker")
+	}
+	corrupt := writeFile(t, dir, "corrupt.zip", []byte("PK\x03\x04 not really a zip"))
+	if err := NewOperator(opts).Extract(corrupt, target); err == nil {
+		t.Fatal("extracting a corrupt archive succeeded")
+	}
+	if exists(marker) {
+		t.Error("failed extract left a marker")
+	}
+
+	// Without -done-marker nothing is written
+	plain := filepath.Join(dir, "plain.zip")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatZip}).Compress(src, plain); err != nil {
+		t.Fatal(err)
+	}
+	if exists(plain + ".done") {
+		t.Error("compress without -done-marker wrote a marker")
+	}
+}
@@ -0,0 +1,91 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// plannedOp is one filesystem change an extraction would make
+type plannedOp struct {
+	Action    string `json:"action"`
+	Path      string `json:"path"`
+	Mode      string `json:"mode,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Target    string `json:"target,omitempty"`
+	Collision bool   `json:"collision"`
+}
+
+// planExtract reports what extracting inputPath to outputPath would do
+// without touching the filesystem. With JSON set each operation is written
+// as a JSON object per line; otherwise a readable list is printed.
+func (op *Operator) planExtract(inputPath, outputPath string, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	targets := make(linkTargets)
+
+	return forEachEntry(inputPath, detectFormat(inputPath, op.opts), op.opts, func(e *archiveEntry, _ io.Reader) error {
+		name, ok := applyEntryFilter(op.opts, archiveEntryModel(e))
+		if !ok {
+			return nil
+		}
+
+		destPath, err := safeDestPath(outputPath, name)
+		if err != nil {
+			return err
+		}
+
+		planned := plannedOp{Path: destPath, Mode: fmt.Sprintf("%04o", e.Info.Mode().Perm())}
+		switch {
+		case e.Info.IsDir():
+			planned.Action = "mkdir"
+			targets.remove(e.Name)
+		case e.isSymlink():
+			if !op.opts.AllowUnsafeLinks {
+				if err := checkLinkTarget(outputPath, destPath, e.Linkname); err != nil {
+					return err
+				}
+			}
+			targets.remove(e.Name)
+			planned.Action = "symlink"
+			planned.Target = e.Linkname
+			planned.Mode = ""
+		case e.isHardLink():
+			target, err := targets.resolve(e.Linkname, destPath)
+			if err != nil {
+				return err
+			}
+			if _, err := safeDestPath(outputPath, target); err != nil {
+				return fmt.Errorf("unsafe hard link %s -> %s: target escapes extraction directory", destPath, target)
+			}
+			targets.add(e.Name, name)
+			planned.Action = "link"
+			planned.Target = target
+			planned.Mode = ""
+		default:
+			targets.add(e.Name, name)
+			planned.Action = "create"
+			planned.Size = e.Info.Size()
+		}
+
+		// Existing directories are reused rather than replaced
+		if fi, err := os.Lstat(destPath); err == nil {
+			planned.Collision = !(e.Info.IsDir() && fi.IsDir())
+		}
+
+		if op.opts.JSON {
+			return enc.Encode(planned)
+		}
+
+		suffix := ""
+		if planned.Collision {
+			suffix = " (overwrite)"
+		}
+		if planned.Target != "" {
+			suffix = " -> " + planned.Target + suffix
+		}
+		_, err = fmt.Fprintf(w, "  would %s: %s%s\n", planned.Action, planned.Path, suffix)
+		return err
+	})
+}
@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestPlanExtractJSON(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTarGz(t, dir, []tarMember{
+		{name: "d/", typeflag: tar.TypeDir},
+		{name: "d/a.txt", body: "alpha"},
+		{name: "d/new.txt", body: "new"},
+		{name: "b.txt", body: "beta"},
+		{name: "ln", typeflag: tar.TypeSymlink, linkname: "b.txt"},
+		{name: "x", typeflag: tar.TypeDir},
+	})
+
+	// An existing directory is reused; files, links and a file in place
+	// of a directory are overwritten
+	output := filepath.Join(dir, "out")
+	if err := os.MkdirAll(filepath.Join(output, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(output, "d"), "a.txt", []byte("old"))
+	writeFile(t, output, "b.txt", []byte("old"))
+	writeFile(t, output, "x", []byte("file"))
+	if err := os.Symlink("elsewhere", filepath.Join(output, "ln")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	op := NewOperator(&models.ArchiveOptions{DryRun: true, JSON: true})
+	if err := op.planExtract(input, output, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]plannedOp{
+		"d":         {Action: "mkdir", Mode: "0755"},
+		"d/a.txt":   {Action: "create", Mode: "0644", Size: 5, Collision: true},
+		"d/new.txt": {Action: "create", Mode: "0644", Size: 3},
+		"b.txt":     {Action: "create", Mode: "0644", Size: 4, Collision: true},
+		"ln":        {Action: "symlink", Target: "b.txt", Collision: true},
+		"x":         {Action: "mkdir", Mode: "0755", Collision: true},
+	}
+	plan := buf.String()
+	dec := json.NewDecoder(&buf)
+	seen := 0
+	for dec.More() {
+		var got plannedOp
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		rel, err := filepath.Rel(output, got.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, ok := want[filepath.ToSlash(rel)]
+		if !ok {
+			t.Errorf("unexpected operation %+v", got)
+			continue
+		}
+		w.Path = got.Path
+		if got != w {
+			t.Errorf("%s: planned %+v, want %+v", rel, got, w)
+		}
+		seen++
+	}
+	if seen != len(want) {
+		t.Errorf("planned %d operations, want %d", seen, len(want))
+	}
+
+	// Extract prints the same plan and leaves the target untouched
+	got := captureStdout(t, func() error { return op.Extract(input, output) })
+	if got != plan {
+		t.Errorf("Extract printed %q, want the plan %q", got, plan)
+	}
+	if _, err := os.Stat(filepath.Join(output, "d", "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("dry run created d/new.txt: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(output, "b.txt")); string(got) != "old" {
+		t.Errorf("dry run changed b.txt to %q", got)
+	}
+}
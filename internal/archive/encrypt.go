@@ -0,0 +1,170 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// paxEncrypted marks tar entries whose content is sealed individually
+const paxEncrypted = "GAR.encrypted"
+
+// zipExtraEncrypted is the zip extra field ID ("GA") that marks entries
+// whose content is sealed individually. The field carries no data.
+const zipExtraEncrypted = 0x4147
+
+// errEntryPassword is returned when an encrypted entry is read without a
+// password
+var errEntryPassword = errors.New("entry is encrypted; a password is required")
+
+// errArchivePassword is returned when an encrypted archive is read
+// without a password
+var errArchivePassword = errors.New("archive is encrypted; a password or keyfile is required")
+
+// hasArchiveKey reports whether opts hold a password or keyfile for
+// whole-archive encryption
+func hasArchiveKey(opts *models.ArchiveOptions) bool {
+	return opts.Password != "" || len(opts.Keyfile) > 0
+}
+
+// archiveEncrypted reports whether the archive at inputPath is encrypted
+// as a whole and can be decrypted, which needs a password or keyfile. With
+// -encrypt-pattern the archive itself is a plain zip or tar.gz and only
+// matching entries are sealed, so the password alone is not enough to tell.
+func archiveEncrypted(inputPath string, opts *models.ArchiveOptions) bool {
+	return hasArchiveKey(opts) && hasEncryptionHeader(inputPath)
+}
+
+// hasEncryptionHeader reports whether the file at inputPath starts with the
+// header of an encrypted stream
+func hasEncryptionHeader(inputPath string) bool {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, len(crypto.StreamMagic))
+	if _, err := io.ReadFull(file, head); err != nil {
+		return false
+	}
+	return string(head) == crypto.StreamMagic
+}
+
+// checkArchivePassword fails when the archive at inputPath is encrypted as
+// a whole but no password was given
+func checkArchivePassword(inputPath string, opts *models.ArchiveOptions) error {
+	if !hasArchiveKey(opts) && hasEncryptionHeader(inputPath) {
+		return errArchivePassword
+	}
+	return nil
+}
+
+// newEntryCipher returns the cipher used to open encrypted entries, or nil
+// when no password is set
+func newEntryCipher(opts *models.ArchiveOptions) (*crypto.EntryCipher, error) {
+	if opts.Password == "" {
+		return nil, nil
+	}
+	return crypto.NewEntryCipher(opts.Password)
+}
+
+// openEntry decrypts the content of an encrypted entry. name is the entry
+// name as stored in the archive, which the content was sealed under.
+func openEntry(c *crypto.EntryCipher, name string, r io.Reader) (io.Reader, error) {
+	if c == nil {
+		return nil, fmt.Errorf("%s: %w", name, errEntryPassword)
+	}
+	return c.Open(r, strings.TrimSuffix(name, "/"))
+}
+
+// checkSealedRename fails when e is still sealed and was renamed from
+// storedName: its content only opens under the name it was sealed with
+func checkSealedRename(e *archiveEntry, storedName string) error {
+	if e.Encrypted && e.Name != storedName {
+		return fmt.Errorf("%s: an encrypted entry cannot be renamed without the password", storedName)
+	}
+	return nil
+}
+
+// encryptedSuffix marks encrypted entries in listings
+func encryptedSuffix(encrypted bool) string {
+	if encrypted {
+		return " [encrypted]"
+	}
+	return ""
+}
+
+// zipExtraHas reports whether the zip extra data holds a field with id
+func zipExtraHas(extra []byte, id uint16) bool {
+	return zipExtraData(extra, id) != nil
+}
+
+// zipExtraField encodes an empty extra field with id
+func zipExtraField(id uint16) []byte {
+	field := make([]byte, 4)
+	binary.LittleEndian.PutUint16(field, id)
+	return field
+}
+
+// entryEncrypter seals the content of regular files whose names match one
+// of its patterns before passing them on, leaving everything else readable
+// without a password
+type entryEncrypter struct {
+	entryWriter
+	cipher   *crypto.EntryCipher
+	patterns []string
+}
+
+func newEntryEncrypter(ew entryWriter, opts *models.ArchiveOptions) (*entryEncrypter, error) {
+	c, err := crypto.NewEntryCipher(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &entryEncrypter{entryWriter: ew, cipher: c, patterns: opts.EncryptPattern}, nil
+}
+
+// WriteEntry writes e, sealing its content if its name matches
+func (w *entryEncrypter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	if r == nil || e.Encrypted || !matchesAny(w.patterns, e.Name) {
+		return w.entryWriter.WriteEntry(e, r)
+	}
+
+	// The sealed size is known up front, which tar headers need
+	sealed := *e
+	sealed.Info = &memFileInfo{
+		name:    e.Info.Name(),
+		size:    crypto.SealedSize(e.Info.Size()),
+		mode:    e.Info.Mode(),
+		modTime: e.Info.ModTime(),
+	}
+	sealed.Fragments = nil
+	sealed.Encrypted = true
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sealer, err := w.cipher.Seal(pw, e.Name)
+		if err == nil {
+			if _, err = copyPooled(sealer, r); err == nil {
+				err = sealer.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err := w.entryWriter.WriteEntry(&sealed, pr)
+	// Unblock the sealer if the writer stopped early, and wait so r is
+	// not read after returning
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+	return err
+}
@@ -0,0 +1,265 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// archiveEntry is a single archive member independent of its format
+type archiveEntry struct {
+	// Name is the slash-separated entry name without a trailing slash
+	Name string
+	// Info carries size, mode and modification time
+	Info os.FileInfo
+	// Linkname is the symlink target for symlink entries, or the member a
+	// tar hard link entry links to
+	Linkname string
+	// PAXRecords are extra tar records to store with the entry
+	PAXRecords map[string]string
+	// Fragments lists the data regions of a sparse file; nil stores the
+	// content as is
+	Fragments []sparseFragment
+	// Encrypted reports that the content is sealed with the archive
+	// password (see -encrypt-pattern); the size is that of the sealed data
+	Encrypted bool
+	// Owner, when set, replaces the owner taken from Info (see
+	// -attr-rules). Only tar stores owners.
+	Owner *entryOwner
+}
+
+// setPAXRecord records a PAX key/value pair for tar output
+func (e *archiveEntry) setPAXRecord(key, value string) {
+	if e.PAXRecords == nil {
+		e.PAXRecords = make(map[string]string)
+	}
+	e.PAXRecords[key] = value
+}
+
+// clone returns a copy of e that can be changed independently
+func (e *archiveEntry) clone() *archiveEntry {
+	c := *e
+	if e.PAXRecords != nil {
+		c.PAXRecords = maps.Clone(e.PAXRecords)
+	}
+	return &c
+}
+
+func (e *archiveEntry) isSymlink() bool {
+	return e.Info.Mode()&os.ModeSymlink != 0
+}
+
+// isHardLink reports whether the entry is a tar hard link to Linkname
+func (e *archiveEntry) isHardLink() bool {
+	return e.Linkname != "" && !e.isSymlink()
+}
+
+// entryFunc receives each entry of an archive. r streams the content of
+// regular files and is nil otherwise; it is only valid during the call.
+type entryFunc func(e *archiveEntry, r io.Reader) error
+
+// isMetadataEntry reports whether name is one of the entries gar adds for
+// its own use, the manifest and the tar.gz index. They are not part of the
+// archived tree, so extract, list and verify leave them out.
+func isMetadataEntry(name string) bool {
+	name = path.Clean(strings.TrimSuffix(name, "/"))
+	return name == manifestName || name == indexName
+}
+
+// forEachEntry iterates over the entries of the archive at inputPath,
+// leaving out metadata entries
+func forEachEntry(inputPath string, format models.ArchiveFormat, opts *models.ArchiveOptions, fn entryFunc) error {
+	return forEachArchiveEntry(inputPath, format, opts, func(e *archiveEntry, r io.Reader) error {
+		if isMetadataEntry(e.Name) {
+			return nil
+		}
+		return fn(e, r)
+	})
+}
+
+// forEachArchiveEntry iterates over every entry of the archive at
+// inputPath, metadata entries included
+func forEachArchiveEntry(inputPath string, format models.ArchiveFormat, opts *models.ArchiveOptions, fn entryFunc) error {
+	if err := checkArchivePassword(inputPath, opts); err != nil {
+		return err
+	}
+	if isTarFormat(format) {
+		return forEachTarEntry(inputPath, format, opts, fn)
+	}
+	if format == models.FormatSevenZip {
+		return forEachSevenZipEntry(inputPath, fn)
+	}
+	if archiveEncrypted(inputPath, opts) {
+		return forEachEncryptedZipEntry(inputPath, opts, fn)
+	}
+	return forEachZipEntry(inputPath, opts, fn)
+}
+
+// forEachEncryptedZipEntry decrypts the archive to a temporary file, since
+// zip needs random access, and iterates over its entries
+func forEachEncryptedZipEntry(inputPath string, opts *models.ArchiveOptions, fn entryFunc) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := crypto.NewEncryptedReader(file, opts.Password, opts.Keyfile)
+	if err != nil {
+		return err
+	}
+
+	tmpPath, err := NewOperator(opts).bufferToTemp(reader, "gar-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	return forEachZipEntry(tmpPath, opts, fn)
+}
+
+func forEachZipEntry(inputPath string, opts *models.ArchiveOptions, fn entryFunc) error {
+	zipReader, err := openZip(inputPath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	c, err := newEntryCipher(opts)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zipReader.File {
+		if err := visitZipEntry(f, c, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// visitZipEntry passes f to fn. Encrypted entries are decrypted when c is
+// set and passed through sealed otherwise.
+func visitZipEntry(f *zip.File, c *crypto.EntryCipher, fn entryFunc) error {
+	entry := &archiveEntry{
+		Name:      strings.TrimSuffix(f.Name, "/"),
+		Info:      f.FileInfo(),
+		Encrypted: zipExtraHas(f.Extra, zipExtraEncrypted),
+	}
+
+	if entry.Info.IsDir() {
+		return fn(entry, nil)
+	}
+
+	rc, err := openZipFile(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if entry.isSymlink() {
+		target, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		entry.Linkname = string(target)
+		return fn(entry, nil)
+	}
+
+	r, err := openSealedEntry(entry, c, rc)
+	if err != nil {
+		return err
+	}
+	if err := fn(entry, r); err != nil {
+		return err
+	}
+	return rc.Close()
+}
+
+// openSealedEntry decrypts the content of an encrypted entry when c is set,
+// updating e to describe the plaintext. Other entries are returned as is.
+func openSealedEntry(e *archiveEntry, c *crypto.EntryCipher, r io.Reader) (io.Reader, error) {
+	if !e.Encrypted || c == nil {
+		return r, nil
+	}
+
+	plain, err := c.Open(r, e.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Name, err)
+	}
+	e.Info = &memFileInfo{
+		name:    e.Info.Name(),
+		size:    crypto.OpenedSize(e.Info.Size()),
+		mode:    e.Info.Mode(),
+		modTime: e.Info.ModTime(),
+	}
+	e.Encrypted = false
+	return plain, nil
+}
+
+func forEachTarEntry(inputPath string, format models.ArchiveFormat, opts *models.ArchiveOptions, fn entryFunc) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if archiveEncrypted(inputPath, opts) {
+		reader, err = crypto.NewEncryptedReader(reader, opts.Password, opts.Keyfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	tarStream, err := decompressTar(reader, format, opts)
+	if err != nil {
+		return err
+	}
+	defer tarStream.Close()
+
+	c, err := newEntryCipher(opts)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(tarStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := &archiveEntry{
+			Name:       strings.TrimSuffix(header.Name, "/"),
+			Info:       header.FileInfo(),
+			Linkname:   header.Linkname,
+			PAXRecords: header.PAXRecords,
+			Encrypted:  header.PAXRecords[paxEncrypted] != "",
+		}
+		delete(entry.PAXRecords, paxEncrypted)
+
+		var r io.Reader
+		if header.Typeflag == tar.TypeReg {
+			if r, err = openSealedEntry(entry, c, tarReader); err != nil {
+				return err
+			}
+		}
+		if err := fn(entry, r); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// backupPatterns match editor backups and OS metadata files
+var backupPatterns = []string{
+	"*~",
+	".#*",
+	"#*#",
+	"*.swp",
+	".DS_Store",
+	"Thumbs.db",
+}
+
+// isExcluded reports whether the slash-separated entry name matches an
+// exclude pattern. Patterns without a slash match the base name at any
+// depth; patterns with a slash match the whole relative name.
+func isExcluded(opts *models.ArchiveOptions, name string) bool {
+	if matchesAny(opts.Exclude, name) {
+		return true
+	}
+	return opts.ExcludeBackups && matchesAny(backupPatterns, name)
+}
+
+// skipsEmpty reports whether fi is an empty regular file that SkipEmpty
+// leaves out; directories are always kept
+func skipsEmpty(opts *models.ArchiveOptions, fi os.FileInfo) bool {
+	return opts.SkipEmpty && fi.Mode().IsRegular() && fi.Size() == 0
+}
+
+func matchesAny(patterns []string, name string) bool {
+	base := path.Base(name)
+	for _, pattern := range patterns {
+		target := base
+		if strings.Contains(pattern, "/") {
+			target = name
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
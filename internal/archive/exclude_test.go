@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestIsExcluded(t *testing.T) {
+	backups := &models.ArchiveOptions{ExcludeBackups: true}
+	patterns := &models.ArchiveOptions{Exclude: []string{"*.log", "build/*", "tmp"}}
+
+	tests := []struct {
+		opts *models.ArchiveOptions
+		name string
+		want bool
+	}{
+		{backups, "notes.txt~", true},
+		{backups, "dir/.#notes.txt", true},
+		{backups, "#notes.txt#", true},
+		{backups, "dir/.notes.txt.swp", true},
+		{backups, "a/b/.DS_Store", true},
+		{backups, "Thumbs.db", true},
+		{backups, "notes.txt", false},
+		{backups, "#notes.txt", false},
+		{backups, "swp", false},
+		{backups, "thumbs.db.txt", false},
+		{patterns, "app.log", true},
+		{patterns, "dir/app.log", true},
+		{patterns, "build/out", true},
+		{patterns, "src/build/out", false},
+		{patterns, "tmp", true},
+		{patterns, "dir/tmp", true},
+		{patterns, "notes.txt~", false},
+		{&models.ArchiveOptions{}, "notes.txt~", false},
+	}
+	for _, tt := range tests {
+		if got := isExcluded(tt.opts, tt.name); got != tt.want {
+			t.Errorf("isExcluded(backups %v, exclude %q, %q) = %v, want %v", tt.opts.ExcludeBackups, tt.opts.Exclude, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExcludeBackups(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"main.go":             "package main",
+		"main.go~":            "old",
+		".#main.go":           "lock",
+		"#main.go#":           "autosave",
+		".main.go.swp":        "swap",
+		".DS_Store":           "finder",
+		"docs/Thumbs.db":      "thumbs",
+		"docs/readme.md":      "readme",
+		"docs/.readme.md.swp": "swap",
+	})
+
+	want := []string{".", "docs", "docs/readme.md", "main.go"}
+	if got := archivedNames(t, src, models.ArchiveOptions{ExcludeBackups: true}); !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if got := archivedNames(t, src, models.ArchiveOptions{}); len(got) != 11 {
+		t.Errorf("without -exclude-backups: %d entries, want all 11", len(got))
+	}
+}
+
+func TestSkipEmpty(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"a.txt":       "alpha",
+		"empty.txt":   "",
+		"sub/b.txt":   "beta",
+		"sub/nil.txt": "",
+	})
+	// Empty directories are still archived
+	if err := os.Mkdir(filepath.Join(src, "vacant"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{".", "a.txt", "sub", "sub/b.txt", "vacant"}
+	if got := archivedNames(t, src, models.ArchiveOptions{SkipEmpty: true}); !slices.Equal(got, want) {
+		t.Errorf("tar.gz entries = %q, want %q", got, want)
+	}
+
+	output := filepath.Join(t.TempDir(), "out.zip")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatZip, SkipEmpty: true}).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	want = []string{"./", "a.txt", "sub/", "sub/b.txt", "vacant/"}
+	if !slices.Equal(names, want) {
+		t.Errorf("zip entries = %q, want %q", names, want)
+	}
+
+	all := archivedNames(t, src, models.ArchiveOptions{})
+	if !slices.Contains(all, "empty.txt") || !slices.Contains(all, "sub/nil.txt") {
+		t.Errorf("without -skip-empty, entries = %q, want the empty files too", all)
+	}
+}
@@ -0,0 +1,224 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// safeDestPath joins name onto outputPath and rejects names that would
+// resolve outside of outputPath (path traversal). Symlinks already on disk
+// are followed as the kernel would follow them when the entry is written,
+// so a link extracted earlier cannot redirect a later entry out of the
+// extraction directory.
+func safeDestPath(outputPath, name string) (string, error) {
+	destPath := filepath.Join(outputPath, name)
+
+	// Convert both paths to absolute to handle relative paths like "." correctly
+	absDestPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination path: %s", name)
+	}
+	absOutputPath, err := filepath.Abs(outputPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid output path: %s", outputPath)
+	}
+	if !isWithin(absOutputPath, absDestPath) {
+		return "", fmt.Errorf("illegal file path: %s", name)
+	}
+	if absDestPath == absOutputPath {
+		return destPath, nil
+	}
+
+	// The entry itself replaces whatever is at destPath, so only the
+	// directories leading to it are resolved
+	root, err := resolvePath(absOutputPath)
+	if err != nil {
+		return "", err
+	}
+	parent, err := resolvePath(filepath.Dir(absDestPath))
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(root, filepath.Join(parent, filepath.Base(absDestPath))) {
+		return "", fmt.Errorf("illegal file path: %s: a symlink leads outside the extraction directory", name)
+	}
+
+	return destPath, nil
+}
+
+// maxLinkHops bounds the symlinks followed while resolving a path, as the
+// kernel's ELOOP limit does
+const maxLinkHops = 40
+
+// resolvePath resolves the symlinks along the absolute path as far as it
+// exists on disk, the way the kernel does when opening it: each ".." is
+// applied to the directory reached so far, not to the text of the path.
+// Components that do not exist yet are taken as they are.
+func resolvePath(path string) (string, error) {
+	hops := 0
+	return resolvePathHops(path, &hops)
+}
+
+func resolvePathHops(path string, hops *int) (string, error) {
+	volume := filepath.VolumeName(path)
+	resolved := volume + string(filepath.Separator)
+	for _, part := range strings.Split(filepath.ToSlash(path[len(volume):]), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(next)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		*hops++
+		if *hops > maxLinkHops {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			// Joined without cleaning, so ".." in the target is resolved
+			// against the directory it leads to
+			target = resolved + string(filepath.Separator) + target
+		}
+		if resolved, err = resolvePathHops(target, hops); err != nil {
+			return "", err
+		}
+	}
+	return resolved, nil
+}
+
+// createDestFile creates or truncates the regular file destPath. Unless
+// opts.AllowSymlinkOverwrite is set, a symlink already at destPath is
+// removed first, so the write replaces the link instead of following it to
+// whatever file it points at.
+func createDestFile(destPath string, mode os.FileMode, opts *models.ArchiveOptions) (*os.File, error) {
+	if !opts.AllowSymlinkOverwrite {
+		if fi, err := os.Lstat(destPath); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(destPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Shared writable mappings need the file open for reading too
+	flag := os.O_WRONLY
+	if opts.Mmap {
+		flag = os.O_RDWR
+	}
+	return os.OpenFile(destPath, flag|os.O_CREATE|os.O_TRUNC, umasked(mode, opts))
+}
+
+// umasked clears the permission bits of opts.Umask from an extracted
+// file's or directory's mode. The process umask still applies on top when
+// files and directories are created.
+func umasked(mode os.FileMode, opts *models.ArchiveOptions) os.FileMode {
+	return mode &^ opts.Umask
+}
+
+// checkLinkTarget rejects symlink targets that are absolute or that resolve
+// outside of outputPath when followed from destPath, including through
+// symlinks already extracted
+func checkLinkTarget(outputPath, destPath, target string) error {
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return fmt.Errorf("unsafe symlink %s -> %s: absolute target", destPath, target)
+	}
+
+	absOutputPath, err := filepath.Abs(outputPath)
+	if err != nil {
+		return fmt.Errorf("invalid output path: %s", outputPath)
+	}
+	absDestPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return fmt.Errorf("invalid destination path: %s", destPath)
+	}
+
+	if !isWithin(absOutputPath, filepath.Join(filepath.Dir(absDestPath), target)) {
+		return fmt.Errorf("unsafe symlink %s -> %s: target escapes extraction directory", destPath, target)
+	}
+
+	root, err := resolvePath(absOutputPath)
+	if err != nil {
+		return err
+	}
+	parent, err := resolvePath(filepath.Dir(absDestPath))
+	if err != nil {
+		return err
+	}
+	resolved, err := resolvePath(parent + string(filepath.Separator) + target)
+	if err != nil {
+		return fmt.Errorf("unsafe symlink %s -> %s: %w", destPath, target, err)
+	}
+	if !isWithin(root, resolved) {
+		return fmt.Errorf("unsafe symlink %s -> %s: target escapes extraction directory", destPath, target)
+	}
+
+	return nil
+}
+
+// linkTargets maps the stored names of the files an extraction has
+// written to their names after the entry filter, so a hard link follows
+// its target through -transform and can only point at a file extracted in
+// the same run
+type linkTargets map[string]string
+
+// add records that the entry stored as stored was written as name
+func (lt linkTargets) add(stored, name string) {
+	lt[path.Clean(stored)] = name
+}
+
+// remove forgets stored once a later entry of another type replaces it
+func (lt linkTargets) remove(stored string) {
+	delete(lt, path.Clean(stored))
+}
+
+// resolve returns the extracted name of the hard link target linkname
+func (lt linkTargets) resolve(linkname, destPath string) (string, error) {
+	name, ok := lt[path.Clean(linkname)]
+	if !ok {
+		return "", fmt.Errorf("hard link %s -> %s: target was not extracted", destPath, linkname)
+	}
+	return name, nil
+}
+
+// createHardLink recreates destPath as a hard link to the regular file
+// extracted as name, which must still lie within outputPath. A file at
+// destPath is replaced.
+func createHardLink(outputPath, name, destPath string, opts *models.ArchiveOptions) error {
+	targetPath, err := safeDestPath(outputPath, name)
+	if err != nil {
+		return fmt.Errorf("unsafe hard link %s -> %s: target escapes extraction directory", destPath, name)
+	}
+	if fi, err := os.Lstat(targetPath); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("hard link %s -> %s: target is not a regular file", destPath, name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), umasked(0755, opts)); err != nil {
+		return err
+	}
+	if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(targetPath, destPath)
+}
+
+// isWithin reports whether path is root or lies beneath it. Both paths must
+// be absolute and clean.
+func isWithin(root, path string) bool {
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
@@ -0,0 +1,613 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// tarMember describes one entry of a test archive
+type tarMember struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+// writeTarGz writes members to a tar.gz in dir and returns its path
+func writeTarGz(t *testing.T, dir string, members []tarMember) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, m := range members {
+		typeflag := m.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		header := &tar.Header{
+			Name:     m.name,
+			Typeflag: typeflag,
+			Linkname: m.linkname,
+			Mode:     0644,
+			Size:     int64(len(m.body)),
+			ModTime:  time.Unix(1700000000, 0),
+		}
+		if typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(m.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "test.tar.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSafeDestPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "away")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(".", filepath.Join(root, "self")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"file.txt", true},
+		{"dir/file.txt", true},
+		{"self/file.txt", true},
+		{"self/self/file.txt", true},
+		{".", true},
+		{"../escape.txt", false},
+		{"dir/../../escape.txt", false},
+		{"away/file.txt", false},
+		{"self/away/file.txt", false},
+		// The last component is replaced, not followed
+		{"away", true},
+	}
+	for _, tt := range tests {
+		_, err := safeDestPath(root, tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("safeDestPath(%q) error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckLinkTarget(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink(".", filepath.Join(root, "d")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dest   string
+		target string
+		ok     bool
+	}{
+		{"link", "file.txt", true},
+		{"sub/link", "../file.txt", true},
+		{"link", "/etc/passwd", false},
+		{"link", "../../outside", false},
+		{"sub/link", "../../outside", false},
+		// d resolves to the root, so d/e -> .. leaves it
+		{"d/e", "..", false},
+		{"d/e", ".", true},
+	}
+	for _, tt := range tests {
+		err := checkLinkTarget(root, filepath.Join(root, tt.dest), tt.target)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkLinkTarget(%q -> %q) error = %v, want ok %v", tt.dest, tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestResolvePathLoop(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink("b", filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolvePath(filepath.Join(root, "a", "x")); err == nil {
+		t.Fatal("resolvePath followed a symlink loop without error")
+	}
+}
+
+// TestExtractSymlinkChain extracts d -> ., then d/e -> .., then
+// e/escaped.txt: each step looks harmless by name alone, but together they
+// would write above the output directory
+func TestExtractSymlinkChain(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTarGz(t, dir, []tarMember{
+		{name: "d", typeflag: tar.TypeSymlink, linkname: "."},
+		{name: "d/e", typeflag: tar.TypeSymlink, linkname: ".."},
+		{name: "e/escaped.txt", body: "escaped"},
+	})
+
+	output := filepath.Join(dir, "out", "x")
+	err := NewOperator(&models.ArchiveOptions{}).Extract(input, output)
+	if err == nil {
+		t.Fatal("extract succeeded; want the symlink chain rejected")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out", "escaped.txt")); err == nil {
+		t.Fatal("escaped.txt was written outside the output directory")
+	}
+}
+
+func TestExtractRejectsUnsafeSymlinks(t *testing.T) {
+	for _, target := range []string{"/etc/passwd", "../../outside"} {
+		dir := t.TempDir()
+		input := writeTarGz(t, dir, []tarMember{
+			{name: "link", typeflag: tar.TypeSymlink, linkname: target},
+		})
+
+		err := NewOperator(&models.ArchiveOptions{}).Extract(input, filepath.Join(dir, "out"))
+		if err == nil || !strings.Contains(err.Error(), "unsafe symlink") {
+			t.Errorf("symlink to %s: error = %v, want unsafe symlink", target, err)
+		}
+	}
+}
+
+func TestExtractSafeSymlink(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTarGz(t, dir, []tarMember{
+		{name: "data/file.txt", body: "content"},
+		{name: "link", typeflag: tar.TypeSymlink, linkname: "data/file.txt"},
+	})
+
+	output := filepath.Join(dir, "out")
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(filepath.Join(output, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "data/file.txt" {
+		t.Errorf("link target = %q, want data/file.txt", target)
+	}
+}
+
+// renameTop is the EntryFilter of -transform='s,^top/,new/,'
+func renameTop(e models.Entry) (bool, string) {
+	if rest, ok := strings.CutPrefix(e.Name, "top/"); ok {
+		return true, "new/" + rest
+	}
+	return true, ""
+}
+
+func TestExtractReplacesPlantedSymlink(t *testing.T) {
+	inputs := map[string]func(dir string) string{
+		"zip": func(dir string) string {
+			return writeZipFile(t, dir, map[string]string{"a.txt": "archived"}, []string{"a.txt"})
+		},
+		"tar.gz": func(dir string) string {
+			return writeTarGz(t, dir, []tarMember{{name: "a.txt", body: "archived"}})
+		},
+	}
+	for name, input := range inputs {
+		for _, allow := range []bool{false, true} {
+			dir := t.TempDir()
+			victim := writeFile(t, dir, "victim.txt", []byte("precious"))
+			output := filepath.Join(dir, "out")
+			if err := os.MkdirAll(output, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(victim, filepath.Join(output, "a.txt")); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := &models.ArchiveOptions{AllowSymlinkOverwrite: allow}
+			if err := NewOperator(opts).Extract(input(dir), output); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			got, err := os.ReadFile(victim)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Lstat(filepath.Join(output, "a.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allow {
+				// The old behavior writes through the link
+				if string(got) != "archived" || fi.Mode()&os.ModeSymlink == 0 {
+					t.Errorf("%s -allow-symlink-overwrite: target %q, link mode %v", name, got, fi.Mode())
+				}
+				continue
+			}
+			if string(got) != "precious" {
+				t.Errorf("%s: symlink target changed to %q", name, got)
+			}
+			if !fi.Mode().IsRegular() {
+				t.Errorf("%s: a.txt has mode %v, want a regular file", name, fi.Mode())
+			}
+		}
+	}
+}
+
+func TestExtractHardLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []tarMember
+		filter  models.EntryFilter
+		link    string
+		target  string
+		wantErr string
+	}{
+		{
+			name: "plain",
+			members: []tarMember{
+				{name: "top/a.txt", body: "content"},
+				{name: "top/b.txt", typeflag: tar.TypeLink, linkname: "top/a.txt"},
+			},
+			link:   "top/b.txt",
+			target: "top/a.txt",
+		},
+		{
+			name: "transformed",
+			members: []tarMember{
+				{name: "top/a.txt", body: "content"},
+				{name: "top/b.txt", typeflag: tar.TypeLink, linkname: "top/a.txt"},
+			},
+			filter: renameTop,
+			link:   "new/b.txt",
+			target: "new/a.txt",
+		},
+		{
+			name: "link to a link",
+			members: []tarMember{
+				{name: "./a.txt", body: "content"},
+				{name: "b.txt", typeflag: tar.TypeLink, linkname: "a.txt"},
+				{name: "c.txt", typeflag: tar.TypeLink, linkname: "./b.txt"},
+			},
+			link:   "c.txt",
+			target: "a.txt",
+		},
+		{
+			name: "target not in archive",
+			members: []tarMember{
+				{name: "b.txt", typeflag: tar.TypeLink, linkname: "a.txt"},
+			},
+			wantErr: "target was not extracted",
+		},
+		{
+			name: "target filtered out",
+			members: []tarMember{
+				{name: "a.txt", body: "content"},
+				{name: "b.txt", typeflag: tar.TypeLink, linkname: "a.txt"},
+			},
+			filter: func(e models.Entry) (bool, string) {
+				return e.Name != "a.txt", ""
+			},
+			wantErr: "target was not extracted",
+		},
+		{
+			name: "target outside the archive root",
+			members: []tarMember{
+				{name: "b.txt", typeflag: tar.TypeLink, linkname: "../outside.txt"},
+			},
+			wantErr: "target was not extracted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "outside.txt"), []byte("outside"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			input := writeTarGz(t, dir, tt.members)
+			output := filepath.Join(dir, "out")
+
+			err := NewOperator(&models.ArchiveOptions{EntryFilter: tt.filter}).Extract(input, output)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			link, err := os.Stat(filepath.Join(output, tt.link))
+			if err != nil {
+				t.Fatal(err)
+			}
+			target, err := os.Stat(filepath.Join(output, tt.target))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(link, target) {
+				t.Errorf("%s is not a hard link to %s", tt.link, tt.target)
+			}
+		})
+	}
+}
+
+// TestArchiveHardLinks checks that a second name of a file is archived as
+// a tar hard link and comes back as a link to the first, while zip, which
+// has no hard links, stores the content twice
+func TestArchiveHardLinks(t *testing.T) {
+	src := writeTestTree(t, map[string]string{"a.txt": "shared content", "single.txt": "single"})
+	if err := os.Mkdir(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "sub", "b.txt")); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+
+	for _, format := range []models.ArchiveFormat{models.FormatTarGz, models.FormatTar, models.FormatZip} {
+		t.Run(formatName(format), func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "out"+GetExtension(format))
+			if err := NewOperator(&models.ArchiveOptions{Format: format, Manifest: true}).Compress(src, input); err != nil {
+				t.Fatal(err)
+			}
+			if format == models.FormatTarGz {
+				headers := readTarGzHeaders(t, input)
+				link := headers["sub/b.txt"]
+				if link == nil || link.Typeflag != tar.TypeLink || strings.TrimPrefix(link.Linkname, "./") != "a.txt" || link.Size != 0 {
+					t.Fatalf("sub/b.txt header = %+v, want a hard link to a.txt", link)
+				}
+				if headers["single.txt"].Typeflag != tar.TypeReg {
+					t.Errorf("single.txt has type %q, want a regular file", headers["single.txt"].Typeflag)
+				}
+			}
+			captureStdout(t, func() error {
+				return NewOperator(&models.ArchiveOptions{}).Verify(input)
+			})
+
+			output := filepath.Join(dir, "out")
+			if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"a.txt": "shared content", "sub/b.txt": "shared content", "single.txt": "single"}
+			if got := readTree(t, output); !maps.Equal(got, want) {
+				t.Errorf("extracted %v, want %v", got, want)
+			}
+			a, err := os.Stat(filepath.Join(output, "a.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.Stat(filepath.Join(output, "sub", "b.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked := os.SameFile(a, b); linked != isTarFormat(format) {
+				t.Errorf("sub/b.txt linked to a.txt: %v, want %v", linked, isTarFormat(format))
+			}
+		})
+	}
+}
+
+func TestPlanExtractHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTarGz(t, dir, []tarMember{
+		{name: "top/a.txt", body: "content"},
+		{name: "top/b.txt", typeflag: tar.TypeLink, linkname: "top/a.txt"},
+	})
+	output := filepath.Join(dir, "out")
+
+	var buf bytes.Buffer
+	op := NewOperator(&models.ArchiveOptions{EntryFilter: renameTop})
+	if err := op.planExtract(input, output, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "would link: " + filepath.Join(output, "new/b.txt") + " -> new/a.txt"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("plan = %q, want it to contain %q", buf.String(), want)
+	}
+
+	input = writeTarGz(t, dir, []tarMember{
+		{name: "b.txt", typeflag: tar.TypeLink, linkname: "a.txt"},
+	})
+	if err := op.planExtract(input, output, &buf); err == nil {
+		t.Error("plan succeeded; want the link to a missing target rejected")
+	}
+}
+
+func FuzzSafeDestPath(f *testing.F) {
+	for _, seed := range []string{"a/b", "../x", "a/../../x", "/etc/passwd", "a/./b/..", ""} {
+		f.Add(seed)
+	}
+	root := f.TempDir()
+	f.Fuzz(func(t *testing.T, name string) {
+		destPath, err := safeDestPath(root, name)
+		if err != nil {
+			return
+		}
+		abs, err := filepath.Abs(destPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isWithin(root, abs) {
+			t.Fatalf("safeDestPath(%q) = %s, outside %s", name, destPath, root)
+		}
+	})
+}
+
+func TestExtractDuplicateNamesLastWins(t *testing.T) {
+	// Enough other entries that a zip would otherwise use the worker pool
+	var names, bodies []string
+	names, bodies = append(names, "dup.txt"), append(bodies, "first")
+	for i := 0; i < 2*serialMaxEntries; i++ {
+		names, bodies = append(names, fmt.Sprintf("f%02d.txt", i)), append(bodies, "filler")
+	}
+	names, bodies = append(names, "dup.txt"), append(bodies, "last")
+
+	writeZip := func(t *testing.T, dir string) string {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for i, name := range names {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(bodies[i])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return writeFile(t, dir, "dup.zip", buf.Bytes())
+	}
+	writeTar := func(t *testing.T, dir string) string {
+		members := make([]tarMember, len(names))
+		for i, name := range names {
+			members[i] = tarMember{name: name, body: bodies[i]}
+		}
+		return writeTarGz(t, dir, members)
+	}
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		for _, preserveOrder := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/preserve-order=%v", format, preserveOrder), func(t *testing.T) {
+				// Repeat so a race between workers would show up
+				for run := 0; run < 5; run++ {
+					dir := t.TempDir()
+					input := writeTar(t, dir)
+					if format == "zip" {
+						input = writeZip(t, dir)
+					}
+					output := filepath.Join(dir, "out")
+
+					opts := &models.ArchiveOptions{Workers: 8, PreserveOrder: preserveOrder}
+					if err := NewOperator(opts).Extract(input, output); err != nil {
+						t.Fatal(err)
+					}
+					data, err := os.ReadFile(filepath.Join(output, "dup.txt"))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if string(data) != "last" {
+						t.Fatalf("run %d: dup.txt = %q, want %q", run, data, "last")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestExtractLateDirectoryEntry(t *testing.T) {
+	dirTime := time.Unix(1600000000, 0)
+	type member struct {
+		name string
+		mode os.FileMode
+		body string
+	}
+	// The directory entry, read-only and with an old time, comes between
+	// files inside it
+	members := []member{
+		{name: "dir/a.txt", mode: 0644, body: "alpha"},
+		{name: "dir/", mode: os.ModeDir | 0555},
+		{name: "dir/b.txt", mode: 0644, body: "beta"},
+	}
+
+	writeTar := func(t *testing.T, dir string) string {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for _, m := range members {
+			header := &tar.Header{Name: m.name, Typeflag: tar.TypeReg, Mode: int64(m.mode.Perm()), Size: int64(len(m.body)), ModTime: time.Unix(1700000000, 0)}
+			if m.mode.IsDir() {
+				header.Typeflag, header.ModTime = tar.TypeDir, dirTime
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(m.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return writeFile(t, dir, "late.tar.gz", buf.Bytes())
+	}
+	writeZip := func(t *testing.T, dir string) string {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, m := range members {
+			header := &zip.FileHeader{Name: m.name, Method: zip.Deflate, Modified: time.Unix(1700000000, 0)}
+			if m.mode.IsDir() {
+				header.Modified = dirTime
+			}
+			header.SetMode(m.mode)
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(m.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return writeFile(t, dir, "late.zip", buf.Bytes())
+	}
+
+	for format, write := range map[string]func(*testing.T, string) string{"tar.gz": writeTar, "zip": writeZip} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			input := write(t, dir)
+			output := filepath.Join(dir, "out")
+			t.Cleanup(func() { os.Chmod(filepath.Join(output, "dir"), 0755) })
+
+			if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+				t.Fatal(err)
+			}
+			got := readTree(t, output)
+			if got["dir/a.txt"] != "alpha" || got["dir/b.txt"] != "beta" {
+				t.Errorf("extracted %v", got)
+			}
+			fi, err := os.Stat(filepath.Join(output, "dir"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Writing b.txt would have changed both had they been set early
+			if fi.Mode().Perm() != 0555 {
+				t.Errorf("dir mode = %o, want 555", fi.Mode().Perm())
+			}
+			if !fi.ModTime().Equal(dirTime) {
+				t.Errorf("dir time = %v, want %v", fi.ModTime(), dirTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+//go:build linux
+
+package archive
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocateFile reserves size bytes of disk space for f and extends it to
+// that size, so that writes through a mapping of it cannot run out of space
+// and raise SIGBUS
+func allocateFile(f *os.File, size int64) error {
+	return unix.Fallocate(int(f.Fd()), 0, 0, size)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package archive
+
+import (
+	"errors"
+	"os"
+)
+
+// allocateFile cannot reserve disk space on this platform. Truncate would
+// leave a sparse file whose mapped writes raise SIGBUS once the disk is
+// full, so -mmap copies normally instead.
+func allocateFile(*os.File, int64) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,102 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// paxFileFlags is the PAX record for file flags (chflags/chattr), as
+// written by libarchive: a comma-separated list of flag names
+const paxFileFlags = "SCHILY.fflags"
+
+// fileFlag names one platform flag bit
+type fileFlag struct {
+	name string
+	bit  uint32
+}
+
+var fileFlagsWarning sync.Once
+
+// warnFileFlagsUnsupported notes once that file flags are skipped on this
+// platform
+func warnFileFlagsUnsupported() {
+	fileFlagsWarning.Do(func() {
+		fmt.Fprintln(os.Stderr, "Warning: -preserve-flags is not supported on this platform; file flags are ignored")
+	})
+}
+
+// formatFileFlags names the known flags set in bits
+func formatFileFlags(bits uint32) string {
+	var names []string
+	for _, f := range fileFlagTable {
+		if bits&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parseFileFlags returns the bits of the flags named in value. Names this
+// platform does not know are ignored.
+func parseFileFlags(value string) uint32 {
+	var bits uint32
+	for _, name := range strings.Split(value, ",") {
+		for _, f := range fileFlagTable {
+			if f.name == strings.TrimSpace(name) {
+				bits |= f.bit
+			}
+		}
+	}
+	return bits
+}
+
+// knownFileFlags is the mask of every flag in fileFlagTable
+func knownFileFlags() uint32 {
+	var mask uint32
+	for _, f := range fileFlagTable {
+		mask |= f.bit
+	}
+	return mask
+}
+
+// storeFileFlags records the flags of path in e, if any are set
+func storeFileFlags(path string, e *archiveEntry) error {
+	bits, err := readFileFlags(path)
+	if err != nil {
+		return fmt.Errorf("read flags of %s: %w", path, err)
+	}
+	if bits != 0 {
+		e.setPAXRecord(paxFileFlags, formatFileFlags(bits))
+	}
+	return nil
+}
+
+// pendingFileFlags collects the flags to restore once extraction is done.
+// Flags such as immutable would otherwise stop later entries (or the file's
+// own mode and times) from being written.
+type pendingFileFlags struct {
+	paths []string
+	flags []uint32
+}
+
+// add queues the flags named in value for path
+func (p *pendingFileFlags) add(path, value string) {
+	if bits := parseFileFlags(value); bits != 0 {
+		p.paths = append(p.paths, path)
+		p.flags = append(p.flags, bits)
+	}
+}
+
+// apply sets the queued flags, children before their directories. Flags
+// that cannot be set (e.g. without the privilege immutable flags need) are
+// reported as warnings.
+func (p *pendingFileFlags) apply() {
+	for i := len(p.paths) - 1; i >= 0; i-- {
+		if err := writeFileFlags(p.paths[i], p.flags[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot restore flags on %s: %v\n", p.paths[i], err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build darwin || freebsd || netbsd || openbsd
+
+package archive
+
+import "golang.org/x/sys/unix"
+
+// File flags from sys/stat.h, shared by macOS and the BSDs
+const (
+	ufNodump    = 0x00000001
+	ufImmutable = 0x00000002
+	ufAppend    = 0x00000004
+	sfImmutable = 0x00020000
+	sfAppend    = 0x00040000
+)
+
+// fileFlagTable maps file flags to their chflags names
+var fileFlagTable = []fileFlag{
+	{"nodump", ufNodump},
+	{"uchg", ufImmutable},
+	{"uappnd", ufAppend},
+	{"schg", sfImmutable},
+	{"sappnd", sfAppend},
+}
+
+// readFileFlags returns the known file flags of path
+func readFileFlags(path string) (uint32, error) {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return 0, err
+	}
+	return uint32(st.Flags) & knownFileFlags(), nil
+}
+
+// writeFileFlags sets the known file flags of path to bits, keeping any
+// others
+func writeFileFlags(path string, bits uint32) error {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return err
+	}
+	return unix.Chflags(path, int(uint32(st.Flags)&^knownFileFlags()|bits))
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package archive
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// Inode flags from linux/fs.h, as read and set by lsattr and chattr
+const (
+	fsImmutableFl = 0x00000010
+	fsAppendFl    = 0x00000020
+	fsNodumpFl    = 0x00000040
+	fsNoatimeFl   = 0x00000080
+)
+
+// fileFlagTable maps inode flags to the names libarchive uses for them
+var fileFlagTable = []fileFlag{
+	{"schg", fsImmutableFl},
+	{"sappnd", fsAppendFl},
+	{"nodump", fsNodumpFl},
+	{"noatime", fsNoatimeFl},
+}
+
+// readFileFlags returns the known inode flags of path. Filesystems without
+// inode flags report none.
+func readFileFlags(path string) (uint32, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer unix.Close(fd)
+
+	bits, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+	if errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EINVAL) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return bits & knownFileFlags(), nil
+}
+
+// writeFileFlags sets the known inode flags of path to bits, keeping
+// flags the filesystem manages itself (such as extents)
+func writeFileFlags(path string, bits uint32) error {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	current, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		return err
+	}
+	return unix.IoctlSetPointerInt(fd, unix.FS_IOC_SETFLAGS, int(current&^knownFileFlags()|bits))
+}
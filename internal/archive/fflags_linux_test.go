@@ -0,0 +1,93 @@
+//go:build linux
+
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestFileFlagsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	want := map[string]uint32{"nodump.txt": fsNodumpFl, "immutable.txt": fsImmutableFl, "plain.txt": 0}
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name := range want {
+		writeFile(t, src, name, []byte(name))
+	}
+
+	// Flagged files must be cleared before the temporary directory can go
+	var flagged []string
+	t.Cleanup(func() {
+		for _, p := range flagged {
+			writeFileFlags(p, 0)
+		}
+	})
+	setFlags := func(p string, bits uint32) error {
+		err := writeFileFlags(p, bits)
+		if err == nil {
+			flagged = append(flagged, p)
+		}
+		return err
+	}
+
+	if err := setFlags(filepath.Join(src, "nodump.txt"), fsNodumpFl); err != nil {
+		if errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+			t.Skipf("the filesystem has no inode flags: %v", err)
+		}
+		t.Fatal(err)
+	}
+	// Immutable needs CAP_LINUX_IMMUTABLE; without it only nodump is checked
+	if err := setFlags(filepath.Join(src, "immutable.txt"), fsImmutableFl); err != nil {
+		if !errors.Is(err, unix.EPERM) {
+			t.Fatal(err)
+		}
+		t.Logf("immutable flag not permitted: %v", err)
+		want["immutable.txt"] = 0
+	}
+
+	output := filepath.Join(dir, "out.tar.gz")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatTarGz, PreserveFlags: true}).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	headers := readTarGzHeaders(t, output)
+	for name, bits := range want {
+		if got := headers[name].PAXRecords[paxFileFlags]; got != formatFileFlags(bits) {
+			t.Errorf("%s: %s = %q, want %q", name, paxFileFlags, got, formatFileFlags(bits))
+		}
+	}
+
+	for _, preserve := range []bool{false, true} {
+		extracted := filepath.Join(dir, "out")
+		if preserve {
+			extracted += "-flags"
+		}
+		if err := NewOperator(&models.ArchiveOptions{PreserveFlags: preserve}).Extract(output, extracted); err != nil {
+			t.Fatal(err)
+		}
+		for name, bits := range want {
+			p := filepath.Join(extracted, name)
+			got, err := readFileFlags(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != 0 {
+				flagged = append(flagged, p)
+			}
+			if !preserve {
+				bits = 0
+			}
+			if got != bits {
+				t.Errorf("-preserve-flags=%v: %s has flags %q, want %q", preserve, name, formatFileFlags(got), formatFileFlags(bits))
+			}
+		}
+	}
+}
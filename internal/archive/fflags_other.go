@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package archive
+
+// fileFlagTable is empty: file flags are unsupported on this platform
+var fileFlagTable []fileFlag
+
+// readFileFlags is unsupported on this platform
+func readFileFlags(string) (uint32, error) {
+	warnFileFlagsUnsupported()
+	return 0, nil
+}
+
+// writeFileFlags is unsupported on this platform
+func writeFileFlags(string, uint32) error {
+	warnFileFlagsUnsupported()
+	return nil
+}
@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// formatTree is the directory tree the format round trips archive
+var formatTree = map[string]string{
+	"a.txt":            "alpha",
+	"docs/readme.md":   strings.Repeat("readme line\n", 500),
+	"docs/deep/b.bin":  string([]byte{0, 1, 2, 255, 254}),
+	"docs/deep/empty":  "",
+	"src/main.go":      "package main\n",
+	"src/main_test.go": "package main\n",
+}
+
+// formatLevels names the compression presets
+var formatLevels = map[string]models.CompressionLevel{
+	"fastest": models.LevelFastest,
+	"normal":  models.LevelNormal,
+	"best":    models.LevelBest,
+}
+
+// roundTrip compresses formatTree plus an empty directory with opts,
+// extracts the result and checks that both came back
+func roundTrip(t *testing.T, opts models.ArchiveOptions) {
+	t.Helper()
+	src := writeTestTree(t, formatTree)
+	if err := os.Mkdir(filepath.Join(src, "vacant"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	input := filepath.Join(t.TempDir(), "out"+GetExtension(opts.Format))
+	if err := NewOperator(&opts).Compress(src, input); err != nil {
+		t.Fatal(err)
+	}
+	if got := detectFormat(input, &models.ArchiveOptions{}); got != opts.Format {
+		t.Errorf("%s detected as %s", filepath.Base(input), formatName(got))
+	}
+
+	output := filepath.Join(t.TempDir(), "out")
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, output); !maps.Equal(got, formatTree) {
+		t.Errorf("extracted %v, want %v", got, formatTree)
+	}
+	if fi, err := os.Stat(filepath.Join(output, "vacant")); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory not restored: %v", err)
+	}
+}
+
+func TestTarZstdRoundTrip(t *testing.T) {
+	for name, level := range formatLevels {
+		t.Run(name, func(t *testing.T) {
+			roundTrip(t, models.ArchiveOptions{Format: models.FormatTarZstd, CompressionLevel: level})
+		})
+	}
+}
+
+// TestTarRoundTrip checks that plain tar restores the tree and that the
+// archive is a bare tar stream holding the directories, with no gzip layer
+func TestTarRoundTrip(t *testing.T) {
+	if got := ParseFormat("tar"); got != models.FormatTar {
+		t.Fatalf("ParseFormat(tar) = %s", formatName(got))
+	}
+	roundTrip(t, models.ArchiveOptions{Format: models.FormatTar})
+
+	src := writeTestTree(t, formatTree)
+	input := filepath.Join(t.TempDir(), "out.tar")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatTar}).Compress(src, input); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	types := make(map[string]byte)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("not a bare tar stream: %v", err)
+		}
+		types[strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "./"), "/")] = hdr.Typeflag
+	}
+	for _, dir := range []string{"docs", "docs/deep", "src"} {
+		if types[dir] != tar.TypeDir {
+			t.Errorf("%s has type %q, want a directory entry", dir, types[dir])
+		}
+	}
+	for name := range formatTree {
+		if types[name] != tar.TypeReg {
+			t.Errorf("%s has type %q, want a regular file", name, types[name])
+		}
+	}
+}
+
+func TestTarXzRoundTrip(t *testing.T) {
+	for name, level := range formatLevels {
+		t.Run(name, func(t *testing.T) {
+			roundTrip(t, models.ArchiveOptions{Format: models.FormatTarXz, CompressionLevel: level})
+		})
+	}
+}
+
+// TestGNUTarXz extracts a GNU tar archive compressed by xz(1) and checks
+// every byte, the empty directory and the symlink came through
+func TestGNUTarXz(t *testing.T) {
+	input := filepath.Join("testdata", "gnu-tree.tar.xz")
+	if got := detectFormat(input, &models.ArchiveOptions{}); got != models.FormatTarXz {
+		t.Fatalf("fixture detected as %s", formatName(got))
+	}
+
+	output := t.TempDir()
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+
+	var binary []byte
+	for i := 0; i < 16; i++ {
+		for b := 0; b < 256; b++ {
+			binary = append(binary, byte(b))
+		}
+	}
+	want := map[string][]byte{
+		"pkg/readme.txt": []byte("hello from GNU tar\n"),
+		"pkg/binary.bin": binary,
+	}
+	for name, data := range want {
+		got, err := os.ReadFile(filepath.Join(output, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s differs from the original (%d bytes, want %d)", name, len(got), len(data))
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(output, "pkg", "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory not restored: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(output, "pkg", "link")); err != nil || target != "readme.txt" {
+		t.Errorf("link target = %q (err %v), want %q", target, err, "readme.txt")
+	}
+}
+
+func BenchmarkCompressTarFormats(b *testing.B) {
+	src := b.TempDir()
+	// Text-like content that compresses, as source trees do
+	for i := 0; i < 32; i++ {
+		line := fmt.Sprintf("func example%d(x int) int { return x*x + %d } // a line of source\n", i, i)
+		data := []byte(strings.Repeat(line, 256<<10/len(line)+1)[:256<<10])
+		if err := os.WriteFile(filepath.Join(src, fmt.Sprintf("f%02d.txt", i)), data, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, format := range []models.ArchiveFormat{models.FormatTarGz, models.FormatTarZstd} {
+		b.Run(formatName(format), func(b *testing.B) {
+			output := filepath.Join(b.TempDir(), "out"+GetExtension(format))
+			b.SetBytes(32 * 256 << 10)
+			for i := 0; i < b.N; i++ {
+				if err := NewOperator(&models.ArchiveOptions{Format: format, CompressionLevel: models.LevelNormal}).Compress(src, output); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if fi, err := os.Stat(output); err == nil {
+				b.ReportMetric(float64(fi.Size()), "archive-bytes")
+			}
+		})
+	}
+}
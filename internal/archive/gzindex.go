@@ -0,0 +1,312 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// indexName is the tar entry listing where every other entry starts
+const indexName = ".gar-index"
+
+// indexHeader starts every index
+const indexHeader = "# gar-index v1"
+
+// indexMemberSize is how much uncompressed data a gzip member collects
+// before a new member is started at the next entry boundary. Smaller
+// members mean less to decompress before an entry, at some cost in ratio.
+const indexMemberSize = 1 << 20
+
+// gzipIndexID is the gzip extra subfield ("GI") of the empty trailing
+// member that records where the index member starts
+var gzipIndexID = []byte("GI")
+
+// gzipIndexTail bounds the search for the trailing member
+const gzipIndexTail = 128
+
+// indexPos locates an entry: the compressed offset of the gzip member it
+// is in and the uncompressed offset of its first header within the member
+type indexPos struct {
+	member int64
+	skip   int64
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// gzipMembers writes a gzip stream as a series of members. Each member is
+// a complete gzip stream, so decompression can start at any member while
+// ordinary readers still see one continuous stream.
+type gzipMembers struct {
+	out   *countingWriter
+	opts  *models.ArchiveOptions
+	gw    io.WriteCloser
+	start int64
+	size  int64
+}
+
+func newGzipMembers(writer io.Writer, opts *models.ArchiveOptions) (*gzipMembers, error) {
+	out := &countingWriter{w: writer}
+	gw, err := newGzipWriter(out, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipMembers{out: out, opts: opts, gw: gw}, nil
+}
+
+func (m *gzipMembers) Write(p []byte) (int, error) {
+	n, err := m.gw.Write(p)
+	m.size += int64(n)
+	return n, err
+}
+
+// reset ends the current member and starts a new one
+func (m *gzipMembers) reset() error {
+	if err := m.gw.Close(); err != nil {
+		return err
+	}
+	gw, err := newGzipWriter(m.out, m.opts)
+	if err != nil {
+		return err
+	}
+	m.gw, m.start, m.size = gw, m.out.n, 0
+	return nil
+}
+
+// Close ends the last member
+func (m *gzipMembers) Close() error {
+	return m.gw.Close()
+}
+
+// tarIndex records where each entry of an indexed tar.gz starts
+type tarIndex struct {
+	members *gzipMembers
+	buf     bytes.Buffer
+}
+
+// mark is called before an entry's header is written. It completes the
+// previous entry, starts a new member once the current one is large
+// enough, and records the entry's position.
+func (x *tarIndex) mark(tw *tar.Writer, name string) error {
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if x.members.size >= indexMemberSize {
+		if err := x.members.reset(); err != nil {
+			return err
+		}
+	}
+	// Names spanning lines cannot be represented and are found by scanning
+	if !strings.Contains(name, "\n") {
+		fmt.Fprintf(&x.buf, "%d %d %s\n", x.members.start, x.members.size, name)
+	}
+	return nil
+}
+
+// finish writes the index entry in a member of its own, the tar trailer,
+// and the empty trailing member pointing at the index
+func (x *tarIndex) finish(w *tarEntryWriter) error {
+	if err := w.tw.Flush(); err != nil {
+		return err
+	}
+	if err := x.members.reset(); err != nil {
+		return err
+	}
+	indexOffset := x.members.start
+
+	content := append([]byte(indexHeader+"\n"), x.buf.Bytes()...)
+	info := &memFileInfo{name: indexName, size: int64(len(content)), mode: 0644, modTime: w.modTime}
+	if err := w.WriteEntry(&archiveEntry{Name: indexName, Info: info}, bytes.NewReader(content)); err != nil {
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if err := x.members.Close(); err != nil {
+		return err
+	}
+
+	trailer := gzip.NewWriter(x.members.out)
+	extra := make([]byte, 12)
+	copy(extra, gzipIndexID)
+	binary.LittleEndian.PutUint16(extra[2:], 8)
+	binary.LittleEndian.PutUint64(extra[4:], uint64(indexOffset))
+	trailer.Extra = extra
+	return trailer.Close()
+}
+
+// readIndexOffset returns the offset of the index member recorded in the
+// trailing member, if the archive has one
+func readIndexOffset(file *os.File) (int64, bool) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, false
+	}
+	size := min(info.Size(), gzipIndexTail)
+	tail := make([]byte, size)
+	if _, err := file.ReadAt(tail, info.Size()-size); err != nil && err != io.EOF {
+		return 0, false
+	}
+
+	// The trailing member has FEXTRA set
+	i := bytes.LastIndex(tail, []byte{0x1f, 0x8b, 8, 4})
+	if i < 0 {
+		return 0, false
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(tail[i:]))
+	if err != nil {
+		return 0, false
+	}
+	extra := gz.Header.Extra
+	if len(extra) < 12 || !bytes.Equal(extra[:2], gzipIndexID) || binary.LittleEndian.Uint16(extra[2:]) != 8 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(extra[4:])), true
+}
+
+// loadIndex reads the index entry from the member at offset
+func loadIndex(file *os.File, offset int64) (map[string]indexPos, error) {
+	gz, err := gzip.NewReader(io.NewSectionReader(file, offset, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if header.Name != indexName {
+		return nil, fmt.Errorf("index not found at offset %d", offset)
+	}
+
+	scanner := bufio.NewScanner(tr)
+	if !scanner.Scan() || scanner.Text() != indexHeader {
+		return nil, fmt.Errorf("invalid index header")
+	}
+	index := make(map[string]indexPos)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid index line: %q", scanner.Text())
+		}
+		member, err1 := strconv.ParseInt(fields[0], 10, 64)
+		skip, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid index line: %q", scanner.Text())
+		}
+		index[path.Clean(fields[2])] = indexPos{member: member, skip: skip}
+	}
+	return index, scanner.Err()
+}
+
+// errEntryFound stops a scan once the wanted entry has been copied
+var errEntryFound = errors.New("entry found")
+
+// ExtractEntryTo writes the content of the regular file name in the
+// archive at inputPath to w. Indexed tar.gz archives (see -index) are read
+// from the gzip member holding the entry; other archives are scanned.
+func (op *Operator) ExtractEntryTo(inputPath, name string, w io.Writer) error {
+	name = path.Clean(name)
+
+	if detectFormat(inputPath, op.opts) == models.FormatTarGz && !archiveEncrypted(inputPath, op.opts) {
+		found, err := op.extractIndexed(inputPath, name, w)
+		if found || err != nil {
+			return err
+		}
+	}
+
+	err := forEachEntry(inputPath, detectFormat(inputPath, op.opts), op.opts, func(e *archiveEntry, r io.Reader) error {
+		if r == nil || path.Clean(e.Name) != name {
+			return nil
+		}
+		if e.Encrypted {
+			return fmt.Errorf("%s: %w", e.Name, errEntryPassword)
+		}
+		if _, err := copyPooled(w, r); err != nil {
+			return err
+		}
+		return errEntryFound
+	})
+	if err == errEntryFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: no such file in %s", name, inputPath)
+}
+
+// extractIndexed looks name up in the archive's index and copies it from
+// its member. It reports false when the archive has no index or the index
+// does not list name.
+func (op *Operator) extractIndexed(inputPath, name string, w io.Writer) (bool, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	offset, ok := readIndexOffset(file)
+	if !ok {
+		return false, nil
+	}
+	index, err := loadIndex(file, offset)
+	if err != nil {
+		return false, fmt.Errorf("read index: %w", err)
+	}
+	pos, ok := index[name]
+	if !ok {
+		return false, nil
+	}
+
+	gz, err := gzip.NewReader(io.NewSectionReader(file, pos.member, 1<<62))
+	if err != nil {
+		return true, err
+	}
+	if _, err := io.CopyN(io.Discard, gz, pos.skip); err != nil {
+		return true, fmt.Errorf("seek to %s: %w", name, err)
+	}
+
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		return true, err
+	}
+	if path.Clean(header.Name) != name || header.Typeflag != tar.TypeReg {
+		return true, fmt.Errorf("index entry for %s points at %s", name, header.Name)
+	}
+
+	var r io.Reader = tr
+	if header.PAXRecords[paxEncrypted] != "" {
+		c, err := newEntryCipher(op.opts)
+		if err != nil {
+			return true, err
+		}
+		if r, err = openEntry(c, header.Name, tr); err != nil {
+			return true, err
+		}
+	}
+	_, err = copyPooled(w, r)
+	return true, err
+}
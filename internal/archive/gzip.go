@@ -0,0 +1,117 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// blockSize is the size of a tar header block
+const blockSize = 512
+
+// isTarStream reports whether r starts with a tar header, without
+// consuming it. Headers are recognized by the ustar magic at offset 257 or,
+// for old v7 archives, by a valid header checksum. An all-zero block is an
+// empty archive.
+func isTarStream(r *bufio.Reader) bool {
+	block, err := r.Peek(blockSize)
+	if err != nil {
+		return false
+	}
+
+	if bytes.HasPrefix(block[257:], []byte("ustar")) {
+		return true
+	}
+	if bytes.Count(block, []byte{0}) == blockSize {
+		return true
+	}
+	return validTarChecksum(block)
+}
+
+// validTarChecksum checks the header checksum of a tar block
+func validTarChecksum(block []byte) bool {
+	field := strings.TrimRight(strings.TrimSpace(string(block[148:156])), "\x00")
+	want, err := strconv.ParseInt(strings.TrimSpace(field), 8, 64)
+	if err != nil {
+		return false
+	}
+
+	var sum int64
+	for i, b := range block {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		sum += int64(b)
+	}
+	return sum == want
+}
+
+// plainFileName is the file name a compressed file that holds no tar
+// archive extracts to: inputPath without its directory and ext
+func plainFileName(inputPath, ext string) string {
+	base := filepath.Base(inputPath)
+	if strings.HasSuffix(strings.ToLower(base), ext) {
+		return base[:len(base)-len(ext)]
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// extractPlainGzip writes the decompressed content of a gzip file that
+// does not contain a tar archive
+func extractPlainGzip(r io.Reader, header gzip.Header, inputPath, outputPath string, opts *models.ArchiveOptions) error {
+	return extractPlainFile(r, plainFileName(inputPath, ".gz"), header.ModTime, outputPath, opts)
+}
+
+// extractPlainFile writes the decompressed content r of a compressed file
+// that does not contain a tar archive as a single file named name
+func extractPlainFile(r io.Reader, name string, modTime time.Time, outputPath string, opts *models.ArchiveOptions) error {
+	name, ok := applyEntryFilter(opts, models.Entry{
+		Name:    name,
+		Size:    -1,
+		Mode:    0644,
+		ModTime: modTime,
+	})
+	if !ok {
+		return nil
+	}
+
+	destPath, err := safeDestPath(outputPath, name)
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("  Extracting: %s\n", name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), umasked(0755, opts)); err != nil {
+		return err
+	}
+
+	outFile, err := createDestFile(destPath, 0666, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := copyEntry(outFile, r, name, -1, opts); err != nil {
+		outFile.Close()
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+
+	if !modTime.IsZero() {
+		return os.Chtimes(destPath, modTime, modTime)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestIsTarStream(t *testing.T) {
+	tarData := func(format tar.Format) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 1, Format: format})
+		tw.Write([]byte("a"))
+		tw.Close()
+		return buf.Bytes()
+	}
+
+	// A v7 header has no magic, only a checksum
+	v7 := tarData(tar.FormatUSTAR)
+	copy(v7[257:265], make([]byte, 8))
+	sum := 0
+	for i, b := range v7[:blockSize] {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		sum += int(b)
+	}
+	copy(v7[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	badSum := bytes.Clone(v7)
+	badSum[0] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"ustar", tarData(tar.FormatUSTAR), true},
+		{"pax", tarData(tar.FormatPAX), true},
+		{"gnu", tarData(tar.FormatGNU), true},
+		{"v7", v7, true},
+		{"v7 with a bad checksum", badSum, false},
+		{"empty archive", make([]byte, 1024), true},
+		{"text", []byte(strings.Repeat("plain text\n", 100)), false},
+		{"short", []byte("ustar"), false},
+		{"nothing", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isTarStream(bufio.NewReaderSize(bytes.NewReader(tt.data), blockSize)); got != tt.want {
+			t.Errorf("%s: isTarStream = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlainFileName(t *testing.T) {
+	tests := []struct {
+		path, ext, want string
+	}{
+		{"dir/notes.txt.gz", ".gz", "notes.txt"},
+		{"NOTES.TXT.GZ", ".gz", "NOTES.TXT"},
+		{"data.bz2", ".bz2", "data"},
+		{"data.tgz", ".gz", "data"},
+		{"data", ".gz", "data"},
+	}
+	for _, tt := range tests {
+		if got := plainFileName(tt.path, tt.ext); got != tt.want {
+			t.Errorf("plainFileName(%q, %q) = %q, want %q", tt.path, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestExtractPlainGzip(t *testing.T) {
+	dir := t.TempDir()
+	content := gzipTestData(100 << 10)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var member bytes.Buffer
+	gw := gzip.NewWriter(&member)
+	gw.ModTime = modTime
+	gw.Write(content)
+	gw.Close()
+	input := writeFile(t, dir, "notes.txt.gz", member.Bytes())
+
+	output := filepath.Join(dir, "out")
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(output, "notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("notes.txt differs from the compressed content")
+	}
+	if fi, err := os.Stat(filepath.Join(output, "notes.txt")); err != nil || !fi.ModTime().Equal(modTime) {
+		t.Errorf("notes.txt time = %v (err %v), want the gzip header time %v", fi.ModTime(), err, modTime)
+	}
+
+	listing := captureStdout(t, func() error {
+		return NewOperator(&models.ArchiveOptions{}).List(input)
+	})
+	if !strings.Contains(listing, "notes.txt") {
+		t.Errorf("listing does not name notes.txt:\n%s", listing)
+	}
+
+	// A tar inside still extracts as a tree
+	tarInput := writeTarGz(t, dir, []tarMember{{name: "d/a.txt", body: "a"}})
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(tarInput, filepath.Join(dir, "tree")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, filepath.Join(dir, "tree")); len(got) != 1 || got["d/a.txt"] != "a" {
+		t.Errorf("tar.gz extracted to %v", got)
+	}
+}
@@ -0,0 +1,51 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// fileID identifies a file on disk independently of its names
+type fileID struct {
+	dev, ino uint64
+}
+
+// hardLinks remembers the first name archived for each file that has
+// more than one link, so the others can be stored as tar hard links
+type hardLinks map[fileID]string
+
+// link returns the name fi was first archived under, or records name as
+// that name and reports false. It always reports false for files with a
+// single link and on platforms that cannot tell.
+func (h hardLinks) link(name string, fi os.FileInfo) (string, bool) {
+	if h == nil || !fi.Mode().IsRegular() {
+		return "", false
+	}
+	id, ok := linkedFileID(fi)
+	if !ok {
+		return "", false
+	}
+	if first, ok := h[id]; ok {
+		return first, true
+	}
+	h[id] = name
+	return "", false
+}
+
+// newHardLinks returns an empty table when every output format stores
+// hard links, and nil otherwise. Text conversion goes by name, so it
+// could treat two names of one file differently; with it each name is
+// stored as a file of its own.
+func newHardLinks(opts *models.ArchiveOptions, formats ...models.ArchiveFormat) hardLinks {
+	if opts.TextConvert != "" {
+		return nil
+	}
+	for _, format := range formats {
+		if !isTarFormat(format) {
+			return nil
+		}
+	}
+	return make(hardLinks)
+}
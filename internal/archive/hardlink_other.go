@@ -0,0 +1,11 @@
+//go:build !unix
+
+package archive
+
+import "os"
+
+// linkedFileID is unsupported on this platform, so hard links are
+// archived as separate files
+func linkedFileID(os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package archive
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkedFileID returns the device and inode of fi when the file has more
+// than one link
+func linkedFileID(fi os.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,51 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// DefaultHash is the digest used when no algorithm is configured
+const DefaultHash = "sha256"
+
+// hashFactories maps algorithm names to hash constructors
+var hashFactories = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New256(nil) // only fails for oversized keys
+		return h
+	},
+	"xxhash": func() hash.Hash { return xxhash.New() },
+}
+
+// newHashFunc returns the constructor for the named algorithm; an empty
+// name selects DefaultHash
+func newHashFunc(name string) (func() hash.Hash, error) {
+	if name == "" {
+		name = DefaultHash
+	}
+	factory, ok := hashFactories[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm: %s (supported: %s)", name, strings.Join(hashNames(), ", "))
+	}
+	return factory, nil
+}
+
+// hashNames lists the supported algorithms in sorted order
+func hashNames() []string {
+	names := make([]string, 0, len(hashFactories))
+	for name := range hashFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,174 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// archiveStats summarizes the entries of an archive
+type archiveStats struct {
+	Entries     int
+	Files       int
+	Directories int
+	Symlinks    int
+	TotalSize   int64
+}
+
+// Info prints a summary of the archive's contents and of how it is
+// compressed, as far as its headers tell
+func (op *Operator) Info(inputPath string) error {
+	format := detectFormat(inputPath, op.opts)
+
+	var stats archiveStats
+	err := forEachEntry(inputPath, format, op.opts, func(e *archiveEntry, _ io.Reader) error {
+		stats.Entries++
+		switch {
+		case e.Info.IsDir():
+			stats.Directories++
+		case e.isSymlink():
+			stats.Symlinks++
+		default:
+			stats.Files++
+			stats.TotalSize += e.Info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	compression, err := compressionInfo(inputPath, format, op.opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Archive: %s\n", inputPath)
+	fmt.Printf("  Entries:     %d\n", stats.Entries)
+	fmt.Printf("  Files:       %d (%d bytes)\n", stats.Files, stats.TotalSize)
+	fmt.Printf("  Directories: %d\n", stats.Directories)
+	fmt.Printf("  Symlinks:    %d\n", stats.Symlinks)
+	fmt.Printf("  Compression: %s\n", compression)
+	return nil
+}
+
+// ListEmptyDirs prints the directory entries of the archive that have no
+// file descendants
+func (op *Operator) ListEmptyDirs(inputPath string) error {
+	dirs, err := emptyDirs(inputPath, op.opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Empty directories:")
+	for _, dir := range dirs {
+		fmt.Printf("  %s/\n", dir)
+	}
+	return nil
+}
+
+// ListDuplicates prints groups of file entries with identical contents
+func (op *Operator) ListDuplicates(inputPath string) error {
+	groups, err := duplicateFiles(inputPath, op.opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Duplicate files:")
+	for _, group := range groups {
+		fmt.Printf("  %d copies, %d bytes each:\n", len(group.Names), group.Size)
+		for _, name := range group.Names {
+			fmt.Printf("    %s\n", name)
+		}
+	}
+	return nil
+}
+
+// duplicateGroup is a set of files sharing the same contents
+type duplicateGroup struct {
+	Size  int64
+	Names []string
+}
+
+// duplicateFiles hashes every non-empty file entry with the configured
+// algorithm and returns the groups with more than one member, ordered by
+// their first name. Content is hashed rather than compared by zip CRC-32,
+// which is too weak to call two files identical.
+func duplicateFiles(inputPath string, opts *models.ArchiveOptions) ([]duplicateGroup, error) {
+	newHash, err := newHashFunc(opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	byDigest := make(map[string]*duplicateGroup)
+	err = forEachEntry(inputPath, detectFormat(inputPath, opts), opts, func(e *archiveEntry, r io.Reader) error {
+		if r == nil || e.Info.Size() == 0 {
+			return nil
+		}
+
+		h := newHash()
+		n, err := copyPooled(h, r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		// The size is part of the key, so only a full collision merges groups
+		key := fmt.Sprintf("%x:%d", h.Sum(nil), n)
+		group, ok := byDigest[key]
+		if !ok {
+			group = &duplicateGroup{Size: n}
+			byDigest[key] = group
+		}
+		group.Names = append(group.Names, e.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []duplicateGroup
+	for _, group := range byDigest {
+		if len(group.Names) > 1 {
+			sort.Strings(group.Names)
+			groups = append(groups, *group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Names[0] < groups[j].Names[0] })
+	return groups, nil
+}
+
+// emptyDirs returns the sorted names of directory entries that contain no
+// files, directly or in any subdirectory
+func emptyDirs(inputPath string, opts *models.ArchiveOptions) ([]string, error) {
+	dirs := make(map[string]bool)
+	nonEmpty := make(map[string]bool)
+
+	err := forEachEntry(inputPath, detectFormat(inputPath, opts), opts, func(e *archiveEntry, _ io.Reader) error {
+		name := path.Clean(e.Name)
+		if e.Info.IsDir() {
+			dirs[name] = true
+			return nil
+		}
+
+		// Every ancestor of a file is non-empty, including the root
+		nonEmpty["."] = true
+		for dir := path.Dir(name); dir != "." && dir != "/" && !nonEmpty[dir]; dir = path.Dir(dir) {
+			nonEmpty[dir] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var empty []string
+	for dir := range dirs {
+		if !nonEmpty[dir] {
+			empty = append(empty, dir)
+		}
+	}
+	sort.Strings(empty)
+	return empty, nil
+}
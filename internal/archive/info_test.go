@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestEmptyDirs(t *testing.T) {
+	want := []string{"a/b", "c", "d", "d/e"}
+
+	t.Run("tar.gz", func(t *testing.T) {
+		input := writeTarGz(t, t.TempDir(), []tarMember{
+			{name: "a/", typeflag: tar.TypeDir},
+			{name: "a/b/", typeflag: tar.TypeDir},
+			{name: "a/file.txt", body: "a"},
+			{name: "c/", typeflag: tar.TypeDir},
+			{name: "d/", typeflag: tar.TypeDir},
+			{name: "d/e/", typeflag: tar.TypeDir},
+			{name: "f/", typeflag: tar.TypeDir},
+			{name: "f/link", typeflag: tar.TypeSymlink, linkname: "../a/file.txt"},
+			// No entry for g itself
+			{name: "g/h.txt", body: "h"},
+		})
+		got, err := emptyDirs(input, &models.ArchiveOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("emptyDirs = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		src := writeTestTree(t, map[string]string{"a/file.txt": "a", "f/g.txt": "g"})
+		for _, dir := range want {
+			if err := os.MkdirAll(filepath.Join(src, dir), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		input := filepath.Join(t.TempDir(), "in.zip")
+		if err := NewOperator(&models.ArchiveOptions{}).Compress(src, input); err != nil {
+			t.Fatal(err)
+		}
+		got, err := emptyDirs(input, &models.ArchiveOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("emptyDirs = %q, want %q", got, want)
+		}
+
+		listing := captureStdout(t, func() error {
+			return NewOperator(&models.ArchiveOptions{}).ListEmptyDirs(input)
+		})
+		if !strings.Contains(listing, "  d/e/\n") || strings.Contains(listing, "  a/\n") {
+			t.Errorf("listing:\n%s", listing)
+		}
+	})
+}
+
+func TestListDuplicates(t *testing.T) {
+	files := map[string]string{
+		"a.txt":      "same content",
+		"b/copy.txt": "same content",
+		"c/again":    "same content",
+		"x.bin":      "other",
+		"y/x.bin":    "other",
+		"unique":     "unique",
+		// A CRC-32 collision with "plumless" must not count as a copy
+		"buckeroo": "buckeroo",
+		"plumless": "plumless",
+		"empty1":   "",
+		"empty2":   "",
+	}
+	want := []duplicateGroup{
+		{Size: 12, Names: []string{"a.txt", "b/copy.txt", "c/again"}},
+		{Size: 5, Names: []string{"x.bin", "y/x.bin"}},
+	}
+	src := writeTestTree(t, files)
+
+	for _, format := range []models.ArchiveFormat{models.FormatZip, models.FormatTarGz} {
+		input := filepath.Join(t.TempDir(), "in"+GetExtension(format))
+		if err := NewOperator(&models.ArchiveOptions{Format: format}).Compress(src, input); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, algorithm := range []string{"", "xxhash"} {
+			got, err := duplicateFiles(input, &models.ArchiveOptions{Hash: algorithm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, want, func(a, b duplicateGroup) bool {
+				return a.Size == b.Size && slices.Equal(a.Names, b.Names)
+			}) {
+				t.Errorf("%s -hash=%q: duplicates = %v, want %v", formatName(format), algorithm, got, want)
+			}
+		}
+
+		listing := captureStdout(t, func() error {
+			return NewOperator(&models.ArchiveOptions{}).ListDuplicates(input)
+		})
+		if !strings.Contains(listing, "  3 copies, 12 bytes each:\n    a.txt\n    b/copy.txt\n    c/again\n") {
+			t.Errorf("%s listing:\n%s", formatName(format), listing)
+		}
+	}
+}
+
+func TestListPrintsStoredNames(t *testing.T) {
+	// Names as written by nonconforming tools
+	names := []string{`dir\sub\a.txt`, `dir\`, "trailing/", "./dot.txt"}
+	dir := t.TempDir()
+
+	members := make([]tarMember, len(names))
+	files := make(map[string][]byte, len(names))
+	for i, name := range names {
+		members[i] = tarMember{name: name}
+		if strings.HasSuffix(name, "/") {
+			members[i].typeflag = tar.TypeDir
+		}
+		files[name] = nil
+	}
+	inputs := map[string]string{
+		"tar.gz": writeTarGz(t, dir, members),
+		"zip":    writeFile(t, dir, "names.zip", buildZip(t, 0, files, names)),
+	}
+	for format, input := range inputs {
+		t.Run(format, func(t *testing.T) {
+			out := captureStdout(t, func() error { return NewOperator(&models.ArchiveOptions{}).List(input) })
+			for _, name := range names {
+				if !strings.Contains(out, "  "+name+" (0 bytes)\n") {
+					t.Errorf("listing does not show %q as stored:\n%s", name, out)
+				}
+			}
+		})
+	}
+}
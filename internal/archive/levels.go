@@ -0,0 +1,76 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/bzip2"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// codecMaxLevels holds the highest exact level of each codec whose normal
+// level can be overridden; levels start at 1
+var codecMaxLevels = map[models.Codec]int{
+	models.CodecFlate: 9,
+	models.CodecGzip:  9,
+	models.CodecZstd:  maxZstdLevel,
+}
+
+// CheckNormalLevels validates per-codec overrides of the normal level. A
+// level of 0 leaves the codec on its preset.
+func CheckNormalLevels(levels map[models.Codec]int) error {
+	for codec, level := range levels {
+		maxLevel, ok := codecMaxLevels[codec]
+		if !ok {
+			return fmt.Errorf("unknown codec %q", codec)
+		}
+		if level < 0 || level > maxLevel {
+			return fmt.Errorf("invalid %s level %d: want 1-%d", codec, level, maxLevel)
+		}
+	}
+	return nil
+}
+
+// formatMaxLevels holds the highest exact codec level of each format that
+// is written with a codec; levels start at 1
+var formatMaxLevels = map[models.ArchiveFormat]int{
+	models.FormatZip:     9,
+	models.FormatTarGz:   9,
+	models.FormatTarBz2:  bzip2.BestCompression,
+	models.FormatTarZstd: maxZstdLevel,
+	models.FormatTarXz:   xzPresetBest,
+}
+
+// CheckFormatLevels validates exact codec levels given per format. A level
+// of 0 leaves the format on its preset. Plain tar is not compressed and 7z
+// is read only, so neither takes a level.
+func CheckFormatLevels(levels map[models.ArchiveFormat]int) error {
+	for format, level := range levels {
+		maxLevel, ok := formatMaxLevels[format]
+		switch {
+		case !ok && (format == models.FormatTar || format == models.FormatSevenZip):
+			if level != 0 {
+				return fmt.Errorf("invalid %s level %d: the format has no compression levels", strings.TrimPrefix(GetExtension(format), "."), level)
+			}
+		case !ok:
+			return fmt.Errorf("unknown format %d", format)
+		case level < 0 || level > maxLevel:
+			return fmt.Errorf("invalid %s level %d: want 1-%d", strings.TrimPrefix(GetExtension(format), "."), level, maxLevel)
+		}
+	}
+	return nil
+}
+
+// exactLevel returns the exact level codec is to use, or 0 to go by the
+// preset: an exact -compression level applies to every codec, and the
+// codec's entry in NormalLevels stands in for the normal preset
+func exactLevel(opts *models.ArchiveOptions, codec models.Codec) int {
+	if opts.CodecLevel != 0 {
+		return opts.CodecLevel
+	}
+	if opts.CompressionLevel == models.LevelNormal {
+		return opts.NormalLevels[codec]
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"bytes"
+	"compress/flate"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestNormalLevels(t *testing.T) {
+	levels := map[models.Codec]int{models.CodecFlate: 2, models.CodecGzip: 7, models.CodecZstd: 19}
+	normal := &models.ArchiveOptions{CompressionLevel: models.LevelNormal, NormalLevels: levels}
+
+	// Each codec reads its own entry
+	if got := flateLevel(normal, models.CodecFlate); got != 2 {
+		t.Errorf("flate level = %d, want 2", got)
+	}
+	if got := flateLevel(normal, models.CodecGzip); got != 7 {
+		t.Errorf("gzip level = %d, want 7", got)
+	}
+	if got, want := zstdLevel(normal), zstd.EncoderLevelFromZstd(19); got != want {
+		t.Errorf("zstd level = %v, want %v", got, want)
+	}
+
+	// Other presets and exact levels are left alone
+	best := &models.ArchiveOptions{CompressionLevel: models.LevelBest, NormalLevels: levels}
+	if got := flateLevel(best, models.CodecGzip); got != flate.BestCompression {
+		t.Errorf("gzip level under best = %d, want %d", got, flate.BestCompression)
+	}
+	if got := zstdLevel(best); got != zstd.SpeedBestCompression {
+		t.Errorf("zstd level under best = %v, want %v", got, zstd.SpeedBestCompression)
+	}
+	exact := &models.ArchiveOptions{CompressionLevel: models.LevelNormal, CodecLevel: 4, NormalLevels: levels}
+	if got := flateLevel(exact, models.CodecFlate); got != 4 {
+		t.Errorf("flate level with an exact level = %d, want 4", got)
+	}
+
+	// A codec without an entry keeps the preset
+	partial := &models.ArchiveOptions{CompressionLevel: models.LevelNormal, NormalLevels: map[models.Codec]int{models.CodecZstd: 19}}
+	if got := flateLevel(partial, models.CodecGzip); got != flate.DefaultCompression {
+		t.Errorf("gzip level without an override = %d, want %d", got, flate.DefaultCompression)
+	}
+}
+
+// TestNormalLevelArchives checks that the writer of each format uses its
+// codec's override: the archive is the one the same exact level writes
+func TestNormalLevelArchives(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"a.txt":     strings.Repeat("the quick brown fox jumps over the lazy dog\n", 4000),
+		"dir/b.txt": strings.Repeat("0123456789abcdef", 8000),
+	})
+	tests := []struct {
+		format models.ArchiveFormat
+		codec  models.Codec
+		level  int
+	}{
+		{models.FormatZip, models.CodecFlate, 1},
+		{models.FormatTarGz, models.CodecGzip, 1},
+		{models.FormatTarZstd, models.CodecZstd, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.codec), func(t *testing.T) {
+			compress := func(opts models.ArchiveOptions) []byte {
+				t.Helper()
+				opts.Format = tt.format
+				output := filepath.Join(t.TempDir(), "out"+GetExtension(tt.format))
+				if err := NewOperator(&opts).Compress(src, output); err != nil {
+					t.Fatal(err)
+				}
+				data, err := os.ReadFile(output)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return data
+			}
+
+			// Every other codec's override must not leak into this one
+			levels := map[models.Codec]int{models.CodecFlate: 9, models.CodecGzip: 9, models.CodecZstd: 19}
+			levels[tt.codec] = tt.level
+			overridden := compress(models.ArchiveOptions{CompressionLevel: models.LevelNormal, NormalLevels: levels})
+			exact := compress(models.ArchiveOptions{CodecLevel: tt.level})
+			normal := compress(models.ArchiveOptions{CompressionLevel: models.LevelNormal})
+
+			if !bytes.Equal(overridden, exact) {
+				t.Errorf("-%s-level=%d wrote %d bytes, level %d writes %d", tt.codec, tt.level, len(overridden), tt.level, len(exact))
+			}
+			if bytes.Equal(overridden, normal) {
+				t.Errorf("-%s-level=%d wrote the normal preset's archive", tt.codec, tt.level)
+			}
+		})
+	}
+}
+
+func TestCheckNormalLevels(t *testing.T) {
+	tests := []struct {
+		levels  map[models.Codec]int
+		wantErr string
+	}{
+		{map[models.Codec]int{models.CodecFlate: 0, models.CodecGzip: 9, models.CodecZstd: 22}, ""},
+		{map[models.Codec]int{models.CodecGzip: 10}, "invalid gzip level 10: want 1-9"},
+		{map[models.Codec]int{models.CodecFlate: -1}, "invalid flate level -1: want 1-9"},
+		{map[models.Codec]int{models.CodecZstd: 23}, "invalid zstd level 23: want 1-22"},
+		{map[models.Codec]int{"lz4": 1}, `unknown codec "lz4"`},
+	}
+	for _, tt := range tests {
+		err := CheckNormalLevels(tt.levels)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("CheckNormalLevels(%v) = %v", tt.levels, err)
+			}
+		} else if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("CheckNormalLevels(%v) = %v, want %q", tt.levels, err, tt.wantErr)
+		}
+	}
+}
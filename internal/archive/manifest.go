@@ -0,0 +1,177 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// manifestName is the archive entry holding content digests
+const manifestName = ".gar-manifest"
+
+// manifestHeader starts every manifest and records the digest algorithm
+const manifestHeader = "# gar-manifest hash="
+
+// merkleField follows the algorithm in the header of a manifest that
+// records the Merkle root of its digests
+const merkleField = " merkle="
+
+// manifest records a content digest for every regular file of an archive
+type manifest struct {
+	Algorithm string
+	Names     []string
+	Digests   map[string]string
+	// Root is the hex Merkle root over Names in order, if recorded
+	Root string
+}
+
+func newManifest(algorithm string) *manifest {
+	return &manifest{Algorithm: algorithm, Digests: make(map[string]string)}
+}
+
+// add records the digest of name
+func (m *manifest) add(name, digest string) {
+	if _, ok := m.Digests[name]; !ok {
+		m.Names = append(m.Names, name)
+	}
+	m.Digests[name] = digest
+}
+
+// encode renders the manifest in a sha256sum-like text format preceded by
+// the algorithm header
+func (m *manifest) encode() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%s", manifestHeader, m.Algorithm)
+	if m.Root != "" {
+		fmt.Fprintf(&buf, "%s%s", merkleField, m.Root)
+	}
+	buf.WriteByte('\n')
+	for _, name := range m.Names {
+		fmt.Fprintf(&buf, "%s  %s\n", m.Digests[name], name)
+	}
+	return buf.Bytes()
+}
+
+// parseManifest decodes a manifest written by encode
+func parseManifest(r io.Reader) (*manifest, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("empty manifest")
+	}
+	header, ok := strings.CutPrefix(scanner.Text(), manifestHeader)
+	if !ok {
+		return nil, fmt.Errorf("invalid manifest header")
+	}
+	algorithm, root, _ := strings.Cut(header, merkleField)
+
+	m := newManifest(algorithm)
+	m.Root = root
+	for scanner.Scan() {
+		digest, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			return nil, fmt.Errorf("invalid manifest line: %q", scanner.Text())
+		}
+		m.add(name, digest)
+	}
+	return m, scanner.Err()
+}
+
+// manifestWriter hashes regular file content as it is written and adds
+// the manifest as the final entry when closed
+type manifestWriter struct {
+	entryWriter
+	newHash  func() hash.Hash
+	manifest *manifest
+	// merkle records the Merkle root of the digests in the manifest
+	merkle  bool
+	verbose bool
+}
+
+func newManifestWriter(ew entryWriter, opts *models.ArchiveOptions) (*manifestWriter, error) {
+	algorithm := opts.Hash
+	newHash, err := newHashFunc(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "" {
+		algorithm = DefaultHash
+	}
+	algorithm = strings.ToLower(algorithm)
+	if opts.Merkle {
+		if err := checkMerkleHash(algorithm); err != nil {
+			return nil, err
+		}
+	}
+	return &manifestWriter{
+		entryWriter: ew,
+		newHash:     newHash,
+		manifest:    newManifest(algorithm),
+		merkle:      opts.Merkle,
+		verbose:     opts.Verbose,
+	}, nil
+}
+
+// WriteEntry writes e while recording its content digest
+func (w *manifestWriter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	if r == nil || e.Name == manifestName {
+		return w.entryWriter.WriteEntry(e, r)
+	}
+
+	h := w.newHash()
+	if err := w.entryWriter.WriteEntry(e, io.TeeReader(r, h)); err != nil {
+		return err
+	}
+	w.manifest.add(e.Name, hex.EncodeToString(h.Sum(nil)))
+	return nil
+}
+
+// Close appends the manifest entry and finalizes the archive
+func (w *manifestWriter) Close() error {
+	if w.merkle {
+		tree, err := newMerkleTree(w.manifest, w.newHash)
+		if err != nil {
+			w.entryWriter.Close()
+			return err
+		}
+		w.manifest.Root = hex.EncodeToString(tree.root())
+		if w.verbose {
+			fmt.Printf("Merkle root: %s\n", w.manifest.Root)
+		}
+	}
+
+	content := w.manifest.encode()
+	info := &memFileInfo{name: manifestName, size: int64(len(content)), mode: 0644, modTime: time.Now()}
+	if err := w.entryWriter.WriteEntry(&archiveEntry{Name: manifestName, Info: info}, bytes.NewReader(content)); err != nil {
+		w.entryWriter.Close()
+		return err
+	}
+	return w.entryWriter.Close()
+}
+
+// memFileInfo describes an entry generated in memory rather than read
+// from disk
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() any           { return nil }
+
+var _ fs.FileInfo = (*memFileInfo)(nil)
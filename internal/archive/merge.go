@@ -0,0 +1,122 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Merge policies for entries whose names collide across source archives
+const (
+	// MergeFirst keeps the first entry seen and drops later duplicates
+	MergeFirst = "first"
+	// MergeNamespace stores colliding entries under the source archive name
+	MergeNamespace = "namespace"
+)
+
+// Merge combines the entries of several archives (of any supported format)
+// into a single archive written in the configured format
+func (op *Operator) Merge(inputPaths []string, outputPath string) error {
+	if len(inputPaths) == 0 {
+		return fmt.Errorf("no input archives to merge")
+	}
+
+	policy := op.opts.MergePolicy
+	if policy == "" {
+		policy = MergeFirst
+	}
+	if policy != MergeFirst && policy != MergeNamespace {
+		return fmt.Errorf("unknown merge policy: %s", policy)
+	}
+
+	if op.opts.Verbose {
+		fmt.Printf("Merging %s into %s...\n", strings.Join(inputPaths, ", "), outputPath)
+	}
+
+	return op.writeArchive(outputPath, func(ew entryWriter) error {
+		seen := make(map[string]bool)
+		for _, inputPath := range inputPaths {
+			if err := op.mergeArchive(inputPath, ew, seen, policy); err != nil {
+				return fmt.Errorf("merge %s: %w", inputPath, err)
+			}
+		}
+		return nil
+	})
+}
+
+// mergeArchive copies the entries of one source archive into ew
+func (op *Operator) mergeArchive(inputPath string, ew entryWriter, seen map[string]bool, policy string) error {
+	namespace := archiveBaseName(inputPath)
+
+	// The configured format is the output format, so sources are always
+	// detected individually
+
+	return forEachEntry(inputPath, detectFormat(inputPath, nil), op.opts, func(e *archiveEntry, r io.Reader) error {
+		name, ok := applyEntryFilter(op.opts, archiveEntryModel(e))
+		if !ok {
+			return nil
+		}
+		storedName := e.Name
+		e.Name = name
+
+		if seen[e.Name] {
+			// Directories are shared between sources rather than duplicated
+			if e.Info.IsDir() || policy == MergeFirst {
+				if op.opts.Verbose {
+					fmt.Printf("  Skipping duplicate: %s\n", e.Name)
+				}
+				countSkipped(op.opts)
+				return nil
+			}
+
+			e.Name = path.Join(namespace, e.Name)
+			if seen[e.Name] {
+				return fmt.Errorf("duplicate entry after namespacing: %s", e.Name)
+			}
+		}
+		seen[e.Name] = true
+		if err := checkSealedRename(e, storedName); err != nil {
+			return err
+		}
+
+		if op.opts.Verbose {
+			fmt.Printf("  Adding: %s\n", e.Name)
+		}
+
+		if err := ew.WriteEntry(e, r); err != nil {
+			countFailed(op.opts)
+			return err
+		}
+		if r != nil {
+			countFile(op.opts, e.Info.Size())
+		}
+		return nil
+	})
+}
+
+// archiveEntryModel describes e for EntryFilter callbacks
+func archiveEntryModel(e *archiveEntry) models.Entry {
+	return models.Entry{
+		Name:    e.Name,
+		Size:    e.Info.Size(),
+		Mode:    e.Info.Mode(),
+		ModTime: e.Info.ModTime(),
+		IsDir:   e.Info.IsDir(),
+	}
+}
+
+// archiveBaseName strips directories and archive extensions from a path
+func archiveBaseName(inputPath string) string {
+	base := filepath.Base(inputPath)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tbz", ".tar.zst", ".tzst", ".tar.xz", ".txz", ".tar", ".7z", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(base), ext) {
+			return base[:len(base)-len(ext)]
+		}
+	}
+	return base
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"archive/tar"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	zipInput := writeZipFile(t, dir, map[string]string{"shared.txt": "from zip", "zip-only.txt": "z"}, []string{"shared.txt", "zip-only.txt"})
+	tarInput := writeTarGz(t, dir, []tarMember{
+		{name: "docs", typeflag: tar.TypeDir},
+		{name: "shared.txt", body: "from tar"},
+		{name: "docs/tar-only.txt", body: "t"},
+	})
+
+	tests := []struct {
+		policy  string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			policy: "",
+			want:   map[string]string{"shared.txt": "from zip", "zip-only.txt": "z", "docs/tar-only.txt": "t"},
+		},
+		{
+			policy: MergeFirst,
+			want:   map[string]string{"shared.txt": "from zip", "zip-only.txt": "z", "docs/tar-only.txt": "t"},
+		},
+		{
+			// The tar.gz is named test.tar.gz
+			policy: MergeNamespace,
+			want:   map[string]string{"shared.txt": "from zip", "zip-only.txt": "z", "test/shared.txt": "from tar", "docs/tar-only.txt": "t"},
+		},
+		{policy: "last", wantErr: "unknown merge policy"},
+	}
+	for _, tt := range tests {
+		for _, format := range []models.ArchiveFormat{models.FormatZip, models.FormatTarGz} {
+			t.Run(tt.policy+"/"+formatName(format), func(t *testing.T) {
+				output := filepath.Join(t.TempDir(), "merged")
+				opts := &models.ArchiveOptions{Format: format, MergePolicy: tt.policy}
+				err := NewOperator(opts).Merge([]string{zipInput, tarInput}, output)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("error = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				dest := t.TempDir()
+				if err := NewOperator(&models.ArchiveOptions{Format: format}).Extract(output, dest); err != nil {
+					t.Fatal(err)
+				}
+				if got := readTree(t, dest); !maps.Equal(got, tt.want) {
+					t.Errorf("merged tree = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMergeNoInputs(t *testing.T) {
+	err := NewOperator(&models.ArchiveOptions{}).Merge(nil, filepath.Join(t.TempDir(), "out.zip"))
+	if err == nil {
+		t.Fatal("Merge succeeded without inputs")
+	}
+}
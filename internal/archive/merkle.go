@@ -0,0 +1,124 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// Domain separation prefixes, as in RFC 6962, so a leaf can never be
+// passed off as an inner node
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// merkleTree is a binary hash tree over the manifest entries in order.
+// levels[0] holds the leaves and the last level holds the root. A node
+// without a sibling moves up a level unchanged.
+type merkleTree struct {
+	newHash func() hash.Hash
+	levels  [][][]byte
+}
+
+// merkleStep is one sibling on the path from a leaf to the root
+type merkleStep struct {
+	Hash []byte
+	// Left is set when the sibling is the left child
+	Left bool
+}
+
+// newMerkleTree builds the tree over the digests of m
+func newMerkleTree(m *manifest, newHash func() hash.Hash) (*merkleTree, error) {
+	t := &merkleTree{newHash: newHash}
+
+	level := make([][]byte, len(m.Names))
+	for i, name := range m.Names {
+		digest, err := hex.DecodeString(m.Digests[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest digest for %s", name)
+		}
+		level[i] = t.leaf(name, digest)
+	}
+	t.levels = append(t.levels, level)
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, t.node(level[i], level[i+1]))
+			}
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t, nil
+}
+
+// leaf hashes an entry name with its content digest, so a proof binds
+// the content to the name it was stored under
+func (t *merkleTree) leaf(name string, digest []byte) []byte {
+	h := t.newHash()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(digest)
+	return h.Sum(nil)
+}
+
+func (t *merkleTree) node(left, right []byte) []byte {
+	h := t.newHash()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// root returns the root hash; the root of an empty tree is the digest of
+// no input
+func (t *merkleTree) root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return t.newHash().Sum(nil)
+	}
+	return top[0]
+}
+
+// proof returns the siblings on the path from leaf i to the root
+func (t *merkleTree) proof(i int) []merkleStep {
+	var steps []merkleStep
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := i ^ 1
+		if sibling < len(level) {
+			steps = append(steps, merkleStep{Hash: level[sibling], Left: sibling < i})
+		}
+		i /= 2
+	}
+	return steps
+}
+
+// verifyProof reports whether the leaf for name and digest leads to root
+// through steps
+func (t *merkleTree) verifyProof(name string, digest []byte, steps []merkleStep, root []byte) bool {
+	sum := t.leaf(name, digest)
+	for _, step := range steps {
+		if step.Left {
+			sum = t.node(step.Hash, sum)
+		} else {
+			sum = t.node(sum, step.Hash)
+		}
+	}
+	return bytes.Equal(sum, root)
+}
+
+// checkMerkleHash rejects digests too weak to make a tree tamper-evident
+func checkMerkleHash(algorithm string) error {
+	if algorithm == "xxhash" {
+		return fmt.Errorf("-merkle needs a cryptographic hash; use sha256, sha512 or blake2b")
+	}
+	return nil
+}
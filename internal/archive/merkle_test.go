@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// merkleManifest is a manifest of n entries whose digests hash their names
+func merkleManifest(n int) *manifest {
+	m := newManifest("sha256")
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		digest := sha256.Sum256([]byte(name))
+		m.add(name, hex.EncodeToString(digest[:]))
+	}
+	return m
+}
+
+func TestMerkleTreeProofs(t *testing.T) {
+	empty, err := newMerkleTree(merkleManifest(0), sha256.New)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256(nil); string(empty.root()) != string(want[:]) {
+		t.Errorf("empty root = %x, want %x", empty.root(), want)
+	}
+
+	for n := 1; n <= 9; n++ {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			m := merkleManifest(n)
+			tree, err := newMerkleTree(m, sha256.New)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root := tree.root()
+			for i, name := range m.Names {
+				digest, _ := hex.DecodeString(m.Digests[name])
+				proof := tree.proof(i)
+				if !tree.verifyProof(name, digest, proof, root) {
+					t.Fatalf("proof for %s does not reach the root", name)
+				}
+
+				// The proof binds the content and the name
+				tampered := append([]byte(nil), digest...)
+				tampered[0] ^= 1
+				if tree.verifyProof(name, tampered, proof, root) {
+					t.Errorf("%s: a changed digest verified", name)
+				}
+				if tree.verifyProof(name+".moved", digest, proof, root) {
+					t.Errorf("%s: a changed name verified", name)
+				}
+				if n > 1 && tree.verifyProof(name, digest, tree.proof((i+1)%n), root) {
+					t.Errorf("%s: the proof of another entry verified", name)
+				}
+			}
+		})
+	}
+
+}
+
+func TestVerifyEntry(t *testing.T) {
+	src := writeTestTree(t, map[string]string{"a.txt": "alpha", "b.txt": "beta", "dir/c.txt": "gamma"})
+	input := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatTarGz, Merkle: true}).Compress(src, input); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(input, models.FormatTarGz, &models.ArchiveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Root == "" {
+		t.Fatal("archive records no Merkle root")
+	}
+
+	out := captureStdout(t, func() error {
+		return NewOperator(&models.ArchiveOptions{MerkleRoot: strings.ToUpper(m.Root)}).VerifyEntry(input, "./dir/c.txt")
+	})
+	if !strings.Contains(out, "dir/c.txt: OK") {
+		t.Errorf("output = %q", out)
+	}
+
+	tests := []struct {
+		name string
+		opts models.ArchiveOptions
+		want string
+	}{
+		{"missing.txt", models.ArchiveOptions{}, "not in manifest"},
+		{"a.txt", models.ArchiveOptions{MerkleRoot: strings.Repeat("00", 32)}, "does not match -merkle-root"},
+	}
+	for _, tt := range tests {
+		err := NewOperator(&tt.opts).VerifyEntry(input, tt.name)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	plain := filepath.Join(t.TempDir(), "plain.tar.gz")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatTarGz, Manifest: true}).Compress(src, plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewOperator(&models.ArchiveOptions{}).VerifyEntry(plain, "a.txt"); err == nil || !strings.Contains(err.Error(), "no Merkle root") {
+		t.Errorf("archive without a root: err = %v", err)
+	}
+}
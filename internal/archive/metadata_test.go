@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// captureStdout returns what fn prints to standard output
+func captureStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, fn)
+}
+
+// captureStderr returns what fn prints to standard error
+func captureStderr(t *testing.T, fn func() error) string {
+	t.Helper()
+	return captureOutput(t, &os.Stderr, fn)
+}
+
+// captureOutput runs fn with *file redirected to a pipe and returns what
+// was written to it
+func captureOutput(t *testing.T, file **os.File, fn func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+
+	err = fn()
+	*file = saved
+	w.Close()
+	out := <-done
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestMetadataEntriesHidden(t *testing.T) {
+	files := map[string]string{"a.txt": "alpha", "dir/b.txt": "beta"}
+
+	tests := []struct {
+		name string
+		opts models.ArchiveOptions
+		ext  string
+	}{
+		{"zip manifest", models.ArchiveOptions{Format: models.FormatZip, Manifest: true}, ".zip"},
+		{"tar.gz manifest and index", models.ArchiveOptions{Format: models.FormatTarGz, Manifest: true, Index: true}, ".tar.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src")
+			for name, content := range files {
+				p := filepath.Join(src, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			plainOpts := tt.opts
+			plainOpts.Manifest, plainOpts.Index = false, false
+			plain := filepath.Join(dir, "plain"+tt.ext)
+			if err := NewOperator(&plainOpts).Compress(src, plain); err != nil {
+				t.Fatal(err)
+			}
+			input := filepath.Join(dir, "meta"+tt.ext)
+			if err := NewOperator(&tt.opts).Compress(src, input); err != nil {
+				t.Fatal(err)
+			}
+
+			op := NewOperator(&models.ArchiveOptions{MaxRatio: 0})
+			output := filepath.Join(dir, "out")
+			if err := op.Extract(input, output); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{manifestName, indexName} {
+				if _, err := os.Lstat(filepath.Join(output, name)); !os.IsNotExist(err) {
+					t.Errorf("%s was extracted (err %v)", name, err)
+				}
+			}
+
+			listing := captureStdout(t, func() error { return op.List(input) })
+			if strings.Contains(listing, manifestName) || strings.Contains(listing, indexName) {
+				t.Errorf("listing shows metadata entries:\n%s", listing)
+			}
+			if !strings.Contains(listing, "a.txt") {
+				t.Errorf("listing misses a.txt:\n%s", listing)
+			}
+
+			got, err := op.Count(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := op.Count(plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("Count = %d, want %d as without metadata", got, want)
+			}
+
+			var buf bytes.Buffer
+			if err := op.verifyTo(input, &buf); err != nil {
+				t.Fatalf("verify: %v\n%s", err, buf.String())
+			}
+			if !strings.Contains(buf.String(), "(2 files,") {
+				t.Errorf("verify counted metadata entries: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestIsMetadataEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{".gar-manifest", true},
+		{".gar-index", true},
+		{"./.gar-index", true},
+		{".gar-index/", true},
+		{"dir/.gar-index", false},
+		{".gar-indexes", false},
+		{"a.txt", false},
+	}
+	for _, tt := range tests {
+		if got := isMetadataEntry(tt.name); got != tt.want {
+			t.Errorf("isMetadataEntry(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// mmapMinSize is the smallest entry Mmap writes through a memory mapping;
+// for anything smaller setting up the mapping costs more than it saves
+const mmapMinSize = 1 << 20
+
+// mapsEntry reports whether an extracted entry of size bytes is written
+// through a memory mapping. The size must be known and exact, so entries
+// whose line endings are converted are copied normally.
+func mapsEntry(opts *models.ArchiveOptions, name string, size int64) bool {
+	return opts.Mmap && size >= mmapMinSize && size <= math.MaxInt && !convertsText(opts, name)
+}
+
+// copyMapped allocates size bytes for f and copies src into a shared
+// mapping of it. When the space cannot be allocated up front (a sparse file
+// would fault once the disk fills) or f cannot be mapped, the content is
+// written normally.
+func copyMapped(f *os.File, src io.Reader, size int64) (int64, error) {
+	if err := allocateFile(f, size); err != nil {
+		return copyUnmapped(f, src)
+	}
+	data, err := mapFile(f, int(size))
+	if err != nil {
+		return copyUnmapped(f, src)
+	}
+
+	n, err := io.ReadFull(src, data)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		err = errors.New("entry is shorter than its recorded size")
+	case err == nil:
+		// The content must end where the recorded size says
+		var extra [1]byte
+		if _, rerr := io.ReadFull(src, extra[:]); rerr == nil {
+			err = errors.New("entry is longer than its recorded size")
+		} else if rerr != io.EOF {
+			err = rerr
+		}
+	}
+
+	if uerr := unmapFile(data); err == nil {
+		err = uerr
+	}
+	return int64(n), err
+}
+
+// copyUnmapped drops whatever an attempt to map f left in it and copies src
+// with write(2)
+func copyUnmapped(f *os.File, src io.Reader) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	return copyPooled(f, src)
+}
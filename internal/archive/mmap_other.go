@@ -0,0 +1,18 @@
+//go:build !unix
+
+package archive
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile is unsupported on this platform, so -mmap copies normally
+func mapFile(*os.File, int) ([]byte, error) {
+	return nil, errors.New("memory-mapped output is not supported on this platform")
+}
+
+// unmapFile is unsupported on this platform
+func unmapFile([]byte) error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyMapped(t *testing.T) {
+	data := gzipTestData(mmapMinSize + 12345)
+
+	tests := []struct {
+		name string
+		src  []byte
+		size int64
+		want string
+	}{
+		{"exact", data, int64(len(data)), ""},
+		{"short", data[:len(data)-1], int64(len(data)), "shorter than its recorded size"},
+		{"long", data, int64(len(data)) - 1, "longer than its recorded size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = copyMapped(f, bytes.NewReader(tt.src), tt.size)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("error = %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.src) {
+				t.Errorf("file holds %d bytes, want the %d copied", len(got), len(tt.src))
+			}
+		})
+	}
+}
+
+func BenchmarkCopyEntry(b *testing.B) {
+	data := gzipTestData(64 << 20)
+	dir := b.TempDir()
+
+	for _, bc := range []struct {
+		name string
+		mmap bool
+	}{{"write", false}, {"mmap", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			path := filepath.Join(dir, bc.name)
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				f, err := os.Create(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if bc.mmap {
+					_, err = copyMapped(f, bytes.NewReader(data), int64(len(data)))
+				} else {
+					_, err = copyPooled(f, bytes.NewReader(data))
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package archive
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the first size bytes of f for reading and writing, with
+// changes written back to the file
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+// unmapFile releases a mapping made by mapFile
+func unmapFile(data []byte) error {
+	return unix.Munmap(data)
+}
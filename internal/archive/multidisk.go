@@ -0,0 +1,405 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Zip records involved in reassembling multi-disk archives
+const (
+	zip64LocatorSig  = 0x07064b50
+	zip64LocatorSize = 20
+	zip64EndSize     = 56
+	zipEndSize       = 22
+	zipCentralSize   = 46
+
+	// maxZipDisks is the most disks the 16-bit fields of the end record
+	// can count; a zip64 locator claiming more is not believed
+	maxZipDisks = 0xffff
+)
+
+// zipArchive is an open zip archive, possibly spanning several disks
+type zipArchive struct {
+	*zip.Reader
+	// size is the total size of all segments
+	size  int64
+	files []*os.File
+}
+
+// Close closes every segment
+func (z *zipArchive) Close() error {
+	var err error
+	for _, f := range z.files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openZip opens the zip at inputPath. A multi-disk archive, whose end of
+// central directory record in the final .zip names a disk other than the
+// first, is read across its .z01, .z02, ... segments in order.
+func openZip(inputPath string) (*zipArchive, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	end, err := readZipEnd(file, info.Size())
+	if err != nil || end.disk == 0 {
+		// Not a spanned archive (or not a zip at all); let archive/zip
+		// report any problem
+		zr, err := newZipReader(file, info.Size())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &zipArchive{Reader: zr, size: info.Size(), files: []*os.File{file}}, nil
+	}
+
+	z, err := openMultiDisk(inputPath, file, info.Size(), end)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("multi-disk zip: %w", err)
+	}
+	return z, nil
+}
+
+// zipEnd is the end of central directory information of a zip
+type zipEnd struct {
+	// disk is the number of the disk holding the record, which is the
+	// last one
+	disk      uint32
+	cdDisk    uint32
+	records   uint64
+	cdSize    uint64
+	cdOffset  uint64
+	zip64Disk uint32
+	zip64Off  uint64
+	zip64     bool
+}
+
+// readZipEnd locates and decodes the end of central directory record (and
+// the zip64 locator preceding it, if any) at the end of file
+func readZipEnd(file *os.File, size int64) (*zipEnd, error) {
+	tailSize := min(size, zipTailSize+zip64LocatorSize)
+	tail := make([]byte, tailSize)
+	if _, err := file.ReadAt(tail, size-tailSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	i := bytes.LastIndex(tail, zipEOCDMagic)
+	if i < 0 || len(tail)-i < zipEndSize {
+		return nil, errors.New("no end of central directory record")
+	}
+
+	le := binary.LittleEndian
+	rec := tail[i:]
+	end := &zipEnd{
+		disk:     uint32(le.Uint16(rec[4:])),
+		cdDisk:   uint32(le.Uint16(rec[6:])),
+		records:  uint64(le.Uint16(rec[10:])),
+		cdSize:   uint64(le.Uint32(rec[12:])),
+		cdOffset: uint64(le.Uint32(rec[16:])),
+	}
+
+	if i >= zip64LocatorSize {
+		loc := tail[i-zip64LocatorSize : i]
+		if le.Uint32(loc) == zip64LocatorSig {
+			end.zip64 = true
+			end.zip64Disk = le.Uint32(loc[4:])
+			end.zip64Off = le.Uint64(loc[8:])
+			if disks := le.Uint32(loc[16:]); disks > 0 {
+				end.disk = disks - 1
+			}
+		}
+	}
+	return end, nil
+}
+
+// segmentPaths returns the paths of all disks of a spanned archive whose
+// last disk is lastPath: name.z01, name.z02, ... then name.zip
+func segmentPaths(lastPath string, disks int) []string {
+	base := lastPath
+	if ext := filepath.Ext(lastPath); strings.EqualFold(ext, ".zip") {
+		base = strings.TrimSuffix(lastPath, ext)
+	}
+
+	paths := make([]string, 0, disks)
+	for i := 1; i < disks; i++ {
+		paths = append(paths, fmt.Sprintf("%s.z%02d", base, i))
+	}
+	return append(paths, lastPath)
+}
+
+// openMultiDisk concatenates the segments and appends a rewritten central
+// directory whose offsets are absolute, so archive/zip (which ignores disk
+// numbers) can read the result as one archive
+func openMultiDisk(inputPath string, last *os.File, lastSize int64, end *zipEnd) (*zipArchive, error) {
+	if end.disk >= maxZipDisks {
+		return nil, fmt.Errorf("archive claims %d disks", uint64(end.disk)+1)
+	}
+	paths := segmentPaths(inputPath, int(end.disk)+1)
+	z := &zipArchive{}
+
+	var parts []readerAtPart
+	var bases []int64
+	var offset int64
+	for i, path := range paths {
+		file, size := last, lastSize
+		if i < len(paths)-1 {
+			f, err := os.Open(path)
+			if err != nil {
+				z.Close()
+				return nil, err
+			}
+			z.files = append(z.files, f)
+			info, err := f.Stat()
+			if err != nil {
+				z.Close()
+				return nil, err
+			}
+			file, size = f, info.Size()
+		}
+		parts = append(parts, readerAtPart{r: file, off: offset, size: size})
+		bases = append(bases, offset)
+		offset += size
+	}
+	z.files = append(z.files, last)
+	joined := &multiReaderAt{parts: parts, size: offset}
+
+	fail := func(err error) (*zipArchive, error) {
+		// The last segment is closed by the caller
+		for _, f := range z.files[:len(z.files)-1] {
+			f.Close()
+		}
+		return nil, err
+	}
+
+	if end.zip64 {
+		if err := readZip64End(joined, bases, end); err != nil {
+			return fail(err)
+		}
+	}
+	if int(end.cdDisk) >= len(bases) {
+		return fail(fmt.Errorf("central directory on missing disk %d", end.cdDisk))
+	}
+
+	// The directory must lie within the segments before it is allocated:
+	// the sizes in the end record are not trusted
+	start := uint64(bases[end.cdDisk])
+	if end.cdOffset > uint64(offset)-start || end.cdSize > uint64(offset)-start-end.cdOffset {
+		return fail(fmt.Errorf("central directory (%d bytes at %d on disk %d) extends past the end of the archive", end.cdSize, end.cdOffset, end.cdDisk))
+	}
+	cd := make([]byte, end.cdSize)
+	if _, err := joined.ReadAt(cd, int64(start+end.cdOffset)); err != nil {
+		return fail(fmt.Errorf("read central directory: %w", err))
+	}
+	if err := absoluteOffsets(cd, bases); err != nil {
+		return fail(err)
+	}
+
+	tail := append(cd, zipEndRecords(end.records, uint64(len(cd)), uint64(offset))...)
+	parts = append(parts, readerAtPart{r: bytes.NewReader(tail), off: offset, size: int64(len(tail))})
+	joined = &multiReaderAt{parts: parts, size: offset + int64(len(tail))}
+
+	zr, err := newZipReader(joined, joined.size)
+	if err != nil {
+		return fail(err)
+	}
+	z.Reader = zr
+	z.size = offset
+	return z, nil
+}
+
+// readZip64End replaces the directory location in end with the values of
+// the zip64 end of central directory record
+func readZip64End(r io.ReaderAt, bases []int64, end *zipEnd) error {
+	if int(end.zip64Disk) >= len(bases) {
+		return fmt.Errorf("zip64 record on missing disk %d", end.zip64Disk)
+	}
+	rec := make([]byte, zip64EndSize)
+	if _, err := r.ReadAt(rec, bases[end.zip64Disk]+int64(end.zip64Off)); err != nil {
+		return err
+	}
+
+	le := binary.LittleEndian
+	if le.Uint32(rec) != zip64EndSig {
+		return errors.New("invalid zip64 end of central directory record")
+	}
+	end.cdDisk = le.Uint32(rec[20:])
+	end.records = le.Uint64(rec[32:])
+	end.cdSize = le.Uint64(rec[40:])
+	end.cdOffset = le.Uint64(rec[48:])
+	return nil
+}
+
+// absoluteOffsets rewrites the local header offsets of every central
+// directory entry in cd to offsets into the concatenated segments
+func absoluteOffsets(cd []byte, bases []int64) error {
+	le := binary.LittleEndian
+	for len(cd) > 0 {
+		if len(cd) < zipCentralSize || le.Uint32(cd) != zipCentralHeaderSig {
+			return errors.New("invalid central directory header")
+		}
+		nameLen := int(le.Uint16(cd[28:]))
+		extraLen := int(le.Uint16(cd[30:]))
+		commentLen := int(le.Uint16(cd[32:]))
+		if len(cd) < zipCentralSize+nameLen+extraLen+commentLen {
+			return errors.New("truncated central directory")
+		}
+		extra := cd[zipCentralSize+nameLen : zipCentralSize+nameLen+extraLen]
+
+		disk := uint32(le.Uint16(cd[34:]))
+		offset := uint64(le.Uint32(cd[42:]))
+
+		// Values that do not fit are moved to the zip64 extra field, in
+		// the order uncompressed size, compressed size, offset, disk
+		var offsetField []byte
+		if field := zipExtraData(extra, zip64ExtraID); field != nil {
+			if le.Uint32(cd[24:]) == 0xFFFFFFFF && len(field) >= 8 {
+				field = field[8:]
+			}
+			if le.Uint32(cd[20:]) == 0xFFFFFFFF && len(field) >= 8 {
+				field = field[8:]
+			}
+			if offset == 0xFFFFFFFF && len(field) >= 8 {
+				offsetField = field[:8]
+				offset = le.Uint64(field)
+				field = field[8:]
+			}
+			if disk == 0xFFFF && len(field) >= 4 {
+				disk = le.Uint32(field)
+			}
+		}
+
+		if int(disk) >= len(bases) {
+			return fmt.Errorf("entry on missing disk %d", disk)
+		}
+		abs := uint64(bases[disk]) + offset
+
+		switch {
+		case offsetField != nil:
+			le.PutUint64(offsetField, abs)
+		case abs < 0xFFFFFFFF:
+			le.PutUint32(cd[42:], uint32(abs))
+		default:
+			return errors.New("entry offset exceeds 4 GiB without a zip64 field")
+		}
+
+		cd = cd[zipCentralSize+nameLen+extraLen+commentLen:]
+	}
+	return nil
+}
+
+// zipExtraData returns the data of the extra field with id, or nil
+func zipExtraData(extra []byte, id uint16) []byte {
+	le := binary.LittleEndian
+	for len(extra) >= 4 {
+		fieldID, size := le.Uint16(extra), int(le.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			return nil
+		}
+		if fieldID == id {
+			return extra[:size]
+		}
+		extra = extra[size:]
+	}
+	return nil
+}
+
+// zipEndRecords encodes single-disk end of central directory records for a
+// directory of cdSize bytes at cdOffset, using zip64 records when needed
+func zipEndRecords(records, cdSize, cdOffset uint64) []byte {
+	le := binary.LittleEndian
+	var buf []byte
+
+	needZip64 := records >= 0xFFFF || cdSize >= 0xFFFFFFFF || cdOffset >= 0xFFFFFFFF
+	if needZip64 {
+		rec := make([]byte, zip64EndSize)
+		le.PutUint32(rec, zip64EndSig)
+		le.PutUint64(rec[4:], zip64EndSize-12)
+		le.PutUint16(rec[12:], 45)
+		le.PutUint16(rec[14:], 45)
+		le.PutUint64(rec[24:], records)
+		le.PutUint64(rec[32:], records)
+		le.PutUint64(rec[40:], cdSize)
+		le.PutUint64(rec[48:], cdOffset)
+
+		loc := make([]byte, zip64LocatorSize)
+		le.PutUint32(loc, zip64LocatorSig)
+		le.PutUint64(loc[8:], cdOffset+cdSize)
+		le.PutUint32(loc[16:], 1)
+
+		buf = append(append(buf, rec...), loc...)
+		records, cdSize, cdOffset = 0xFFFF, 0xFFFFFFFF, 0xFFFFFFFF
+	}
+
+	rec := make([]byte, zipEndSize)
+	le.PutUint32(rec, zipEndSig)
+	le.PutUint16(rec[8:], uint16(records))
+	le.PutUint16(rec[10:], uint16(records))
+	le.PutUint32(rec[12:], uint32(cdSize))
+	le.PutUint32(rec[16:], uint32(cdOffset))
+	return append(buf, rec...)
+}
+
+// readerAtPart places r at offset off of a multiReaderAt
+type readerAtPart struct {
+	r    io.ReaderAt
+	off  int64
+	size int64
+}
+
+// multiReaderAt presents consecutive parts as one io.ReaderAt
+type multiReaderAt struct {
+	parts []readerAtPart
+	size  int64
+}
+
+func (m *multiReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= m.size {
+		return 0, io.EOF
+	}
+
+	// Find the part containing off
+	i := sort.Search(len(m.parts), func(i int) bool {
+		return m.parts[i].off+m.parts[i].size > off
+	})
+
+	n := 0
+	for ; i < len(m.parts) && n < len(p); i++ {
+		part := m.parts[i]
+		rel := off + int64(n) - part.off
+		chunk := p[n:min(len(p), n+int(part.size-rel))]
+		read, err := part.r.ReadAt(chunk, rel)
+		n += read
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if read < len(chunk) {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// splitZip turns a single-disk zip into a two-disk one split at at, which
+// must lie before the central directory: local header offsets and the end
+// record are rewritten to be relative to their disks
+func splitZip(t *testing.T, data []byte, at int) (first, last []byte) {
+	t.Helper()
+	le := binary.LittleEndian
+	data = bytes.Clone(data)
+
+	end := bytes.LastIndex(data, zipEOCDMagic)
+	cdSize := int(le.Uint32(data[end+12:]))
+	cdOffset := int(le.Uint32(data[end+16:]))
+	if at > cdOffset {
+		t.Fatalf("split point %d is past the central directory at %d", at, cdOffset)
+	}
+
+	for p := cdOffset; p < cdOffset+cdSize; {
+		offset := int(le.Uint32(data[p+42:]))
+		if offset >= at {
+			le.PutUint16(data[p+34:], 1)
+			le.PutUint32(data[p+42:], uint32(offset-at))
+		}
+		p += zipCentralSize + int(le.Uint16(data[p+28:])) + int(le.Uint16(data[p+30:])) + int(le.Uint16(data[p+32:]))
+	}
+	le.PutUint16(data[end+4:], 1)
+	le.PutUint16(data[end+6:], 1)
+	le.PutUint32(data[end+16:], uint32(cdOffset-at))
+	return data[:at], data[at:]
+}
+
+// writeSplitZip writes a two-disk archive of files to dir and returns the
+// path of its last disk
+func writeSplitZip(t *testing.T, dir string, files map[string][]byte, order []string) string {
+	t.Helper()
+	data := buildZip(t, zip.Deflate, files, order)
+	// Split inside the second entry, as spanning tools do
+	first, last := splitZip(t, data, bytes.Index(data, []byte(order[1]))+3)
+
+	lastPath := filepath.Join(dir, "multi.zip")
+	if err := os.WriteFile(filepath.Join(dir, "multi.z01"), first, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lastPath, last, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return lastPath
+}
+
+func TestOpenMultiDisk(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt": []byte("first disk"),
+		"b.txt": bytes.Repeat([]byte("spanning "), 500),
+		"c.txt": []byte("last disk"),
+	}
+	lastPath := writeSplitZip(t, t.TempDir(), files, []string{"a.txt", "b.txt", "c.txt"})
+
+	z, err := openZip(lastPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+
+	if len(z.File) != len(files) {
+		t.Fatalf("read %d entries, want %d", len(z.File), len(files))
+	}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if !bytes.Equal(got, files[f.Name]) {
+			t.Errorf("%s: content differs", f.Name)
+		}
+	}
+}
+
+func TestOpenMultiDiskBadDirectory(t *testing.T) {
+	files := map[string][]byte{"a.txt": []byte("a"), "b.txt": []byte("b")}
+	le := binary.LittleEndian
+
+	tests := []struct {
+		name   string
+		modify func(end []byte)
+	}{
+		{"huge size", func(end []byte) { le.PutUint32(end[12:], 0xffffffff) }},
+		{"size past end", func(end []byte) { le.PutUint32(end[12:], le.Uint32(end[12:])+1) }},
+		{"offset past end", func(end []byte) { le.PutUint32(end[16:], 0xfffffff0) }},
+		{"missing disk", func(end []byte) { le.PutUint16(end[6:], 7) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lastPath := writeSplitZip(t, t.TempDir(), files, []string{"a.txt", "b.txt"})
+			data, err := os.ReadFile(lastPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(data[bytes.LastIndex(data, zipEOCDMagic):])
+			if err := os.WriteFile(lastPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			z, err := openZip(lastPath)
+			if err == nil {
+				z.Close()
+				t.Fatal("opened a zip with a bad central directory")
+			}
+			if !strings.Contains(err.Error(), "multi-disk zip") {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
+
+func FuzzOpenZip(f *testing.F) {
+	f.Add(buildZipSeed(zip.Deflate), uint16(1), uint16(1))
+	f.Fuzz(func(t *testing.T, data []byte, disk, cdDisk uint16) {
+		// Mark the archive as spanned so the multi-disk reader parses it
+		if end := bytes.LastIndex(data, zipEOCDMagic); end >= 0 && len(data)-end >= zipEndSize {
+			binary.LittleEndian.PutUint16(data[end+4:], disk%4)
+			binary.LittleEndian.PutUint16(data[end+6:], cdDisk%4)
+		}
+		dir := t.TempDir()
+		path := filepath.Join(dir, "fuzz.zip")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i < 4; i++ {
+			os.WriteFile(filepath.Join(dir, "fuzz.z0"+string(rune('0'+i))), data[:len(data)/2], 0644)
+		}
+		if z, err := openZip(path); err == nil {
+			z.Close()
+		}
+	})
+}
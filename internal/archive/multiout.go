@@ -0,0 +1,155 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// splitOutputs splits a comma-separated -output value into its paths. A
+// comma preceded by a backslash is part of the path.
+func splitOutputs(outputPath string) []string {
+	if !strings.Contains(outputPath, ",") {
+		return []string{outputPath}
+	}
+
+	var paths []string
+	var current strings.Builder
+	flush := func() {
+		if p := strings.TrimSpace(current.String()); p != "" {
+			paths = append(paths, p)
+		}
+		current.Reset()
+	}
+	for i := 0; i < len(outputPath); i++ {
+		switch {
+		case strings.HasPrefix(outputPath[i:], `\,`):
+			current.WriteByte(',')
+			i++
+		case outputPath[i] == ',':
+			flush()
+		default:
+			current.WriteByte(outputPath[i])
+		}
+	}
+	flush()
+	return paths
+}
+
+// writeArchives writes the same entries to several outputs at once, each in
+// the format its extension names, so fill reads the input only once
+func (op *Operator) writeArchives(outputPaths []string, fill func(ew entryWriter) error) error {
+	var archives []*pendingArchive
+	abort := func(pending []*pendingArchive) {
+		for _, a := range pending {
+			a.abort()
+		}
+	}
+
+	tee := &teeEntryWriter{}
+	for _, outputPath := range outputPaths {
+		opts := *op.opts
+		opts.Format = formatFromPath(outputPath)
+
+		a, err := NewOperator(&opts).createArchive(outputPath)
+		if err != nil {
+			abort(archives)
+			return fmt.Errorf("%s: %w", outputPath, err)
+		}
+		archives = append(archives, a)
+		tee.writers = append(tee.writers, a.ew)
+	}
+
+	tally := &entryTally{entryWriter: tee}
+	if err := fill(tally); err != nil {
+		if errors.Is(err, errInterrupted) {
+			for i, a := range archives {
+				if perr := a.finishPartial(outputPaths[i], tally); !errors.Is(perr, errInterrupted) {
+					err = perr
+				}
+			}
+			return err
+		}
+		abort(archives)
+		return err
+	}
+	for i, a := range archives {
+		if err := a.finish(); err != nil {
+			abort(archives[i+1:])
+			return fmt.Errorf("%s: %w", outputPaths[i], err)
+		}
+	}
+	return nil
+}
+
+// teeEntryWriter writes every entry to several entry writers. Content is
+// read once: the first writer reads it directly and the others receive a
+// copy through pipes, each compressing in its own goroutine.
+type teeEntryWriter struct {
+	writers []entryWriter
+}
+
+// WriteEntry adds e to every writer
+func (t *teeEntryWriter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	// Writers may update the entry they are given (the encrypter does), so
+	// every copy is taken before the first writer starts
+	entries := []*archiveEntry{e}
+	for range t.writers[1:] {
+		entries = append(entries, e.clone())
+	}
+
+	if r == nil {
+		for i, w := range t.writers {
+			if err := w.WriteEntry(entries[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	pipes := make([]io.Writer, 0, len(t.writers)-1)
+	closers := make([]*io.PipeWriter, 0, len(t.writers)-1)
+	errs := make(chan error, len(t.writers)-1)
+	for i, w := range t.writers[1:] {
+		pr, pw := io.Pipe()
+		pipes = append(pipes, pw)
+		closers = append(closers, pw)
+
+		go func(w entryWriter, entry *archiveEntry) {
+			err := w.WriteEntry(entry, pr)
+			if err != nil {
+				// Stop the other writers rather than blocking them
+				pr.CloseWithError(err)
+			} else {
+				// Drain anything the writer left so the tee keeps flowing
+				io.Copy(io.Discard, pr)
+			}
+			errs <- err
+		}(w, entries[i+1])
+	}
+
+	err := t.writers[0].WriteEntry(e, io.TeeReader(r, io.MultiWriter(pipes...)))
+	for _, pw := range closers {
+		pw.CloseWithError(err)
+	}
+	for range closers {
+		if werr := <-errs; err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// Close closes every writer. writeArchives finishes each archive on its own
+// instead, so one failing output does not leave the others unclosed.
+func (t *teeEntryWriter) Close() error {
+	var firstErr error
+	for _, w := range t.writers {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestSplitOutputs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"out.zip", []string{"out.zip"}},
+		{"a.zip,b.tar.gz", []string{"a.zip", "b.tar.gz"}},
+		{" a.zip , ,b.tar.gz,", []string{"a.zip", "b.tar.gz"}},
+		{`release\,v1.zip`, []string{"release,v1.zip"}},
+		{`a\,b.zip,c.tar.gz`, []string{"a,b.zip", "c.tar.gz"}},
+		{`dir\sub\,x.zip`, []string{`dir\sub,x.zip`}},
+		{`dir\out.zip,b.zip`, []string{`dir\out.zip`, "b.zip"}},
+	}
+	for _, tt := range tests {
+		if got := splitOutputs(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("splitOutputs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompressMultipleFormats(t *testing.T) {
+	files := map[string]string{
+		"a.txt":         "alpha",
+		"empty":         "",
+		"sub/b.txt":     "beta",
+		"sub/deep/big":  strings.Repeat("0123456789abcdef", 1<<16),
+		"sub/deep/more": "more",
+	}
+	src := writeTestTree(t, files)
+	dir := t.TempDir()
+	outputs := []string{filepath.Join(dir, "out.zip"), filepath.Join(dir, "out.tar.gz"), filepath.Join(dir, "out.tar.zst")}
+
+	if err := NewOperator(&models.ArchiveOptions{}).Compress(src, strings.Join(outputs, ",")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, output := range outputs {
+		if format, err := sniffFile(output); err != nil || format != formatFromPath(output) {
+			t.Errorf("%s holds format %s, %v", filepath.Base(output), formatName(format), err)
+		}
+		extracted := filepath.Join(dir, filepath.Base(output)+".x")
+		if err := NewOperator(&models.ArchiveOptions{}).Extract(output, extracted); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(output), err)
+		}
+		if got := readTree(t, extracted); !maps.Equal(got, files) {
+			t.Errorf("%s extracts to %d files, want the %d of the input", filepath.Base(output), len(got), len(files))
+		}
+	}
+}
+
+func TestCompressMultipleFormatsFailure(t *testing.T) {
+	src := writeTestTree(t, map[string]string{"a.txt": "alpha"})
+	dir := t.TempDir()
+	good := filepath.Join(dir, "out.zip")
+	bad := filepath.Join(dir, "missing", "out.tar.gz")
+
+	// The error names the output that failed
+	err := NewOperator(&models.ArchiveOptions{}).Compress(src, good+","+bad)
+	if err == nil || !strings.HasPrefix(err.Error(), bad+": ") {
+		t.Fatalf("err = %v, want it to name %s", err, bad)
+	}
+}
@@ -0,0 +1,86 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// walkOrdered is walkInput with the entries reordered per the OrderFrom
+// file: listed names come first in the listed order, then every other
+// entry sorted by name. All entries are collected before fn is called.
+func walkOrdered(inputPath string, info os.FileInfo, opts *models.ArchiveOptions, fn walkFunc) error {
+	rank, err := loadOrder(opts.OrderFrom)
+	if err != nil {
+		return err
+	}
+
+	type walkedEntry struct {
+		path, name string
+		fi         os.FileInfo
+	}
+	var entries []walkedEntry
+	err = walkInput(inputPath, info, opts, func(path, name string, fi os.FileInfo) error {
+		entries = append(entries, walkedEntry{path, name, fi})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		ri, listedI := rank[orderKey(entries[i].name)]
+		rj, listedJ := rank[orderKey(entries[j].name)]
+		switch {
+		case listedI && listedJ:
+			return ri < rj
+		case listedI != listedJ:
+			return listedI
+		default:
+			return entries[i].name < entries[j].name
+		}
+	})
+
+	for _, e := range entries {
+		if err := fn(e.path, e.name, e.fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadOrder reads an order file of one entry name per line, ignoring blank
+// lines and # comments, and returns each name's position
+func loadOrder(path string) (map[string]int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open order file: %w", err)
+	}
+	defer file.Close()
+
+	rank := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, dup := rank[orderKey(line)]; !dup {
+			rank[orderKey(line)] = len(rank)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read order file: %w", err)
+	}
+	return rank, nil
+}
+
+// orderKey normalizes a name so "dir" and "dir/" match
+func orderKey(name string) string {
+	return strings.TrimSuffix(name, "/")
+}
@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestOrderFrom(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\n",
+		"a.class":              "a",
+		"b.class":              "b",
+		"z/y.txt":              "y",
+		"c.txt":                "c",
+	})
+	order := writeFile(t, t.TempDir(), "order.txt", []byte(strings.Join([]string{
+		"# manifest first, as jar readers expect",
+		"META-INF/",
+		"META-INF/MANIFEST.MF",
+		"",
+		"z/y.txt",
+		"  b.class  ",
+		"missing.txt",
+		"b.class",
+	}, "\n")))
+
+	output := filepath.Join(t.TempDir(), "out.zip")
+	opts := &models.ArchiveOptions{Format: models.FormatZip, OrderFrom: order}
+	if err := NewOperator(opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var got []string
+	for _, f := range zr.File {
+		got = append(got, f.Name)
+	}
+	want := []string{"META-INF/", "META-INF/MANIFEST.MF", "z/y.txt", "b.class", "./", "a.class", "c.txt", "z/"}
+	if !slices.Equal(got, want) {
+		t.Errorf("central directory order = %q, want %q", got, want)
+	}
+
+	opts.OrderFrom = filepath.Join(t.TempDir(), "missing.txt")
+	if err := NewOperator(opts).Compress(src, output); err == nil || !strings.Contains(err.Error(), "open order file") {
+		t.Errorf("missing order file: err = %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/remote"
+)
+
+// archiveOutput is the destination an archive is written to: either a
+// local file or a temporary file that is uploaded on Close
+type archiveOutput struct {
+	file   *os.File
+	remote string
+	size   int64
+}
+
+// stdoutPath is the output path that writes the archive to standard output
+const stdoutPath = "-"
+
+// openOutput creates the archive destination for outputPath. Remote
+// destinations (s3://, dav://) are buffered in the temp directory first.
+func (op *Operator) openOutput(outputPath string) (*archiveOutput, error) {
+	if outputPath == stdoutPath {
+		return &archiveOutput{file: os.Stdout}, nil
+	}
+	if !remote.IsRemote(outputPath) {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveOutput{file: file}, nil
+	}
+
+	file, err := op.createTemp("gar-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	return &archiveOutput{file: file, remote: outputPath}, nil
+}
+
+// Write writes archive bytes to the destination
+func (o *archiveOutput) Write(p []byte) (int, error) {
+	n, err := o.file.Write(p)
+	o.size += int64(n)
+	return n, err
+}
+
+// Close finishes the archive, uploading it for remote destinations
+func (o *archiveOutput) Close() error {
+	if o.file == os.Stdout {
+		return nil
+	}
+	if o.remote == "" {
+		return o.file.Close()
+	}
+	defer o.discard()
+
+	if _, err := o.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return remote.Upload(context.Background(), o.remote, o.file, o.size)
+}
+
+// Abort releases the destination after a failed operation without uploading
+func (o *archiveOutput) Abort() {
+	if o.file == os.Stdout {
+		return
+	}
+	if o.remote == "" {
+		o.file.Close()
+		return
+	}
+	o.discard()
+}
+
+// discard closes and removes the temporary upload buffer
+func (o *archiveOutput) discard() {
+	o.file.Close()
+	os.Remove(o.file.Name())
+}
@@ -0,0 +1,76 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// errInterrupted stops compression between entries once the Context of
+// the options is done
+var errInterrupted = errors.New("interrupted")
+
+// partialExt is appended to the name of an archive finalized after an
+// interruption
+const partialExt = ".partial"
+
+// checkInterrupt returns errInterrupted once opts.Context is done
+func checkInterrupt(opts *models.ArchiveOptions) error {
+	if opts.Context != nil && opts.Context.Err() != nil {
+		return errInterrupted
+	}
+	return nil
+}
+
+// entryTally counts the entries written through it, so an interrupted
+// run can say what the partial archive holds
+type entryTally struct {
+	entryWriter
+	entries int
+	last    string
+}
+
+func (t *entryTally) WriteEntry(e *archiveEntry, r io.Reader) error {
+	if err := t.entryWriter.WriteEntry(e, r); err != nil {
+		return err
+	}
+	t.entries++
+	t.last = e.Name
+	return nil
+}
+
+// finishPartial completes an archive whose compression was interrupted:
+// the writers are closed as usual, so the archive is readable up to the
+// last complete entry, and it is renamed with the .partial suffix. Remote
+// archives are not uploaded, and partial archives are not signed. It
+// returns errInterrupted unless finalizing fails.
+func (a *pendingArchive) finishPartial(outputPath string, tally *entryTally) error {
+	if a.out.remote != "" {
+		a.abort()
+		return fmt.Errorf("%w; %s was not uploaded", errInterrupted, outputPath)
+	}
+
+	a.signer = nil
+	if err := a.finish(); err != nil {
+		return fmt.Errorf("finalize interrupted archive: %w", err)
+	}
+
+	name := outputPath
+	if a.out.file != os.Stdout {
+		name = outputPath + partialExt
+		if err := os.Rename(outputPath, name); err != nil {
+			return fmt.Errorf("finalize interrupted archive: %w", err)
+		}
+	}
+
+	if tally.entries == 0 {
+		fmt.Fprintf(os.Stderr, "Interrupted: %s holds no entries\n", name)
+	} else {
+		fmt.Fprintf(os.Stderr, "Interrupted: %s holds %d entries, up to %s\n", name, tally.entries, tally.last)
+	}
+	return errInterrupted
+}
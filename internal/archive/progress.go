@@ -0,0 +1,131 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/progress"
+)
+
+// trackEntry notifies the configured progress reporter that an entry is
+// starting and returns a reader reporting bytes read from src. The returned
+// done func must be called once the entry has been copied successfully.
+func trackEntry(src io.Reader, name string, size int64, opts *models.ArchiveOptions) (io.Reader, func()) {
+	reporter := opts.Progress
+	if reporter == nil {
+		return src, func() {}
+	}
+
+	reporter.Start(name, size)
+	pr := &progressReader{r: src, reporter: reporter}
+	return pr, func() { reporter.Done(name, pr.n) }
+}
+
+// copyBuffers recycles copy buffers across entries so archives with many
+// small files do not allocate one per entry
+var copyBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, bufferSize.Load())
+		return &buf
+	},
+}
+
+// bufferSize is the size of the copy and read buffers; see SetBufferSize
+var bufferSize atomic.Int64
+
+func init() {
+	bufferSize.Store(BufferSize)
+}
+
+// MinBufferSize is the smallest buffer SetBufferSize accepts
+const MinBufferSize = 4 * 1024
+
+// SetBufferSize changes the size of the buffers used to copy entry data
+// and to read zips sequentially, for every operation in the process
+func SetBufferSize(size int64) error {
+	if size < MinBufferSize {
+		return fmt.Errorf("buffer size %d is below the minimum of %d", size, MinBufferSize)
+	}
+	bufferSize.Store(size)
+	return nil
+}
+
+// copyPooled is io.Copy using a buffer from copyBuffers. Readers and
+// writers that copy by themselves (io.WriterTo, io.ReaderFrom) still do, so
+// a bytes.Buffer is written out directly and a file copied to a file uses
+// copy_file_range. Only the methods of *os.File are hidden when the other
+// side is not a file or socket, as they would fall back to io.Copy with a
+// buffer allocated per call.
+func copyPooled(dst io.Writer, src io.Reader) (int64, error) {
+	if _, ok := dst.(*os.File); ok && !copiesNatively(src) {
+		dst = struct{ io.Writer }{dst}
+	}
+	if _, ok := src.(*os.File); ok && !copiesNatively(dst) {
+		src = struct{ io.Reader }{src}
+	}
+
+	buf := copyBuffers.Get().(*[]byte)
+	// Buffers pooled before a size change are replaced as they come back
+	if size := bufferSize.Load(); int64(len(*buf)) != size {
+		fresh := make([]byte, size)
+		buf = &fresh
+	}
+	defer copyBuffers.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// copiesNatively reports whether a file can copy to or from x without a
+// user-space buffer: x is a file or socket, possibly behind a LimitReader
+func copiesNatively(x any) bool {
+	if lr, ok := x.(*io.LimitedReader); ok {
+		x = lr.R
+	}
+	switch x.(type) {
+	case *os.File, net.Conn:
+		return true
+	}
+	return false
+}
+
+// copyEntry copies an extracted entry's content from src to dst with progress
+// reporting, converting line endings of files matched by -text-pattern
+func copyEntry(dst io.Writer, src io.Reader, name string, size int64, opts *models.ArchiveOptions) (int64, error) {
+	if convertsText(opts, name) {
+		src = newLineEndingReader(src, opts.TextConvert)
+	}
+	r, done := trackEntry(src, name, size, opts)
+
+	var n int64
+	var err error
+	if f, ok := dst.(*os.File); ok && mapsEntry(opts, name, size) {
+		n, err = copyMapped(f, r, size)
+	} else {
+		n, err = copyPooled(dst, r)
+	}
+	if err != nil {
+		return n, err
+	}
+	done()
+	countFile(opts, n)
+	return n, nil
+}
+
+// progressReader forwards reads while reporting the bytes read
+type progressReader struct {
+	r        io.Reader
+	reporter progress.Reporter
+	n        int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.n += int64(n)
+	pr.reporter.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/progress"
+)
+
+// writerToReader records whether WriteTo was used
+type writerToReader struct {
+	*strings.Reader
+	used bool
+}
+
+func (r *writerToReader) WriteTo(w io.Writer) (int64, error) {
+	r.used = true
+	return r.Reader.WriteTo(w)
+}
+
+// readerFromWriter records whether ReadFrom was used
+type readerFromWriter struct {
+	bytes.Buffer
+	used bool
+}
+
+func (w *readerFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.used = true
+	return w.Buffer.ReadFrom(r)
+}
+
+func TestCopyPooled(t *testing.T) {
+	content := strings.Repeat("copy pooled ", 10000)
+
+	t.Run("WriterTo", func(t *testing.T) {
+		src := &writerToReader{Reader: strings.NewReader(content)}
+		var dst bytes.Buffer
+		if n, err := copyPooled(struct{ io.Writer }{&dst}, src); err != nil || n != int64(len(content)) {
+			t.Fatalf("copied %d, %v", n, err)
+		}
+		if !src.used || dst.String() != content {
+			t.Errorf("WriteTo used %v, content equal %v", src.used, dst.String() == content)
+		}
+	})
+
+	t.Run("ReaderFrom", func(t *testing.T) {
+		dst := &readerFromWriter{}
+		if _, err := copyPooled(dst, struct{ io.Reader }{strings.NewReader(content)}); err != nil {
+			t.Fatal(err)
+		}
+		if !dst.used || dst.String() != content {
+			t.Errorf("ReadFrom used %v, content equal %v", dst.used, dst.String() == content)
+		}
+	})
+
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		srcPath := filepath.Join(dir, "src")
+		if err := os.WriteFile(srcPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		src, err := os.Open(srcPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+		dst, err := os.Create(filepath.Join(dir, "dst"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dst.Close()
+
+		// A limited file to a file, then the rest to a buffer
+		if n, err := copyPooled(dst, io.LimitReader(src, 1000)); err != nil || n != 1000 {
+			t.Fatalf("copied %d, %v", n, err)
+		}
+		var rest bytes.Buffer
+		if _, err := copyPooled(&rest, src); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(dst.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got)+rest.String() != content {
+			t.Error("copied content differs")
+		}
+	})
+}
+
+func TestCopiesNatively(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name string
+		x    any
+		want bool
+	}{
+		{"file", f, true},
+		{"limited file", io.LimitReader(f, 1), true},
+		{"buffer", &bytes.Buffer{}, false},
+		{"limited buffer", io.LimitReader(&bytes.Buffer{}, 1), false},
+	}
+	for _, tt := range tests {
+		if got := copiesNatively(tt.x); got != tt.want {
+			t.Errorf("%s: copiesNatively = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParallelExtractProgressTotals(t *testing.T) {
+	files := make(map[string]string)
+	var total int64
+	for i := range 64 {
+		content := strings.Repeat(fmt.Sprintf("file %d ", i), 100*(i+1))
+		files[fmt.Sprintf("d%d/f%d.txt", i%4, i)] = content
+		total += int64(len(content))
+	}
+	input := compressTree(t, files, models.ArchiveOptions{})
+
+	var out bytes.Buffer
+	opts := &models.ArchiveOptions{Workers: 8, Progress: progress.NewJSON(&out)}
+	if err := NewOperator(opts).Extract(input, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var final progress.Event
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &final); err != nil {
+		t.Fatal(err)
+	}
+	if final.Event != "finish" || final.Bytes != total || final.Entries != int64(len(files)) {
+		t.Errorf("final event %+v, want finish with %d bytes and %d entries", final, total, len(files))
+	}
+}
@@ -0,0 +1,76 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rawTarWriter is implemented by the tar entry writers, which can take a
+// complete tar stream in place of individual entries
+type rawTarWriter interface {
+	writeRawTar(r io.Reader) error
+}
+
+// compressRawTar compresses an existing tar stream read from inputPath
+// (stdin for "-") without parsing it, so a pipeline that already produces
+// tar only pays for the compressor. Any tar format can be written; the
+// stream goes through the same compressor as a walked directory would.
+func (op *Operator) compressRawTar(inputPath, outputPath string) error {
+	if !isTarFormat(op.opts.Format) {
+		return fmt.Errorf("-raw-tar requires tar output (tar, tar.gz, tar.bz2, tar.zst or tar.xz)")
+	}
+	// Entries are never seen individually, so nothing can be recorded,
+	// changed or encrypted per entry
+	if op.opts.Manifest || op.opts.Merkle || op.opts.Index || len(op.opts.EncryptPattern) > 0 || op.opts.AttrRules != "" {
+		return fmt.Errorf("-raw-tar cannot be combined with -manifest, -merkle, -index, -encrypt-pattern or -attr-rules")
+	}
+
+	var in io.Reader = os.Stdin
+	if inputPath != stdoutPath {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return fmt.Errorf("input path error: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	stream := bufio.NewReaderSize(in, blockSize)
+	if !isTarStream(stream) {
+		return fmt.Errorf("input is not a tar stream")
+	}
+
+	a, err := op.createArchive(outputPath)
+	if err != nil {
+		return err
+	}
+	w, ok := a.ew.(rawTarWriter)
+	if !ok {
+		a.abort()
+		return fmt.Errorf("-raw-tar requires tar output")
+	}
+	if err := w.writeRawTar(stream); err != nil {
+		a.abort()
+		return err
+	}
+	return a.finish()
+}
+
+// writeRawTar copies a complete tar stream, trailer included, into the
+// compressor. Close then only flushes the compressor.
+func (w *tarEntryWriter) writeRawTar(r io.Reader) error {
+	w.raw = true
+	_, err := copyPooled(w.w, r)
+	return err
+}
+
+// closeTar writes the tar trailer unless a raw stream brought its own
+func (w *tarEntryWriter) closeTar() error {
+	if w.raw {
+		return nil
+	}
+	return w.tw.Close()
+}
@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// writeTar writes a plain tar holding files to dir/in.tar
+func writeTar(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, body := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), ModTime: time.Unix(1700000000, 0)}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "in.tar")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCompressRawTar(t *testing.T) {
+	files := map[string]string{"a.txt": "alpha", "b.txt": strings.Repeat("beta", 1000)}
+
+	tests := []struct {
+		name     string
+		format   models.ArchiveFormat
+		ext      string
+		password string
+	}{
+		{"tar", models.FormatTar, ".tar", ""},
+		{"tar.gz", models.FormatTarGz, ".tar.gz", ""},
+		{"tar.bz2", models.FormatTarBz2, ".tar.bz2", ""},
+		{"tar.zst", models.FormatTarZstd, ".tar.zst", ""},
+		{"tar.xz", models.FormatTarXz, ".tar.xz", ""},
+		{"encrypted tar.zst", models.FormatTarZstd, ".tar.zst", "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := writeTar(t, dir, files)
+			output := filepath.Join(dir, "out"+tt.ext)
+
+			opts := &models.ArchiveOptions{Format: tt.format, RawTar: true, Password: tt.password}
+			if err := NewOperator(opts).Compress(input, output); err != nil {
+				t.Fatal(err)
+			}
+
+			dest := filepath.Join(dir, "dest")
+			extractOpts := &models.ArchiveOptions{Format: tt.format, Password: tt.password}
+			if err := NewOperator(extractOpts).Extract(output, dest); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(dest, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressRawTarRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		opts models.ArchiveOptions
+		want string
+	}{
+		{"zip output", models.ArchiveOptions{Format: models.FormatZip}, "requires tar output"},
+		{"manifest", models.ArchiveOptions{Format: models.FormatTarGz, Manifest: true}, "cannot be combined"},
+		{"attr rules", models.ArchiveOptions{Format: models.FormatTarXz, AttrRules: "rules"}, "cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := writeTar(t, dir, map[string]string{"a.txt": "a"})
+			output := filepath.Join(dir, "out")
+
+			tt.opts.RawTar = true
+			err := NewOperator(&tt.opts).Compress(input, output)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+			if _, err := os.Stat(output); !os.IsNotExist(err) {
+				t.Errorf("output was created (err %v)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// damageRecorder remembers the first error reading an entry's content, so
+// damage to the archive can be told apart from failures writing the output
+type damageRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *damageRecorder) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF && d.err == nil {
+		d.err = err
+	}
+	return n, err
+}
+
+// recoverZip extracts what it can from a damaged or truncated zip by
+// reading local headers front to back, as with -stream, and stops at the
+// first entry that cannot be read instead of failing. The central
+// directory is never needed.
+func recoverZip(reader io.Reader, outputPath string, opts *models.ArchiveOptions) error {
+	zr := newZipStreamReader(reader)
+
+	c, err := newEntryCipher(opts)
+	if err != nil {
+		return err
+	}
+
+	recovered := 0
+	var damage error
+	for {
+		entry, body, err := zr.Next()
+		if err == errZipStreamEnd {
+			break
+		}
+		if err != nil {
+			damage = err
+			break
+		}
+
+		content := &damageRecorder{r: body}
+		if err := extractZipStreamEntry(entry, content, c, outputPath, opts); err != nil {
+			if content.err == nil {
+				return err
+			}
+			damage = fmt.Errorf("%s: %w", entry.Name, content.err)
+			break
+		}
+		recovered++
+	}
+
+	reportRecovery(recovered, damage)
+	return nil
+}
+
+// listRecoveredZip lists the entries of a damaged or truncated zip up to
+// the first one that cannot be read
+func listRecoveredZip(inputPath string) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zr := newZipStreamReader(file)
+	recovered := 0
+	var damage error
+
+	fmt.Println("Archive contents:")
+	for {
+		entry, body, err := zr.Next()
+		if err == errZipStreamEnd {
+			break
+		}
+		if err != nil {
+			damage = err
+			break
+		}
+		// Sizes of streamed entries are only known after their content
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			damage = fmt.Errorf("%s: %w", entry.Name, err)
+			break
+		}
+		if isMetadataEntry(entry.Name) {
+			continue
+		}
+		fmt.Printf("  %s (%d bytes)%s\n", entry.Name, entry.Size, encryptedSuffix(entry.encrypted))
+		recovered++
+	}
+
+	reportRecovery(recovered, damage)
+	return nil
+}
+
+// reportRecovery prints how many entries were read intact and where
+// reading stopped, if the archive is damaged
+func reportRecovery(recovered int, damage error) {
+	if damage == nil {
+		fmt.Printf("Recovered %d entries; no damage found\n", recovered)
+		return
+	}
+	fmt.Printf("Recovered %d entries; stopped at damaged data: %v\n", recovered, damage)
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestRecoverTruncatedZip(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":     []byte("alpha"),
+		"dir/b.txt": bytes.Repeat([]byte("beta "), 2000),
+		"c.bin":     bytes.Repeat([]byte("0123456789"), 10000),
+	}
+	order := []string{"a.txt", "dir/b.txt", "c.bin"}
+
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		data := buildZip(t, method, files, order)
+		cd := bytes.Index(data, []byte("PK\x01\x02"))
+		last := bytes.LastIndex(data[:cd], zipLocalMagic)
+
+		tests := []struct {
+			name    string
+			cut     int
+			want    []string
+			summary string
+		}{
+			{"no central directory", cd, order, "Recovered 3 entries; no damage found"},
+			{"truncated entry", last + 30 + len("c.bin") + 100, order[:2], "Recovered 2 entries; stopped at damaged data: c.bin: "},
+		}
+		for _, tt := range tests {
+			dir := t.TempDir()
+			input := writeFile(t, dir, "in.zip", data[:tt.cut])
+
+			// Without -recover the archive cannot be opened at all
+			if err := NewOperator(&models.ArchiveOptions{}).Extract(input, filepath.Join(dir, "plain")); err == nil {
+				t.Errorf("method %d %s: extract without -recover succeeded", method, tt.name)
+			}
+
+			output := filepath.Join(dir, "out")
+			opts := &models.ArchiveOptions{Recover: true}
+			report := captureStdout(t, func() error { return NewOperator(opts).Extract(input, output) })
+			if !strings.Contains(report, tt.summary) {
+				t.Errorf("method %d %s: report %q, want %q", method, tt.name, report, tt.summary)
+			}
+			for _, name := range tt.want {
+				got, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(name)))
+				if err != nil || !bytes.Equal(got, files[name]) {
+					t.Errorf("method %d %s: %s not recovered: %v", method, tt.name, name, err)
+				}
+			}
+
+			listing := captureStdout(t, func() error { return NewOperator(opts).List(input) })
+			for _, name := range order {
+				listed := strings.Contains(listing, "  "+name+" (")
+				if want := len(tt.want) == len(order) || name != "c.bin"; listed != want {
+					t.Errorf("method %d %s: %s listed %v, want %v:\n%s", method, tt.name, name, listed, want, listing)
+				}
+			}
+		}
+	}
+}
+
+func TestRecoverRejectsTarGz(t *testing.T) {
+	input := writeTarGz(t, t.TempDir(), []tarMember{{name: "a.txt", body: "a"}})
+	err := NewOperator(&models.ArchiveOptions{Recover: true}).Extract(input, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "-recover applies to zip archives") {
+		t.Errorf("err = %v", err)
+	}
+}
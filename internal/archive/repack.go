@@ -0,0 +1,66 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Repack streams the entries of a zip or tar.gz archive into an
+// uncompressed tar written to outputPath ("-" for standard output) in a
+// single pass, without extracting to disk. The password, if any, applies
+// to the input only. Progress messages go to standard error so they never
+// mix with the tar stream.
+func (op *Operator) Repack(inputPath, outputPath string) error {
+	defer op.finishProgress()
+
+	if op.opts.Verbose {
+		fmt.Fprintf(os.Stderr, "Repacking %s to %s...\n", inputPath, outputPath)
+	}
+
+	out, err := op.openOutput(outputPath)
+	if err != nil {
+		return fmt.Errorf("create output file: %w", err)
+	}
+
+	tw := newTarEntryWriter(out, op.opts)
+	err = forEachEntry(inputPath, detectFormat(inputPath, op.opts), op.opts, func(e *archiveEntry, r io.Reader) error {
+		name, ok := applyEntryFilter(op.opts, archiveEntryModel(e))
+		if !ok {
+			return nil
+		}
+		storedName := e.Name
+		e.Name = name
+		if err := checkSealedRename(e, storedName); err != nil {
+			return err
+		}
+
+		if op.opts.Verbose {
+			fmt.Fprintf(os.Stderr, "  Repacking: %s\n", e.Name)
+		}
+
+		if r == nil {
+			return tw.WriteEntry(e, nil)
+		}
+
+		// A failed entry is not reported as done
+		r, done := trackEntry(r, e.Name, e.Info.Size(), op.opts)
+		if err := tw.WriteEntry(e, r); err != nil {
+			return err
+		}
+		done()
+		return nil
+	})
+	if err != nil {
+		tw.Close()
+		out.Abort()
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// recordingReporter records the progress events it receives
+type recordingReporter struct {
+	mu      sync.Mutex
+	started []string
+	done    []string
+}
+
+func (r *recordingReporter) Start(name string, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, name)
+}
+
+func (r *recordingReporter) Add(int64) {}
+
+func (r *recordingReporter) Done(name string, _ int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = append(r.done, name)
+}
+
+func (r *recordingReporter) Finish() {}
+
+// writeZipFile writes files to a zip in dir and returns its path
+func writeZipFile(t *testing.T, dir string, files map[string]string, order []string) string {
+	t.Helper()
+	data := make(map[string][]byte, len(files))
+	for name, content := range files {
+		data[name] = []byte(content)
+	}
+	path := filepath.Join(dir, "in.zip")
+	if err := os.WriteFile(path, buildZip(t, zip.Deflate, data, order), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRepackZipToTar(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "alpha", "dir/b.txt": strings.Repeat("beta", 1000)}
+	input := writeZipFile(t, dir, files, []string{"a.txt", "dir/b.txt"})
+
+	output := filepath.Join(dir, "out.tar")
+	reporter := &recordingReporter{}
+	if err := NewOperator(&models.ArchiveOptions{Progress: reporter}).Repack(input, output); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(bytes.NewReader(data))
+	got := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[header.Name] = string(content)
+	}
+	for name, want := range files {
+		if got[name] != want {
+			t.Errorf("%s: got %d bytes, want %d", name, len(got[name]), len(want))
+		}
+	}
+	if len(reporter.done) != len(files) {
+		t.Errorf("done reported for %v, want every file", reporter.done)
+	}
+}
+
+func TestRepackFailedEntryNotDone(t *testing.T) {
+	dir := t.TempDir()
+	input := writeZipFile(t, dir, map[string]string{"bad.txt": strings.Repeat("payload ", 100)}, []string{"bad.txt"})
+
+	// Corrupt the deflate stream so reading the entry fails
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := bytes.Index(data, []byte("bad.txt")) + len("bad.txt")
+	for i := start + 2; i < start+12; i++ {
+		data[i] ^= 0x5a
+	}
+	if err := os.WriteFile(input, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reporter := &recordingReporter{}
+	err = NewOperator(&models.ArchiveOptions{Progress: reporter}).Repack(input, filepath.Join(dir, "out.tar"))
+	if err == nil {
+		t.Fatal("repacking a corrupt entry succeeded")
+	}
+	if len(reporter.done) != 0 {
+		t.Errorf("failed entry reported done: %v", reporter.done)
+	}
+}
@@ -0,0 +1,404 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/remote"
+)
+
+// DefaultPartSize is the amount of input a resumable compress writes to
+// each part before starting the next
+const DefaultPartSize = 64 << 20
+
+// resumeJournalName is the journal file inside the parts directory
+const resumeJournalName = "journal"
+
+// journalSettings is the first line of the journal: what the parts are
+// written from. A run with different settings cannot resume the parts.
+type journalSettings struct {
+	Input      string `json:"input"`
+	Format     string `json:"format"`
+	Level      int    `json:"level"`
+	CodecLevel int    `json:"codec_level"`
+	Encryption string `json:"encryption"`
+}
+
+// newJournalSettings returns the settings of a resumable compress of
+// inputPath with opts
+func newJournalSettings(inputPath string, opts *models.ArchiveOptions) (journalSettings, error) {
+	input, err := filepath.Abs(inputPath)
+	if err != nil {
+		return journalSettings{}, err
+	}
+
+	encryption := "none"
+	switch {
+	case len(opts.EncryptPattern) > 0:
+		encryption = "entries " + strings.Join(opts.EncryptPattern, ",")
+	case hasArchiveKey(opts):
+		encryption = fmt.Sprintf("archive cipher=%s kdf=%s keyfile=%v",
+			cmp.Or(opts.Cipher, crypto.CipherAESGCM), cmp.Or(opts.KDF, crypto.KDFPBKDF2), len(opts.Keyfile) > 0)
+	}
+	return journalSettings{
+		Input:      input,
+		Format:     GetExtension(opts.Format),
+		Level:      int(opts.CompressionLevel),
+		CodecLevel: opts.CodecLevel,
+		Encryption: encryption,
+	}, nil
+}
+
+// diff names the first setting that differs from want, or returns ""
+func (s journalSettings) diff(want journalSettings) string {
+	switch {
+	case s.Input != want.Input:
+		return fmt.Sprintf("the input (%s, not %s)", s.Input, want.Input)
+	case s.Format != want.Format:
+		return fmt.Sprintf("the format (%s, not %s)", s.Format, want.Format)
+	case s.Level != want.Level || s.CodecLevel != want.CodecLevel:
+		return "the compression level"
+	case s.Encryption != want.Encryption:
+		return "the encryption"
+	}
+	return ""
+}
+
+// journalRecord is one line of the journal after the settings: a
+// completed part and the entries it holds
+type journalRecord struct {
+	Part    string         `json:"part"`
+	Entries []journalEntry `json:"entries"`
+}
+
+// journalEntry is an entry of a completed part. Regular files record the
+// size and modification time they were written with, so a changed file is
+// noticed when resuming.
+type journalEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size,omitempty"`
+	ModTime int64  `json:"mtime,omitempty"`
+}
+
+func newJournalEntry(name string, fi os.FileInfo) journalEntry {
+	if !fi.Mode().IsRegular() {
+		return journalEntry{Name: name}
+	}
+	return journalEntry{Name: name, Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+}
+
+// compressResumable compresses inputPath through a directory of parts next
+// to outputPath. Each completed part is recorded in a journal, so a run that
+// is interrupted can be repeated with -resume and only writes the entries
+// no completed part holds. Once every entry is written the parts are joined
+// into outputPath and the directory is removed.
+func (op *Operator) compressResumable(inputPath string, info os.FileInfo, outputPath string) error {
+	if outputPath == stdoutPath || remote.IsRemote(outputPath) {
+		return fmt.Errorf("-resume needs a local output file")
+	}
+	if op.opts.Snapshot != "" {
+		return fmt.Errorf("-resume cannot be combined with -snapshot")
+	}
+
+	dir := outputPath + ".parts"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	jw, err := openJournal(dir, inputPath, op.opts)
+	if err != nil {
+		return err
+	}
+	if len(jw.parts) > 0 && op.opts.Verbose {
+		fmt.Printf("Resuming after %d completed parts\n", len(jw.parts))
+	}
+
+	if err := compressEntries(inputPath, info, jw, &jw.partOpts, nil, newHardLinks(&jw.partOpts, jw.partOpts.Format)); err != nil {
+		// The entries of an interrupted run are complete, so the part
+		// being written is kept as well
+		if errors.Is(err, errInterrupted) {
+			if cerr := jw.Close(); cerr != nil {
+				return cerr
+			}
+			fmt.Fprintf(os.Stderr, "Interrupted: %d parts completed in %s\n", len(jw.parts), dir)
+			return fmt.Errorf("%w; run again with -resume to continue", err)
+		}
+		jw.abort()
+		return err
+	}
+	if err := jw.Close(); err != nil {
+		return err
+	}
+	// A completed part still holds an entry the input no longer has
+	if name := jw.removed(); name != "" {
+		return fmt.Errorf("cannot resume: %s is no longer part of the input but was written to a part; delete %s to start over", name, dir)
+	}
+
+	if err := op.joinParts(jw, outputPath); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// joinParts writes the entries of every part, in order, to outputPath with
+// the full set of options, so encryption, manifests and signatures apply to
+// the finished archive only
+func (op *Operator) joinParts(jw *journalWriter, outputPath string) error {
+	return op.writeArchive(outputPath, func(ew entryWriter) error {
+		for _, part := range jw.parts {
+			err := forEachEntry(filepath.Join(jw.dir, part), jw.partOpts.Format, &jw.partOpts, func(e *archiveEntry, r io.Reader) error {
+				return ew.WriteEntry(e, r)
+			})
+			if err != nil {
+				return fmt.Errorf("join %s: %w", part, err)
+			}
+		}
+		return nil
+	})
+}
+
+// journalWriter is the entryWriter of a resumable compress. It skips
+// entries held by completed parts and writes the rest to a new part every
+// PartSize bytes of input.
+type journalWriter struct {
+	dir      string
+	journal  *os.File
+	partOpts models.ArchiveOptions
+	// parts lists the completed parts in order
+	parts []string
+	// done holds the entries of the completed parts
+	done map[string]journalEntry
+	// visited holds the entries of this run's input
+	visited map[string]journalEntry
+
+	current *pendingArchive
+	name    string
+	entries []journalEntry
+	size    int64
+}
+
+// openJournal reads the journal in dir, removes any part it does not
+// record as complete and opens it for appending. It fails when the journal
+// was written for another input or with other settings.
+func openJournal(dir, inputPath string, opts *models.ArchiveOptions) (*journalWriter, error) {
+	settings, err := newJournalSettings(inputPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	jw := &journalWriter{dir: dir, partOpts: *opts, done: make(map[string]journalEntry), visited: make(map[string]journalEntry)}
+
+	// Parts are plain archives; encryption, manifests and signatures are
+	// applied when they are joined
+	jw.partOpts.Password = ""
+	jw.partOpts.Keyfile = nil
+	jw.partOpts.EncryptPattern = nil
+	jw.partOpts.Manifest = false
+	jw.partOpts.Merkle = false
+	jw.partOpts.Index = false
+	jw.partOpts.SignKey = ""
+	if jw.partOpts.PartSize <= 0 {
+		jw.partOpts.PartSize = DefaultPartSize
+	}
+
+	journalPath := filepath.Join(dir, resumeJournalName)
+	data, err := os.ReadFile(journalPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// Keep the complete records; a line cut short by the interruption ends
+	// the journal and is overwritten below. Without complete settings the
+	// journal starts over.
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	var recorded journalSettings
+	if !bytes.HasSuffix(lines[0], []byte("\n")) || json.Unmarshal(lines[0], &recorded) != nil || recorded.Input == "" {
+		lines = nil
+	} else if diff := recorded.diff(settings); diff != "" {
+		return nil, fmt.Errorf("cannot resume: the parts in %s were written with different settings: %s; delete the directory to start over", dir, diff)
+	}
+
+	var valid int
+	for i, line := range lines {
+		var rec journalRecord
+		if i == 0 {
+			valid += len(line)
+			continue
+		}
+		if !bytes.HasSuffix(line, []byte("\n")) || json.Unmarshal(line, &rec) != nil || rec.Part == "" {
+			break
+		}
+		jw.parts = append(jw.parts, rec.Part)
+		for _, e := range rec.Entries {
+			jw.done[e.Name] = e
+		}
+		valid += len(line)
+	}
+
+	// Anything else in the directory is a part that never completed
+	complete := make(map[string]bool, len(jw.parts))
+	for _, part := range jw.parts {
+		complete[part] = true
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name() != resumeJournalName && !complete[f.Name()] {
+			if err := os.RemoveAll(filepath.Join(dir, f.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	journal, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := journal.Truncate(int64(valid)); err == nil {
+		_, err = journal.Seek(0, io.SeekEnd)
+	}
+	if err == nil && valid == 0 {
+		err = writeJournalLine(journal, settings)
+	}
+	if err != nil {
+		journal.Close()
+		return nil, err
+	}
+	jw.journal = journal
+	return jw, nil
+}
+
+// writeJournalLine appends v to the journal as a line of JSON and syncs it
+func writeJournalLine(journal *os.File, v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return journal.Sync()
+}
+
+// written reports whether a completed part already holds name, the input
+// entry described by fi. It fails when the part holds another version of
+// the file, which the finished archive would otherwise contain.
+func (jw *journalWriter) written(name string, fi os.FileInfo) (bool, error) {
+	current := newJournalEntry(name, fi)
+	jw.visited[name] = current
+
+	done, ok := jw.done[name]
+	if !ok {
+		return false, nil
+	}
+	if done != current {
+		return false, fmt.Errorf("cannot resume: %s changed since it was written to a part; delete %s to start over", name, jw.dir)
+	}
+	return true, nil
+}
+
+// removed returns the name of an entry a completed part holds that this
+// run's input no longer has, or ""
+func (jw *journalWriter) removed() string {
+	for name := range jw.done {
+		if _, ok := jw.visited[name]; !ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// WriteEntry adds e to the current part, starting one if needed, and
+// completes the part once it holds PartSize bytes
+func (jw *journalWriter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	if jw.current == nil {
+		jw.name = fmt.Sprintf("part-%04d%s", len(jw.parts)+1, GetExtension(jw.partOpts.Format))
+		a, err := NewOperator(&jw.partOpts).createArchive(filepath.Join(jw.dir, jw.name))
+		if err != nil {
+			return err
+		}
+		jw.current = a
+	}
+
+	if err := jw.current.ew.WriteEntry(e, r); err != nil {
+		return err
+	}
+	entry, ok := jw.visited[e.Name]
+	if !ok {
+		entry = journalEntry{Name: e.Name}
+	}
+	jw.entries = append(jw.entries, entry)
+	if r != nil {
+		jw.size += e.Info.Size()
+	}
+
+	if jw.size >= jw.partOpts.PartSize {
+		return jw.completePart()
+	}
+	return nil
+}
+
+// completePart finishes the current part and records it in the journal.
+// The part is synced first, so a recorded part is always intact.
+func (jw *journalWriter) completePart() error {
+	a := jw.current
+	jw.current = nil
+	if err := a.finish(); err != nil {
+		return err
+	}
+	if err := syncFile(filepath.Join(jw.dir, jw.name)); err != nil {
+		return err
+	}
+
+	if err := writeJournalLine(jw.journal, journalRecord{Part: jw.name, Entries: jw.entries}); err != nil {
+		return err
+	}
+
+	jw.parts = append(jw.parts, jw.name)
+	for _, e := range jw.entries {
+		jw.done[e.Name] = e
+	}
+	jw.entries, jw.size = nil, 0
+	return nil
+}
+
+// Close completes the last part and closes the journal
+func (jw *journalWriter) Close() error {
+	var err error
+	if jw.current != nil {
+		err = jw.completePart()
+	}
+	if cerr := jw.journal.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// abort discards the part being written; completed parts are kept for the
+// next run
+func (jw *journalWriter) abort() {
+	if jw.current != nil {
+		jw.current.abort()
+	}
+	jw.journal.Close()
+}
+
+// syncFile flushes the file at path to stable storage
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
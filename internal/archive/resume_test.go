@@ -0,0 +1,169 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// interruptedResume runs a resumable compress of src that is interrupted
+// once the walk reaches c.txt, leaving the parts of a.txt and b.txt
+func interruptedResume(t *testing.T, src, output string, opts models.ArchiveOptions) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts.Resume, opts.PartSize, opts.Context = true, 1, ctx
+	opts.EntryFilter = func(e models.Entry) (bool, string) {
+		if strings.HasSuffix(e.Name, "c.txt") {
+			cancel()
+		}
+		return true, ""
+	}
+	err := NewOperator(&opts).Compress(src, output)
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("first run: error = %v, want an interruption", err)
+	}
+	if _, err := os.Stat(filepath.Join(output+".parts", resumeJournalName)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeChecksJournal(t *testing.T) {
+	files := map[string]string{"a.txt": "alpha", "b.txt": "beta", "c.txt": "gamma", "d.txt": "delta"}
+	base := models.ArchiveOptions{Format: models.FormatZip}
+
+	tests := []struct {
+		name string
+		// change alters the input or options before the second run
+		change func(t *testing.T, src string, opts *models.ArchiveOptions) string
+		want   string
+	}{
+		{"unchanged", nil, ""},
+		{"format", func(t *testing.T, src string, opts *models.ArchiveOptions) string {
+			opts.Format = models.FormatTarGz
+			return src
+		}, "the format"},
+		{"level", func(t *testing.T, src string, opts *models.ArchiveOptions) string {
+			opts.CompressionLevel = models.LevelBest
+			return src
+		}, "the compression level"},
+		{"encryption", func(t *testing.T, src string, opts *models.ArchiveOptions) string {
+			opts.Password = "secret"
+			return src
+		}, "the encryption"},
+		{"input", func(t *testing.T, src string, opts *models.ArchiveOptions) string {
+			other := filepath.Join(filepath.Dir(src), "other")
+			if err := os.Rename(src, other); err != nil {
+				t.Fatal(err)
+			}
+			return other
+		}, "the input"},
+		{"file changed", func(t *testing.T, src string, opts *models.ArchiveOptions) string {
+			if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha, edited"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			return src
+		}, "a.txt changed"},
+		{"file touched", func(t *testing.T, src string, opts *models.ArchiveOptions) string {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(filepath.Join(src, "b.txt"), later, later); err != nil {
+				t.Fatal(err)
+			}
+			return src
+		}, "b.txt changed"},
+		{"file removed", func(t *testing.T, src string, opts *models.ArchiveOptions) string {
+			if err := os.Remove(filepath.Join(src, "a.txt")); err != nil {
+				t.Fatal(err)
+			}
+			return src
+		}, "no longer part of the input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src")
+			if err := os.Mkdir(src, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			output := filepath.Join(dir, "out.zip")
+			interruptedResume(t, src, output, base)
+
+			opts := base
+			if tt.change != nil {
+				src = tt.change(t, src, &opts)
+			}
+			opts.Resume, opts.PartSize = true, 1
+			err := NewOperator(&opts).Compress(src, output)
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("error = %v, want %q", err, tt.want)
+				}
+				// The parts are kept for the user to delete
+				if _, err := os.Stat(output + ".parts"); err != nil {
+					t.Errorf("parts directory: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dest := filepath.Join(dir, "dest")
+			if err := NewOperator(&models.ArchiveOptions{}).Extract(output, dest); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(dest, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			count, err := NewOperator(&models.ArchiveOptions{}).Count(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The files and the root directory, each once
+			if count != len(files)+1 {
+				t.Errorf("archive holds %d entries, want %d", count, len(files)+1)
+			}
+		})
+	}
+}
+
+func TestOpenJournalRestartsWithoutSettings(t *testing.T) {
+	dir := t.TempDir()
+	// A journal cut short while writing its settings, and a stray part
+	if err := os.WriteFile(filepath.Join(dir, resumeJournalName), []byte(`{"input":"/x","form`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "part-0001.zip"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jw, err := openJournal(dir, t.TempDir(), &models.ArchiveOptions{Format: models.FormatZip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	if len(jw.parts) != 0 {
+		t.Errorf("parts = %v, want none", jw.parts)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "part-0001.zip")); !os.IsNotExist(err) {
+		t.Errorf("stray part kept (err %v)", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/sevenzip"
+)
+
+// maxLinkTarget bounds the symlink targets read from 7z content
+const maxLinkTarget = 4096
+
+// errSevenZipWrite explains that 7z is a read-only format
+var errSevenZipWrite = fmt.Errorf("writing 7z archives is not supported; 7z archives can be listed, verified and extracted")
+
+// extractSevenZip extracts the 7z archive at inputPath to outputPath.
+// Entries are decoded in archive order, since solid archives compress
+// many files as one stream.
+func extractSevenZip(inputPath, outputPath string, opts *models.ArchiveOptions) error {
+	z, err := sevenzip.OpenReader(inputPath)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	var dirs pendingDirs
+	err = z.Walk(func(f *sevenzip.File, r io.Reader) error {
+		if isMetadataEntry(f.Name) {
+			return nil
+		}
+		name, ok := applyEntryFilter(opts, sevenZipEntry(f))
+		if !ok {
+			return nil
+		}
+
+		destPath, err := safeDestPath(outputPath, name)
+		if err != nil {
+			return err
+		}
+
+		if f.Mode.IsDir() {
+			if err := os.MkdirAll(destPath, umasked(0755, opts)); err != nil {
+				return err
+			}
+			dirs.add(destPath, umasked(f.Mode.Perm(), opts), f.Modified)
+			return nil
+		}
+
+		if opts.Verbose {
+			fmt.Printf("  Extracting: %s\n", name)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destPath), umasked(0755, opts)); err != nil {
+			return err
+		}
+
+		if f.Mode&os.ModeSymlink != 0 {
+			target, err := readLinkTarget(name, r)
+			if err != nil {
+				return err
+			}
+			if !opts.AllowUnsafeLinks {
+				if err := checkLinkTarget(outputPath, destPath, target); err != nil {
+					return err
+				}
+			}
+			return createSymlink(outputPath, target, destPath, opts)
+		}
+
+		outFile, err := createDestFile(destPath, f.Mode.Perm(), opts)
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+
+		if r != nil {
+			if _, err := copyEntry(outFile, r, name, f.Size, opts); err != nil {
+				return err
+			}
+		}
+		return outFile.Close()
+	})
+	if derr := dirs.apply(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// readLinkTarget reads a symlink target stored as the entry content
+func readLinkTarget(name string, r io.Reader) (string, error) {
+	if r == nil {
+		return "", fmt.Errorf("%s: symlink has no target", name)
+	}
+	target, err := io.ReadAll(io.LimitReader(r, maxLinkTarget+1))
+	if err != nil {
+		return "", err
+	}
+	if len(target) == 0 || len(target) > maxLinkTarget {
+		return "", fmt.Errorf("%s: invalid symlink target", name)
+	}
+	return string(target), nil
+}
+
+// sevenZipEntry describes a 7z entry for EntryFilter callbacks
+func sevenZipEntry(f *sevenzip.File) models.Entry {
+	return models.Entry{
+		Name:    f.Name,
+		Size:    f.Size,
+		Mode:    f.Mode,
+		ModTime: f.Modified,
+		IsDir:   f.Mode.IsDir(),
+	}
+}
+
+func listSevenZip(inputPath string) error {
+	z, err := sevenzip.OpenReader(inputPath)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	fmt.Println("Archive contents:")
+	for _, f := range z.File {
+		if isMetadataEntry(f.Name) {
+			continue
+		}
+		fmt.Printf("  %s (%d bytes)\n", f.Name, f.Size)
+	}
+	return nil
+}
+
+// forEachSevenZipEntry passes every entry of the 7z archive at inputPath
+// to fn. Symlink targets are read from the content into Linkname.
+func forEachSevenZipEntry(inputPath string, fn entryFunc) error {
+	z, err := sevenzip.OpenReader(inputPath)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	return z.Walk(func(f *sevenzip.File, r io.Reader) error {
+		entry := &archiveEntry{
+			Name: strings.TrimSuffix(f.Name, "/"),
+			Info: &memFileInfo{
+				name:    path.Base(f.Name),
+				size:    f.Size,
+				mode:    f.Mode,
+				modTime: f.Modified,
+			},
+		}
+
+		switch {
+		case f.Mode.IsDir():
+			return fn(entry, nil)
+		case f.Mode&os.ModeSymlink != 0:
+			target, err := readLinkTarget(f.Name, r)
+			if err != nil {
+				return err
+			}
+			entry.Linkname = target
+			return fn(entry, nil)
+		}
+		if r == nil {
+			r = strings.NewReader("")
+		}
+		return fn(entry, r)
+	})
+}
@@ -0,0 +1,87 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/remote"
+)
+
+// archiveSigner hashes archive bytes as they are written and stores a
+// detached Ed25519 signature next to the archive
+type archiveSigner struct {
+	key     ed25519.PrivateKey
+	hash    hash.Hash
+	sigPath string
+}
+
+func newArchiveSigner(outputPath, keyPath string) (*archiveSigner, error) {
+	if outputPath == stdoutPath || remote.IsRemote(outputPath) {
+		return nil, fmt.Errorf("-sign-key needs a local output file")
+	}
+	key, err := crypto.LoadSigningKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load signing key: %w", err)
+	}
+	return &archiveSigner{key: key, hash: crypto.NewSignatureHash(), sigPath: outputPath + crypto.SignatureExt}, nil
+}
+
+// write signs the archive bytes seen so far
+func (s *archiveSigner) write() error {
+	sig, err := crypto.SignDigest(s.key, s.hash.Sum(nil))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.sigPath, sig, 0644)
+}
+
+// verifiedCopy checks the detached signature of the archive at inputPath
+// against the public key at keyPath, before anything in the archive is
+// read. The archive is hashed while it is copied to a private temporary
+// file, and the path of that copy is returned: extracting from it means
+// the bytes extracted are the bytes verified, even if the archive is
+// replaced in the meantime. The caller removes the copy.
+func (op *Operator) verifiedCopy(inputPath, keyPath string) (string, error) {
+	if keyPath == "" {
+		return "", fmt.Errorf("-require-signature needs -pubkey")
+	}
+	key, err := crypto.LoadVerifyKey(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("load public key: %w", err)
+	}
+
+	sigPath := inputPath + crypto.SignatureExt
+	sig, err := os.ReadFile(sigPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s is not signed (no %s); refusing to extract", inputPath, sigPath)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// The copy keeps the archive's name so its format is still detected
+	h := crypto.NewSignatureHash()
+	copyPath, err := op.bufferToTemp(io.TeeReader(file, h), "gar-*-"+filepath.Base(inputPath))
+	if err != nil {
+		return "", err
+	}
+	if err := crypto.VerifyDigest(key, h.Sum(nil), sig); err != nil {
+		os.Remove(copyPath)
+		return "", fmt.Errorf("%s: %w; refusing to extract", sigPath, err)
+	}
+	return copyPath, nil
+}
@@ -0,0 +1,130 @@
+package archive
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// writeKeyPair writes a PEM Ed25519 key pair to dir and returns the paths
+// of the private and public key
+func writeKeyPair(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "pub.pem")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath
+}
+
+func TestRequireSignature(t *testing.T) {
+	keyDir := t.TempDir()
+	privPath, pubPath := writeKeyPair(t, keyDir)
+	_, otherPub := writeKeyPair(t, t.TempDir())
+
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, archive string)
+		pubKey  string
+		errMsg  string
+	}{
+		{"valid", func(*testing.T, string) {}, pubPath, ""},
+		{"other key", func(*testing.T, string) {}, otherPub, "refusing to extract"},
+		{"no signature", func(t *testing.T, archive string) {
+			os.Remove(archive + crypto.SignatureExt)
+		}, pubPath, "is not signed"},
+		{"tampered", func(t *testing.T, archive string) {
+			data, err := os.ReadFile(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data[len(data)/2] ^= 0xff
+			os.WriteFile(archive, data, 0644)
+		}, pubPath, "refusing to extract"},
+		{"no public key", func(*testing.T, string) {}, "", "needs -pubkey"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := compressTree(t, map[string]string{"a.txt": "signed content"}, models.ArchiveOptions{SignKey: privPath})
+			tt.prepare(t, archive)
+
+			tempDir := t.TempDir()
+			output := t.TempDir()
+			opts := &models.ArchiveOptions{RequireSignature: true, PublicKey: tt.pubKey, TempDir: tempDir}
+			err := NewOperator(opts).Extract(archive, output)
+
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := os.ReadFile(filepath.Join(output, "a.txt")); string(got) != "signed content" {
+					t.Errorf("extracted %q", got)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("err = %v, want %q", err, tt.errMsg)
+			}
+
+			// The verified copy never outlives the extraction
+			if left, _ := os.ReadDir(tempDir); len(left) != 0 {
+				t.Errorf("temporary files left: %v", left)
+			}
+		})
+	}
+}
+
+func TestVerifiedCopyIsolatesArchive(t *testing.T) {
+	privPath, pubPath := writeKeyPair(t, t.TempDir())
+	archive := compressTree(t, map[string]string{"a.txt": "signed"}, models.ArchiveOptions{SignKey: privPath})
+	signed, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := NewOperator(&models.ArchiveOptions{TempDir: t.TempDir()})
+	copyPath, err := op.verifiedCopy(archive, pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(copyPath)
+
+	// Replacing the archive after verification does not reach the copy
+	// that is extracted
+	unsigned := compressTree(t, map[string]string{"a.txt": "swapped"}, models.ArchiveOptions{})
+	if err := os.Rename(unsigned, archive); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(signed) {
+		t.Error("verified copy differs from the signed archive")
+	}
+	if !strings.HasSuffix(copyPath, filepath.Base(archive)) {
+		t.Errorf("copy %s does not keep the archive name", copyPath)
+	}
+}
@@ -0,0 +1,94 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotEntry is the recorded state of one input path
+type snapshotEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	IsDir   bool      `json:"dir,omitempty"`
+}
+
+// snapshot records the input tree seen by a compress run so the next run
+// can archive only what changed
+type snapshot struct {
+	Files map[string]snapshotEntry `json:"files"`
+}
+
+// snapshotTracker compares entries against the previous snapshot while
+// recording the current state
+type snapshotTracker struct {
+	path string
+	prev *snapshot
+	next *snapshot
+}
+
+// loadSnapshot reads the snapshot at path; a missing file yields an empty
+// snapshot so the first run archives everything
+func loadSnapshot(path string) (*snapshotTracker, error) {
+	prev := &snapshot{Files: make(map[string]snapshotEntry)}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, prev); err != nil {
+			return nil, err
+		}
+		if prev.Files == nil {
+			prev.Files = make(map[string]snapshotEntry)
+		}
+	}
+
+	return &snapshotTracker{
+		path: path,
+		prev: prev,
+		next: &snapshot{Files: make(map[string]snapshotEntry)},
+	}, nil
+}
+
+// visit records name and reports whether it is new or changed since the
+// previous snapshot. Directories only count as changed when new.
+func (t *snapshotTracker) visit(name string, fi os.FileInfo) bool {
+	current := snapshotEntry{Size: fi.Size(), ModTime: fi.ModTime().UTC(), IsDir: fi.IsDir()}
+	if fi.IsDir() {
+		current.Size = 0
+		current.ModTime = time.Time{}
+	}
+	t.next.Files[name] = current
+
+	old, ok := t.prev.Files[name]
+	return !ok || old.IsDir != current.IsDir || old.Size != current.Size || !old.ModTime.Equal(current.ModTime)
+}
+
+// save atomically replaces the snapshot file with the recorded state
+func (t *snapshotTracker) save() error {
+	data, err := json.MarshalIndent(t.next, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), ".gar-snapshot-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), t.path)
+}
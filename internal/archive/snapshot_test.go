@@ -0,0 +1,59 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestSnapshotIncremental(t *testing.T) {
+	src := writeTestTree(t, map[string]string{"a.txt": "alpha", "sub/b.txt": "beta", "sub/c.txt": "gamma"})
+	opts := models.ArchiveOptions{Snapshot: filepath.Join(t.TempDir(), "state.json")}
+
+	// The first run has no snapshot and archives everything
+	if got, want := archivedNames(t, src, opts), []string{".", "a.txt", "sub", "sub/b.txt", "sub/c.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("first run archived %q, want %q", got, want)
+	}
+	if _, err := os.Stat(opts.Snapshot); err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+
+	// Changing the content and the mtime of one file archives only it
+	changed := filepath.Join(src, "sub", "b.txt")
+	if err := os.WriteFile(changed, []byte("beta, edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(changed, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := archivedNames(t, src, opts), []string{"sub/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("second run archived %q, want %q", got, want)
+	}
+
+	// A touched file counts as changed even at the same size
+	touched := filepath.Join(src, "a.txt")
+	if err := os.Chtimes(touched, later, later); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, src, "new.txt", []byte("new"))
+	if got, want := archivedNames(t, src, opts), []string{"a.txt", "new.txt"}; !slices.Equal(got, want) {
+		t.Errorf("third run archived %q, want %q", got, want)
+	}
+
+	// Nothing changed since the last run
+	if got := archivedNames(t, src, opts); len(got) != 0 {
+		t.Errorf("fourth run archived %q, want nothing", got)
+	}
+}
+
+func TestLoadSnapshotCorrupt(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "state.json", []byte("{not json"))
+	if _, err := loadSnapshot(path); err == nil {
+		t.Error("loadSnapshot succeeded on a corrupt file")
+	}
+}
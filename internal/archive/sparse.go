@@ -0,0 +1,364 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// sparseBlock is the granularity of hole detection
+const sparseBlock = 4096
+
+// sparseFragment is a run of data at Offset within a sparse file; the
+// bytes between fragments are zero
+type sparseFragment struct {
+	Offset int64
+	Length int64
+}
+
+// scanSparse reads r to the end and returns the non-zero regions at
+// sparseBlock granularity together with the total size. The content of
+// the regions is copied to data as it is found.
+func scanSparse(r io.Reader, data io.Writer) ([]sparseFragment, int64, error) {
+	var frags []sparseFragment
+	buf := make([]byte, sparseBlock)
+	var offset int64
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 && !isZero(buf[:n]) {
+			if _, err := data.Write(buf[:n]); err != nil {
+				return nil, 0, err
+			}
+			if last := len(frags) - 1; last >= 0 && frags[last].Offset+frags[last].Length == offset {
+				frags[last].Length += int64(n)
+			} else {
+				frags = append(frags, sparseFragment{Offset: offset, Length: int64(n)})
+			}
+		}
+		offset += int64(n)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return frags, offset, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// hasHoles reports whether frags leave any part of a size-byte file empty
+func hasHoles(frags []sparseFragment, size int64) bool {
+	var data int64
+	for _, f := range frags {
+		data += f.Length
+	}
+	return data < size
+}
+
+func isZero(p []byte) bool {
+	for _, b := range p {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sparseFile is the content of a file or block device together with its
+// data regions, found without reading the source twice
+type sparseFile struct {
+	// r streams the whole content, holes included
+	r     io.Reader
+	frags []sparseFragment
+	size  int64
+	close func() error
+}
+
+func (s *sparseFile) Close() error {
+	return s.close()
+}
+
+// openSparse opens the file or block device at path and finds its data
+// regions. Regular files ask the filesystem where their holes are, so
+// detection reads nothing. Devices, and files on systems that cannot
+// tell, are scanned once for zero blocks while their data is spooled to
+// a temporary file, which then supplies the content. Devices report no
+// size, so their size comes from the scan.
+func openSparse(path string, fi os.FileInfo) (*sparseFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.Mode().IsRegular() {
+		frags, ok, err := dataRegions(file, fi.Size())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if ok {
+			return &sparseFile{r: file, frags: frags, size: fi.Size(), close: file.Close}, nil
+		}
+	}
+	defer file.Close()
+
+	spool, err := os.CreateTemp("", "gar-sparse-*")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() error {
+		err := spool.Close()
+		os.Remove(spool.Name())
+		return err
+	}
+	frags, size, err := scanSparse(file, spool)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	return &sparseFile{r: &holeReader{data: spool, frags: frags, size: size}, frags: frags, size: size, close: cleanup}, nil
+}
+
+// holeReader rebuilds sparse content from its data regions, read in order
+// from data, filling the holes between them with zeros
+type holeReader struct {
+	data  io.Reader
+	frags []sparseFragment
+	size  int64
+	pos   int64
+}
+
+func (h *holeReader) Read(p []byte) (int, error) {
+	if h.pos >= h.size {
+		return 0, io.EOF
+	}
+
+	if len(h.frags) > 0 && h.pos >= h.frags[0].Offset {
+		end := h.frags[0].Offset + h.frags[0].Length
+		if int64(len(p)) > end-h.pos {
+			p = p[:end-h.pos]
+		}
+		n, err := h.data.Read(p)
+		h.pos += int64(n)
+		if h.pos == end {
+			h.frags = h.frags[1:]
+			if err == io.EOF {
+				err = nil
+			}
+		} else if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+
+	next := h.size
+	if len(h.frags) > 0 {
+		next = h.frags[0].Offset
+	}
+	if int64(len(p)) > next-h.pos {
+		p = p[:next-h.pos]
+	}
+	clear(p)
+	h.pos += int64(len(p))
+	return len(p), nil
+}
+
+// writeSparse writes header and the data regions of r as a PAX 1.0 sparse
+// entry (the layout GNU tar uses for --sparse). archive/tar can read these
+// but not write them, so the blocks are encoded here and written to the
+// underlying stream between tar.Writer entries.
+func (w *tarEntryWriter) writeSparse(header *tar.Header, frags []sparseFragment, r io.Reader) error {
+	if err := w.tw.Flush(); err != nil {
+		return err
+	}
+
+	// GNU tar takes the extracted size from the end of the last fragment,
+	// so a trailing hole is marked with an empty one
+	if last := len(frags) - 1; last < 0 || frags[last].Offset+frags[last].Length < header.Size {
+		frags = append(frags[:len(frags):len(frags)], sparseFragment{Offset: header.Size})
+	}
+
+	// The sparse map precedes the data: fragment count, then an offset and
+	// length per fragment, padded to a whole block
+	var sparseMap []byte
+	sparseMap = append(strconv.AppendInt(sparseMap, int64(len(frags)), 10), '\n')
+	var dataSize int64
+	for _, f := range frags {
+		sparseMap = append(strconv.AppendInt(sparseMap, f.Offset, 10), '\n')
+		sparseMap = append(strconv.AppendInt(sparseMap, f.Length, 10), '\n')
+		dataSize += f.Length
+	}
+	sparseMap = append(sparseMap, make([]byte, padding(int64(len(sparseMap))))...)
+	storedSize := int64(len(sparseMap)) + dataSize
+
+	records := []string{
+		paxRecord("GNU.sparse.major", "1"),
+		paxRecord("GNU.sparse.minor", "0"),
+		paxRecord("GNU.sparse.name", header.Name),
+		paxRecord("GNU.sparse.realsize", strconv.FormatInt(header.Size, 10)),
+		paxRecord("size", strconv.FormatInt(storedSize, 10)),
+	}
+	extra := len(records)
+	for key, value := range header.PAXRecords {
+		records = append(records, paxRecord(key, value))
+	}
+	// Ids that overflow the octal header fields are also kept in base-256
+	// there, but PAX is what every reader understands
+	if !fitsOctal(int64(header.Uid), 8) {
+		records = append(records, paxRecord("uid", strconv.Itoa(header.Uid)))
+	}
+	if !fitsOctal(int64(header.Gid), 8) {
+		records = append(records, paxRecord("gid", strconv.Itoa(header.Gid)))
+	}
+	sort.Strings(records[extra:])
+
+	var pax bytes.Buffer
+	for _, record := range records {
+		pax.WriteString(record)
+	}
+
+	dir, file := path.Split(header.Name)
+	sparseName := truncateName(path.Join(dir, "GNUSparseFile.0", file))
+	paxName := truncateName(path.Join(dir, "PaxHeaders.0", file))
+
+	var out bytes.Buffer
+	out.Write(ustarHeader(header, paxName, tar.TypeXHeader, int64(pax.Len())))
+	out.Write(pax.Bytes())
+	out.Write(make([]byte, padding(int64(pax.Len()))))
+	out.Write(ustarHeader(header, sparseName, tar.TypeReg, storedSize))
+	out.Write(sparseMap)
+	if _, err := w.w.Write(out.Bytes()); err != nil {
+		return err
+	}
+
+	// Copy each data fragment, skipping the zero runs between them
+	var pos int64
+	for _, f := range frags {
+		if _, err := io.CopyN(io.Discard, r, f.Offset-pos); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w.w, r, f.Length); err != nil {
+			return err
+		}
+		pos = f.Offset + f.Length
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(make([]byte, padding(dataSize)))
+	return err
+}
+
+// paxRecord formats a PAX extended header record, whose length prefix
+// counts itself
+func paxRecord(key, value string) string {
+	const padding = 3 // space, equals sign and newline
+	size := len(key) + len(value) + padding
+	size += len(strconv.Itoa(size))
+	record := strconv.Itoa(size) + " " + key + "=" + value + "\n"
+	if len(record) != size {
+		size = len(record)
+		record = strconv.Itoa(size) + " " + key + "=" + value + "\n"
+	}
+	return record
+}
+
+// ustarHeader encodes a single USTAR header block for name, copying the
+// ownership, mode and time from header
+func ustarHeader(header *tar.Header, name string, typeflag byte, size int64) []byte {
+	block := make([]byte, blockSize)
+	copy(block[0:100], name)
+	putNumeric(block[100:108], header.Mode&0o7777)
+	putNumeric(block[108:116], int64(header.Uid))
+	putNumeric(block[116:124], int64(header.Gid))
+	putNumeric(block[124:136], size)
+	putNumeric(block[136:148], header.ModTime.Unix())
+	block[156] = typeflag
+	copy(block[257:265], "ustar\x0000")
+	copy(block[265:297], header.Uname)
+	copy(block[297:329], header.Gname)
+
+	// The checksum is computed with its own field filled with spaces
+	copy(block[148:156], "        ")
+	var sum int64
+	for _, b := range block {
+		sum += int64(b)
+	}
+	copy(block[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	return block
+}
+
+// putNumeric writes n as a NUL-terminated, zero-padded octal field, or
+// in the GNU base-256 encoding when it does not fit
+func putNumeric(field []byte, n int64) {
+	if !fitsOctal(n, len(field)) {
+		putBase256(field, n)
+		return
+	}
+	s := strconv.FormatInt(n, 8)
+	for len(s) < len(field)-1 {
+		s = "0" + s
+	}
+	copy(field, s)
+}
+
+// fitsOctal reports whether n fits a NUL-terminated octal field of width
+// bytes
+func fitsOctal(n int64, width int) bool {
+	return n >= 0 && n < 1<<(3*(width-1))
+}
+
+// putBase256 writes n big-endian in two's complement with the high bit
+// of the first byte set, as GNU tar does for large or negative numbers
+func putBase256(field []byte, n int64) {
+	for i := len(field) - 1; i > 0; i-- {
+		field[i] = byte(n)
+		n >>= 8
+	}
+	field[0] = 0x80 | byte(n)&0x7f
+	if n < 0 {
+		field[0] = 0xff
+	}
+}
+
+// truncateName keeps name within the 100-byte USTAR name field; the full
+// name is carried in the PAX records
+func truncateName(name string) string {
+	if len(name) <= 100 {
+		return name
+	}
+	return name[len(name)-100:]
+}
+
+// padding returns the bytes needed to fill the last block of size bytes
+func padding(size int64) int64 {
+	return -size & (blockSize - 1)
+}
+
+// sparseWriter restores holes while extracting: zero chunks are skipped
+// with a seek instead of written. The caller truncates the file to its
+// final size afterwards so a trailing hole is kept.
+type sparseWriter struct {
+	file *os.File
+}
+
+func (w sparseWriter) Write(p []byte) (int, error) {
+	if isZero(p) {
+		if _, err := w.file.Seek(int64(len(p)), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.file.Write(p)
+}
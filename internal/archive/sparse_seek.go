@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd
+
+package archive
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataRegions returns the data regions of f as the filesystem reports them
+// with SEEK_DATA and SEEK_HOLE, without reading the file, and rewinds f.
+// ok is false when the filesystem does not support the query.
+func dataRegions(f *os.File, size int64) (frags []sparseFragment, ok bool, err error) {
+	fd := int(f.Fd())
+	for offset := int64(0); offset < size; {
+		data, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// Only a hole remains
+			break
+		}
+		if errors.Is(err, unix.EINVAL) && offset == 0 {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, false, err
+		}
+		hole = min(hole, size)
+		if hole > data {
+			frags = append(frags, sparseFragment{Offset: data, Length: hole - data})
+		}
+		offset = hole
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	return frags, true, nil
+}
@@ -0,0 +1,227 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestScanSparse(t *testing.T) {
+	block := bytes.Repeat([]byte{'x'}, sparseBlock)
+	zero := make([]byte, sparseBlock)
+	tests := []struct {
+		name    string
+		content [][]byte
+		frags   []sparseFragment
+	}{
+		{"empty", nil, nil},
+		{"all data", [][]byte{block, block}, []sparseFragment{{0, 2 * sparseBlock}}},
+		{"all zero", [][]byte{zero, zero}, nil},
+		{"leading hole", [][]byte{zero, block}, []sparseFragment{{sparseBlock, sparseBlock}}},
+		{"trailing hole", [][]byte{block, zero}, []sparseFragment{{0, sparseBlock}}},
+		{"holes between", [][]byte{block, zero, zero, block, block}, []sparseFragment{{0, sparseBlock}, {3 * sparseBlock, 2 * sparseBlock}}},
+		{"short tail", [][]byte{zero, []byte("tail")}, []sparseFragment{{sparseBlock, 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := bytes.Join(tt.content, nil)
+			var data bytes.Buffer
+			frags, size, err := scanSparse(bytes.NewReader(content), &data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(len(content)) {
+				t.Errorf("size = %d, want %d", size, len(content))
+			}
+			if !equalFragments(frags, tt.frags) {
+				t.Errorf("fragments = %v, want %v", frags, tt.frags)
+			}
+
+			// The spooled data and fragments rebuild the content
+			got, err := io.ReadAll(&holeReader{data: &data, frags: frags, size: size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Error("rebuilt content differs")
+			}
+		})
+	}
+}
+
+func equalFragments(a, b []sparseFragment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHoleReaderShortData(t *testing.T) {
+	r := &holeReader{data: bytes.NewReader([]byte("abc")), frags: []sparseFragment{{2, 5}}, size: 10}
+	if _, err := io.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Fatalf("err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestUstarHeaderLargeNumbers(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		uid, gid int
+		size     int64
+	}{
+		{"octal", 1000, 1000, 1 << 20},
+		{"large ids", 1 << 30, 3000000, 0},
+		{"large size", 0, 0, 1 << 36},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := &tar.Header{Mode: 0644, Uid: tt.uid, Gid: tt.gid, ModTime: modTime}
+			block := ustarHeader(header, "file", tar.TypeReg, tt.size)
+
+			got, err := tar.NewReader(bytes.NewReader(block)).Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Uid != tt.uid || got.Gid != tt.gid || got.Size != tt.size || !got.ModTime.Equal(modTime) {
+				t.Errorf("read uid %d gid %d size %d time %v", got.Uid, got.Gid, got.Size, got.ModTime)
+			}
+		})
+	}
+}
+
+func TestWriteSparse(t *testing.T) {
+	data := bytes.Repeat([]byte{'d'}, 100)
+	tests := map[string][]byte{
+		"data at end":   append(append(data, make([]byte, 3*sparseBlock)...), "end"...),
+		"trailing hole": append(data, make([]byte, 3*sparseBlock)...),
+		"only a hole":   make([]byte, 2*sparseBlock),
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			testWriteSparse(t, content)
+		})
+	}
+}
+
+func testWriteSparse(t *testing.T, content []byte) {
+	frags, size, err := scanSparse(bytes.NewReader(content), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := newTarEntryWriter(&buf, &models.ArchiveOptions{})
+	header := &tar.Header{Name: "disk.img", Typeflag: tar.TypeReg, Mode: 0600, Size: size, Uid: 4000000000 >> 1, Gid: 1 << 24, ModTime: time.Unix(1700000000, 0)}
+	if err := w.writeSparse(header, frags, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(&buf)
+	got, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "disk.img" || got.Uid != header.Uid || got.Gid != header.Gid {
+		t.Errorf("read %q uid %d gid %d", got.Name, got.Uid, got.Gid)
+	}
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("sparse content differs")
+	}
+}
+
+func TestOpenSparseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sparse")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 64 << 20
+	if _, err := f.WriteAt([]byte("head"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("middle"), 32<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sparse, err := openSparse(path, fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sparse.Close()
+
+	if sparse.size != size {
+		t.Errorf("size = %d, want %d", sparse.size, size)
+	}
+	var data int64
+	for _, f := range sparse.frags {
+		data += f.Length
+	}
+	// Filesystems without hole support report the whole file as data
+	if data == 0 || data > size {
+		t.Errorf("data regions %v", sparse.frags)
+	}
+
+	content, err := io.ReadAll(sparse.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(content)) != size || string(content[:4]) != "head" || string(content[32<<20:32<<20+6]) != "middle" {
+		t.Error("content differs")
+	}
+}
+
+func FuzzScanSparse(f *testing.F) {
+	f.Add([]byte("data"), uint16(3))
+	f.Add(make([]byte, 100), uint16(0))
+	f.Fuzz(func(t *testing.T, data []byte, holes uint16) {
+		// Interleave the data with whole zero blocks
+		var content []byte
+		for i := range int(holes % 8) {
+			content = append(content, make([]byte, sparseBlock)...)
+			content = append(content, data[:len(data)*i/8]...)
+		}
+		content = append(content, data...)
+
+		var spool bytes.Buffer
+		frags, size, err := scanSparse(bytes.NewReader(content), &spool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(&holeReader{data: &spool, frags: frags, size: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatal("rebuilt content differs")
+		}
+	})
+}
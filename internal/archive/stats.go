@@ -0,0 +1,49 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// countFile records a regular file of n bytes added or extracted
+func countFile(opts *models.ArchiveOptions, n int64) {
+	if opts.Stats != nil {
+		opts.Stats.Files.Add(1)
+		opts.Stats.Bytes.Add(n)
+	}
+}
+
+// countSkipped records an entry that was left out
+func countSkipped(opts *models.ArchiveOptions) {
+	if opts.Stats != nil {
+		opts.Stats.Skipped.Add(1)
+	}
+}
+
+// countFailed records an entry that could not be processed
+func countFailed(opts *models.ArchiveOptions) {
+	if opts.Stats != nil {
+		opts.Stats.Failed.Add(1)
+	}
+}
+
+// summaryVerbs names what happened to files for each operation
+var summaryVerbs = map[string]string{
+	"Compression": "added",
+	"Extraction":  "extracted",
+	"Merge":       "merged",
+}
+
+// formatSummary renders the end-of-run summary line
+func formatSummary(operationName string, stats *models.RunStats, elapsed time.Duration) string {
+	verb, ok := summaryVerbs[operationName]
+	if !ok {
+		verb = "processed"
+	}
+
+	return fmt.Sprintf("Summary: %d files %s, %d skipped, %d failed, %d bytes in %v",
+		stats.Files.Load(), verb, stats.Skipped.Load(), stats.Failed.Load(), stats.Bytes.Load(), elapsed)
+}
@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestRunSummary(t *testing.T) {
+	src := writeTestTree(t, map[string]string{"a.txt": "aaa", "b.txt": "bb", "x.log": "zzzz", "sub/c.txt": "c", "sub/y.log": "y"})
+	output := filepath.Join(t.TempDir(), "out.zip")
+
+	run := func(operationName string, opts *models.ArchiveOptions, fn func(*Operator) error) string {
+		t.Helper()
+		opts.Stats = &models.RunStats{}
+		opts.Verbose = true
+		out := captureStdout(t, func() error {
+			TimeOperation(func() error { return fn(NewOperator(opts)) }, true, operationName, opts.Stats)
+			return nil
+		})
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		return lines[len(lines)-1]
+	}
+
+	tests := []struct {
+		name          string
+		operationName string
+		opts          *models.ArchiveOptions
+		fn            func(*Operator) error
+		want          string
+	}{
+		{
+			name:          "compress with excludes",
+			operationName: "Compression",
+			opts:          &models.ArchiveOptions{Exclude: []string{"*.log"}},
+			fn:            func(op *Operator) error { return op.Compress(src, output) },
+			want:          "Summary: 3 files added, 2 skipped, 0 failed, 6 bytes in ",
+		},
+		{
+			name:          "extract with a filter",
+			operationName: "Extraction",
+			opts: &models.ArchiveOptions{EntryFilter: func(e models.Entry) (bool, string) {
+				return e.Name != "b.txt", ""
+			}},
+			fn:   func(op *Operator) error { return op.Extract(output, t.TempDir()) },
+			want: "Summary: 2 files extracted, 1 skipped, 0 failed, 4 bytes in ",
+		},
+		{
+			name:          "failed extraction",
+			operationName: "Extraction",
+			opts:          &models.ArchiveOptions{},
+			fn:            func(op *Operator) error { return op.Extract(output+".missing", t.TempDir()) },
+			want:          "Summary: 0 files extracted, 0 skipped, 1 failed, 0 bytes in ",
+		},
+	}
+	for _, tt := range tests {
+		if got := run(tt.operationName, tt.opts, tt.fn); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: last line %q, want %q...", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSummary(t *testing.T) {
+	stats := &models.RunStats{}
+	stats.Files.Add(2)
+	stats.Bytes.Add(10)
+	got := formatSummary("Update", stats, time.Second)
+	if want := "Summary: 2 files processed, 0 skipped, 0 failed, 10 bytes in 1s"; got != want {
+		t.Errorf("formatSummary = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// StreamWriter writes an archive to an io.Writer one entry at a time, for
+// callers whose content is produced on the fly rather than read from disk
+type StreamWriter struct {
+	op  *Operator
+	enc *crypto.EncryptedWriter
+	ew  entryWriter
+}
+
+// NewStreamWriter starts an archive in opts.Format on w. The archive is
+// only complete once Close returns; w itself is left open.
+func NewStreamWriter(w io.Writer, opts *models.ArchiveOptions) (*StreamWriter, error) {
+	op := NewOperator(opts)
+	enc, ew, err := op.newArchiveWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamWriter{op: op, enc: enc, ew: ew}, nil
+}
+
+// Add writes an entry named name with the contents of r. A directory mode
+// adds a directory entry and r is ignored; only regular files and
+// directories can be added. tar records each size ahead of the content, so
+// for tar.gz the content is spooled to a temporary file first.
+func (s *StreamWriter) Add(name string, r io.Reader, mode os.FileMode, modTime time.Time) error {
+	if err := checkEntryName(name); err != nil {
+		return err
+	}
+	info := &memFileInfo{name: path.Base(name), mode: mode, modTime: modTime}
+
+	switch {
+	case mode.IsDir():
+		return s.ew.WriteEntry(&archiveEntry{Name: name, Info: info}, nil)
+	case !mode.IsRegular():
+		return fmt.Errorf("%s: only regular files and directories can be added", name)
+	}
+
+	if isTarFormat(s.op.opts.Format) {
+		tmpPath, err := s.op.bufferToTemp(r, "gar-entry-*")
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer os.Remove(tmpPath)
+
+		f, err := os.Open(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		info.size = st.Size()
+		r = f
+	}
+
+	return s.ew.WriteEntry(&archiveEntry{Name: name, Info: info}, r)
+}
+
+// checkEntryName rejects entry names that extract outside the destination:
+// absolute names, Windows drive and rooted names, and names with a ".."
+// element. Backslashes count as separators, as Windows extractors treat
+// them.
+func checkEntryName(name string) error {
+	if name == "" {
+		return fmt.Errorf("entry name is empty")
+	}
+	if path.IsAbs(name) || strings.HasPrefix(name, `\`) || (len(name) >= 2 && name[1] == ':') {
+		return fmt.Errorf("%s: entry name must be relative", name)
+	}
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return fmt.Errorf("%s: entry name must not contain \"..\"", name)
+		}
+	}
+	return nil
+}
+
+// Close finishes the archive, writing the format trailer and the final
+// encrypted frame
+func (s *StreamWriter) Close() error {
+	if err := s.ew.Close(); err != nil {
+		return err
+	}
+	if s.enc != nil {
+		return s.enc.Close()
+	}
+	return nil
+}
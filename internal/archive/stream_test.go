@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestCheckEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a.txt", ""},
+		{"dir/sub/a.txt", ""},
+		{"dir/", ""},
+		{"./a.txt", ""},
+		{"a..b/c..", ""},
+		{"", "empty"},
+		{"/etc/passwd", "must be relative"},
+		{`\windows\system32`, "must be relative"},
+		{`\\server\share\a`, "must be relative"},
+		{"C:/a.txt", "must be relative"},
+		{"c:a.txt", "must be relative"},
+		{"..", `".."`},
+		{"../a.txt", `".."`},
+		{"dir/../../a.txt", `".."`},
+		{`dir\..\a.txt`, `".."`},
+		{"dir/..", `".."`},
+	}
+	for _, tt := range tests {
+		err := checkEntryName(tt.name)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%q: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestStreamWriterRejectsUnsafeNames(t *testing.T) {
+	for _, format := range []models.ArchiveFormat{models.FormatZip, models.FormatTarGz} {
+		var buf bytes.Buffer
+		sw, err := NewStreamWriter(&buf, &models.ArchiveOptions{Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"/etc/cron.d/x", "../x", "a/../../x"} {
+			if err := sw.Add(name, strings.NewReader("x"), 0644, time.Now()); err == nil {
+				t.Errorf("%v: Add(%q) succeeded", format, name)
+			}
+		}
+		if err := sw.Add("ok.txt", strings.NewReader("fine"), 0644, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if err := sw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the accepted entry is in the archive
+		dir := t.TempDir()
+		input := filepath.Join(dir, "in"+GetExtension(format))
+		if err := os.WriteFile(input, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		output := filepath.Join(dir, "out")
+		if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "ok.txt" {
+			t.Errorf("%v: extracted %v, want only ok.txt", format, entries)
+		}
+	}
+}
+
+func FuzzCheckEntryName(f *testing.F) {
+	for _, s := range []string{"a.txt", "../a", "/a", `C:\a`, `a\..\b`, "a/./b"} {
+		f.Add(s)
+	}
+	// An accepted name stays inside whatever directory it is extracted to
+	root := f.TempDir()
+	f.Fuzz(func(t *testing.T, name string) {
+		if checkEntryName(name) != nil {
+			return
+		}
+		dest, err := safeDestPath(root, name)
+		if err != nil {
+			t.Fatalf("accepted %q, which extracts outside: %v", name, err)
+		}
+		if !isWithin(root, filepath.Clean(dest)) {
+			t.Fatalf("accepted %q, which extracts to %s", name, dest)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Fallbacks for symlinks the destination filesystem cannot create
+const (
+	// SymlinkFallbackError fails the extraction
+	SymlinkFallbackError = "error"
+	// SymlinkFallbackText writes the target path as the content of a
+	// regular file
+	SymlinkFallbackText = "text"
+	// SymlinkFallbackCopy copies the file the symlink points to, which must
+	// already have been extracted into the output directory
+	SymlinkFallbackCopy = "copy"
+)
+
+// symlink creates symlinks; tests replace it to simulate filesystems
+// without them
+var symlink = os.Symlink
+
+// checkSymlinkFallback rejects unknown -symlink-fallback values
+func checkSymlinkFallback(fallback string) error {
+	switch fallback {
+	case "", SymlinkFallbackError, SymlinkFallbackText, SymlinkFallbackCopy:
+		return nil
+	}
+	return fmt.Errorf("unknown symlink fallback: %s (want error, text or copy)", fallback)
+}
+
+// createSymlink creates destPath as a symlink to target, replacing what
+// is already there as replaceExisting allows. When the filesystem refuses
+// (FAT, or Windows without the privilege), the entry is written as
+// opts.SymlinkFallback says.
+func createSymlink(outputPath, target, destPath string, opts *models.ArchiveOptions) error {
+	err := symlink(target, destPath)
+	if errors.Is(err, fs.ErrExist) {
+		replaced, rerr := replaceExisting(destPath, opts)
+		if rerr != nil || !replaced {
+			return rerr
+		}
+		err = symlink(target, destPath)
+	}
+	if err == nil {
+		return nil
+	}
+
+	switch opts.SymlinkFallback {
+	case SymlinkFallbackText:
+		return writeLinkText(target, destPath, opts)
+	case SymlinkFallbackCopy:
+		return copyLinkTarget(outputPath, target, destPath, opts)
+	default:
+		return err
+	}
+}
+
+// replaceExisting removes the entry at destPath so a symlink can take its
+// place, as the overwrite conflict policy (the default) does for files.
+// With AllowSymlinkOverwrite a symlink already there is trusted and kept,
+// and it reports false. Directories are never removed.
+func replaceExisting(destPath string, opts *models.ArchiveOptions) (bool, error) {
+	fi, err := os.Lstat(destPath)
+	if err != nil {
+		return false, err
+	}
+	if opts.OnConflict != "" && opts.OnConflict != ConflictOverwrite {
+		return false, fmt.Errorf("symlink %s: %w", destPath, fs.ErrExist)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 && opts.AllowSymlinkOverwrite {
+		return false, nil
+	}
+	if fi.IsDir() {
+		return false, fmt.Errorf("symlink %s: a directory is in the way", destPath)
+	}
+	return true, os.Remove(destPath)
+}
+
+// writeLinkText writes target as the content of the regular file destPath
+func writeLinkText(target, destPath string, opts *models.ArchiveOptions) error {
+	f, err := createDestFile(destPath, 0666, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, target); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// copyLinkTarget copies the file target names, resolved from the
+// directory of destPath, to destPath. The target must lie inside
+// outputPath even with AllowUnsafeLinks: an unsafe symlink only points
+// outside, while a copy would read the file there into the output.
+func copyLinkTarget(outputPath, target, destPath string, opts *models.ArchiveOptions) error {
+	if err := checkLinkTarget(outputPath, destPath, target); err != nil {
+		return fmt.Errorf("cannot copy target: %w", err)
+	}
+
+	in, err := os.Open(filepath.Join(filepath.Dir(destPath), target))
+	if err != nil {
+		return fmt.Errorf("symlink %s -> %s: cannot copy target: %w", destPath, target, err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("symlink %s -> %s: cannot copy target: not a regular file", destPath, target)
+	}
+
+	out, err := createDestFile(destPath, info.Mode().Perm(), opts)
+	if err != nil {
+		return err
+	}
+	if _, err := copyPooled(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// withoutSymlinks makes symlink creation fail for the rest of the test, as
+// on a filesystem without symlinks
+func withoutSymlinks(t *testing.T) {
+	t.Helper()
+	saved := symlink
+	symlink = func(oldname, newname string) error {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+	}
+	t.Cleanup(func() { symlink = saved })
+}
+
+func TestSymlinkFallback(t *testing.T) {
+	members := []tarMember{
+		{name: "dir/target.txt", body: "target content"},
+		{name: "dir/link", typeflag: tar.TypeSymlink, linkname: "target.txt"},
+	}
+	tests := []struct {
+		fallback string
+		want     string
+		wantErr  string
+	}{
+		{fallback: "", wantErr: "unsupported"}, // the default
+		{fallback: SymlinkFallbackError, wantErr: "unsupported"},
+		{fallback: SymlinkFallbackText, want: "target.txt"},
+		{fallback: SymlinkFallbackCopy, want: "target content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fallback, func(t *testing.T) {
+			withoutSymlinks(t)
+			dir := t.TempDir()
+			input := writeTarGz(t, dir, members)
+			output := filepath.Join(dir, "out")
+
+			err := NewOperator(&models.ArchiveOptions{SymlinkFallback: tt.fallback}).Extract(input, output)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Lstat(filepath.Join(output, "dir", "link"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !fi.Mode().IsRegular() {
+				t.Fatalf("link is %v, want a regular file", fi.Mode())
+			}
+			data, err := os.ReadFile(filepath.Join(output, "dir", "link"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("link content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymlinkFallbackCopyStaysInOutput(t *testing.T) {
+	dir := t.TempDir()
+	secret := writeFile(t, dir, "secret.txt", []byte("host file"))
+
+	for name, target := range map[string]string{"relative": "../secret.txt", "absolute": secret} {
+		t.Run(name, func(t *testing.T) {
+			withoutSymlinks(t)
+			input := writeTarGz(t, t.TempDir(), []tarMember{{name: "link", typeflag: tar.TypeSymlink, linkname: target}})
+			output := filepath.Join(dir, "out")
+
+			// Unsafe links are allowed, but copying their target is not
+			opts := &models.ArchiveOptions{SymlinkFallback: SymlinkFallbackCopy, AllowUnsafeLinks: true}
+			err := NewOperator(opts).Extract(input, output)
+			if err == nil || !strings.Contains(err.Error(), "cannot copy target") {
+				t.Errorf("err = %v, want the copy refused", err)
+			}
+			if data, err := os.ReadFile(filepath.Join(output, "link")); err == nil {
+				t.Errorf("copied %q from outside the output directory", data)
+			}
+		})
+	}
+}
+
+// TestExtractSymlinkTwice extracts the same archive into one directory
+// twice, and over entries already in the symlink's place
+func TestExtractSymlinkTwice(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTarGz(t, dir, []tarMember{
+		{name: "dir/target.txt", body: "target content"},
+		{name: "dir/link", typeflag: tar.TypeSymlink, linkname: "target.txt"},
+	})
+	readLink := func(output string) string {
+		t.Helper()
+		target, err := os.Readlink(filepath.Join(output, "dir", "link"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return target
+	}
+
+	tests := []struct {
+		name     string
+		opts     models.ArchiveOptions
+		existing func(link string) error
+		want     string
+		wantErr  string
+	}{
+		{name: "again", opts: models.ArchiveOptions{}, want: "target.txt"},
+		{name: "again overwrite", opts: models.ArchiveOptions{OnConflict: ConflictOverwrite}, want: "target.txt"},
+		{
+			name:     "over a file",
+			existing: func(link string) error { return os.WriteFile(link, []byte("stale"), 0644) },
+			want:     "target.txt",
+		},
+		{
+			name:     "over another link",
+			existing: func(link string) error { return os.Symlink("elsewhere", link) },
+			want:     "target.txt",
+		},
+		{
+			name:     "over another link with -allow-symlink-overwrite",
+			opts:     models.ArchiveOptions{AllowSymlinkOverwrite: true},
+			existing: func(link string) error { return os.Symlink("elsewhere", link) },
+			want:     "elsewhere",
+		},
+		{
+			name:     "over a directory",
+			existing: func(link string) error { return os.Mkdir(link, 0755) },
+			wantErr:  "a directory is in the way",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out")
+			if tt.existing == nil {
+				// The first extraction leaves the link in place
+				if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				if err := os.MkdirAll(filepath.Join(output, "dir"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := tt.existing(filepath.Join(output, "dir", "link")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := tt.opts
+			err := NewOperator(&opts).Extract(input, output)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readLink(output); got != tt.want {
+				t.Errorf("link target = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
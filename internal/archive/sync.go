@@ -0,0 +1,264 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// syncTracker records the names an archive holds and skips entries whose
+// destination file is up to date: its content digest matches the manifest
+// when the archive has one, otherwise it is at least as new as the entry
+type syncTracker struct {
+	outputPath string
+	// manifest holds the archive's digests, computed with newHash; nil
+	// compares modification times
+	manifest *manifest
+	newHash  func() hash.Hash
+	// cache keeps destination digests between runs; nil without a manifest
+	cache *checksumCache
+
+	mu    sync.Mutex
+	names map[string]bool
+	// extracted maps the names of files being extracted with a manifest
+	// digest to their entries, so the digest can be cached afterwards
+	extracted map[string]models.Entry
+}
+
+func newSyncTracker(outputPath string) *syncTracker {
+	return &syncTracker{outputPath: outputPath, names: make(map[string]bool), extracted: make(map[string]models.Entry)}
+}
+
+// options returns a copy of opts whose EntryFilter runs the configured
+// filter, records the resulting name and skips up-to-date files
+func (t *syncTracker) options(opts *models.ArchiveOptions) *models.ArchiveOptions {
+	tracked := *opts
+	inner := opts.EntryFilter
+	tracked.EntryFilter = func(e models.Entry) (bool, string) {
+		name := e.Name
+		if inner != nil {
+			include, newName := inner(e)
+			if !include {
+				return false, ""
+			}
+			if newName != "" {
+				name = newName
+			}
+		}
+
+		t.record(name)
+		if !e.IsDir && t.upToDate(e, name) {
+			return false, ""
+		}
+		if !e.IsDir && t.cache != nil {
+			t.mu.Lock()
+			t.extracted[name] = e
+			t.mu.Unlock()
+		}
+		return true, name
+	}
+	return &tracked
+}
+
+// record adds name and all of its parent directories
+func (t *syncTracker) record(name string) {
+	name = path.Clean(strings.TrimSuffix(name, "/"))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name != "." && name != "/" && !t.names[name] {
+		t.names[name] = true
+		name = path.Dir(name)
+	}
+}
+
+// upToDate reports whether the destination of e, extracted as name,
+// already holds its content. Entries listed in the manifest compare the
+// digest of the existing file, taken from the checksum cache while its
+// size and modification time are unchanged; others compare modification
+// times only, so the destination is never read.
+func (t *syncTracker) upToDate(e models.Entry, name string) bool {
+	dest := filepath.Join(t.outputPath, filepath.FromSlash(name))
+	fi, err := os.Lstat(dest)
+	if err != nil || fi.IsDir() {
+		return false
+	}
+
+	if t.manifest != nil && fi.Mode().IsRegular() {
+		if want, ok := t.manifest.Digests[path.Clean(e.Name)]; ok {
+			if fi.Size() != e.Size {
+				return false
+			}
+			got, err := t.digest(name, dest, fi)
+			return err == nil && got == want
+		}
+	}
+	return !e.ModTime.After(fi.ModTime())
+}
+
+// digest returns the digest of the destination file dest, extracted as
+// name and described by fi, hashing it only on a cache miss (always on a
+// dry run, which keeps no cache)
+func (t *syncTracker) digest(name, dest string, fi os.FileInfo) (string, error) {
+	if t.cache == nil {
+		return fileDigest(dest, t.newHash)
+	}
+	if digest, ok := t.cache.lookup(name, fi); ok {
+		return digest, nil
+	}
+	digest, err := fileDigest(dest, t.newHash)
+	if err != nil {
+		return "", err
+	}
+	t.cache.store(name, fi, digest)
+	return digest, nil
+}
+
+// saveCache records the manifest digests of the files just extracted,
+// which hold exactly the archived content, and writes the cache. A file
+// that is no longer a regular file of the entry's size is left to be
+// hashed on the next run.
+func (t *syncTracker) saveCache() error {
+	for name, e := range t.extracted {
+		digest, ok := t.manifest.Digests[path.Clean(e.Name)]
+		if !ok {
+			continue
+		}
+		fi, err := os.Lstat(filepath.Join(t.outputPath, filepath.FromSlash(name)))
+		if err != nil || !fi.Mode().IsRegular() || fi.Size() != e.Size {
+			continue
+		}
+		t.cache.store(name, fi, digest)
+	}
+	return t.cache.save(func(name string) bool { return t.names[name] })
+}
+
+// fileDigest returns the hex digest of the file at path
+func fileDigest(path string, newHash func() hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := newHash()
+	if _, err := copyPooled(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// useManifest makes the tracker compare content digests from the
+// manifest of inputPath, if it has one. The manifest must have been
+// written with the configured -hash algorithm.
+func (t *syncTracker) useManifest(inputPath string, opts *models.ArchiveOptions) error {
+	m, err := readManifest(inputPath, detectFormat(inputPath, opts), opts)
+	if err != nil || m == nil {
+		return err
+	}
+
+	algorithm := opts.Hash
+	if algorithm == "" {
+		algorithm = DefaultHash
+	}
+	if !strings.EqualFold(m.Algorithm, algorithm) {
+		return fmt.Errorf("archive manifest uses %s, not %s; run with -hash=%s to compare contents", m.Algorithm, algorithm, m.Algorithm)
+	}
+	newHash, err := newHashFunc(m.Algorithm)
+	if err != nil {
+		return err
+	}
+	t.manifest, t.newHash = m, newHash
+	if !opts.DryRun {
+		t.cache = loadChecksumCache(t.outputPath, m.Algorithm)
+	}
+	return nil
+}
+
+// extractSync extracts only entries that are missing or newer than the
+// existing files (Update). With Sync it then deletes everything under
+// outputPath the archive does not hold, so the tree mirrors the archive.
+func (op *Operator) extractSync(inputPath, outputPath string) error {
+	tracker := newSyncTracker(outputPath)
+	if err := tracker.useManifest(inputPath, op.opts); err != nil {
+		return err
+	}
+	return op.syncWith(tracker, inputPath, outputPath)
+}
+
+// syncWith runs extractSync with a prepared tracker
+func (op *Operator) syncWith(tracker *syncTracker, inputPath, outputPath string) error {
+	if err := NewOperator(tracker.options(op.opts)).extract(inputPath, outputPath); err != nil {
+		return err
+	}
+	if tracker.cache != nil {
+		if err := tracker.saveCache(); err != nil {
+			return fmt.Errorf("save checksum cache: %w", err)
+		}
+	}
+	if !op.opts.Sync {
+		return nil
+	}
+
+	// An empty name set would delete the whole target
+	if len(tracker.names) == 0 {
+		return fmt.Errorf("archive has no entries to sync; refusing to delete the contents of %s", outputPath)
+	}
+	return tracker.prune(op.opts, os.Stdout)
+}
+
+// prune removes files and directories under the output path that were not
+// recorded, or reports them to w with DryRun
+func (t *syncTracker) prune(opts *models.ArchiveOptions, w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	return filepath.WalkDir(t.outputPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Nothing to prune when a dry run targets a new directory
+			if p == t.outputPath && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(t.outputPath, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." || rel == checksumCacheName || t.names[filepath.ToSlash(rel)] {
+			return nil
+		}
+
+		switch {
+		case opts.JSON && opts.DryRun:
+			err = enc.Encode(plannedOp{Action: "delete", Path: p})
+		case opts.DryRun:
+			_, err = fmt.Fprintf(w, "  would delete: %s\n", p)
+		default:
+			if opts.Verbose {
+				fmt.Printf("  Deleting: %s\n", p)
+			}
+			// Parents of recorded names are recorded too, so nothing
+			// below an unrecorded directory is kept
+			err = os.RemoveAll(p)
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
@@ -0,0 +1,262 @@
+package archive
+
+import (
+	"hash"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// compressTree writes files under a new directory and compresses it to a
+// zip with the given options
+func compressTree(t *testing.T, files map[string]string, opts models.ArchiveOptions) string {
+	t.Helper()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := filepath.Join(dir, "out.zip")
+	opts.Format = models.FormatZip
+	if err := NewOperator(&opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestUpdateComparesManifestDigests(t *testing.T) {
+	files := map[string]string{"same.txt": "unchanged", "edited.txt": "original", "resized.txt": "short"}
+
+	for _, algorithm := range []string{"sha256", "xxhash"} {
+		t.Run(algorithm, func(t *testing.T) {
+			input := compressTree(t, files, models.ArchiveOptions{Manifest: true, Hash: algorithm})
+			output := t.TempDir()
+
+			// Every existing file is newer than its entry, so a time
+			// comparison would keep them all
+			future := time.Now().Add(time.Hour)
+			existing := map[string]string{"same.txt": "unchanged", "edited.txt": "tampered", "resized.txt": "much longer"}
+			for name, content := range existing {
+				p := filepath.Join(output, name)
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(p, future, future); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := &models.ArchiveOptions{Update: true, Hash: algorithm}
+			if err := NewOperator(opts).Extract(input, output); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(output, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			fi, err := os.Stat(filepath.Join(output, "same.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !fi.ModTime().Equal(future) {
+				t.Error("same.txt was rewritten although its digest matches")
+			}
+		})
+	}
+}
+
+func TestUpdateHashMismatch(t *testing.T) {
+	input := compressTree(t, map[string]string{"a.txt": "a"}, models.ArchiveOptions{Manifest: true, Hash: "sha512"})
+	opts := &models.ArchiveOptions{Update: true, Hash: "sha256"}
+	err := NewOperator(opts).Extract(input, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "-hash=sha512") {
+		t.Fatalf("err = %v, want a -hash=sha512 hint", err)
+	}
+}
+
+func TestUpdateWithoutManifestUsesModTime(t *testing.T) {
+	input := compressTree(t, map[string]string{"a.txt": "archived"}, models.ArchiveOptions{})
+	output := t.TempDir()
+	p := filepath.Join(output, "a.txt")
+	if err := os.WriteFile(p, []byte("local edit"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(p, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewOperator(&models.ArchiveOptions{Update: true}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(p); string(got) != "local edit" {
+		t.Errorf("newer local file replaced: %q", got)
+	}
+}
+
+func TestSync(t *testing.T) {
+	input := compressTree(t, map[string]string{
+		"same.txt":    "same",
+		"changed.txt": "new content",
+		"sub/new.txt": "added",
+	}, models.ArchiveOptions{})
+
+	setup := func(t *testing.T) string {
+		output := t.TempDir()
+		past := time.Now().Add(-time.Hour)
+		for name, content := range map[string]string{
+			"same.txt":       "same",
+			"changed.txt":    "old",
+			"extra.txt":      "extra",
+			"sub/stale.txt":  "stale",
+			"gone/deep/x.md": "x",
+		} {
+			p := filepath.Join(output, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(p, past, past); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return output
+	}
+
+	t.Run("mirror", func(t *testing.T) {
+		output := setup(t)
+		if err := NewOperator(&models.ArchiveOptions{Sync: true}).Extract(input, output); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"same.txt": "same", "changed.txt": "new content", "sub/new.txt": "added"}
+		if got := readTree(t, output); !maps.Equal(got, want) {
+			t.Errorf("tree = %v, want %v", got, want)
+		}
+		if _, err := os.Stat(filepath.Join(output, "gone")); !os.IsNotExist(err) {
+			t.Errorf("extra directory kept: %v", err)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		output := setup(t)
+		before := readTree(t, output)
+		opts := &models.ArchiveOptions{Sync: true, DryRun: true}
+		plan := captureStdout(t, func() error { return NewOperator(opts).Extract(input, output) })
+
+		for _, name := range []string{"extra.txt", "sub/stale.txt", "gone"} {
+			want := "would delete: " + filepath.Join(output, filepath.FromSlash(name)) + "\n"
+			if !strings.Contains(plan, want) {
+				t.Errorf("plan lacks %q:\n%s", want, plan)
+			}
+		}
+		if strings.Contains(plan, "gone/deep") || strings.Contains(plan, "delete: "+filepath.Join(output, "same.txt")) {
+			t.Errorf("plan deletes too much:\n%s", plan)
+		}
+		if got := readTree(t, output); !maps.Equal(got, before) {
+			t.Errorf("dry run changed the tree to %v", got)
+		}
+	})
+
+	t.Run("empty archive", func(t *testing.T) {
+		output := setup(t)
+		empty := writeZipFile(t, t.TempDir(), nil, nil)
+		err := NewOperator(&models.ArchiveOptions{Sync: true}).Extract(empty, output)
+		if err == nil || !strings.Contains(err.Error(), "refusing to delete") {
+			t.Fatalf("err = %v, want a refusal", err)
+		}
+		if _, err := os.Stat(filepath.Join(output, "extra.txt")); err != nil {
+			t.Errorf("empty archive pruned the target: %v", err)
+		}
+	})
+}
+
+func TestSyncChecksumCache(t *testing.T) {
+	files := map[string]string{"same.txt": "unchanged", "edited.txt": "original", "new.txt": "new"}
+	input := compressTree(t, files, models.ArchiveOptions{Manifest: true})
+	output := t.TempDir()
+
+	// Existing files are newer than their entries, and the edited one has
+	// the same size, so only its digest tells it apart
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	for name, content := range map[string]string{"same.txt": "unchanged", "edited.txt": "tampered"} {
+		p := filepath.Join(output, name)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := &models.ArchiveOptions{Sync: true}
+	run := func() int {
+		t.Helper()
+		tracker := newSyncTracker(output)
+		if err := tracker.useManifest(input, opts); err != nil {
+			t.Fatal(err)
+		}
+		var hashed atomic.Int32
+		newHash := tracker.newHash
+		tracker.newHash = func() hash.Hash {
+			hashed.Add(1)
+			return newHash()
+		}
+		if err := NewOperator(opts).syncWith(tracker, input, output); err != nil {
+			t.Fatal(err)
+		}
+		if got := readTree(t, output); got["edited.txt"] != files["edited.txt"] || got["new.txt"] != files["new.txt"] {
+			t.Fatalf("tree = %v", got)
+		}
+		return int(hashed.Load())
+	}
+
+	// Missing files need no hashing; existing ones are hashed once
+	if n := run(); n != 2 {
+		t.Errorf("first run hashed %d files, want 2", n)
+	}
+	if _, err := os.Stat(filepath.Join(output, checksumCacheName)); err != nil {
+		t.Fatalf("no cache after the first run: %v", err)
+	}
+
+	// Kept and extracted files alike come from the cache, which -sync
+	// does not prune
+	if n := run(); n != 0 {
+		t.Errorf("second run hashed %d files, want 0", n)
+	}
+
+	// A changed file is hashed again and restored
+	p := filepath.Join(output, "same.txt")
+	if err := os.WriteFile(p, []byte("replaced!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := run(); n != 1 {
+		t.Errorf("third run hashed %d files, want 1", n)
+	}
+	if got, _ := os.ReadFile(p); string(got) != "unchanged" {
+		t.Errorf("same.txt = %q after the third run", got)
+	}
+
+	// A cache for another algorithm is ignored
+	if c := loadChecksumCache(output, "sha512"); len(c.files) != 0 {
+		t.Errorf("sha512 cache has %d entries, want none", len(c.files))
+	}
+}
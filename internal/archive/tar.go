@@ -0,0 +1,17 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"os"
+)
+
+// listPlainTar prints the entries of an uncompressed tar archive
+func listPlainTar(inputPath string) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return listTarEntries(file)
+}
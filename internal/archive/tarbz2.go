@@ -0,0 +1,74 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/bzip2"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// tarBz2EntryWriter writes archive entries to a bzip2-compressed tar stream
+type tarBz2EntryWriter struct {
+	*tarEntryWriter
+	bw *bzip2.Writer
+}
+
+func newTarBz2EntryWriter(writer io.Writer, opts *models.ArchiveOptions) (*tarBz2EntryWriter, error) {
+	switch opts.CompressionLevel {
+	case models.LevelStore, models.LevelHuffman:
+		return nil, fmt.Errorf("tar.bz2 always compresses fully; use level fastest, normal or best, or 1-9")
+	}
+	bzWriter, err := bzip2.NewWriterLevel(writer, bzip2Level(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &tarBz2EntryWriter{tarEntryWriter: newTarEntryWriter(bzWriter, opts), bw: bzWriter}, nil
+}
+
+// Close finishes the tar stream and then the bzip2 stream
+func (w *tarBz2EntryWriter) Close() error {
+	if err := w.closeTar(); err != nil {
+		w.bw.Close()
+		return err
+	}
+	return w.bw.Close()
+}
+
+// bzip2Level maps the compression options to a bzip2 block size, in
+// units of 100 kB. Smaller blocks are faster and compress less.
+func bzip2Level(opts *models.ArchiveOptions) int {
+	if opts.CodecLevel != 0 {
+		return opts.CodecLevel
+	}
+	if opts.CompressionLevel == models.LevelFastest {
+		return bzip2.BestSpeed
+	}
+	return bzip2.DefaultCompression
+}
+
+// extractTarBz2 extracts a bzip2 stream, which normally wraps a tar
+// archive. A plain bzip2-compressed file is extracted as a single file
+// named after the archive without its .bz2 extension.
+func extractTarBz2(reader io.Reader, inputPath, outputPath string, opts *models.ArchiveOptions) error {
+	stream := bufio.NewReaderSize(bzip2.NewReader(reader), blockSize)
+	if !isTarStream(stream) {
+		return extractPlainFile(stream, plainFileName(inputPath, ".bz2"), time.Time{}, outputPath, opts)
+	}
+
+	return extractTar(stream, outputPath, opts)
+}
+
+func listTarBz2(inputPath string) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return listTar(bzip2.NewReader(file), plainFileName(inputPath, ".bz2"))
+}
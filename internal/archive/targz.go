@@ -3,107 +3,295 @@ package archive
 
 import (
 	"archive/tar"
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/cubetiqlabs/gar/internal/bzip2"
+	"github.com/cubetiqlabs/gar/internal/crypto"
 	"github.com/cubetiqlabs/gar/internal/models"
+	kgzip "github.com/klauspost/compress/gzip"
+	"github.com/klauspost/pgzip"
 )
 
-func compressTarGz(inputPath string, info os.FileInfo, writer io.Writer, opts *models.ArchiveOptions) error {
-	// Setup gzip
-	var gzLevel int
-	switch opts.CompressionLevel {
-	case models.LevelFastest:
-		gzLevel = gzip.BestSpeed
-	case models.LevelBest:
-		gzLevel = gzip.BestCompression
-	default:
-		gzLevel = gzip.DefaultCompression
+// tarEntryWriter writes archive entries to an uncompressed tar stream
+type tarEntryWriter struct {
+	w  io.Writer
+	tw *tar.Writer
+	// ustar forces plain USTAR headers without PAX or GNU extensions
+	ustar bool
+	// modTime, when set, replaces every entry's modification time
+	modTime time.Time
+	// raw is set once a complete tar stream was copied in by writeRawTar
+	raw bool
+}
+
+func newTarEntryWriter(writer io.Writer, opts *models.ArchiveOptions) *tarEntryWriter {
+	return &tarEntryWriter{w: writer, tw: tar.NewWriter(writer), ustar: opts.StripExtendedHeaders, modTime: opts.ModTime}
+}
+
+// tarGzEntryWriter writes archive entries to a gzip-compressed tar stream
+type tarGzEntryWriter struct {
+	*tarEntryWriter
+	gw io.WriteCloser
+	// index, when set, records entry positions for ExtractEntryTo
+	index *tarIndex
+}
+
+func newTarGzEntryWriter(writer io.Writer, opts *models.ArchiveOptions) (*tarGzEntryWriter, error) {
+	if opts.Index {
+		members, err := newGzipMembers(writer, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &tarGzEntryWriter{
+			tarEntryWriter: newTarEntryWriter(members, opts),
+			gw:             members,
+			index:          &tarIndex{members: members},
+		}, nil
 	}
 
-	gzWriter, err := gzip.NewWriterLevel(writer, gzLevel)
+	gzWriter, err := newGzipWriter(writer, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer gzWriter.Close()
 
-	tarWriter := tar.NewWriter(gzWriter)
-	defer tarWriter.Close()
+	return &tarGzEntryWriter{tarEntryWriter: newTarEntryWriter(gzWriter, opts), gw: gzWriter}, nil
+}
 
-	if info.IsDir() {
-		return filepath.Walk(inputPath, func(path string, fi os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+// WriteEntry adds e to the tar stream, recording its position when indexed
+func (w *tarGzEntryWriter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	if w.index != nil {
+		if err := w.index.mark(w.tw, e.Name); err != nil {
+			return err
+		}
+	}
+	return w.tarEntryWriter.WriteEntry(e, r)
+}
 
-			header, err := tar.FileInfoHeader(fi, fi.Name())
-			if err != nil {
-				return err
-			}
+// gzipReader decompresses tar.gz input with either gzip implementation
+type gzipReader struct {
+	io.ReadCloser
+	Header gzip.Header
+}
 
-			relPath, err := filepath.Rel(inputPath, path)
+// newGzipReader opens the gzip stream in r. ParallelGzip selects
+// klauspost/pgzip, which inflates blocks ahead of the reader in a separate
+// goroutine and checks the CRC concurrently, for streams it reads the same
+// way as compress/gzip (see pgzipCompatible); reads through an -index use
+// compress/gzip regardless.
+func newGzipReader(r io.Reader, opts *models.ArchiveOptions) (*gzipReader, error) {
+	if opts.ParallelGzip {
+		br := bufio.NewReader(r)
+		r = br
+		if header, _ := br.Peek(gzipHeaderSize); pgzipCompatible(header) {
+			pr, err := pgzip.NewReader(br)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			header.Name = filepath.ToSlash(relPath)
+			return &gzipReader{ReadCloser: pr, Header: gzip.Header(pr.Header)}, nil
+		}
+	}
 
-			if err := tarWriter.WriteHeader(header); err != nil {
-				return err
-			}
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipReader{ReadCloser: gr, Header: gr.Header}, nil
+}
 
-			if !fi.IsDir() {
-				file, err := os.Open(path)
-				if err != nil {
-					return err
-				}
-				defer file.Close()
+// gzipHeaderSize is the size of the fixed part of a gzip member header
+const gzipHeaderSize = 10
 
-				if opts.Verbose {
-					fmt.Printf("  Adding: %s\n", relPath)
-				}
+// gzipFlagHeaderCRC marks a gzip header that ends in a CRC-16 of itself
+const gzipFlagHeaderCRC = 1 << 1
 
-				_, err = io.Copy(tarWriter, file)
-				return err
-			}
+// pgzipCompatible reports whether pgzip decodes the gzip stream starting
+// with header like compress/gzip does. pgzip checks a header CRC against
+// the fixed part only, so it rejects valid headers that also carry a name,
+// comment or extra field; those streams, and anything too short to tell,
+// fall back to compress/gzip.
+func pgzipCompatible(header []byte) bool {
+	return len(header) == gzipHeaderSize && header[3]&gzipFlagHeaderCRC == 0
+}
 
-			return nil
-		})
+// isTarFormat reports whether format is a tar stream, plain or compressed
+func isTarFormat(format models.ArchiveFormat) bool {
+	switch format {
+	case models.FormatTar, models.FormatTarGz, models.FormatTarBz2, models.FormatTarZstd, models.FormatTarXz:
+		return true
 	}
+	return false
+}
 
-	// Single file
-	file, err := os.Open(inputPath)
+// decompressTar returns the tar stream inside r, compressed as format says
+// (or not at all for plain tar)
+func decompressTar(r io.Reader, format models.ArchiveFormat, opts *models.ArchiveOptions) (io.ReadCloser, error) {
+	switch format {
+	case models.FormatTar:
+		return io.NopCloser(r), nil
+	case models.FormatTarBz2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case models.FormatTarZstd:
+		return newZstdReader(r)
+	case models.FormatTarXz:
+		xr, err := newXzReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	}
+	gzReader, err := newGzipReader(r, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer file.Close()
+	return gzReader, nil
+}
 
-	header, err := tar.FileInfoHeader(info, info.Name())
+// newGzipWriter creates the gzip compressor for tar.gz output. FastGzip
+// selects the klauspost implementation, which writes standard gzip
+// considerably faster than compress/gzip.
+func newGzipWriter(writer io.Writer, opts *models.ArchiveOptions) (io.WriteCloser, error) {
+	if opts.FastGzip {
+		gw, err := kgzip.NewWriterLevel(writer, flateLevel(opts, models.CodecGzip))
+		if err != nil {
+			return nil, err
+		}
+		gw.ModTime = opts.ModTime
+		return gw, nil
+	}
+
+	gw, err := gzip.NewWriterLevel(writer, flateLevel(opts, models.CodecGzip))
+	if err != nil {
+		return nil, err
+	}
+	gw.ModTime = opts.ModTime
+	return gw, nil
+}
+
+// WriteEntry adds e to the tar stream
+func (w *tarEntryWriter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	header, err := tar.FileInfoHeader(e.Info, e.Linkname)
 	if err != nil {
 		return err
 	}
-	header.Name = filepath.Base(inputPath)
+	header.Name = e.Name
+	if e.isHardLink() {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = e.Linkname
+		header.Size = 0
+	}
+	// The names would otherwise map back to the original owner
+	if e.Owner != nil && e.Owner.uid >= 0 {
+		header.Uid, header.Uname = e.Owner.uid, ""
+	}
+	if e.Owner != nil && e.Owner.gid >= 0 {
+		header.Gid, header.Gname = e.Owner.gid, ""
+	}
+	if !w.modTime.IsZero() {
+		header.ModTime = w.modTime
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+	}
+
+	if e.Encrypted && w.ustar {
+		return fmt.Errorf("%s: encrypted entries cannot be stored as USTAR", e.Name)
+	}
 
-	if err := tarWriter.WriteHeader(header); err != nil {
+	if w.ustar {
+		// USTAR has whole-second times and no room for extra records;
+		// anything else that does not fit (long names, large ids) is
+		// reported by WriteHeader instead of spilling into extensions
+		header.Format = tar.FormatUSTAR
+		header.ModTime = header.ModTime.Truncate(time.Second)
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+	} else {
+		for key, value := range e.PAXRecords {
+			if header.PAXRecords == nil {
+				header.PAXRecords = make(map[string]string)
+			}
+			header.PAXRecords[key] = value
+		}
+		if e.Encrypted {
+			if header.PAXRecords == nil {
+				header.PAXRecords = make(map[string]string)
+			}
+			header.PAXRecords[paxEncrypted] = "1"
+		}
+	}
+
+	if e.Fragments != nil && r != nil && header.Typeflag == tar.TypeReg && !w.ustar {
+		return w.writeSparse(header, e.Fragments, r)
+	}
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		if w.ustar {
+			return fmt.Errorf("%s: cannot be stored as USTAR: %w", e.Name, err)
+		}
 		return err
 	}
 
-	_, err = io.Copy(tarWriter, file)
+	if r == nil || header.Typeflag != tar.TypeReg {
+		return nil
+	}
+	_, err = copyPooled(w.tw, r)
 	return err
 }
 
-func extractTarGz(reader io.Reader, outputPath string, opts *models.ArchiveOptions) error {
-	gzReader, err := gzip.NewReader(reader)
+// Close writes the tar trailer
+func (w *tarEntryWriter) Close() error {
+	return w.closeTar()
+}
+
+// Close writes the tar trailer and flushes the gzip stream
+func (w *tarGzEntryWriter) Close() error {
+	if w.index != nil {
+		return w.index.finish(w.tarEntryWriter)
+	}
+	if err := w.closeTar(); err != nil {
+		w.gw.Close()
+		return err
+	}
+	return w.gw.Close()
+}
+
+// extractTarGz extracts a gzip stream, which normally wraps a tar archive.
+// A plain gzip-compressed file is extracted as a single file named after
+// the archive without its .gz extension.
+func extractTarGz(reader io.Reader, inputPath, outputPath string, opts *models.ArchiveOptions) error {
+	gzReader, err := newGzipReader(reader, opts)
 	if err != nil {
 		return err
 	}
 	defer gzReader.Close()
 
-	tarReader := tar.NewReader(gzReader)
+	stream := bufio.NewReaderSize(gzReader, blockSize)
+	if !isTarStream(stream) {
+		return extractPlainGzip(stream, gzReader.Header, inputPath, outputPath, opts)
+	}
+
+	return extractTar(stream, outputPath, opts)
+}
+
+// extractTar extracts an uncompressed tar stream to outputPath. Entries
+// are always extracted one at a time in archive order, so a later entry
+// replaces an earlier one of the same name, as with tar(1).
+func extractTar(reader io.Reader, outputPath string, opts *models.ArchiveOptions) error {
+	tarReader := tar.NewReader(reader)
 
+	c, err := newEntryCipher(opts)
+	if err != nil {
+		return err
+	}
+
+	var flags pendingFileFlags
+	var dirs pendingDirs
+	targets := make(linkTargets)
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
@@ -113,11 +301,20 @@ func extractTarGz(reader io.Reader, outputPath string, opts *models.ArchiveOptio
 			return err
 		}
 
-		destPath := filepath.Join(outputPath, header.Name)
+		if isMetadataEntry(header.Name) {
+			continue
+		}
+		name, ok := applyEntryFilter(opts, tarEntry(header))
+		if !ok {
+			continue
+		}
+		storedName := header.Name
+		header.Name = name
 
 		// Security check: prevent path traversal
-		if !strings.HasPrefix(filepath.Clean(destPath), filepath.Clean(outputPath)) {
-			return fmt.Errorf("illegal file path: %s", header.Name)
+		destPath, err := safeDestPath(outputPath, header.Name)
+		if err != nil {
+			return err
 		}
 
 		if opts.Verbose {
@@ -125,49 +322,167 @@ func extractTarGz(reader io.Reader, outputPath string, opts *models.ArchiveOptio
 		}
 
 		switch header.Typeflag {
+		case tar.TypeGNULongName, tar.TypeGNULongLink:
+			// archive/tar folds GNU long name/link records into the header
+			// that follows them, so these should never surface here. Skip
+			// them defensively rather than writing a bogus file.
+			continue
 		case tar.TypeDir:
-			if err := os.MkdirAll(destPath, 0755); err != nil {
+			if err := os.MkdirAll(destPath, umasked(0755, opts)); err != nil {
 				return err
 			}
+			dirs.add(destPath, umasked(os.FileMode(header.Mode), opts), header.ModTime)
+			targets.remove(storedName)
 		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			if err := os.MkdirAll(filepath.Dir(destPath), umasked(0755, opts)); err != nil {
 				return err
 			}
 
-			outFile, err := os.Create(destPath)
+			outFile, err := createDestFile(destPath, 0666, opts)
 			if err != nil {
 				return err
 			}
 
-			if _, err := io.Copy(outFile, tarReader); err != nil {
+			var src io.Reader = tarReader
+			size := header.Size
+			if header.PAXRecords[paxEncrypted] != "" {
+				if src, err = openEntry(c, storedName, tarReader); err != nil {
+					outFile.Close()
+					return err
+				}
+				size = crypto.OpenedSize(size)
+			}
+
+			var dst io.Writer = outFile
+			if opts.Sparse {
+				dst = sparseWriter{file: outFile}
+			}
+			if _, err := copyEntry(dst, src, header.Name, size, opts); err != nil {
 				outFile.Close()
 				return err
 			}
+			if opts.Sparse {
+				if err := outFile.Truncate(size); err != nil {
+					outFile.Close()
+					return err
+				}
+			}
 			outFile.Close()
 
-			if err := os.Chmod(destPath, os.FileMode(header.Mode)); err != nil {
+			if err := os.Chmod(destPath, umasked(os.FileMode(header.Mode), opts)); err != nil {
 				return err
 			}
+			targets.add(storedName, header.Name)
+		case tar.TypeSymlink:
+			if !opts.AllowUnsafeLinks {
+				if err := checkLinkTarget(outputPath, destPath, header.Linkname); err != nil {
+					return err
+				}
+			}
+
+			if err := os.MkdirAll(filepath.Dir(destPath), umasked(0755, opts)); err != nil {
+				return err
+			}
+			if err := createSymlink(outputPath, header.Linkname, destPath, opts); err != nil {
+				return err
+			}
+			targets.remove(storedName)
+		case tar.TypeLink:
+			target, err := targets.resolve(header.Linkname, destPath)
+			if err != nil {
+				return err
+			}
+			if err := createHardLink(outputPath, target, destPath, opts); err != nil {
+				return err
+			}
+			targets.add(storedName, header.Name)
+		}
+
+		if opts.PreserveBirthTime {
+			if err := restoreBirthTime(destPath, header); err != nil {
+				return err
+			}
+		}
+		if opts.ACLs {
+			if err := restoreACLs(destPath, header); err != nil {
+				return err
+			}
+		}
+		if opts.PreserveFlags && header.Typeflag != tar.TypeSymlink {
+			if value, ok := header.PAXRecords[paxFileFlags]; ok {
+				flags.add(destPath, value)
+			}
 		}
 	}
 
-	return nil
+	// Directory modes go first: an immutable flag would refuse them
+	err = dirs.apply()
+	flags.apply()
+	return err
+}
+
+// restoreBirthTime applies a stored creation time to destPath where the
+// platform supports it
+func restoreBirthTime(destPath string, header *tar.Header) error {
+	value, ok := header.PAXRecords[paxCreationTime]
+	if !ok || header.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	btime, err := parsePAXTime(value)
+	if err != nil {
+		return err
+	}
+	return setBirthTime(destPath, btime)
 }
 
-func listTarGz(inputPath string) error {
+// tarEntry describes a tar member for EntryFilter callbacks
+func tarEntry(header *tar.Header) models.Entry {
+	return models.Entry{
+		Name:    header.Name,
+		Size:    header.Size,
+		Mode:    header.FileInfo().Mode(),
+		ModTime: header.ModTime,
+		IsDir:   header.Typeflag == tar.TypeDir,
+	}
+}
+
+func listTarGz(inputPath string, opts *models.ArchiveOptions) error {
 	file, err := os.Open(inputPath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	gzReader, err := gzip.NewReader(file)
+	gzReader, err := newGzipReader(file, opts)
 	if err != nil {
 		return err
 	}
 	defer gzReader.Close()
 
-	tarReader := tar.NewReader(gzReader)
+	return listTar(gzReader, plainFileName(inputPath, ".gz"))
+}
+
+// listTar prints the entries of a decompressed tar stream. A stream that
+// holds no tar archive is listed as the single file plainName.
+func listTar(r io.Reader, plainName string) error {
+	stream := bufio.NewReaderSize(r, blockSize)
+	if !isTarStream(stream) {
+		size, err := io.Copy(io.Discard, stream)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Archive contents:")
+		fmt.Printf("  %s (%d bytes)\n", plainName, size)
+		return nil
+	}
+
+	return listTarEntries(stream)
+}
+
+// listTarEntries prints the entries of an uncompressed tar stream
+func listTarEntries(r io.Reader) error {
+	tarReader := tar.NewReader(r)
 
 	fmt.Println("Archive contents:")
 	for {
@@ -179,7 +494,10 @@ func listTarGz(inputPath string) error {
 			return err
 		}
 
-		fmt.Printf("  %s (%d bytes)\n", header.Name, header.Size)
+		if isMetadataEntry(header.Name) {
+			continue
+		}
+		fmt.Printf("  %s (%d bytes)%s\n", header.Name, header.Size, encryptedSuffix(header.PAXRecords[paxEncrypted] != ""))
 	}
 
 	return nil
@@ -0,0 +1,345 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// gzipMember compresses data into one gzip member
+func gzipMember(t testing.TB, data []byte, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Name = name
+	if _, err := gw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// gzipMemberHeaderCRC compresses data into a gzip member whose header
+// carries a name and a header CRC, which compress/gzip cannot write
+func gzipMemberHeaderCRC(t testing.TB, data []byte, name string) []byte {
+	t.Helper()
+	header := []byte{0x1f, 0x8b, 8, 1<<3 | gzipFlagHeaderCRC, 0, 0, 0, 0, 0, 255}
+	header = append(header, name...)
+	header = append(header, 0)
+	header = binary.LittleEndian.AppendUint16(header, uint16(crc32.ChecksumIEEE(header)))
+
+	var body bytes.Buffer
+	fw, err := flate.NewWriter(&body, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	fw.Close()
+
+	member := append(header, body.Bytes()...)
+	member = binary.LittleEndian.AppendUint32(member, crc32.ChecksumIEEE(data))
+	return binary.LittleEndian.AppendUint32(member, uint32(len(data)))
+}
+
+// readTarGzHeaders returns the headers of the tar.gz at path by name
+func readTarGzHeaders(t *testing.T, path string) map[string]*tar.Header {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := make(map[string]*tar.Header)
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return headers
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[strings.TrimPrefix(header.Name, "./")] = header
+	}
+}
+
+// gzipTestData is compressible but not trivially so
+func gzipTestData(size int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"alpha ", "beta ", "gamma ", "delta\n", "epsilon ", "zeta "}
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.WriteString(words[rng.Intn(len(words))])
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestGzipReaderMatchesStdlib(t *testing.T) {
+	data := gzipTestData(3 << 20)
+
+	tests := []struct {
+		name   string
+		stream []byte
+	}{
+		{"empty", gzipMember(t, nil, "")},
+		{"single member", gzipMember(t, data, "data.tar")},
+		{"multiple members", append(gzipMember(t, data[:1000], "a"), gzipMember(t, data[1000:], "b")...)},
+		{"header crc", gzipMemberHeaderCRC(t, data, "data.tar")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr, err := gzip.NewReader(bytes.NewReader(tt.stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := io.ReadAll(sr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, parallel := range []bool{false, true} {
+				gr, err := newGzipReader(bytes.NewReader(tt.stream), &models.ArchiveOptions{ParallelGzip: parallel})
+				if err != nil {
+					t.Fatalf("parallel %v: %v", parallel, err)
+				}
+				got, err := io.ReadAll(gr)
+				gr.Close()
+				if err != nil {
+					t.Fatalf("parallel %v: %v", parallel, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("parallel %v: output differs from compress/gzip", parallel)
+				}
+				if gr.Header.Name != sr.Header.Name {
+					t.Errorf("parallel %v: name %q, want %q", parallel, gr.Header.Name, sr.Header.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestPgzipCompatible(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   bool
+	}{
+		{"plain", gzipMember(t, nil, "")[:gzipHeaderSize], true},
+		{"named", gzipMember(t, nil, "a.tar")[:gzipHeaderSize], true},
+		{"header crc", gzipMemberHeaderCRC(t, nil, "a.tar")[:gzipHeaderSize], false},
+		{"short", []byte{0x1f, 0x8b}, false},
+	}
+	for _, tt := range tests {
+		if got := pgzipCompatible(tt.header); got != tt.want {
+			t.Errorf("%s: pgzipCompatible = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkGzipReader(b *testing.B) {
+	data := gzipTestData(32 << 20)
+	stream := gzipMember(b, data, "")
+
+	for _, bc := range []struct {
+		name     string
+		parallel bool
+	}{{"stdlib", false}, {"pgzip", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			opts := &models.ArchiveOptions{ParallelGzip: bc.parallel}
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				gr, err := newGzipReader(bytes.NewReader(stream), opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, gr); err != nil {
+					b.Fatal(err)
+				}
+				gr.Close()
+			}
+		})
+	}
+}
+
+// TestGNULongNames reads a GNU tar archive whose names and link target
+// exceed the 100 bytes of the ustar header, so GNU tar stores them in
+// ././@LongLink records
+func TestGNULongNames(t *testing.T) {
+	dir := strings.Repeat("d", 60) + "/" + strings.Repeat("e", 70)
+	name := dir + "/" + strings.Repeat("f", 80) + ".txt"
+	input := filepath.Join("testdata", "gnu-longnames.tar.gz")
+
+	output := t.TempDir()
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(output, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "long name\n" {
+		t.Errorf("content = %q, want %q", content, "long name\n")
+	}
+	target, err := os.Readlink(filepath.Join(output, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != name {
+		t.Errorf("link target = %q, want %q", target, name)
+	}
+	if entries, err := os.ReadDir(output); err != nil || len(entries) != 2 {
+		t.Errorf("output holds %d entries (err %v), want the directory and the link", len(entries), err)
+	}
+
+	listing := captureStdout(t, func() error {
+		return NewOperator(&models.ArchiveOptions{}).List(input)
+	})
+	if strings.Contains(listing, "@LongLink") || !strings.Contains(listing, name) {
+		t.Errorf("listing does not show the long name alone:\n%s", listing)
+	}
+}
+
+func TestGzipWriterRoundTrip(t *testing.T) {
+	data := gzipTestData(1 << 20)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, fast := range []bool{false, true} {
+		for _, level := range []models.CompressionLevel{models.LevelFastest, models.LevelNormal, models.LevelBest, models.LevelStore, models.LevelHuffman} {
+			opts := &models.ArchiveOptions{FastGzip: fast, CompressionLevel: level, ModTime: modTime}
+			var buf bytes.Buffer
+			gw, err := newGzipWriter(&buf, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := gw.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := gw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Read back with compress/gzip, whatever wrote it
+			gr, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(gr)
+			if err != nil {
+				t.Fatalf("fast %v level %d: %v", fast, level, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("fast %v level %d: content differs", fast, level)
+			}
+			if !gr.ModTime.Equal(modTime) {
+				t.Errorf("fast %v level %d: header time %v, want %v", fast, level, gr.ModTime, modTime)
+			}
+		}
+	}
+}
+
+func BenchmarkGzipWriter(b *testing.B) {
+	data := gzipTestData(8 << 20)
+	for _, bc := range []struct {
+		name string
+		fast bool
+	}{
+		{"compress-gzip", false},
+		{"klauspost", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			opts := &models.ArchiveOptions{FastGzip: bc.fast}
+			b.SetBytes(int64(len(data)))
+			for range b.N {
+				gw, err := newGzipWriter(io.Discard, opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := gw.Write(data); err != nil {
+					b.Fatal(err)
+				}
+				if err := gw.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestStripExtendedHeaders(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"a.txt": "a",
+		// Fits USTAR by splitting into prefix and name
+		strings.Repeat("p", 90) + "/" + strings.Repeat("n", 90) + ".txt": "split",
+	})
+	// Sub-second times would need a PAX record
+	subsecond := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "a.txt"), subsecond, subsecond); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	opts := &models.ArchiveOptions{Format: models.FormatTarGz, StripExtendedHeaders: true, PreserveBirthTime: true}
+	if err := NewOperator(opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	headers := readTarGzHeaders(t, output)
+	for name, header := range headers {
+		if len(header.PAXRecords) != 0 || header.Format&(tar.FormatPAX|tar.FormatGNU) != 0 {
+			t.Errorf("%s: format %v with PAX records %v, want plain USTAR", name, header.Format, header.PAXRecords)
+		}
+	}
+	if got := headers["a.txt"].ModTime; !got.Equal(subsecond.Truncate(time.Second)) {
+		t.Errorf("a.txt time %v, want %v", got, subsecond.Truncate(time.Second))
+	}
+
+	// No extension records at all, in case the reader folded them away
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for block := 0; block+512 <= len(raw); block += 512 {
+		if bytes.HasPrefix(raw[block+257:], []byte("ustar")) {
+			if flag := raw[block+156]; flag == tar.TypeXHeader || flag == tar.TypeXGlobalHeader || flag == tar.TypeGNULongName || flag == tar.TypeGNULongLink {
+				t.Errorf("extension record of type %c at offset %d", flag, block)
+			}
+		}
+	}
+
+	// A name component over 100 bytes cannot be split into USTAR fields
+	long := writeTestTree(t, map[string]string{strings.Repeat("x", 120) + ".txt": "long"})
+	err = NewOperator(opts).Compress(long, filepath.Join(t.TempDir(), "long.tar.gz"))
+	if err == nil || !strings.Contains(err.Error(), "cannot be stored as USTAR") {
+		t.Errorf("error = %v, want the long name rejected", err)
+	}
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatTarGz}).Compress(long, filepath.Join(t.TempDir(), "pax.tar.gz")); err != nil {
+		t.Errorf("without the option: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// xzPresetDicts holds the dictionary size of the xz command line presets
+// 1-9; larger dictionaries find more distant matches and need more memory
+// on both ends
+var xzPresetDicts = [...]int{
+	1: 1 << 20,
+	2: 2 << 20,
+	3: 4 << 20,
+	4: 4 << 20,
+	5: 8 << 20,
+	6: 8 << 20,
+	7: 16 << 20,
+	8: 32 << 20,
+	9: 64 << 20,
+}
+
+// Presets the named compression levels map to, as in the xz command line
+const (
+	xzPresetFastest = 1
+	xzPresetDefault = 6
+	xzPresetBest    = 9
+)
+
+// tarXzEntryWriter writes archive entries to an xz-compressed tar stream
+type tarXzEntryWriter struct {
+	*tarEntryWriter
+	xw *xz.Writer
+}
+
+func newTarXzEntryWriter(writer io.Writer, opts *models.ArchiveOptions) (*tarXzEntryWriter, error) {
+	switch opts.CompressionLevel {
+	case models.LevelStore, models.LevelHuffman:
+		return nil, fmt.Errorf("tar.xz always compresses fully; use level fastest, normal or best, or 1-9")
+	}
+	preset := xzPreset(opts)
+	if preset >= len(xzPresetDicts) {
+		return nil, fmt.Errorf("invalid xz level %d: want 1-9", preset)
+	}
+
+	config := xz.WriterConfig{DictCap: xzPresetDicts[preset], Matcher: lzma.HashTable4}
+	xw, err := config.NewWriter(writer)
+	if err != nil {
+		return nil, err
+	}
+	return &tarXzEntryWriter{tarEntryWriter: newTarEntryWriter(xw, opts), xw: xw}, nil
+}
+
+// Close finishes the tar stream and then the xz stream
+func (w *tarXzEntryWriter) Close() error {
+	if err := w.closeTar(); err != nil {
+		w.xw.Close()
+		return err
+	}
+	return w.xw.Close()
+}
+
+// xzPreset maps the compression options to an xz preset, 1-9
+func xzPreset(opts *models.ArchiveOptions) int {
+	if opts.CodecLevel != 0 {
+		return opts.CodecLevel
+	}
+	switch opts.CompressionLevel {
+	case models.LevelFastest:
+		return xzPresetFastest
+	case models.LevelBest:
+		return xzPresetBest
+	default:
+		return xzPresetDefault
+	}
+}
+
+// newXzReader decompresses an xz stream, including concatenated streams
+// as xz itself writes for multithreaded runs
+func newXzReader(r io.Reader) (io.Reader, error) {
+	return xz.NewReader(bufio.NewReader(r))
+}
+
+// extractTarXz extracts an xz stream, which normally wraps a tar archive.
+// A plain xz-compressed file is extracted as a single file named after
+// the archive without its .xz extension.
+func extractTarXz(reader io.Reader, inputPath, outputPath string, opts *models.ArchiveOptions) error {
+	xr, err := newXzReader(reader)
+	if err != nil {
+		return err
+	}
+
+	stream := bufio.NewReaderSize(xr, blockSize)
+	if !isTarStream(stream) {
+		return extractPlainFile(stream, plainFileName(inputPath, ".xz"), time.Time{}, outputPath, opts)
+	}
+
+	return extractTar(stream, outputPath, opts)
+}
+
+func listTarXz(inputPath string) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	xr, err := newXzReader(file)
+	if err != nil {
+		return err
+	}
+
+	return listTar(xr, plainFileName(inputPath, ".xz"))
+}
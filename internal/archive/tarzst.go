@@ -0,0 +1,108 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// maxZstdLevel is the highest level the zstd command line accepts
+const maxZstdLevel = 22
+
+// tarZstdEntryWriter writes archive entries to a zstd-compressed tar stream
+type tarZstdEntryWriter struct {
+	*tarEntryWriter
+	zw *zstd.Encoder
+}
+
+func newTarZstdEntryWriter(writer io.Writer, opts *models.ArchiveOptions) (*tarZstdEntryWriter, error) {
+	switch opts.CompressionLevel {
+	case models.LevelStore, models.LevelHuffman:
+		return nil, fmt.Errorf("tar.zst always compresses fully; use level fastest, normal or best, or 1-%d", maxZstdLevel)
+	}
+	if opts.CodecLevel > maxZstdLevel {
+		return nil, fmt.Errorf("invalid zstd level %d: want 1-%d", opts.CodecLevel, maxZstdLevel)
+	}
+	zw, err := zstd.NewWriter(writer, zstd.WithEncoderLevel(zstdLevel(opts)))
+	if err != nil {
+		return nil, err
+	}
+	return &tarZstdEntryWriter{tarEntryWriter: newTarEntryWriter(zw, opts), zw: zw}, nil
+}
+
+// Close finishes the tar stream and then the zstd stream
+func (w *tarZstdEntryWriter) Close() error {
+	if err := w.closeTar(); err != nil {
+		w.zw.Close()
+		return err
+	}
+	return w.zw.Close()
+}
+
+// zstdLevel maps the compression options to a zstd encoder speed. Exact
+// levels (including a -zstd-level override) use the zstd command line's
+// scale of 1-22, which the encoder rounds to its nearest speed.
+func zstdLevel(opts *models.ArchiveOptions) zstd.EncoderLevel {
+	if level := exactLevel(opts, models.CodecZstd); level != 0 {
+		return zstd.EncoderLevelFromZstd(level)
+	}
+	switch opts.CompressionLevel {
+	case models.LevelFastest:
+		return zstd.SpeedFastest
+	case models.LevelBest:
+		return zstd.SpeedBestCompression
+	default:
+		return zstd.SpeedDefault
+	}
+}
+
+// newZstdReader decompresses a zstd stream. Decoding runs in the calling
+// goroutine, as the other tar decompressors do.
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// extractTarZstd extracts a zstd stream, which normally wraps a tar
+// archive. A plain zstd-compressed file is extracted as a single file
+// named after the archive without its .zst extension.
+func extractTarZstd(reader io.Reader, inputPath, outputPath string, opts *models.ArchiveOptions) error {
+	zr, err := newZstdReader(reader)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	stream := bufio.NewReaderSize(zr, blockSize)
+	if !isTarStream(stream) {
+		return extractPlainFile(stream, plainFileName(inputPath, ".zst"), time.Time{}, outputPath, opts)
+	}
+
+	return extractTar(stream, outputPath, opts)
+}
+
+func listTarZstd(inputPath string) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zr, err := newZstdReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	return listTar(zr, plainFileName(inputPath, ".zst"))
+}
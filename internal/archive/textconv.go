@@ -0,0 +1,122 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"io"
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Line endings -text-convert writes
+const (
+	// TextLF converts CRLF line endings to LF
+	TextLF = "lf"
+	// TextCRLF converts bare LF line endings to CRLF
+	TextCRLF = "crlf"
+)
+
+// convertsText reports whether the line endings of the file name are
+// converted. Only names matching TextPattern are touched, so binary files
+// pass through unchanged.
+func convertsText(opts *models.ArchiveOptions, name string) bool {
+	return opts.TextConvert != "" && matchesAny(opts.TextPattern, name)
+}
+
+// lineEndingReader converts the line endings of the text read from r
+type lineEndingReader struct {
+	r    io.Reader
+	crlf bool
+	in   []byte
+	out  []byte
+	conv []byte
+	err  error
+	// cr is set when the last byte seen was a carriage return. Converting
+	// to LF holds it back until the next byte shows whether it starts a
+	// CRLF pair.
+	cr bool
+}
+
+func newLineEndingReader(r io.Reader, mode string) *lineEndingReader {
+	return &lineEndingReader{r: r, crlf: mode == TextCRLF, in: make([]byte, 32*1024)}
+}
+
+func (t *lineEndingReader) Read(p []byte) (int, error) {
+	for len(t.out) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		n, err := t.r.Read(t.in)
+		t.out = t.convert(t.in[:n], err != nil)
+		t.err = err
+	}
+
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+// convert rewrites one chunk; end reports that no more input follows
+func (t *lineEndingReader) convert(chunk []byte, end bool) []byte {
+	out := t.conv[:0]
+	for _, b := range chunk {
+		if t.crlf {
+			if b == '\n' && !t.cr {
+				out = append(out, '\r')
+			}
+			out = append(out, b)
+			t.cr = b == '\r'
+			continue
+		}
+
+		if t.cr {
+			t.cr = false
+			if b == '\n' {
+				out = append(out, '\n')
+				continue
+			}
+			out = append(out, '\r')
+		}
+		if b == '\r' {
+			t.cr = true
+			continue
+		}
+		out = append(out, b)
+	}
+	if end && t.cr && !t.crlf {
+		out = append(out, '\r')
+		t.cr = false
+	}
+	t.conv = out
+	return out
+}
+
+// convertToTemp converts the line endings of src into a temporary file,
+// since tar needs the converted size before the content is written, and
+// returns it rewound with that size. The source is read only once. The
+// caller closes and removes the file.
+func convertToTemp(src io.Reader, opts *models.ArchiveOptions) (*os.File, int64, error) {
+	tmp, err := NewOperator(opts).createTemp("gar-text-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := copyPooled(tmp, newLineEndingReader(src, opts.TextConvert))
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+	return tmp, n, nil
+}
+
+// resizedFileInfo reports a different size for a file whose stored
+// content differs from the file on disk
+type resizedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi resizedFileInfo) Size() int64 { return fi.size }
@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestLineEndingReader(t *testing.T) {
+	tests := []struct {
+		mode, in, want string
+	}{
+		{TextLF, "a\r\nb\r\n", "a\nb\n"},
+		{TextLF, "a\rb\r", "a\rb\r"},
+		{TextLF, "a\r\r\nb", "a\r\nb"},
+		{TextCRLF, "a\nb\n", "a\r\nb\r\n"},
+		{TextCRLF, "a\r\nb\n", "a\r\nb\r\n"},
+		{TextCRLF, "", ""},
+	}
+	for _, tt := range tests {
+		// One byte at a time splits every CRLF pair across reads
+		got, err := io.ReadAll(newLineEndingReader(iotest.OneByteReader(strings.NewReader(tt.in)), tt.mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s %q = %q, want %q", tt.mode, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompressTextConvert(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	text := strings.Repeat("line\r\n", 20000)
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "b.bin"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []models.ArchiveFormat{models.FormatTarGz, models.FormatZip} {
+		tmp := t.TempDir()
+		output := filepath.Join(dir, "out"+map[models.ArchiveFormat]string{models.FormatTarGz: ".tar.gz", models.FormatZip: ".zip"}[format])
+		opts := &models.ArchiveOptions{Format: format, TextConvert: TextLF, TextPattern: []string{"*.txt"}, TempDir: tmp}
+		if err := NewOperator(opts).Compress(src, output); err != nil {
+			t.Fatal(err)
+		}
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("%v: %d temporary files left behind", format, len(entries))
+		}
+
+		dest := filepath.Join(dir, "dest", filepath.Base(output))
+		if err := NewOperator(&models.ArchiveOptions{}).Extract(output, dest); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dest, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.ReplaceAll(text, "\r\n", "\n"); string(got) != want {
+			t.Errorf("%v: a.txt has %d bytes, want %d converted", format, len(got), len(want))
+		}
+		if got, _ := os.ReadFile(filepath.Join(dest, "b.bin")); string(got) != text {
+			t.Errorf("%v: b.bin was converted", format)
+		}
+	}
+}
+
+func FuzzLineEndingReader(f *testing.F) {
+	for _, s := range []string{"", "a\r\nb", "\r\r\n\n", "x\ry\n"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		convert := func(in, mode string) string {
+			out, err := io.ReadAll(newLineEndingReader(iotest.HalfReader(strings.NewReader(in)), mode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(out)
+		}
+
+		// Every CRLF pair loses its CR and nothing else changes
+		lf := convert(s, TextLF)
+		if lf != strings.ReplaceAll(s, "\r\n", "\n") {
+			t.Errorf("LF of %q = %q", s, lf)
+		}
+		crlf := convert(s, TextCRLF)
+		if strings.Count(crlf, "\n") != strings.Count(crlf, "\r\n") {
+			t.Errorf("CRLF of %q has a bare LF: %q", s, crlf)
+		}
+		if !strings.Contains(s, "\r") && convert(crlf, TextLF) != s {
+			t.Errorf("CRLF and back of %q = %q", s, convert(crlf, TextLF))
+		}
+	})
+}
@@ -0,0 +1,130 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// transformRule is one sed-style s/regexp/replacement/flags expression
+type transformRule struct {
+	re     *regexp.Regexp
+	repl   string
+	global bool
+}
+
+// ParseTransforms compiles sed-style name transforms such as
+// `s/^src\//app\//` into a function applying them in order. Any character
+// may follow the s as delimiter. Flags: g replaces every match instead of
+// the first, i matches case-insensitively. The replacement may refer to
+// groups as \1 through \9 or ${name}. All rules are validated before any
+// is applied.
+func ParseTransforms(exprs []string) (func(name string) string, error) {
+	rules := make([]transformRule, 0, len(exprs))
+	for _, expr := range exprs {
+		rule, err := parseTransform(expr)
+		if err != nil {
+			return nil, fmt.Errorf("transform %q: %w", expr, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return func(name string) string {
+		for _, rule := range rules {
+			name = rule.apply(name)
+		}
+		return name
+	}, nil
+}
+
+func parseTransform(expr string) (transformRule, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return transformRule{}, fmt.Errorf("expected s/regexp/replacement/[flags]")
+	}
+	delim := expr[1:2]
+
+	parts := splitUnescaped(expr[2:], delim[0])
+	if len(parts) != 3 {
+		return transformRule{}, fmt.Errorf("expected s%[1]sregexp%[1]sreplacement%[1]s[flags]", delim)
+	}
+	pattern, repl, flags := parts[0], parts[1], parts[2]
+
+	// An escaped delimiter stands for itself
+	pattern = strings.ReplaceAll(pattern, `\`+delim, delim)
+	repl = strings.ReplaceAll(repl, `\`+delim, delim)
+
+	rule := transformRule{repl: sedReplacement(repl)}
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			rule.global = true
+		case 'i':
+			pattern = "(?i)" + pattern
+		default:
+			return transformRule{}, fmt.Errorf("unknown flag %q", flag)
+		}
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return transformRule{}, err
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// splitUnescaped splits s at every delim not preceded by a backslash
+func splitUnescaped(s string, delim byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case delim:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// sedReplacement converts \1..\9 and & to regexp.Expand syntax
+func sedReplacement(repl string) string {
+	var b strings.Builder
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		switch {
+		case c == '\\' && i+1 < len(repl):
+			next := repl[i+1]
+			i++
+			if next >= '0' && next <= '9' {
+				fmt.Fprintf(&b, "${%c}", next)
+				continue
+			}
+			if next == '$' {
+				b.WriteString("$$")
+				continue
+			}
+			b.WriteByte(next)
+		case c == '&':
+			b.WriteString("${0}")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (r transformRule) apply(name string) string {
+	if r.global {
+		return r.re.ReplaceAllString(name, r.repl)
+	}
+	loc := r.re.FindStringSubmatchIndex(name)
+	if loc == nil {
+		return name
+	}
+	expanded := r.re.ExpandString(nil, r.repl, name, loc)
+	return name[:loc[0]] + string(expanded) + name[loc[1]:]
+}
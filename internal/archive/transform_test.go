@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTransforms(t *testing.T) {
+	tests := []struct {
+		exprs []string
+		in    string
+		want  string
+	}{
+		{[]string{`s/^src\//app\//`}, "src/main.go", "app/main.go"},
+		{[]string{`s/^src/app/`, `s/app/bin/`}, "src/app.go", "bin/app.go"},
+		{[]string{`s/app/bin/`, `s/^src/app/`}, "src/app.go", "app/bin.go"},
+		{[]string{`s/a/x/`}, "banana", "bxnana"},
+		{[]string{`s/a/x/g`}, "banana", "bxnxnx"},
+		{[]string{`s/README/readme/i`}, "docs/ReadMe.md", "docs/readme.md"},
+		{[]string{`s,/,_,g`}, "a/b/c", "a_b_c"},
+		{[]string{`s/\//-/g`}, "a/b", "a-b"},
+		{[]string{`s/\(.*\)\.txt/&.bak/`}, "(x).txt", "(x).txt.bak"},
+		{[]string{`s/(\w+)-(\w+)/\2-\1/`}, "one-two.go", "two-one.go"},
+		{[]string{`s/(?P<base>\w+)\.c/${base}.o/`}, "main.c", "main.o"},
+		{[]string{`s/x/\$1/`}, "x", "$1"},
+		{[]string{`s/^tmp\/.*//`}, "tmp/cache", ""},
+		{nil, "unchanged", "unchanged"},
+	}
+	for _, tt := range tests {
+		transform, err := ParseTransforms(tt.exprs)
+		if err != nil {
+			t.Errorf("ParseTransforms(%q): %v", tt.exprs, err)
+			continue
+		}
+		if got := transform(tt.in); got != tt.want {
+			t.Errorf("ParseTransforms(%q)(%q) = %q, want %q", tt.exprs, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTransformsInvalid(t *testing.T) {
+	tests := []struct {
+		exprs []string
+		want  string
+	}{
+		{[]string{"x/a/b/"}, "expected s/regexp/replacement/[flags]"},
+		{[]string{"s"}, "expected s/regexp/replacement/[flags]"},
+		{[]string{"s/a/b"}, "expected s/regexp/replacement/[flags]"},
+		{[]string{"s|a|b"}, "expected s|regexp|replacement|[flags]"},
+		{[]string{"s/a/b/q"}, "unknown flag"},
+		{[]string{"s/(/x/"}, "missing closing )"},
+		// Every rule is checked, not only the first
+		{[]string{"s/a/b/", "s/[/x/"}, `transform "s/[/x/"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseTransforms(tt.exprs)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseTransforms(%q) error = %v, want %q", tt.exprs, err, tt.want)
+		}
+	}
+}
+
+func FuzzParseTransforms(f *testing.F) {
+	for _, seed := range []string{`s/a/b/`, `s,x,\1,g`, `s/\//-/gi`, "s", `s/(/x/`} {
+		f.Add(seed, "src/a/b.txt")
+	}
+	f.Fuzz(func(t *testing.T, expr, name string) {
+		transform, err := ParseTransforms([]string{expr})
+		if err != nil {
+			return
+		}
+		transform(name)
+	})
+}
@@ -5,6 +5,6 @@ const (
 	// Version of the application
 	Version = "1.0.0"
 
-	// BufferSize for file operations
+	// BufferSize is the default size of copy buffers (see SetBufferSize)
 	BufferSize = 32 * 1024 // 32KB
 )
@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// umaskModes are the archived modes of the umask test entries
+var umaskModes = map[string]os.FileMode{
+	"dir":         os.ModeDir | 0777,
+	"dir/all.sh":  0777,
+	"dir/own.txt": 0640,
+}
+
+var umaskOrder = []string{"dir", "dir/all.sh", "dir/own.txt"}
+
+func writeUmaskTarGz(t *testing.T, dir string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range umaskOrder {
+		mode := umaskModes[name]
+		header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: int64(mode.Perm()), ModTime: time.Unix(1700000000, 0)}
+		if mode.IsDir() {
+			header.Name += "/"
+			header.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, dir, "umask.tar.gz", buf.Bytes())
+}
+
+func writeUmaskZip(t *testing.T, dir string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range umaskOrder {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		if umaskModes[name].IsDir() {
+			header.Name += "/"
+		}
+		header.SetMode(umaskModes[name])
+		if _, err := zw.CreateHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, dir, "umask.zip", buf.Bytes())
+}
+
+func TestExtractUmask(t *testing.T) {
+	archives := map[string]func(*testing.T, string) string{
+		"tar.gz": writeUmaskTarGz,
+		"zip":    writeUmaskZip,
+	}
+	tests := []struct {
+		name  string
+		umask os.FileMode
+		want  map[string]os.FileMode
+	}{
+		{
+			name:  "077",
+			umask: 077,
+			want:  map[string]os.FileMode{"dir": 0700, "dir/all.sh": 0700, "dir/own.txt": 0600},
+		},
+		{
+			name:  "027",
+			umask: 027,
+			want:  map[string]os.FileMode{"dir": 0750, "dir/all.sh": 0750, "dir/own.txt": 0640},
+		},
+	}
+	for format, write := range archives {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				input := write(t, dir)
+				output := filepath.Join(dir, "out")
+
+				if err := NewOperator(&models.ArchiveOptions{Umask: tt.umask}).Extract(input, output); err != nil {
+					t.Fatal(err)
+				}
+				for name, want := range tt.want {
+					fi, err := os.Stat(filepath.Join(output, name))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got := fi.Mode().Perm(); got != want {
+						t.Errorf("%s mode = %o, want %o", name, got, want)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Verify reads every entry of the archive, which checks the stored CRCs,
+// and compares file contents against the embedded manifest when the
+// archive has one. Problems are printed and summarized in the error.
+func (op *Operator) Verify(inputPath string) error {
+	return op.verifyTo(inputPath, os.Stdout)
+}
+
+// verifyTo verifies inputPath, printing problems and the result to w
+func (op *Operator) verifyTo(inputPath string, w io.Writer) error {
+	format := detectFormat(inputPath, op.opts)
+
+	m, err := readManifest(inputPath, format, op.opts)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", inputPath, err)
+	}
+	if _, err := op.checkMerkleRoot(m); err != nil {
+		return fmt.Errorf("verify %s: %w", inputPath, err)
+	}
+
+	var check func(name string, r io.Reader) error
+	if m != nil {
+		newHash, err := newHashFunc(m.Algorithm)
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", inputPath, err)
+		}
+		check = func(name string, r io.Reader) error {
+			h := newHash()
+			if _, err := copyPooled(h, r); err != nil {
+				return err
+			}
+			want, ok := m.Digests[name]
+			if !ok {
+				return fmt.Errorf("not in manifest")
+			}
+			if got := hex.EncodeToString(h.Sum(nil)); got != want {
+				return fmt.Errorf("%s mismatch", m.Algorithm)
+			}
+			return nil
+		}
+	} else {
+		check = func(_ string, r io.Reader) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		}
+	}
+
+	failures := 0
+	seen := make(map[string]bool)
+	err = forEachEntry(inputPath, format, op.opts, func(e *archiveEntry, r io.Reader) error {
+		name := path.Clean(e.Name)
+		if r == nil {
+			return nil
+		}
+		seen[name] = true
+
+		if err := check(name, r); err != nil {
+			fmt.Fprintf(w, "  FAIL %s: %v\n", name, err)
+			failures++
+		} else if op.opts.Verbose {
+			fmt.Fprintf(w, "  OK   %s\n", name)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", inputPath, err)
+	}
+
+	if m != nil {
+		for _, name := range m.Names {
+			if !seen[name] {
+				fmt.Fprintf(w, "  FAIL %s: missing from archive\n", name)
+				failures++
+			}
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("verify %s: %d problem(s) found", inputPath, failures)
+	}
+
+	switch {
+	case m != nil && m.Root != "":
+		fmt.Fprintf(w, "%s: OK (%d files, %s manifest, Merkle root %s)\n", inputPath, len(seen), m.Algorithm, m.Root)
+	case m != nil:
+		fmt.Fprintf(w, "%s: OK (%d files, %s manifest)\n", inputPath, len(seen), m.Algorithm)
+	default:
+		fmt.Fprintf(w, "%s: OK (%d files, no manifest)\n", inputPath, len(seen))
+	}
+	return nil
+}
+
+// readManifest returns the manifest of the archive at inputPath, or nil
+// if it has none. The manifest is the last entry, so the whole archive is
+// read to find it.
+func readManifest(inputPath string, format models.ArchiveFormat, opts *models.ArchiveOptions) (*manifest, error) {
+	var m *manifest
+	err := forEachArchiveEntry(inputPath, format, opts, func(e *archiveEntry, r io.Reader) error {
+		if path.Clean(e.Name) != manifestName || r == nil {
+			return nil
+		}
+		var err error
+		m, err = parseManifest(r)
+		return err
+	})
+	return m, err
+}
+
+// checkMerkleRoot rebuilds the Merkle tree of m when it records a root
+// and checks the root against it and against MerkleRoot, if set. The
+// tree is nil for manifests without a root.
+func (op *Operator) checkMerkleRoot(m *manifest) (*merkleTree, error) {
+	if m == nil || m.Root == "" {
+		if op.opts.MerkleRoot != "" {
+			return nil, fmt.Errorf("archive records no Merkle root (compress with -merkle)")
+		}
+		return nil, nil
+	}
+
+	newHash, err := newHashFunc(m.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := newMerkleTree(m, newHash)
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(tree.root()) != m.Root {
+		return nil, fmt.Errorf("manifest does not match its Merkle root")
+	}
+	if op.opts.MerkleRoot != "" && !strings.EqualFold(op.opts.MerkleRoot, m.Root) {
+		return nil, fmt.Errorf("recorded Merkle root %s does not match -merkle-root %s", m.Root, op.opts.MerkleRoot)
+	}
+	return tree, nil
+}
+
+// VerifyEntry checks the entry named name against the Merkle root in the
+// manifest: its content is hashed and the inclusion proof built from the
+// other digests must lead to the root. Only that entry's content is
+// hashed, so with a trusted -merkle-root one file can be checked without
+// trusting (or hashing) the rest.
+func (op *Operator) VerifyEntry(inputPath, name string) error {
+	format := detectFormat(inputPath, op.opts)
+	name = path.Clean(name)
+
+	m, err := readManifest(inputPath, format, op.opts)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", inputPath, err)
+	}
+	if m == nil || m.Root == "" {
+		return fmt.Errorf("verify %s: archive records no Merkle root (compress with -merkle)", inputPath)
+	}
+	tree, err := op.checkMerkleRoot(m)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", inputPath, err)
+	}
+	index := slices.Index(m.Names, name)
+	if index < 0 {
+		return fmt.Errorf("verify %s: %s: not in manifest", inputPath, name)
+	}
+
+	var digest []byte
+	err = forEachEntry(inputPath, format, op.opts, func(e *archiveEntry, r io.Reader) error {
+		if r == nil || path.Clean(e.Name) != name {
+			return nil
+		}
+		h := tree.newHash()
+		if _, err := copyPooled(h, r); err != nil {
+			return err
+		}
+		digest = h.Sum(nil)
+		return errEntryFound
+	})
+	if err != nil && err != errEntryFound {
+		return fmt.Errorf("verify %s: %w", inputPath, err)
+	}
+	if digest == nil {
+		return fmt.Errorf("verify %s: %s: missing from archive", inputPath, name)
+	}
+
+	proof := tree.proof(index)
+	if op.opts.Verbose {
+		for _, step := range proof {
+			side := "right"
+			if step.Left {
+				side = "left"
+			}
+			fmt.Printf("  %-5s %x\n", side, step.Hash)
+		}
+	}
+	if !tree.verifyProof(name, digest, proof, tree.root()) {
+		return fmt.Errorf("verify %s: %s: %s does not match the Merkle root", inputPath, name, m.Algorithm)
+	}
+	fmt.Printf("%s: OK (proof of %d steps to Merkle root %s)\n", name, len(proof), m.Root)
+	return nil
+}
@@ -0,0 +1,111 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// verifyResult is the outcome of verifying one archive of a directory
+type verifyResult struct {
+	path string
+	err  error
+	// output holds what Verify printed for the archive
+	output bytes.Buffer
+}
+
+// VerifyDir verifies every archive found under dir on the worker pool, up
+// to opts.Workers at a time (with models.WorkersAuto, as many as a sample of
+// the first archive suggests), and prints a PASS or FAIL line for each in
+// path order. Failing archives are followed by their problems, and with
+// Verbose every archive is. It returns an error if any archive failed.
+func (op *Operator) VerifyDir(dir string) error {
+	paths, err := findArchives(dir)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no archives found in %s", dir)
+	}
+
+	workers := op.opts.Workers
+	if workers <= models.WorkersAuto {
+		workers = autoWorkers(sampleFile(paths[0]))
+	}
+	pool, release := workerPool(op.opts, workers)
+	defer release()
+
+	results := make([]verifyResult, len(paths))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, p := range paths {
+		res := &results[i]
+		res.path = p
+
+		wg.Add(1)
+		sem <- struct{}{}
+		pool.Submit(func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res.err = op.verifyTo(res.path, &res.output)
+		})
+	}
+	wg.Wait()
+
+	failed := 0
+	for i := range results {
+		res := &results[i]
+		name, err := filepath.Rel(dir, res.path)
+		if err != nil {
+			name = res.path
+		}
+
+		if res.err == nil {
+			fmt.Printf("PASS  %s\n", name)
+		} else {
+			failed++
+			detail := strings.TrimPrefix(res.err.Error(), "verify "+res.path+": ")
+			fmt.Printf("FAIL  %s: %s\n", name, detail)
+		}
+		if res.err != nil || op.opts.Verbose {
+			printIndented(&res.output)
+		}
+	}
+
+	fmt.Printf("%d of %d archives passed\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives failed verification", failed, len(results))
+	}
+	return nil
+}
+
+// findArchives returns the files under dir with an archive extension, in
+// lexical order
+func findArchives(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && isArchiveExt(p) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// printIndented prints each line of buf indented under a result line
+func printIndented(buf *bytes.Buffer) {
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		fmt.Printf("      %s\n", strings.TrimLeft(scanner.Text(), " "))
+	}
+}
@@ -0,0 +1,63 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestVerifyDir(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("stored content that verify reads back")
+	good := buildZip(t, zip.Store, map[string][]byte{"a.txt": content}, []string{"a.txt"})
+	writeFile(t, dir, "good.zip", good)
+	// A flipped content byte fails the CRC check
+	bad := bytes.Clone(good)
+	bad[bytes.Index(bad, content)] ^= 0xff
+	writeFile(t, dir, "bad.zip", bad)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTarGz(t, filepath.Join(dir, "sub"), []tarMember{{name: "b.txt", body: "beta"}})
+	// Files without an archive extension are not verified
+	writeFile(t, dir, "notes.txt", []byte("not an archive"))
+
+	var err error
+	out := captureStdout(t, func() error {
+		err = NewOperator(&models.ArchiveOptions{Workers: 4}).VerifyDir(dir)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 archives failed") {
+		t.Errorf("err = %v, want one of three archives failed", err)
+	}
+
+	var results []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "PASS") || strings.HasPrefix(line, "FAIL") {
+			results = append(results, line[:6]+strings.SplitN(line[6:], ":", 2)[0])
+		}
+	}
+	want := []string{"FAIL  bad.zip", "PASS  good.zip", "PASS  " + filepath.Join("sub", "test.tar.gz")}
+	if strings.Join(results, "\n") != strings.Join(want, "\n") {
+		t.Errorf("results:\n%s\nwant:\n%s\noutput:\n%s", strings.Join(results, "\n"), strings.Join(want, "\n"), out)
+	}
+	if !strings.Contains(out, "2 of 3 archives passed") {
+		t.Errorf("output has no summary:\n%s", out)
+	}
+
+	// A directory of good archives passes
+	if err := os.Remove(filepath.Join(dir, "bad.zip")); err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() error { return NewOperator(&models.ArchiveOptions{Workers: 4}).VerifyDir(dir) })
+
+	empty := t.TempDir()
+	if err := NewOperator(&models.ArchiveOptions{}).VerifyDir(empty); err == nil || !strings.Contains(err.Error(), "no archives found") {
+		t.Errorf("empty directory: err = %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// walkFunc is called for every input file that should be stored in the
+// archive, with name being the slash-separated archive name.
+type walkFunc func(path, name string, fi os.FileInfo) error
+
+// walkInput visits inputPath (a single file or a directory tree) and calls fn
+// for each entry that passes the configured EntryFilter
+func walkInput(inputPath string, info os.FileInfo, opts *models.ArchiveOptions, fn walkFunc) error {
+	if !info.IsDir() {
+		if isExcluded(opts, filepath.Base(inputPath)) || skipsEmpty(opts, info) {
+			countSkipped(opts)
+			return nil
+		}
+		name, ok := filterEntry(opts, filepath.Base(inputPath), info)
+		if !ok {
+			return nil
+		}
+		return fn(inputPath, name, info)
+	}
+
+	// filepath.Walk does not descend into a symlinked root, so resolve it
+	// first; entry names stay relative to the root either way
+	root, err := filepath.EvalSymlinks(inputPath)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		relName := filepath.ToSlash(relPath)
+		if relName != "." && (isExcluded(opts, relName) || skipsEmpty(opts, fi)) {
+			countSkipped(opts)
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name, ok := filterEntry(opts, relName, fi)
+		if !ok {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := fn(path, name, fi); err != nil {
+			return err
+		}
+
+		// Without recursion subdirectories are stored as entries only, and
+		// MaxDepth does the same for directories at the limit
+		if fi.IsDir() && path != root && (opts.NoRecursion || atMaxDepth(opts, relName)) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// rootChainTooLong reports whether inputPath starts a chain of more than
+// DerefDepth symlinks, a loop included, warning that it is stored as a link
+func (op *Operator) rootChainTooLong(inputPath string) bool {
+	if op.opts.DerefDepth <= 0 {
+		return false
+	}
+	hops, err := linkHops(inputPath, op.opts.DerefDepth+1)
+	if err != nil || hops <= op.opts.DerefDepth {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s is a chain of more than %d symlinks (-deref-depth); storing the link itself\n",
+		inputPath, op.opts.DerefDepth)
+	return true
+}
+
+// linkHops counts the symlinks followed from p to a file that is not one,
+// stopping at limit, which a loop always reaches
+func linkHops(p string, limit int) (int, error) {
+	hops := 0
+	for hops < limit {
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return hops, err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return hops, nil
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return hops, err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(p), target)
+		}
+		p = target
+		hops++
+	}
+	return hops, nil
+}
+
+// atMaxDepth reports whether the slash-separated relName lies at (or
+// beyond) the configured MaxDepth below the walk root
+func atMaxDepth(opts *models.ArchiveOptions, relName string) bool {
+	return opts.MaxDepth > 0 && strings.Count(relName, "/")+1 >= opts.MaxDepth
+}
+
+// filterEntry applies the EntryFilter (if any) and returns the name to use
+func filterEntry(opts *models.ArchiveOptions, name string, fi os.FileInfo) (string, bool) {
+	return applyEntryFilter(opts, models.Entry{
+		Name:    name,
+		Size:    fi.Size(),
+		Mode:    fi.Mode(),
+		ModTime: fi.ModTime(),
+		IsDir:   fi.IsDir(),
+	})
+}
+
+// applyEntryFilter runs the EntryFilter against entry and returns the
+// (possibly renamed) entry name and whether it should be processed
+func applyEntryFilter(opts *models.ArchiveOptions, entry models.Entry) (string, bool) {
+	if opts.EntryFilter == nil {
+		return entry.Name, true
+	}
+
+	include, newName := opts.EntryFilter(entry)
+	if !include {
+		countSkipped(opts)
+		return "", false
+	}
+	if newName == "" {
+		return entry.Name, true
+	}
+	return newName, true
+}
@@ -0,0 +1,245 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// writeTestTree creates files (and their directories) under a new directory
+// and returns its path
+func writeTestTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// archivedNames compresses src to a tar.gz with opts and returns the
+// sorted entry names
+func archivedNames(t *testing.T, src string, opts models.ArchiveOptions) []string {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	opts.Format = models.FormatTarGz
+	if err := NewOperator(&opts).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range readTarGzHeaders(t, output) {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestSymlinkedInputRoot(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.MkdirAll(filepath.Join(target, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := os.WriteFile(filepath.Join(target, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		noFollowRoot bool
+		want         []string
+	}{
+		{"follow", false, []string{".", "a.txt", "sub", "sub/b.txt"}},
+		{"no follow", true, []string{"link"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out.tar.gz")
+			opts := &models.ArchiveOptions{Format: models.FormatTarGz, NoFollowRoot: tt.noFollowRoot}
+			if err := NewOperator(opts).Compress(link, output); err != nil {
+				t.Fatal(err)
+			}
+
+			headers := readTarGzHeaders(t, output)
+			var names []string
+			for name := range headers {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Fatalf("entries = %q, want %q", names, tt.want)
+			}
+			if tt.noFollowRoot {
+				if h := headers["link"]; h.Typeflag != tar.TypeSymlink || h.Linkname != target {
+					t.Errorf("link stored as type %c -> %q, want a symlink to %s", h.Typeflag, h.Linkname, target)
+				}
+			}
+		})
+	}
+}
+
+func TestDerefDepth(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, target, "a.txt", []byte("a"))
+
+	// link3 -> link2 -> link1 -> target
+	prev := "target"
+	for _, name := range []string{"link1", "link2", "link3"} {
+		if err := os.Symlink(prev, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+		prev = name
+	}
+	// loopA -> loopB -> loopA
+	if err := os.Symlink("loopB", filepath.Join(dir, "loopA")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("loopA", filepath.Join(dir, "loopB")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		input string
+		depth int
+		want  []string
+	}{
+		{"link3", 0, []string{".", "a.txt"}},
+		{"link3", 3, []string{".", "a.txt"}},
+		{"link3", 2, []string{"link3"}},
+		{"link1", 1, []string{".", "a.txt"}},
+		{"loopA", 5, []string{"loopA"}},
+	} {
+		var names []string
+		stderr := captureStderr(t, func() error {
+			names = archivedNames(t, filepath.Join(dir, tt.input), models.ArchiveOptions{DerefDepth: tt.depth})
+			return nil
+		})
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("%s -deref-depth=%d: entries = %q, want %q", tt.input, tt.depth, names, tt.want)
+		}
+		if warned := strings.Contains(stderr, "-deref-depth"); warned != (len(tt.want) == 1) {
+			t.Errorf("%s -deref-depth=%d: stderr %q", tt.input, tt.depth, stderr)
+		}
+	}
+
+	// The stored link keeps its own target
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	captureStderr(t, func() error {
+		opts := &models.ArchiveOptions{Format: models.FormatTarGz, DerefDepth: 1}
+		return NewOperator(opts).Compress(filepath.Join(dir, "link3"), output)
+	})
+	if h := readTarGzHeaders(t, output)["link3"]; h == nil || h.Typeflag != tar.TypeSymlink || h.Linkname != "link2" {
+		t.Errorf("link3 header = %+v, want a symlink to link2", h)
+	}
+
+	// Without a limit a loop fails as before
+	err := NewOperator(&models.ArchiveOptions{}).Compress(filepath.Join(dir, "loopA"), filepath.Join(t.TempDir(), "out.zip"))
+	if err == nil {
+		t.Error("compressing a symlink loop succeeded without -deref-depth")
+	}
+}
+
+func TestNoRecursion(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"top.txt":         "top",
+		"sub/inner.txt":   "inner",
+		"sub/deep/x.txt":  "x",
+		"other/empty.txt": "",
+	})
+
+	tests := []struct {
+		name string
+		opts models.ArchiveOptions
+		want []string
+	}{
+		{"recursive", models.ArchiveOptions{}, []string{".", "other", "other/empty.txt", "sub", "sub/deep", "sub/deep/x.txt", "sub/inner.txt", "top.txt"}},
+		{"no recursion", models.ArchiveOptions{NoRecursion: true}, []string{".", "other", "sub", "top.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := archivedNames(t, src, tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A single file input is unaffected
+	names := archivedNames(t, filepath.Join(src, "top.txt"), models.ArchiveOptions{NoRecursion: true})
+	if !slices.Equal(names, []string{"top.txt"}) {
+		t.Errorf("single file entries = %q, want top.txt", names)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	src := writeTestTree(t, map[string]string{
+		"top.txt":       "top",
+		"a/one.txt":     "1",
+		"a/b/two.txt":   "2",
+		"a/b/c/three":   "3",
+		"a/b/c/d/four":  "4",
+		"e/f/g/h/i/j/k": "deep",
+	})
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{1, []string{".", "a", "e", "top.txt"}},
+		{2, []string{".", "a", "a/b", "a/one.txt", "e", "e/f", "top.txt"}},
+		{3, []string{".", "a", "a/b", "a/b/c", "a/b/two.txt", "a/one.txt", "e", "e/f", "e/f/g", "top.txt"}},
+	}
+	for _, tt := range tests {
+		opts := models.ArchiveOptions{MaxDepth: tt.depth}
+		if got := archivedNames(t, src, opts); !slices.Equal(got, tt.want) {
+			t.Errorf("tar.gz -max-depth=%d: entries = %q, want %q", tt.depth, got, tt.want)
+		}
+
+		// The zip walk applies the same limit
+		output := filepath.Join(t.TempDir(), "out.zip")
+		opts.Format = models.FormatZip
+		if err := NewOperator(&opts).Compress(src, output); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.OpenReader(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range zr.File {
+			got = append(got, strings.TrimSuffix(f.Name, "/"))
+		}
+		zr.Close()
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("zip -max-depth=%d: entries = %q, want %q", tt.depth, got, tt.want)
+		}
+	}
+
+	// No limit, and a limit beyond the tree, store everything
+	all := archivedNames(t, src, models.ArchiveOptions{})
+	if got := archivedNames(t, src, models.ArchiveOptions{MaxDepth: 100}); !slices.Equal(got, all) {
+		t.Errorf("-max-depth=100: entries = %q, want %q", got, all)
+	}
+}
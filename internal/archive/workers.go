@@ -0,0 +1,115 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// maxAutoWorkers caps the worker count when there is no sample to go by.
+// Extraction is mostly bound by the output disk, and beyond a handful of
+// concurrent writers more workers only add seeks and memory.
+const maxAutoWorkers = 8
+
+// sampleBytes is how much of the input a workload sample reads
+const sampleBytes = 1 << 20
+
+// AutoWorkers returns the number of CPUs this process may run on, which
+// GOMAXPROCS derives from the affinity mask and any cgroup CPU limit,
+// capped at maxAutoWorkers. It is the automatic worker count when the
+// workload cannot be sampled.
+func AutoWorkers() int {
+	return max(1, min(runtime.GOMAXPROCS(0), maxAutoWorkers))
+}
+
+// workloadSample is the time a sample of the work spent waiting for I/O
+// and computing
+type workloadSample struct {
+	io, cpu time.Duration
+}
+
+// autoWorkers returns the worker count for the work s was taken from. The
+// disk serves one worker at a time, so once (io+cpu)/io workers keep it
+// busy, further workers only wait for it; CPU-bound work uses every CPU
+// the process may run on.
+func autoWorkers(s workloadSample) int {
+	cpus := max(1, runtime.GOMAXPROCS(0))
+	switch {
+	case s.io <= 0 && s.cpu <= 0:
+		return AutoWorkers()
+	case s.io <= 0:
+		return cpus
+	}
+	n := (s.io + s.cpu + s.io - 1) / s.io
+	return max(1, min(int(n), cpus))
+}
+
+// sampleZip times extracting up to sampleBytes of the compressed content of
+// zr: reading it from the archive and writing it to a scratch file under
+// outputPath count as I/O, inflating it as CPU. The sample is empty when
+// the scratch file cannot be created.
+func sampleZip(zr *zipArchive, outputPath string) workloadSample {
+	scratch, err := os.CreateTemp(outputPath, ".gar-sample-*")
+	if err != nil {
+		return workloadSample{}
+	}
+	defer os.Remove(scratch.Name())
+	defer scratch.Close()
+
+	var s workloadSample
+	var read int64
+	for _, f := range zr.File {
+		if read >= sampleBytes {
+			break
+		}
+		if f.FileInfo().IsDir() || f.CompressedSize64 == 0 {
+			continue
+		}
+
+		start := time.Now()
+		raw, err := f.OpenRaw()
+		if err != nil {
+			continue
+		}
+		n, _ := io.Copy(io.Discard, io.LimitReader(raw, sampleBytes-read))
+		s.io += time.Since(start)
+		read += n
+
+		rc, err := openZipFile(f)
+		if err != nil {
+			continue
+		}
+		start = time.Now()
+		data, _ := io.ReadAll(io.LimitReader(rc, sampleBytes))
+		s.cpu += time.Since(start)
+		rc.Close()
+
+		start = time.Now()
+		scratch.Write(data)
+		s.io += time.Since(start)
+	}
+	return s
+}
+
+// sampleFile times reading up to sampleBytes of the file at path as I/O
+// and hashing it, which stands in for decompressing and checking it, as CPU
+func sampleFile(path string) workloadSample {
+	f, err := os.Open(path)
+	if err != nil {
+		return workloadSample{}
+	}
+	defer f.Close()
+
+	var s workloadSample
+	start := time.Now()
+	data, _ := io.ReadAll(io.LimitReader(f, sampleBytes))
+	s.io = time.Since(start)
+
+	start = time.Now()
+	sha256.Sum256(data)
+	s.cpu = time.Since(start)
+	return s
+}
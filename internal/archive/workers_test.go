@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+func TestAutoWorkers(t *testing.T) {
+	cpus := runtime.GOMAXPROCS(0)
+
+	tests := []struct {
+		name     string
+		sample   workloadSample
+		min, max int
+	}{
+		{"io-bound", workloadSample{io: 90 * time.Millisecond, cpu: 10 * time.Millisecond}, 1, 2},
+		{"only io", workloadSample{io: time.Millisecond}, 1, 1},
+		{"balanced", workloadSample{io: 10 * time.Millisecond, cpu: 10 * time.Millisecond}, min(2, cpus), 2},
+		{"cpu-bound", workloadSample{io: time.Millisecond, cpu: time.Second}, cpus, cpus},
+		{"no io", workloadSample{cpu: time.Millisecond}, cpus, cpus},
+		{"no sample", workloadSample{}, AutoWorkers(), AutoWorkers()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := autoWorkers(tt.sample)
+			if got < tt.min || got > tt.max {
+				t.Errorf("autoWorkers(%+v) = %d, want %d-%d", tt.sample, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestSampleZip(t *testing.T) {
+	files := make(map[string][]byte)
+	var order []string
+	for i := range 8 {
+		name := fmt.Sprintf("f%d.bin", i)
+		files[name] = bytes.Repeat([]byte(name), 64<<10)
+		order = append(order, name)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.zip")
+	if err := os.WriteFile(input, buildZip(t, zip.Deflate, files, order), 0644); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := openZip(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	output := filepath.Join(dir, "out")
+	if err := os.Mkdir(output, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s := sampleZip(zr, output)
+	if s.io <= 0 || s.cpu <= 0 {
+		t.Errorf("sample = %+v, want time spent on both", s)
+	}
+	if n := autoWorkers(s); n < 1 || n > runtime.GOMAXPROCS(0) {
+		t.Errorf("autoWorkers = %d, want 1-%d", n, runtime.GOMAXPROCS(0))
+	}
+	// The scratch file is removed again
+	if entries, _ := os.ReadDir(output); len(entries) != 0 {
+		t.Errorf("sampling left %d files behind", len(entries))
+	}
+	if s := sampleZip(zr, filepath.Join(dir, "missing")); s != (workloadSample{}) {
+		t.Errorf("sample without an output directory = %+v, want none", s)
+	}
+}
+
+func TestExtractAutoWorkersKeepsOptions(t *testing.T) {
+	files := make(map[string][]byte)
+	var order []string
+	for i := range 32 {
+		name := fmt.Sprintf("dir/f%d.txt", i)
+		files[name] = bytes.Repeat([]byte{byte('a' + i%26)}, 256<<10)
+		order = append(order, name)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.zip")
+	if err := os.WriteFile(input, buildZip(t, zip.Deflate, files, order), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &models.ArchiveOptions{Workers: models.WorkersAuto}
+	output := filepath.Join(dir, "out")
+	if err := NewOperator(opts).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Workers != models.WorkersAuto {
+		t.Errorf("Workers = %d after Extract, want the caller's value kept", opts.Workers)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs", name)
+		}
+	}
+}
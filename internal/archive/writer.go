@@ -0,0 +1,184 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// entryWriter adds entries to an archive of a specific format
+type entryWriter interface {
+	// WriteEntry adds e to the archive, copying regular file content from r.
+	// r is nil for directories and symlinks.
+	WriteEntry(e *archiveEntry, r io.Reader) error
+
+	// Close finalizes the archive without closing the underlying writer
+	Close() error
+}
+
+// newEntryWriter creates an entryWriter for the configured format
+func newEntryWriter(writer io.Writer, opts *models.ArchiveOptions) (entryWriter, error) {
+	switch opts.Format {
+	case models.FormatZip:
+		if opts.Index {
+			return nil, fmt.Errorf("-index applies to tar.gz only; zip already has a central directory")
+		}
+		return newZipEntryWriter(writer, opts)
+	case models.FormatTar:
+		if opts.Index {
+			return nil, fmt.Errorf("-index applies to tar.gz only")
+		}
+		return newTarEntryWriter(writer, opts), nil
+	case models.FormatTarGz:
+		return newTarGzEntryWriter(writer, opts)
+	case models.FormatTarBz2:
+		if opts.Index {
+			return nil, fmt.Errorf("-index applies to tar.gz only")
+		}
+		return newTarBz2EntryWriter(writer, opts)
+	case models.FormatTarZstd:
+		if opts.Index {
+			return nil, fmt.Errorf("-index applies to tar.gz only")
+		}
+		return newTarZstdEntryWriter(writer, opts)
+	case models.FormatTarXz:
+		if opts.Index {
+			return nil, fmt.Errorf("-index applies to tar.gz only")
+		}
+		return newTarXzEntryWriter(writer, opts)
+	case models.FormatSevenZip:
+		return nil, errSevenZipWrite
+	default:
+		return nil, fmt.Errorf("unsupported format")
+	}
+}
+
+// compressEntries walks inputPath and writes every selected entry to ew.
+// With a snapshot tracker only new or changed entries are written. With a
+// hard link table, further names of a file already written are stored as
+// links to it.
+func compressEntries(inputPath string, info os.FileInfo, ew entryWriter, opts *models.ArchiveOptions, snap *snapshotTracker, links hardLinks) error {
+	walk := walkInput
+	if opts.OrderFrom != "" {
+		walk = walkOrdered
+	}
+
+	return walk(inputPath, info, opts, func(path, name string, fi os.FileInfo) error {
+		// An interruption stops between entries, so every entry written
+		// is complete
+		if err := checkInterrupt(opts); err != nil {
+			return err
+		}
+		if snap != nil && !snap.visit(name, fi) {
+			countSkipped(opts)
+			return nil
+		}
+		// A resumed run leaves out what completed parts already hold
+		if jw, ok := ew.(*journalWriter); ok {
+			written, err := jw.written(name, fi)
+			if err != nil {
+				return err
+			}
+			if written {
+				countSkipped(opts)
+				return nil
+			}
+		}
+
+		entry := &archiveEntry{Name: name, Info: fi}
+
+		if opts.PreserveBirthTime {
+			if btime, ok := birthTime(path, fi); ok {
+				entry.setPAXRecord(paxCreationTime, formatPAXTime(btime))
+			}
+		}
+
+		if opts.ACLs && (fi.Mode().IsRegular() || fi.IsDir()) {
+			if err := storeACLs(path, entry); err != nil {
+				return err
+			}
+		}
+
+		if opts.PreserveFlags && (fi.Mode().IsRegular() || fi.IsDir()) {
+			if err := storeFileFlags(path, entry); err != nil {
+				return err
+			}
+		}
+
+		if entry.isSymlink() {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entry.Linkname = target
+		}
+
+		if first, ok := links.link(name, fi); ok {
+			if opts.Verbose {
+				fmt.Printf("  Adding: %s (link to %s)\n", name, first)
+			}
+			entry.Linkname = first
+			return ew.WriteEntry(entry, nil)
+		}
+
+		var src io.Reader
+		regular := fi.Mode().IsRegular()
+		if opts.Sparse && (regular || fi.Mode()&os.ModeDevice != 0 && fi.Mode()&os.ModeCharDevice == 0) {
+			sparse, err := openSparse(path, fi)
+			if err != nil {
+				return err
+			}
+			defer sparse.Close()
+
+			if hasHoles(sparse.frags, sparse.size) {
+				entry.Fragments = sparse.frags
+			}
+			if !regular {
+				// Block devices are stored as regular files of their contents
+				entry.Info = &memFileInfo{name: fi.Name(), size: sparse.size, mode: fi.Mode().Perm(), modTime: fi.ModTime()}
+				regular = true
+			}
+			src = sparse.r
+		}
+
+		if !regular {
+			return ew.WriteEntry(entry, nil)
+		}
+
+		if src == nil {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			src = file
+		}
+
+		if entry.Fragments == nil && convertsText(opts, name) {
+			converted, size, err := convertToTemp(src, opts)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(converted.Name())
+			defer converted.Close()
+			entry.Info = resizedFileInfo{FileInfo: entry.Info, size: size}
+			src = converted
+		}
+
+		if opts.Verbose {
+			fmt.Printf("  Adding: %s\n", name)
+		}
+
+		r, done := trackEntry(src, name, entry.Info.Size(), opts)
+		if err := ew.WriteEntry(entry, r); err != nil {
+			countFailed(opts)
+			return err
+		}
+		done()
+		countFile(opts, entry.Info.Size())
+		return nil
+	})
+}
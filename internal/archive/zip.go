@@ -3,131 +3,234 @@ package archive
 
 import (
 	"archive/zip"
-	"compress/gzip"
+	"compress/flate"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
+	"time"
 
+	"github.com/cubetiqlabs/gar/internal/crypto"
 	"github.com/cubetiqlabs/gar/internal/models"
 )
 
-func compressZip(inputPath string, info os.FileInfo, writer io.Writer, opts *models.ArchiveOptions) error {
+// zipEntryWriter writes archive entries to a zip stream
+type zipEntryWriter struct {
+	zw     *zip.Writer
+	method uint16
+	// flags holds the deflate level hint of the general purpose flags
+	flags uint16
+	// modTime, when set, replaces every entry's modification time
+	modTime time.Time
+	// lowMemory trims what the writer keeps per entry until Close
+	lowMemory bool
+}
+
+func newZipEntryWriter(writer io.Writer, opts *models.ArchiveOptions) (*zipEntryWriter, error) {
 	zipWriter := zip.NewWriter(writer)
-	defer zipWriter.Close()
 
-	// Set compression level
-	switch opts.CompressionLevel {
-	case models.LevelFastest:
-		zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
-			return gzip.NewWriterLevel(out, gzip.BestSpeed)
-		})
-	case models.LevelBest:
-		zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
-			return gzip.NewWriterLevel(out, gzip.BestCompression)
-		})
+	method := zip.Deflate
+	level := flateLevel(opts, models.CodecFlate)
+	if level == flate.NoCompression {
+		method = zip.Store
 	}
 
-	if info.IsDir() {
-		return filepath.Walk(inputPath, func(path string, fi os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			header, err := zip.FileInfoHeader(fi)
-			if err != nil {
-				return err
-			}
-
-			relPath, err := filepath.Rel(inputPath, path)
-			if err != nil {
-				return err
-			}
-			header.Name = filepath.ToSlash(relPath)
+	// Check the level up front rather than on the first entry
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, err
+	}
+	// A deflate writer allocates about a megabyte, so one is reused
+	// across entries instead of created for each
+	flaters := &sync.Pool{New: func() any {
+		fw, _ := flate.NewWriter(nil, level) // the level was checked above
+		return fw
+	}}
+	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		fw := flaters.Get().(*flate.Writer)
+		fw.Reset(out)
+		return &pooledFlateWriter{Writer: fw, pool: flaters}, nil
+	})
+
+	return &zipEntryWriter{zw: zipWriter, method: method, flags: deflateFlags(level), modTime: opts.ModTime, lowMemory: opts.LowMemory}, nil
+}
 
-			if fi.IsDir() {
-				header.Name += "/"
-			} else {
-				header.Method = zip.Deflate
-			}
+// pooledFlateWriter returns its deflate writer to the pool once the entry
+// is finished
+type pooledFlateWriter struct {
+	*flate.Writer
+	pool *sync.Pool
+}
 
-			w, err := zipWriter.CreateHeader(header)
-			if err != nil {
-				return err
-			}
+func (w *pooledFlateWriter) Close() error {
+	if w.Writer == nil {
+		return os.ErrClosed
+	}
+	err := w.Writer.Close()
+	w.pool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
 
-			if !fi.IsDir() {
-				file, err := os.Open(path)
-				if err != nil {
-					return err
-				}
-				defer file.Close()
+// deflateFlags returns the general purpose flag bits 1 and 2 that record
+// the deflate level, as Info-ZIP sets them: maximum for 8 and 9, fast for 1
+// and 2, and none (normal) otherwise
+func deflateFlags(level int) uint16 {
+	switch {
+	case level >= 8:
+		return 0x2
+	case level == 1 || level == 2:
+		return 0x4
+	}
+	return 0
+}
 
-				if opts.Verbose {
-					fmt.Printf("  Adding: %s\n", relPath)
-				}
+// WriteEntry adds e to the zip. Symlinks store their target as content.
+func (w *zipEntryWriter) WriteEntry(e *archiveEntry, r io.Reader) error {
+	// FileInfoHeader marks the entry as made on Unix and stores the mode as
+	// S_IF* type and permission bits in ExternalAttrs, which is what unzip
+	// and other Unix tools read. os.FileMode bits differ from those, so they
+	// must not be stored directly.
+	header, err := zip.FileInfoHeader(e.Info)
+	if err != nil {
+		return err
+	}
+	header.Name = e.Name
+	if !w.modTime.IsZero() {
+		header.Modified = w.modTime
+	}
 
-				_, err = io.Copy(w, file)
-				return err
-			}
+	// zip.Writer keeps every header until Close to write the central
+	// directory, so headers cannot be reused between entries. In low
+	// memory mode store only the MS-DOS time, which saves the extended
+	// timestamp field zip.Writer would otherwise allocate and retain.
+	if w.lowMemory {
+		header.SetModTime(header.Modified)
+		header.Modified = time.Time{}
+	}
 
-			return nil
-		})
+	switch {
+	case e.Info.IsDir():
+		header.Name += "/"
+	case e.isSymlink():
+		return w.writeRaw(header, []byte(e.Linkname))
+	default:
+		header.Method = w.method
+		if w.method == zip.Deflate {
+			header.Flags |= w.flags
+		}
+		if e.Encrypted {
+			header.Extra = append(header.Extra, zipExtraField(zipExtraEncrypted)...)
+		}
 	}
 
-	// Single file
-	file, err := os.Open(inputPath)
+	body, err := w.zw.CreateHeader(header)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	header, err := zip.FileInfoHeader(info)
-	if err != nil {
-		return err
+	if r == nil {
+		return nil
 	}
-	header.Name = filepath.Base(inputPath)
-	header.Method = zip.Deflate
+	_, err = copyPooled(body, r)
+	return err
+}
+
+// writeRaw stores small known content without a data descriptor so that
+// sequential readers can skip over it
+func (w *zipEntryWriter) writeRaw(header *zip.FileHeader, content []byte) error {
+	header.Method = zip.Store
+	// CreateRaw stores the legacy MS-DOS time fields as they are
+	if !header.Modified.IsZero() {
+		header.SetModTime(header.Modified)
+	}
+	header.CRC32 = crc32.ChecksumIEEE(content)
+	header.CompressedSize64 = uint64(len(content))
+	header.UncompressedSize64 = uint64(len(content))
 
-	w, err := zipWriter.CreateHeader(header)
+	body, err := w.zw.CreateRaw(header)
 	if err != nil {
 		return err
 	}
-
-	_, err = io.Copy(w, file)
+	_, err = body.Write(content)
 	return err
 }
 
+// Close finalizes the central directory
+func (w *zipEntryWriter) Close() error {
+	return w.zw.Close()
+}
+
 func extractZip(inputPath, outputPath string, opts *models.ArchiveOptions) error {
-	zipReader, err := zip.OpenReader(inputPath)
+	zipReader, err := openZip(inputPath)
 	if err != nil {
 		return err
 	}
 	defer zipReader.Close()
 
-	// Use worker pool for parallel extraction
+	if err := checkZipRatio(zipReader, opts.MaxRatio); err != nil {
+		return err
+	}
+
+	c, err := newEntryCipher(opts)
+	if err != nil {
+		return err
+	}
+
+	// Sampling only pays off for archives the workers would extract
+	workers := opts.Workers
+	if workers <= models.WorkersAuto && !extractsSerially(zipReader, opts, maxAutoWorkers) {
+		workers = autoWorkers(sampleZip(zipReader, outputPath))
+	}
+
+	var dirs pendingDirs
+	if extractsSerially(zipReader, opts, workers) {
+		err = extractZipSerial(zipReader, c, &dirs, outputPath, opts)
+	} else {
+		err = extractZipParallel(zipReader, c, &dirs, outputPath, workers, opts)
+	}
+	if derr := dirs.apply(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// extractZipParallel extracts the entries of zr on the worker pool, at
+// most workers at a time
+func extractZipParallel(zr *zipArchive, c *crypto.EntryCipher, dirs *pendingDirs, outputPath string, workers int, opts *models.ArchiveOptions) error {
+	pool, release := workerPool(opts, workers)
+	defer release()
+
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, opts.Workers)
+	sem := make(chan struct{}, workers)
 	errChan := make(chan error, 1)
 
-	for _, file := range zipReader.File {
+	for _, file := range zr.File {
+		if isMetadataEntry(file.Name) {
+			continue
+		}
+		name, ok := applyEntryFilter(opts, zipEntry(file))
+		if !ok {
+			continue
+		}
+
 		wg.Add(1)
 		sem <- struct{}{}
 
-		go func(f *zip.File) {
+		pool.Submit(func() {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			if err := extractZipFile(f, outputPath, opts); err != nil {
+			if err := extractZipFile(file, c, dirs, name, outputPath, opts); err != nil {
+				countFailed(opts)
 				select {
 				case errChan <- err:
 				default:
 				}
-				fmt.Fprintf(os.Stderr, "Error extracting %s: %v\n", f.Name, err)
+				fmt.Fprintf(os.Stderr, "Error extracting %s: %v\n", file.Name, err)
 			}
-		}(file)
+		})
 	}
 
 	wg.Wait()
@@ -141,55 +244,174 @@ func extractZip(inputPath, outputPath string, opts *models.ArchiveOptions) error
 	}
 }
 
-func extractZipFile(f *zip.File, outputPath string, opts *models.ArchiveOptions) error {
-	destPath := filepath.Join(outputPath, f.Name)
+// Zips with at most serialMaxEntries entries and serialMaxBytes of content
+// are extracted without the worker pool, whose setup costs more than the
+// work and makes the output order vary between runs
+const (
+	serialMaxEntries = 16
+	serialMaxBytes   = 4 << 20
+)
 
-	// Security check: prevent path traversal
-	// Convert both paths to absolute to handle relative paths like "." correctly
-	absDestPath, err := filepath.Abs(destPath)
-	if err != nil {
-		return fmt.Errorf("invalid destination path: %s", f.Name)
+// extractsSerially reports whether zr should be extracted entry by entry in
+// archive order. Archives that repeat a name always are: workers would race
+// to write it, while in order the last entry wins.
+func extractsSerially(zr *zipArchive, opts *models.ArchiveOptions, workers int) bool {
+	if opts.Serial || opts.PreserveOrder || workers <= 1 {
+		return true
 	}
-	absOutputPath, err := filepath.Abs(outputPath)
-	if err != nil {
-		return fmt.Errorf("invalid output path: %s", outputPath)
+
+	var total uint64
+	seen := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		if seen[f.Name] {
+			return true
+		}
+		seen[f.Name] = true
+		total += f.UncompressedSize64
+	}
+	return len(zr.File) <= serialMaxEntries && total <= serialMaxBytes
+}
+
+// extractZipSerial extracts the entries of zr in archive order. As with the
+// worker pool, a failed entry is reported and the rest are still extracted.
+func extractZipSerial(zr *zipArchive, c *crypto.EntryCipher, dirs *pendingDirs, outputPath string, opts *models.ArchiveOptions) error {
+	var firstErr error
+	for _, file := range zr.File {
+		if isMetadataEntry(file.Name) {
+			continue
+		}
+		name, ok := applyEntryFilter(opts, zipEntry(file))
+		if !ok {
+			continue
+		}
+
+		if err := extractZipFile(file, c, dirs, name, outputPath, opts); err != nil {
+			countFailed(opts)
+			if firstErr == nil {
+				firstErr = err
+			}
+			fmt.Fprintf(os.Stderr, "Error extracting %s: %v\n", file.Name, err)
+		}
+	}
+	return firstErr
+}
+
+// checkZipRatio rejects archives whose declared uncompressed size is more
+// than maxRatio times the size of the archive itself. Overlapping-entry zip
+// bombs reuse the same compressed bytes for many members, which shows up as
+// an implausible ratio before anything is written to disk.
+func checkZipRatio(zr *zipArchive, maxRatio int) error {
+	if maxRatio <= 0 {
+		return nil
+	}
+
+	var total uint64
+	overflow := false
+	for _, f := range zr.File {
+		if total+f.UncompressedSize64 < total {
+			overflow = true
+			break
+		}
+		total += f.UncompressedSize64
+	}
+
+	archiveSize := uint64(max(zr.size, 1))
+	if overflow || total/archiveSize > uint64(maxRatio) {
+		return fmt.Errorf("archive expands to %d bytes from %d (ratio above %d); refusing to extract (see -max-ratio)",
+			total, zr.size, maxRatio)
+	}
+	return nil
+}
+
+// zipEntry describes a zip member for EntryFilter callbacks
+func zipEntry(f *zip.File) models.Entry {
+	return models.Entry{
+		Name:    f.Name,
+		Size:    int64(f.UncompressedSize64),
+		Mode:    f.Mode(),
+		ModTime: f.Modified,
+		IsDir:   f.FileInfo().IsDir(),
 	}
-	if !strings.HasPrefix(absDestPath, absOutputPath+string(filepath.Separator)) && absDestPath != absOutputPath {
-		return fmt.Errorf("illegal file path: %s", f.Name)
+}
+
+// zipFileMode returns the permissions to extract f with. Some writers leave
+// the external attributes empty, which would otherwise yield files and
+// directories nobody can read.
+func zipFileMode(f *zip.File) os.FileMode {
+	mode := f.Mode()
+	if mode.Perm() != 0 {
+		return mode
 	}
+	if mode.IsDir() {
+		return mode | 0755
+	}
+	return mode | 0644
+}
 
+// extractZipFile extracts f as name. A directory is only created; its mode
+// and time are queued on dirs.
+func extractZipFile(f *zip.File, c *crypto.EntryCipher, dirs *pendingDirs, name, outputPath string, opts *models.ArchiveOptions) error {
+	destPath, err := safeDestPath(outputPath, name)
+	if err != nil {
+		return err
+	}
+
+	mode := zipFileMode(f)
 	if f.FileInfo().IsDir() {
-		return os.MkdirAll(destPath, f.Mode())
+		if err := os.MkdirAll(destPath, umasked(0755, opts)); err != nil {
+			return err
+		}
+		dirs.add(destPath, umasked(mode, opts), f.Modified)
+		return nil
 	}
 
 	if opts.Verbose {
-		fmt.Printf("  Extracting: %s\n", f.Name)
+		fmt.Printf("  Extracting: %s\n", name)
 	}
 
 	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(destPath), umasked(0755, opts)); err != nil {
 		return err
 	}
 
 	// Extract file
-	rc, err := f.Open()
+	rc, err := openZipFile(f)
 	if err != nil {
 		return err
 	}
-	defer rc.Close()
 
-	outFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	var src io.Reader = rc
+	size := int64(f.UncompressedSize64)
+	if zipExtraHas(f.Extra, zipExtraEncrypted) {
+		if src, err = openEntry(c, f.Name, rc); err != nil {
+			rc.Close()
+			return err
+		}
+		size = crypto.OpenedSize(size)
+	}
+
+	outFile, err := createDestFile(destPath, mode, opts)
 	if err != nil {
+		rc.Close()
 		return err
 	}
 	defer outFile.Close()
 
-	_, err = io.Copy(outFile, rc)
-	return err
+	if _, err := copyEntry(outFile, src, name, size, opts); err != nil {
+		rc.Close()
+		return err
+	}
+
+	// Closing the entry reader reports checksum and decompressor errors
+	// that would otherwise be lost
+	if err := rc.Close(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
 }
 
 func listZip(inputPath string) error {
-	zipReader, err := zip.OpenReader(inputPath)
+	zipReader, err := openZip(inputPath)
 	if err != nil {
 		return err
 	}
@@ -197,8 +419,27 @@ func listZip(inputPath string) error {
 
 	fmt.Println("Archive contents:")
 	for _, f := range zipReader.File {
-		fmt.Printf("  %s (%d bytes)\n", f.Name, f.UncompressedSize64)
+		if isMetadataEntry(f.Name) {
+			continue
+		}
+		fmt.Printf("  %s (%d bytes)%s\n", f.Name, f.UncompressedSize64, encryptedSuffix(zipExtraHas(f.Extra, zipExtraEncrypted)))
 	}
 
 	return nil
 }
+
+func countZip(inputPath string) (int, error) {
+	zipReader, err := openZip(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer zipReader.Close()
+
+	count := 0
+	for _, f := range zipReader.File {
+		if !isMetadataEntry(f.Name) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,465 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// BenchmarkZipEntryWriter measures the allocations per small entry, which
+// dominate zips of trees with very many files
+func BenchmarkZipEntryWriter(b *testing.B) {
+	content := bytes.Repeat([]byte("small file content\n"), 20)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, bc := range []struct {
+		name string
+		opts models.ArchiveOptions
+	}{
+		{"deflate", models.ArchiveOptions{CompressionLevel: models.LevelNormal}},
+		{"deflate-low-memory", models.ArchiveOptions{CompressionLevel: models.LevelNormal, LowMemory: true}},
+		{"store", models.ArchiveOptions{CompressionLevel: models.LevelStore}},
+		{"store-low-memory", models.ArchiveOptions{CompressionLevel: models.LevelStore, LowMemory: true}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			w, err := newZipEntryWriter(io.Discard, &bc.opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				info := &memFileInfo{name: "f", size: int64(len(content)), mode: 0644, modTime: modTime}
+				e := &archiveEntry{Name: fmt.Sprintf("dir/file%08d.txt", i), Info: info}
+				if err := w.WriteEntry(e, bytes.NewReader(content)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestZipEntryWriterLowMemory(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)
+	for _, lowMemory := range []bool{false, true} {
+		var buf bytes.Buffer
+		w, err := newZipEntryWriter(&buf, &models.ArchiveOptions{LowMemory: lowMemory})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 100 {
+			content := bytes.Repeat([]byte{byte(i)}, i*10)
+			info := &memFileInfo{name: "f", size: int64(len(content)), mode: 0644, modTime: modTime}
+			if err := w.WriteEntry(&archiveEntry{Name: fmt.Sprintf("f%d", i), Info: info}, bytes.NewReader(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, bytes.Repeat([]byte{byte(i)}, i*10)) {
+				t.Errorf("low memory %v: %s content differs", lowMemory, f.Name)
+			}
+			if !f.Modified.Equal(modTime) {
+				t.Errorf("low memory %v: %s modified %v, want %v", lowMemory, f.Name, f.Modified, modTime)
+			}
+		}
+	}
+}
+
+// zeroModeZip writes a zip made on Unix whose entries carry no mode bits,
+// as some writers produce
+func zeroModeZip(t *testing.T, names []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		fh := &zip.FileHeader{Name: name, Method: zip.Deflate, CreatorVersion: 3 << 8}
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			if _, err := w.Write([]byte(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZipFileMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs uint32
+		want  os.FileMode
+	}{
+		{"file", 0, 0644},
+		{"dir/", 0, os.ModeDir | 0755},
+		{"file", 0600 << 16, 0600},
+		{"dir/", (040000 | 0700) << 16, os.ModeDir | 0700},
+		{"script", 0755 << 16, 0755},
+	}
+	for _, tt := range tests {
+		f := &zip.File{FileHeader: zip.FileHeader{Name: tt.name, CreatorVersion: 3 << 8, ExternalAttrs: tt.attrs}}
+		if got := zipFileMode(f); got != tt.want {
+			t.Errorf("zipFileMode(%s, %#o) = %v, want %v", tt.name, tt.attrs>>16, got, tt.want)
+		}
+	}
+}
+
+func TestZipUnixAttrs(t *testing.T) {
+	src := writeTestTree(t, map[string]string{"run.sh": "#!/bin/sh\n", "data.txt": "data", "bin/tool": "tool"})
+	modes := map[string]os.FileMode{"run.sh": 0755, "data.txt": 0640, "bin": 0750, "bin/tool": 0700}
+	for name, mode := range modes {
+		if err := os.Chmod(filepath.Join(src, filepath.FromSlash(name)), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("data.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "out.zip")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatZip}).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	// What unzip reads: the host byte of the creator version, then the
+	// S_IF* type and permission bits in the high half of ExternalAttrs
+	const (
+		sIFDIR = 0040000
+		sIFREG = 0100000
+		sIFLNK = 0120000
+	)
+	want := map[string]uint32{
+		"run.sh":   sIFREG | 0755,
+		"data.txt": sIFREG | 0640,
+		"bin/":     sIFDIR | 0750,
+		"bin/tool": sIFREG | 0700,
+		"link":     sIFLNK | 0777,
+	}
+	seen := 0
+	for _, f := range zr.File {
+		mode, ok := want[f.Name]
+		if !ok {
+			continue
+		}
+		seen++
+		if host := f.CreatorVersion >> 8; host != 3 {
+			t.Errorf("%s: creator host %d, want 3 (Unix)", f.Name, host)
+		}
+		if got := f.ExternalAttrs >> 16; got != mode {
+			t.Errorf("%s: external attributes %06o, want %06o", f.Name, got, mode)
+		}
+	}
+	if seen != len(want) {
+		t.Errorf("found %d of %d entries", seen, len(want))
+	}
+}
+
+func TestUnzipCommandModes(t *testing.T) {
+	path, err := exec.LookPath("unzip")
+	if err != nil {
+		t.Skip("unzip not installed")
+	}
+	src := writeTestTree(t, map[string]string{"run.sh": "#!/bin/sh\n", "data.txt": "data"})
+	for name, mode := range map[string]os.FileMode{"run.sh": 0755, "data.txt": 0600} {
+		if err := os.Chmod(filepath.Join(src, name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.zip")
+	if err := NewOperator(&models.ArchiveOptions{Format: models.FormatZip}).Compress(src, output); err != nil {
+		t.Fatal(err)
+	}
+
+	extracted := filepath.Join(dir, "x")
+	if out, err := exec.Command(path, "-q", output, "-d", extracted).CombinedOutput(); err != nil {
+		t.Fatalf("unzip: %v\n%s", err, out)
+	}
+	for name, want := range map[string]os.FileMode{"run.sh": 0755, "data.txt": 0600} {
+		fi, err := os.Stat(filepath.Join(extracted, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("unzip restored %s as %v, want %v", name, fi.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestExtractZeroModeZip(t *testing.T) {
+	dir := t.TempDir()
+	input := writeFile(t, dir, "zero.zip", zeroModeZip(t, []string{"dir/", "dir/a.txt", "b.txt"}))
+
+	// The fixture really has no mode bits
+	zr, err := zip.OpenReader(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Mode().Perm() != 0 {
+			t.Fatalf("%s has mode %v, want none", f.Name, f.Mode())
+		}
+	}
+	zr.Close()
+
+	output := filepath.Join(dir, "out")
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{"dir": 0700, "dir/a.txt": 0600, "b.txt": 0600} {
+		fi, err := os.Stat(filepath.Join(output, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm()&want != want {
+			t.Errorf("%s extracted with mode %v, want at least %v", name, fi.Mode().Perm(), want)
+		}
+	}
+	if got := readTree(t, output); got["dir/a.txt"] != "dir/a.txt" || got["b.txt"] != "b.txt" {
+		t.Errorf("extracted %v", got)
+	}
+}
+
+func TestExtractZipChecksumMismatch(t *testing.T) {
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		content := []byte(strings.Repeat("checked content ", 64))
+		data := buildZip(t, method, map[string][]byte{"ok.txt": []byte("fine"), "bad.txt": content}, []string{"ok.txt", "bad.txt"})
+
+		// Flip the CRC in the central directory header of bad.txt, the
+		// last one, so the data itself still decodes
+		at := bytes.LastIndex(data, []byte("PK\x01\x02"))
+		data[at+16] ^= 0xff
+
+		input := writeFile(t, t.TempDir(), "bad.zip", data)
+		err := NewOperator(&models.ArchiveOptions{}).Extract(input, t.TempDir())
+		if !errors.Is(err, zip.ErrChecksum) {
+			t.Errorf("method %d: error = %v, want %v", method, err, zip.ErrChecksum)
+		}
+	}
+}
+
+func TestMaxRatio(t *testing.T) {
+	zeros := map[string][]byte{"zeros.bin": make([]byte, 4<<20)}
+	text := map[string][]byte{"a.txt": gzipTestData(64 << 10)}
+
+	tests := []struct {
+		name     string
+		files    map[string][]byte
+		maxRatio int
+		wantErr  bool
+	}{
+		{"bomb", zeros, 100, true},
+		{"bomb without a limit", zeros, 0, false},
+		{"bomb under a higher limit", zeros, 10000, false},
+		{"normal", text, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order []string
+			for name := range tt.files {
+				order = append(order, name)
+			}
+			input := writeFile(t, t.TempDir(), "in.zip", buildZip(t, zip.Deflate, tt.files, order))
+			output := t.TempDir()
+
+			err := NewOperator(&models.ArchiveOptions{MaxRatio: tt.maxRatio}).Extract(input, output)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "-max-ratio") {
+					t.Fatalf("error = %v, want a -max-ratio error", err)
+				}
+				if entries, _ := os.ReadDir(output); len(entries) != 0 {
+					t.Errorf("%d entries written before the ratio check", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCheckZipRatioOverflow(t *testing.T) {
+	huge := func(name string) *zip.File {
+		return &zip.File{FileHeader: zip.FileHeader{Name: name, UncompressedSize64: math.MaxUint64 / 2}}
+	}
+	zr := &zipArchive{Reader: &zip.Reader{File: []*zip.File{huge("a"), huge("b"), huge("c")}}, size: 1 << 30}
+	if err := checkZipRatio(zr, math.MaxInt); err == nil {
+		t.Error("checkZipRatio accepted declared sizes that overflow")
+	}
+}
+
+func TestZipHuffmanOnly(t *testing.T) {
+	// Repetitive text: matches make normal deflate far smaller, while
+	// Huffman-only coding only saves on the skewed byte frequencies
+	content := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 1<<13)
+
+	sizes := make(map[models.CompressionLevel]uint64)
+	for _, level := range []models.CompressionLevel{models.LevelNormal, models.LevelHuffman, models.LevelStore} {
+		output := compressTree(t, map[string]string{"a.txt": content}, models.ArchiveOptions{CompressionLevel: level})
+		zr, err := zip.OpenReader(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.Name != "a.txt" {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("level %d: %v", level, err)
+			}
+			if string(got) != content {
+				t.Errorf("level %d: content differs", level)
+			}
+			sizes[level] = f.CompressedSize64
+		}
+	}
+
+	normal, huffman, store := sizes[models.LevelNormal], sizes[models.LevelHuffman], sizes[models.LevelStore]
+	if store < uint64(len(content)) {
+		t.Errorf("store: %d bytes from %d, want no compression", store, len(content))
+	}
+	if huffman >= uint64(len(content)) || huffman <= normal {
+		t.Errorf("huffman: %d bytes, want between normal (%d) and the input (%d)", huffman, normal, len(content))
+	}
+}
+
+func TestFlateLevel(t *testing.T) {
+	tests := []struct {
+		level models.CompressionLevel
+		want  int
+	}{
+		{models.LevelNormal, flate.DefaultCompression},
+		{models.LevelFastest, flate.BestSpeed},
+		{models.LevelBest, flate.BestCompression},
+		{models.LevelStore, flate.NoCompression},
+		{models.LevelHuffman, flate.HuffmanOnly},
+	}
+	for _, tt := range tests {
+		opts := &models.ArchiveOptions{CompressionLevel: tt.level}
+		for _, codec := range []models.Codec{models.CodecFlate, models.CodecGzip} {
+			if got := flateLevel(opts, codec); got != tt.want {
+				t.Errorf("flateLevel(%d, %s) = %d, want %d", tt.level, codec, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestExtractsSerially(t *testing.T) {
+	files := func(n int, size uint64, names ...string) *zipArchive {
+		zr := &zipArchive{Reader: &zip.Reader{}}
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("f%d", i)
+			if i < len(names) {
+				name = names[i]
+			}
+			zr.File = append(zr.File, &zip.File{FileHeader: zip.FileHeader{Name: name, UncompressedSize64: size}})
+		}
+		return zr
+	}
+	tests := []struct {
+		name    string
+		zr      *zipArchive
+		opts    models.ArchiveOptions
+		workers int
+		want    bool
+	}{
+		{name: "small", zr: files(3, 10), workers: 8, want: true},
+		{name: "at entry limit", zr: files(serialMaxEntries, 10), workers: 8, want: true},
+		{name: "many entries", zr: files(serialMaxEntries+1, 10), workers: 8, want: false},
+		{name: "large content", zr: files(2, serialMaxBytes), workers: 8, want: false},
+		{name: "one worker", zr: files(serialMaxEntries+1, 10), workers: 1, want: true},
+		{name: "serial", zr: files(serialMaxEntries+1, 10), opts: models.ArchiveOptions{Serial: true}, workers: 8, want: true},
+		{name: "preserve order", zr: files(serialMaxEntries+1, 10), opts: models.ArchiveOptions{PreserveOrder: true}, workers: 8, want: true},
+		{name: "repeated name", zr: files(serialMaxEntries+1, 10, "a", "a"), workers: 8, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractsSerially(tt.zr, &tt.opts, tt.workers); got != tt.want {
+				t.Errorf("extractsSerially = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractSmallZipInOrder(t *testing.T) {
+	var order []string
+	files := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		// Names that do not sort in archive order
+		name := fmt.Sprintf("%c.txt", 'j'-i)
+		order = append(order, name)
+		files[name] = name
+	}
+	dir := t.TempDir()
+	input := writeZipFile(t, dir, files, order)
+	want := strings.Join(order, "\n")
+
+	// Every run reports the entries in archive order despite eight workers
+	for run := 0; run < 5; run++ {
+		output := filepath.Join(dir, fmt.Sprintf("out%d", run))
+		out := captureStdout(t, func() error {
+			return NewOperator(&models.ArchiveOptions{Workers: 8, Verbose: true}).Extract(input, output)
+		})
+
+		var got []string
+		for _, line := range strings.Split(out, "\n") {
+			if name, ok := strings.CutPrefix(strings.TrimSpace(line), "Extracting: "); ok {
+				got = append(got, name)
+			}
+		}
+		if strings.Join(got, "\n") != want {
+			t.Fatalf("run %d extracted\n%s\nwant\n%s", run, strings.Join(got, "\n"), want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zip compression methods beyond Store and Deflate
+const (
+	zipMethodBzip2      = 12
+	zipMethodLZMA       = 14
+	zipMethodZstdPKWare = zstd.ZipMethodPKWare
+	zipMethodZstd       = zstd.ZipMethodWinZip
+	zipMethodXZ         = 95
+	zipMethodPPMd       = 98
+)
+
+// zipDecompressors reads the methods archive/zip has no decompressor for
+var zipDecompressors = map[uint16]func(io.Reader) io.ReadCloser{
+	zipMethodBzip2: func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(bzip2.NewReader(r))
+	},
+	zipMethodZstdPKWare: zstd.ZipDecompressor(),
+	zipMethodZstd:       zstd.ZipDecompressor(),
+}
+
+// newZipReader opens the zip archive in r with zipDecompressors registered
+// on the reader alone, leaving archive/zip's global registry to programs
+// that import gar as a library
+func newZipReader(r io.ReaderAt, size int64) (*zip.Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	for method, dcomp := range zipDecompressors {
+		zr.RegisterDecompressor(method, dcomp)
+	}
+	return zr, nil
+}
+
+// zipMethodName names a zip compression method for error messages
+func zipMethodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	case zipMethodBzip2:
+		return "bzip2"
+	case zipMethodLZMA:
+		return "LZMA"
+	case zipMethodZstdPKWare, zipMethodZstd:
+		return "zstd"
+	case zipMethodXZ:
+		return "xz"
+	case zipMethodPPMd:
+		return "PPMd"
+	default:
+		return "unknown"
+	}
+}
+
+// errZipMethod reports an entry compressed with a method gar cannot read
+func errZipMethod(name string, method uint16) error {
+	return fmt.Errorf("%s: unsupported compression method %d (%s)", name, method, zipMethodName(method))
+}
+
+// openZipFile opens the content of f, naming the compression method when
+// it cannot be read
+func openZipFile(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if errors.Is(err, zip.ErrAlgorithm) {
+		return nil, errZipMethod(f.Name, f.Method)
+	}
+	return rc, err
+}
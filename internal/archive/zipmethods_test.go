@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/klauspost/compress/zstd"
+)
+
+// buildZstdZip writes files into a zip with the WinZip zstd method
+func buildZstdZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.RegisterCompressor(zipMethodZstd, zstd.ZipCompressor())
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zipMethodZstd})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZipDecompressorsPerReader(t *testing.T) {
+	files := map[string][]byte{"a.txt": bytes.Repeat([]byte("zstd in zip "), 1000)}
+	data := buildZstdZip(t, files)
+
+	zr, err := newZipReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := openZipFile(zr.File[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	// archive/zip's own registry is left alone
+	plain, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.File[0].Open(); !errors.Is(err, zip.ErrAlgorithm) {
+		t.Errorf("plain zip.Reader opened a zstd entry (err %v); the decompressor leaked into the global registry", err)
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.zip")
+	if err := os.WriteFile(input, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out")
+	if err := NewOperator(&models.ArchiveOptions{}).Extract(input, output); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(output, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, files["a.txt"]) {
+		t.Error("extracted a.txt differs")
+	}
+}
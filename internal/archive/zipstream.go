@@ -0,0 +1,453 @@
+// Package archive provides compression and extraction functionality
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/crypto"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Zip record signatures used when reading local headers sequentially
+const (
+	zipLocalHeaderSig   = 0x04034b50
+	zipCentralHeaderSig = 0x02014b50
+	zipDataDescSig      = 0x08074b50
+	zipEndSig           = 0x06054b50
+	zip64EndSig         = 0x06064b50
+
+	zipFlagDataDescriptor = 0x8
+	zip64ExtraID          = 0x0001
+)
+
+// errZipStreamEnd signals that the central directory has been reached
+var errZipStreamEnd = errors.New("end of zip stream")
+
+// zipStreamEntry is a zip member decoded from its local file header
+type zipStreamEntry struct {
+	Name     string
+	Method   uint16
+	Flags    uint16
+	CRC32    uint32
+	Size     uint64
+	Modified time.Time
+	zip64    bool
+	// encrypted marks content sealed with -encrypt-pattern
+	encrypted bool
+}
+
+// zipStreamReader reads a zip archive front to back from a plain io.Reader
+// using only the local file headers. The central directory is never
+// consulted, so modes are not available and entries cannot be validated
+// against it.
+type zipStreamReader struct {
+	r       *bufio.Reader
+	current *zipStreamBody
+}
+
+func newZipStreamReader(r io.Reader) *zipStreamReader {
+	return &zipStreamReader{r: bufio.NewReaderSize(r, int(bufferSize.Load()))}
+}
+
+// Next advances to the next entry, draining any unread content of the
+// previous one. It returns errZipStreamEnd when no more entries follow.
+func (z *zipStreamReader) Next() (*zipStreamEntry, io.Reader, error) {
+	if z.current != nil {
+		if _, err := io.Copy(io.Discard, z.current); err != nil {
+			return nil, nil, err
+		}
+		z.current = nil
+	}
+
+	for {
+		var sig uint32
+		if err := binary.Read(z.r, binary.LittleEndian, &sig); err != nil {
+			if err == io.EOF {
+				return nil, nil, errZipStreamEnd
+			}
+			return nil, nil, err
+		}
+
+		switch sig {
+		case zipLocalHeaderSig:
+			return z.readLocalHeader()
+		case zipDataDescSig:
+			// Spanned archives start with a bare data descriptor signature
+			continue
+		case zipCentralHeaderSig, zipEndSig, zip64EndSig:
+			return nil, nil, errZipStreamEnd
+		default:
+			return nil, nil, fmt.Errorf("zip: invalid record signature 0x%08x", sig)
+		}
+	}
+}
+
+func (z *zipStreamReader) readLocalHeader() (*zipStreamEntry, io.Reader, error) {
+	var buf [26]byte
+	if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+		return nil, nil, err
+	}
+
+	le := binary.LittleEndian
+	entry := &zipStreamEntry{
+		Flags:    le.Uint16(buf[2:]),
+		Method:   le.Uint16(buf[4:]),
+		Modified: msDosTime(le.Uint16(buf[8:]), le.Uint16(buf[6:])),
+		CRC32:    le.Uint32(buf[10:]),
+	}
+	compressed := uint64(le.Uint32(buf[14:]))
+	entry.Size = uint64(le.Uint32(buf[18:]))
+	nameLen := int(le.Uint16(buf[22:]))
+	extraLen := int(le.Uint16(buf[24:]))
+
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(z.r, name); err != nil {
+		return nil, nil, err
+	}
+	entry.Name = string(name)
+
+	extra := make([]byte, extraLen)
+	if _, err := io.ReadFull(z.r, extra); err != nil {
+		return nil, nil, err
+	}
+
+	// Zip64 extra field carries the real sizes when the header holds 0xFFFFFFFF
+	for len(extra) >= 4 {
+		id, size := le.Uint16(extra), int(le.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == zipExtraEncrypted {
+			entry.encrypted = true
+		}
+		if id == zip64ExtraID {
+			entry.zip64 = true
+			field := extra[:size]
+			if entry.Size == 0xFFFFFFFF && len(field) >= 8 {
+				entry.Size = le.Uint64(field)
+				field = field[8:]
+			}
+			if compressed == 0xFFFFFFFF && len(field) >= 8 {
+				compressed = le.Uint64(field)
+			}
+		}
+		extra = extra[size:]
+	}
+
+	hasDescriptor := entry.Flags&zipFlagDataDescriptor != 0
+
+	// Without a data descriptor the compressed size is known up front.
+	// Otherwise deflate streams as is: flate reads byte-wise from a
+	// bufio.Reader, so it stops exactly at the end of the compressed data.
+	// Stored content ends where a descriptor matching it begins.
+	var limited io.Reader
+	if hasDescriptor {
+		switch entry.Method {
+		case 0:
+			limited = &storedDescriptorReader{r: z.r, entry: entry, crc: crc32.NewIEEE()}
+		case 8:
+			limited = z.r
+		default:
+			return nil, nil, fmt.Errorf("zip: %s: entry with data descriptor cannot be streamed (method %d)", entry.Name, entry.Method)
+		}
+	} else {
+		limited = io.LimitReader(z.r, int64(compressed))
+	}
+
+	var raw io.Reader
+	switch entry.Method {
+	case 0:
+		raw = limited
+	case 8:
+		raw = flate.NewReader(limited)
+	default:
+		dcomp, ok := zipDecompressors[entry.Method]
+		if !ok {
+			return nil, nil, fmt.Errorf("zip: %w", errZipMethod(entry.Name, entry.Method))
+		}
+		raw = dcomp(limited)
+	}
+
+	z.current = &zipStreamBody{
+		z:          z,
+		entry:      entry,
+		raw:        raw,
+		limited:    limited,
+		crc:        crc32.NewIEEE(),
+		descriptor: hasDescriptor,
+	}
+	return entry, z.current, nil
+}
+
+// zipStreamBody decompresses one entry and validates its CRC at EOF
+type zipStreamBody struct {
+	z          *zipStreamReader
+	entry      *zipStreamEntry
+	raw        io.Reader
+	limited    io.Reader
+	crc        hash.Hash32
+	descriptor bool
+	done       bool
+}
+
+func (b *zipStreamBody) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, io.EOF
+	}
+
+	n, err := b.raw.Read(p)
+	b.crc.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	b.done = true
+	// Pooled decompressors are returned on Close
+	if c, ok := b.raw.(io.Closer); ok {
+		c.Close()
+	}
+	if b.descriptor {
+		if err := b.readDescriptor(); err != nil {
+			return n, err
+		}
+	} else if _, err := io.Copy(io.Discard, b.limited); err != nil {
+		return n, err
+	}
+	if b.crc.Sum32() != b.entry.CRC32 {
+		return n, fmt.Errorf("zip: %s: checksum mismatch", b.entry.Name)
+	}
+	return n, io.EOF
+}
+
+// readDescriptor consumes the data descriptor that follows streamed content
+func (b *zipStreamBody) readDescriptor() error {
+	r := b.z.r
+	le := binary.LittleEndian
+
+	peek, err := r.Peek(4)
+	if err != nil {
+		return err
+	}
+	if le.Uint32(peek) == zipDataDescSig {
+		r.Discard(4)
+	}
+
+	sizeLen := 4
+	if b.entry.zip64 {
+		sizeLen = 8
+	}
+	buf := make([]byte, 4+2*sizeLen)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+
+	b.entry.CRC32 = le.Uint32(buf)
+	if sizeLen == 8 {
+		b.entry.Size = le.Uint64(buf[12:])
+	} else {
+		b.entry.Size = uint64(le.Uint32(buf[8:]))
+	}
+	return nil
+}
+
+// zipDataDescMagic is the optional signature that starts a data descriptor
+var zipDataDescMagic = []byte("PK\x07\x08")
+
+// storedDescriptorReader reads the content of a stored entry whose size is
+// only recorded in the data descriptor after it. The content ends at the
+// first descriptor signature followed by the CRC-32 and sizes (32 or 64
+// bits) of the bytes read so far; the descriptor itself is left unread.
+type storedDescriptorReader struct {
+	r     *bufio.Reader
+	entry *zipStreamEntry
+	crc   hash.Hash32
+	n     uint64
+	done  bool
+}
+
+func (s *storedDescriptorReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// A descriptor with signature and 64-bit sizes is 24 bytes
+	const maxDescLen = 24
+	window, err := s.r.Peek(min(len(p)+maxDescLen, s.r.Size()))
+	if len(window) == 0 {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+
+	// Content may run up to the last position a descriptor can start at
+	limit := len(window)
+	if err == nil {
+		limit = min(len(window)-maxDescLen+1, len(p))
+	}
+	limit = min(limit, len(p))
+
+	n := limit
+	for i := 0; i < limit; {
+		j := bytes.Index(window[i:], zipDataDescMagic)
+		if j < 0 || i+j >= limit {
+			break
+		}
+		if pos := i + j; s.isDescriptor(window[:pos], window[pos:]) {
+			n = pos
+			s.done = true
+			break
+		}
+		i += j + 1
+	}
+	if n == 0 && !s.done {
+		// Fewer bytes than a descriptor remain and none matched
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	copy(p, window[:n])
+	s.r.Discard(n)
+	s.crc.Write(p[:n])
+	s.n += uint64(n)
+	if s.done {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// isDescriptor reports whether desc starts with a data descriptor for the
+// content read so far followed by data. A descriptor with 64-bit sizes
+// marks the entry as zip64, so readDescriptor reads it whole.
+func (s *storedDescriptorReader) isDescriptor(data, desc []byte) bool {
+	le := binary.LittleEndian
+	if len(desc) < 16 {
+		return false
+	}
+	size := s.n + uint64(len(data))
+	crc := crc32.Update(s.crc.Sum32(), crc32.IEEETable, data)
+	if le.Uint32(desc[4:]) != crc {
+		return false
+	}
+	if le.Uint32(desc[8:]) == uint32(size) && le.Uint32(desc[12:]) == uint32(size) && size < 0xFFFFFFFF {
+		return true
+	}
+	if len(desc) >= 24 && le.Uint64(desc[8:]) == size && le.Uint64(desc[16:]) == size {
+		s.entry.zip64 = true
+		return true
+	}
+	return false
+}
+
+// msDosTime converts an MS-DOS date and time into a time.Time
+func msDosTime(dosDate, dosTime uint16) time.Time {
+	return time.Date(
+		int(dosDate>>9+1980),
+		time.Month(dosDate>>5&0xf),
+		int(dosDate&0x1f),
+		int(dosTime>>11),
+		int(dosTime>>5&0x3f),
+		int(dosTime&0x1f*2),
+		0,
+		time.UTC,
+	)
+}
+
+// extractZipStream extracts a zip archive read sequentially from reader
+func extractZipStream(reader io.Reader, outputPath string, opts *models.ArchiveOptions) error {
+	zr := newZipStreamReader(reader)
+
+	c, err := newEntryCipher(opts)
+	if err != nil {
+		return err
+	}
+
+	for {
+		entry, body, err := zr.Next()
+		if err == errZipStreamEnd {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := extractZipStreamEntry(entry, body, c, outputPath, opts); err != nil {
+			return err
+		}
+	}
+}
+
+// extractZipStreamEntry extracts one entry read by a zipStreamReader. A
+// file whose content cannot be read completely is removed again.
+func extractZipStreamEntry(entry *zipStreamEntry, body io.Reader, c *crypto.EntryCipher, outputPath string, opts *models.ArchiveOptions) error {
+	if isMetadataEntry(entry.Name) {
+		return nil
+	}
+	isDir := strings.HasSuffix(entry.Name, "/")
+	mode := os.FileMode(0644)
+	if isDir {
+		mode = os.ModeDir | 0755
+	}
+
+	name, ok := applyEntryFilter(opts, models.Entry{
+		Name:    entry.Name,
+		Size:    int64(entry.Size),
+		Mode:    mode,
+		ModTime: entry.Modified,
+		IsDir:   isDir,
+	})
+	if !ok {
+		return nil
+	}
+
+	destPath, err := safeDestPath(outputPath, name)
+	if err != nil {
+		return err
+	}
+
+	if isDir {
+		return os.MkdirAll(destPath, umasked(0755, opts))
+	}
+
+	if opts.Verbose {
+		fmt.Printf("  Extracting: %s\n", name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), umasked(0755, opts)); err != nil {
+		return err
+	}
+
+	var src io.Reader = body
+	size := int64(entry.Size)
+	if entry.encrypted {
+		if src, err = openEntry(c, entry.Name, body); err != nil {
+			return err
+		}
+		size = crypto.OpenedSize(size)
+	}
+
+	outFile, err := createDestFile(destPath, mode, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := copyEntry(outFile, src, name, size, opts); err != nil {
+		outFile.Close()
+		os.Remove(destPath)
+		return err
+	}
+	return outFile.Close()
+}
@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// onlyReader hides every method but Read, as a pipe would
+type onlyReader struct{ r io.Reader }
+
+func (o onlyReader) Read(p []byte) (int, error) { return o.r.Read(p) }
+
+// buildZip writes files with method through zip.Writer.CreateHeader, which
+// follows every file with a data descriptor
+func buildZip(t *testing.T, method uint16, files map[string][]byte, order []string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range order {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZipStreamDataDescriptor(t *testing.T) {
+	// Content that looks like a descriptor signature must not end an entry
+	tricky := append([]byte("before PK\x07\x08 after"), bytes.Repeat([]byte("PK\x07\x08\x00\x00\x00\x00"), 2000)...)
+	files := map[string][]byte{
+		"empty.txt":  {},
+		"small.txt":  []byte("hello"),
+		"tricky.bin": tricky,
+		"dir/large":  bytes.Repeat([]byte("0123456789abcdef"), 1<<14),
+	}
+	order := []string{"empty.txt", "small.txt", "tricky.bin", "dir/large"}
+
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		data := buildZip(t, method, files, order)
+
+		zr := newZipStreamReader(onlyReader{bytes.NewReader(data)})
+		var got []string
+		for {
+			entry, body, err := zr.Next()
+			if err == errZipStreamEnd {
+				break
+			}
+			if err != nil {
+				t.Fatalf("method %d: %v", method, err)
+			}
+			content, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("method %d: %s: %v", method, entry.Name, err)
+			}
+			if !bytes.Equal(content, files[entry.Name]) {
+				t.Errorf("method %d: %s: content differs (%d bytes, want %d)", method, entry.Name, len(content), len(files[entry.Name]))
+			}
+			got = append(got, entry.Name)
+		}
+		if len(got) != len(order) {
+			t.Errorf("method %d: read entries %v, want %v", method, got, order)
+		}
+	}
+}
+
+func TestZipStreamStoredCorrupt(t *testing.T) {
+	files := map[string][]byte{"a.txt": []byte("some stored content")}
+	data := buildZip(t, zip.Store, files, []string{"a.txt"})
+
+	// Flip a content byte: the descriptor no longer matches, so the entry
+	// runs into the central directory and fails
+	i := bytes.Index(data, []byte("stored"))
+	data[i] ^= 0xff
+
+	zr := newZipStreamReader(onlyReader{bytes.NewReader(data)})
+	_, body, err := zr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(body); err == nil {
+		t.Fatal("corrupt stored entry read without error")
+	}
+}
+
+func TestExtractZipStreamFromReader(t *testing.T) {
+	files := map[string][]byte{"a/b.txt": []byte("streamed"), "c.txt": []byte("plain")}
+	data := buildZip(t, zip.Store, files, []string{"a/b.txt", "c.txt"})
+
+	output := t.TempDir()
+	if err := extractZipStream(onlyReader{bytes.NewReader(data)}, output, &models.ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(output, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func FuzzZipStream(f *testing.F) {
+	f.Add(buildZipSeed(zip.Store))
+	f.Add(buildZipSeed(zip.Deflate))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		zr := newZipStreamReader(bytes.NewReader(data))
+		for range 64 {
+			_, body, err := zr.Next()
+			if err != nil {
+				return
+			}
+			if _, err := io.Copy(io.Discard, io.LimitReader(body, 1<<20)); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func buildZipSeed(method uint16) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "seed.txt", Method: method})
+	w.Write([]byte("seed content PK\x07\x08"))
+	zw.Close()
+	return buf.Bytes()
+}
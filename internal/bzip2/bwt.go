@@ -0,0 +1,110 @@
+package bzip2
+
+// bwtBuffers holds the arrays the Burrows-Wheeler transform sorts with,
+// reused from block to block
+type bwtBuffers struct {
+	sa, tmp, rank, next, count []int32
+	last                       []byte
+}
+
+// grow sizes the buffers for a block of n bytes
+func (b *bwtBuffers) grow(n int) {
+	if cap(b.sa) < n {
+		b.sa = make([]int32, n)
+		b.tmp = make([]int32, n)
+		b.rank = make([]int32, n)
+		b.next = make([]int32, n)
+		b.last = make([]byte, n)
+	}
+	b.sa, b.tmp, b.rank, b.next, b.last = b.sa[:n], b.tmp[:n], b.rank[:n], b.next[:n], b.last[:n]
+	if cap(b.count) < max(n, 256) {
+		b.count = make([]int32, max(n, 256))
+	}
+}
+
+// transform returns the last column of the sorted rotations of block and
+// the row holding the unrotated block. Rotations are sorted by prefix
+// doubling: after each pass they are ordered by their first 2k bytes,
+// with a counting sort on the ranks of the previous pass.
+func (b *bwtBuffers) transform(block []byte) ([]byte, int) {
+	n := len(block)
+	b.grow(n)
+	sa, tmp, rank, next := b.sa, b.tmp, b.rank, b.next
+
+	// Order by the first byte
+	count := b.count[:256]
+	clear(count)
+	for _, c := range block {
+		count[c]++
+	}
+	for i := 1; i < 256; i++ {
+		count[i] += count[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		count[block[i]]--
+		sa[count[block[i]]] = int32(i)
+	}
+	classes := int32(1)
+	rank[sa[0]] = 0
+	for i := 1; i < n; i++ {
+		if block[sa[i]] != block[sa[i-1]] {
+			classes++
+		}
+		rank[sa[i]] = classes - 1
+	}
+
+	for k := 1; k < n && int(classes) < n; k <<= 1 {
+		// sa is ordered by the first k bytes, so starting each rotation k
+		// bytes earlier orders them by their second k bytes
+		for i, p := range sa {
+			p -= int32(k)
+			if p < 0 {
+				p += int32(n)
+			}
+			tmp[i] = p
+		}
+
+		// A stable counting sort by the rank of the first k bytes
+		count := b.count[:classes]
+		clear(count)
+		for _, p := range tmp {
+			count[rank[p]]++
+		}
+		for i := 1; i < len(count); i++ {
+			count[i] += count[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			p := tmp[i]
+			count[rank[p]]--
+			sa[count[rank[p]]] = p
+		}
+
+		second := func(p int32) int32 {
+			q := p + int32(k)
+			if q >= int32(n) {
+				q -= int32(n)
+			}
+			return rank[q]
+		}
+		classes = 1
+		next[sa[0]] = 0
+		for i := 1; i < n; i++ {
+			if rank[sa[i]] != rank[sa[i-1]] || second(sa[i]) != second(sa[i-1]) {
+				classes++
+			}
+			next[sa[i]] = classes - 1
+		}
+		rank, next = next, rank
+	}
+	b.rank, b.next = rank, next
+
+	origPtr := 0
+	for i, p := range sa {
+		if p == 0 {
+			origPtr = i
+			p = int32(n)
+		}
+		b.last[i] = block[p-1]
+	}
+	return b.last, origPtr
+}
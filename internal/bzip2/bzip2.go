@@ -0,0 +1,234 @@
+// Package bzip2 implements a bzip2 compressor. The standard library's
+// compress/bzip2 only decompresses; NewReader hands reading to it.
+package bzip2
+
+import (
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Block sizes, in units of 100 kB, that NewWriterLevel accepts
+const (
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = BestCompression
+)
+
+// Stream and block signatures
+const (
+	blockMagic = 0x314159265359
+	endMagic   = 0x177245385090
+)
+
+// maxRun is the longest run of one byte the initial run-length encoding
+// stores as a single run
+const maxRun = 255
+
+// NewReader returns a reader decompressing the bzip2 stream in r
+func NewReader(r io.Reader) io.Reader {
+	return bzip2.NewReader(r)
+}
+
+// Writer compresses data written to it as a single bzip2 stream. Close
+// must be called to write the end of the stream.
+type Writer struct {
+	bw    *bitWriter
+	level int
+	// block collects the run-length encoded data of the current block
+	block    []byte
+	blockMax int
+	blockCRC uint32
+	// streamCRC combines the CRCs of every block written
+	streamCRC uint32
+	// runByte repeats runLen times in the data not yet added to block
+	runByte     byte
+	runLen      int
+	wroteHeader bool
+	closed      bool
+	// bwt holds the sorting buffers, reused across blocks
+	bwt bwtBuffers
+}
+
+// NewWriter returns a Writer compressing to w with the default block size
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterLevel(w, DefaultCompression)
+	return z
+}
+
+// NewWriterLevel returns a Writer compressing to w with blocks of level
+// times 100 kB, between BestSpeed and BestCompression
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	if level < BestSpeed || level > BestCompression {
+		return nil, fmt.Errorf("bzip2: invalid compression level %d", level)
+	}
+	// The reference implementation keeps the same margin, so blocks never
+	// exceed what its decoder allocates
+	blockMax := level*100000 - 19
+	return &Writer{
+		bw:       newBitWriter(w),
+		level:    level,
+		block:    make([]byte, 0, blockMax+maxRun),
+		blockMax: blockMax,
+		blockCRC: crcInit,
+	}, nil
+}
+
+// Write compresses p
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("bzip2: write to closed writer")
+	}
+	for _, b := range p {
+		if z.runLen > 0 && (b != z.runByte || z.runLen == maxRun) {
+			if err := z.flushRun(); err != nil {
+				return 0, err
+			}
+		}
+		z.runByte = b
+		z.runLen++
+	}
+	return len(p), z.bw.err
+}
+
+// flushRun adds the pending run to the block, writing the block once it
+// is full. Runs of four or more are stored as four bytes and a count.
+func (z *Writer) flushRun() error {
+	for i := 0; i < z.runLen; i++ {
+		z.blockCRC = updateCRC(z.blockCRC, z.runByte)
+	}
+	if z.runLen < 4 {
+		for i := 0; i < z.runLen; i++ {
+			z.block = append(z.block, z.runByte)
+		}
+	} else {
+		z.block = append(z.block, z.runByte, z.runByte, z.runByte, z.runByte, byte(z.runLen-4))
+	}
+	z.runLen = 0
+
+	if len(z.block) >= z.blockMax {
+		return z.writeBlock()
+	}
+	return nil
+}
+
+// writeHeader writes the stream signature and block size
+func (z *Writer) writeHeader() {
+	if !z.wroteHeader {
+		z.bw.writeBits(32, uint64('B')<<24|uint64('Z')<<16|uint64('h')<<8|uint64('0'+z.level))
+		z.wroteHeader = true
+	}
+}
+
+// writeBlock compresses the collected block
+func (z *Writer) writeBlock() error {
+	z.writeHeader()
+	crc := ^z.blockCRC
+	z.streamCRC = (z.streamCRC<<1 | z.streamCRC>>31) ^ crc
+
+	z.bw.writeBits(48, blockMagic)
+	z.bw.writeBits(32, uint64(crc))
+	// Blocks are never randomized
+	z.bw.writeBits(1, 0)
+
+	last, origPtr := z.bwt.transform(z.block)
+	z.bw.writeBits(24, uint64(origPtr))
+	writeEntropy(z.bw, last)
+
+	z.block = z.block[:0]
+	z.blockCRC = crcInit
+	return z.bw.err
+}
+
+// Close writes any buffered data and the end of the stream. It does not
+// close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.bw.err
+	}
+	z.closed = true
+
+	if z.runLen > 0 {
+		if err := z.flushRun(); err != nil {
+			return err
+		}
+	}
+	if len(z.block) > 0 {
+		if err := z.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	z.writeHeader()
+	z.bw.writeBits(48, endMagic)
+	z.bw.writeBits(32, uint64(z.streamCRC))
+	return z.bw.flush()
+}
+
+// bitWriter packs bits most significant first
+type bitWriter struct {
+	w     io.Writer
+	bits  uint64
+	nbits uint
+	buf   []byte
+	err   error
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{w: w, buf: make([]byte, 0, 4096)}
+}
+
+// writeBits writes the n low bits of v, n at most 48
+func (bw *bitWriter) writeBits(n uint, v uint64) {
+	bw.bits = bw.bits<<n | v&(1<<n-1)
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.nbits -= 8
+		bw.buf = append(bw.buf, byte(bw.bits>>bw.nbits))
+	}
+	if len(bw.buf) >= cap(bw.buf)-8 {
+		bw.write()
+	}
+}
+
+func (bw *bitWriter) write() {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(bw.buf)
+	}
+	bw.buf = bw.buf[:0]
+}
+
+// flush pads the last byte with zeros and writes everything buffered
+func (bw *bitWriter) flush() error {
+	if bw.nbits > 0 {
+		bw.writeBits(8-bw.nbits, 0)
+	}
+	bw.write()
+	return bw.err
+}
+
+// bzip2 uses the CRC-32 polynomial most significant bit first
+const (
+	crcPoly = 0x04c11db7
+	crcInit = 0xffffffff
+)
+
+var crcTable = func() (table [256]uint32) {
+	for i := range table {
+		c := uint32(i) << 24
+		for range 8 {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ crcPoly
+			} else {
+				c <<= 1
+			}
+		}
+		table[i] = c
+	}
+	return table
+}()
+
+func updateCRC(crc uint32, b byte) uint32 {
+	return crc<<8 ^ crcTable[byte(crc>>24)^b]
+}
@@ -0,0 +1,203 @@
+package bzip2
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"math/rand"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// compress writes data to a Writer of the given level in chunks of chunk
+// bytes (all at once when chunk is 0)
+func compress(t testing.TB, data []byte, level, chunk int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	z, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk <= 0 {
+		chunk = max(len(data), 1)
+	}
+	for rest := data; len(rest) > 0; {
+		n := min(chunk, len(rest))
+		if _, err := z.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decompress reads a bzip2 stream with the standard library
+func decompress(t testing.TB, stream []byte) []byte {
+	t.Helper()
+	got, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(stream)))
+	if err != nil {
+		t.Fatalf("compress/bzip2: %v", err)
+	}
+	return got
+}
+
+func randomBytes(n int, seed int64) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+var roundTripTests = []struct {
+	name string
+	data []byte
+}{
+	{"empty", nil},
+	{"one byte", []byte{'x'}},
+	{"run of 3", []byte("aaa")},
+	{"run of 4", []byte("aaaa")},
+	{"run of 5", []byte("aaaaa")},
+	{"run of 255", bytes.Repeat([]byte{'a'}, 255)},
+	{"run of 256", bytes.Repeat([]byte{'a'}, 256)},
+	{"run of 259", bytes.Repeat([]byte{'a'}, 259)},
+	{"long run", bytes.Repeat([]byte{0}, 1<<20)},
+	{"periodic", bytes.Repeat([]byte("ab"), 5000)},
+	{"every byte", func() []byte {
+		var b []byte
+		for i := range 256 {
+			b = append(b, byte(i))
+		}
+		return bytes.Repeat(b, 8)
+	}()},
+	{"text", []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 3000))},
+	{"random", randomBytes(300000, 1)},
+	{"mixed runs", func() []byte {
+		var b []byte
+		rng := rand.New(rand.NewSource(2))
+		for len(b) < 250000 {
+			b = append(b, bytes.Repeat([]byte{byte(rng.Intn(4))}, rng.Intn(300)+1)...)
+		}
+		return b
+	}()},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range roundTripTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Level 1 splits the larger inputs into several blocks
+			for _, level := range []int{BestSpeed, 5, BestCompression} {
+				for _, chunk := range []int{0, 1, 4093} {
+					if chunk == 1 && len(tt.data) > 1<<16 {
+						continue
+					}
+					got := decompress(t, compress(t, tt.data, level, chunk))
+					if !bytes.Equal(got, tt.data) {
+						t.Fatalf("level %d, chunk %d: got %d bytes, want %d", level, chunk, len(got), len(tt.data))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBzip2Command(t *testing.T) {
+	path, err := exec.LookPath("bzip2")
+	if err != nil {
+		t.Skip("bzip2 not installed")
+	}
+	for _, tt := range roundTripTests {
+		cmd := exec.Command(path, "-d", "-c")
+		cmd.Stdin = bytes.NewReader(compress(t, tt.data, BestSpeed, 0))
+		got, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: bzip2 -d: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: bzip2 -d gave %d bytes, want %d", tt.name, len(got), len(tt.data))
+		}
+	}
+}
+
+func TestNewWriterLevel(t *testing.T) {
+	for _, level := range []int{-1, 0, 10} {
+		if _, err := NewWriterLevel(io.Discard, level); err == nil {
+			t.Errorf("NewWriterLevel accepted level %d", level)
+		}
+	}
+	for level := BestSpeed; level <= BestCompression; level++ {
+		var buf bytes.Buffer
+		z, err := NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		z.Close()
+		if want := "BZh" + string(rune('0'+level)); !strings.HasPrefix(buf.String(), want) {
+			t.Errorf("level %d: stream starts %q, want %q", level, buf.Bytes()[:4], want)
+		}
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	z := NewWriter(io.Discard)
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.Write([]byte("late")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	if err := z.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	var b bwtBuffers
+	for _, block := range []string{"a", "banana", "abababab", "mississippi", "zyxwvutsrq", "aaaa", "\x00\xff\x00\xff\x01"} {
+		last, origPtr := b.transform([]byte(block))
+
+		// Sort the rotations directly
+		n := len(block)
+		rotations := make([]string, n)
+		for i := range n {
+			rotations[i] = block[i:] + block[:i]
+		}
+		slices.Sort(rotations)
+		want := make([]byte, n)
+		for i, r := range rotations {
+			want[i] = r[n-1]
+		}
+		if string(last) != string(want) {
+			t.Errorf("transform(%q) = %q, want %q", block, last, want)
+		}
+		if rotations[origPtr] != block {
+			t.Errorf("transform(%q): row %d is %q, not the block", block, origPtr, rotations[origPtr])
+		}
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte("hello, hello, hello"), uint8(1))
+	f.Add(bytes.Repeat([]byte{'a'}, 1000), uint8(9))
+	f.Add([]byte{0, 0, 0, 0, 255, 255, 255, 255, 255}, uint8(3))
+	f.Fuzz(func(t *testing.T, data []byte, level uint8) {
+		level = level%BestCompression + 1
+		got := decompress(t, compress(t, data, int(level), 7))
+		if !bytes.Equal(got, data) {
+			t.Fatalf("round trip of %d bytes at level %d gave %d bytes", len(data), level, len(got))
+		}
+	})
+}
+
+func BenchmarkWriter(b *testing.B) {
+	data := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 20000))
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		z := NewWriter(io.Discard)
+		z.Write(data)
+		z.Close()
+	}
+}
@@ -0,0 +1,304 @@
+package bzip2
+
+import (
+	"container/heap"
+	"slices"
+)
+
+// Symbols of the move-to-front stage. Runs of zeros are written in
+// bijective base 2 with RUNA and RUNB; any other position p is p+1, and
+// the last symbol ends the block.
+const (
+	symRunA = 0
+	symRunB = 1
+)
+
+const (
+	// groupSize is the number of symbols coded with one table
+	groupSize = 50
+	// maxCodeLen bounds code lengths as the reference encoder does
+	maxCodeLen = 17
+	// tableIterations refines the tables and the choice between them
+	tableIterations = 4
+)
+
+// writeEntropy writes the symbol map, the Huffman tables and the coded
+// move-to-front symbols of the transformed block last
+func writeEntropy(bw *bitWriter, last []byte) {
+	// Only the bytes that occur get a move-to-front position
+	var inUse [256]bool
+	for _, c := range last {
+		inUse[c] = true
+	}
+	var seq [256]byte
+	var mtf []byte
+	for c := range 256 {
+		if inUse[c] {
+			seq[c] = byte(len(mtf))
+			mtf = append(mtf, byte(len(mtf)))
+		}
+	}
+	alphaSize := len(mtf) + 2
+	eob := uint16(len(mtf) + 1)
+
+	syms := make([]uint16, 0, len(last)+1)
+	zeros := 0
+	flushZeros := func() {
+		for zeros--; ; zeros = (zeros - 2) / 2 {
+			syms = append(syms, uint16(zeros&1))
+			if zeros < 2 {
+				break
+			}
+		}
+		zeros = 0
+	}
+	for _, c := range last {
+		s := seq[c]
+		j := slices.Index(mtf, s)
+		if j == 0 {
+			zeros++
+			continue
+		}
+		if zeros > 0 {
+			flushZeros()
+		}
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = s
+		syms = append(syms, uint16(j+1))
+	}
+	if zeros > 0 {
+		flushZeros()
+	}
+	syms = append(syms, eob)
+
+	// Symbol map: which 16-byte ranges hold used bytes, then the bytes
+	var ranges uint64
+	for i := range 16 {
+		if slices.Contains(inUse[i*16:i*16+16], true) {
+			ranges |= 1 << (15 - i)
+		}
+	}
+	bw.writeBits(16, ranges)
+	for i := range 16 {
+		if ranges&(1<<(15-i)) == 0 {
+			continue
+		}
+		var bits uint64
+		for j, used := range inUse[i*16 : i*16+16] {
+			if used {
+				bits |= 1 << (15 - j)
+			}
+		}
+		bw.writeBits(16, bits)
+	}
+
+	lengths, selectors := chooseTables(syms, alphaSize)
+
+	bw.writeBits(3, uint64(len(lengths)))
+	bw.writeBits(15, uint64(len(selectors)))
+	order := make([]byte, len(lengths))
+	for i := range order {
+		order[i] = byte(i)
+	}
+	for _, sel := range selectors {
+		j := slices.Index(order, sel)
+		copy(order[1:j+1], order[:j])
+		order[0] = sel
+		bw.writeBits(uint(j+1), 1<<(j+1)-2)
+	}
+
+	codes := make([][]uint32, len(lengths))
+	for t, lens := range lengths {
+		cur := lens[0]
+		bw.writeBits(5, uint64(cur))
+		for _, l := range lens {
+			for ; cur < l; cur++ {
+				bw.writeBits(2, 2)
+			}
+			for ; cur > l; cur-- {
+				bw.writeBits(2, 3)
+			}
+			bw.writeBits(1, 0)
+		}
+		codes[t] = assignCodes(lens)
+	}
+
+	for i, s := range syms {
+		t := selectors[i/groupSize]
+		bw.writeBits(uint(lengths[t][s]), uint64(codes[t][s]))
+	}
+}
+
+// chooseTables picks between two and six code tables for syms, as the
+// reference encoder does: symbols are first split into ranges of equal
+// total frequency, then each group of groupSize symbols is assigned the
+// cheapest table and the tables are rebuilt from their groups.
+func chooseTables(syms []uint16, alphaSize int) ([][]uint8, []byte) {
+	var nTables int
+	switch n := len(syms); {
+	case n < 200:
+		nTables = 2
+	case n < 600:
+		nTables = 3
+	case n < 1200:
+		nTables = 4
+	case n < 2400:
+		nTables = 5
+	default:
+		nTables = 6
+	}
+
+	freq := make([]int, alphaSize)
+	for _, s := range syms {
+		freq[s]++
+	}
+	lengths := make([][]uint8, nTables)
+	remaining, start := len(syms), 0
+	for part := nTables; part > 0; part-- {
+		target := remaining / part
+		end, sum := start-1, 0
+		for sum < target && end < alphaSize-1 {
+			end++
+			sum += freq[end]
+		}
+		if end > start && part != nTables && part != 1 && (nTables-part)%2 == 1 {
+			sum -= freq[end]
+			end--
+		}
+
+		lens := make([]uint8, alphaSize)
+		for s := range lens {
+			if s < start || s > end {
+				lens[s] = 15
+			}
+		}
+		lengths[part-1] = lens
+		start, remaining = end+1, remaining-sum
+	}
+
+	selectors := make([]byte, (len(syms)+groupSize-1)/groupSize)
+	tableFreq := make([][]int, nTables)
+	for t := range tableFreq {
+		tableFreq[t] = make([]int, alphaSize)
+	}
+	for range tableIterations {
+		for t := range tableFreq {
+			clear(tableFreq[t])
+		}
+		for g := range selectors {
+			group := syms[g*groupSize : min((g+1)*groupSize, len(syms))]
+			best, bestCost := 0, -1
+			for t, lens := range lengths {
+				cost := 0
+				for _, s := range group {
+					cost += int(lens[s])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[g] = byte(best)
+			for _, s := range group {
+				tableFreq[best][s]++
+			}
+		}
+		for t := range lengths {
+			lengths[t] = codeLengths(tableFreq[t], maxCodeLen)
+		}
+	}
+	return lengths, selectors
+}
+
+// codeLengths returns Huffman code lengths for freq of at most maxLen
+// bits. Every symbol gets a code, and frequencies are flattened until the
+// longest code fits.
+func codeLengths(freq []int, maxLen int) []uint8 {
+	weights := make([]int, len(freq))
+	for i, f := range freq {
+		weights[i] = max(f, 1)
+	}
+
+	lens := make([]uint8, len(freq))
+	for {
+		depths := huffmanDepths(weights)
+		longest := 0
+		for i, d := range depths {
+			lens[i] = uint8(d)
+			longest = max(longest, d)
+		}
+		if longest <= maxLen {
+			return lens
+		}
+		for i, w := range weights {
+			weights[i] = 1 + w/2
+		}
+	}
+}
+
+// huffmanDepths returns the depth of each leaf in a Huffman tree over
+// weights
+func huffmanDepths(weights []int) []int {
+	n := len(weights)
+	// Nodes 0..n-1 are leaves; internal nodes follow
+	parent := make([]int, 2*n-1)
+	h := &nodeHeap{}
+	for i, w := range weights {
+		heap.Push(h, heapNode{weight: w, index: i})
+	}
+	next := n
+	for h.Len() > 1 {
+		a := heap.Pop(h).(heapNode)
+		b := heap.Pop(h).(heapNode)
+		parent[a.index], parent[b.index] = next, next
+		heap.Push(h, heapNode{weight: a.weight + b.weight, index: next})
+		next++
+	}
+
+	root := next - 1
+	depth := make([]int, 2*n-1)
+	for i := root - 1; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+	}
+	return depth[:n]
+}
+
+type heapNode struct {
+	weight int
+	index  int
+}
+
+// nodeHeap orders nodes by weight, then by index so trees are stable
+type nodeHeap []heapNode
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].index < h[j].index
+}
+func (h nodeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x any)   { *h = append(*h, x.(heapNode)) }
+func (h *nodeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// assignCodes returns the canonical codes for lens: shorter codes first,
+// and within a length in symbol order
+func assignCodes(lens []uint8) []uint32 {
+	codes := make([]uint32, len(lens))
+	code := uint32(0)
+	for l := uint8(1); l <= maxCodeLen; l++ {
+		for s, sl := range lens {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
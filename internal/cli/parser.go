@@ -4,10 +4,13 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/cubetiqlabs/gar/internal/models"
+	"github.com/cubetiqlabs/gar/internal/progress"
 )
 
 // Parser handles command-line argument parsing
@@ -24,23 +27,93 @@ func NewParser() *Parser {
 
 // Parse parses command-line arguments and returns CLIArgs
 func (p *Parser) Parse(args []string) (*models.CLIArgs, error) {
-	// Pre-process arguments to expand combined flags like -cvf to -c -v -f
-	processedArgs := p.processUnixStyleFlags(args)
-
 	// Command line flags
 	var (
 		// Long-form flags (backward compatibility)
-		action      = p.flagSet.String("action", "", "Action: compress, extract, list")
-		input       = p.flagSet.String("input", "", "Input file or directory")
-		output      = p.flagSet.String("output", "", "Output file or directory")
-		format      = p.flagSet.String("format", "zip", "Archive format: zip, tar.gz")
-		password    = p.flagSet.String("password", "", "Password for encryption")
-		compression = p.flagSet.String("compression", "normal", "Compression level: fastest, normal, best")
-		workers     = p.flagSet.Int("workers", runtime.NumCPU(), "Number of worker threads")
-		verbose     = p.flagSet.Bool("verbose", false, "Verbose output")
-		version     = p.flagSet.Bool("version", false, "Show version")
-		help        = p.flagSet.Bool("help", false, "Show help message")
-		h           = p.flagSet.Bool("h", false, "Show help message (short)")
+		action          = p.flagSet.String("action", "", "Action: compress, extract, list, count, info, verify, cat, contains, merge, repack")
+		input           = p.flagSet.String("input", "", "Input file or directory (comma-separated archives for merge)")
+		format          = p.flagSet.String("format", "zip", "Archive format: zip, tar, tar.gz, tar.bz2, tar.zst, tar.xz, 7z (read only) (optionally format:level, e.g. zip:store)")
+		password        = p.flagSet.String("password", "", "Password for encryption (keyring:service/account or fifo:path to read it from there)")
+		compression     = p.flagSet.String("compression", "normal", "Compression level: fastest, normal, best, store, huffman, or a number")
+		workers         = p.flagSet.String("workers", strconv.Itoa(runtime.NumCPU()), "Number of worker threads, or auto")
+		verbose         = p.flagSet.Bool("verbose", false, "Verbose output")
+		mergePolicy     = p.flagSet.String("merge-policy", "first", "Merge collision policy: first, namespace")
+		stream          = p.flagSet.Bool("stream", false, "Extract zip sequentially from local headers (no seeking)")
+		tempDir         = p.flagSet.String("temp-dir", os.Getenv("GAR_TMPDIR"), "Directory for temporary files (default $GAR_TMPDIR or system temp)")
+		btime           = p.flagSet.Bool("preserve-btime", false, "Store and restore file creation times where supported (tar.gz)")
+		noFollow        = p.flagSet.Bool("no-follow-root", false, "Store a symlinked input path as a symlink instead of following it")
+		derefDepth      = p.flagSet.Int("deref-depth", 0, "Follow at most this many symlinks at the input path; store a longer chain as a link (0 = unlimited)")
+		progressFmt     = p.flagSet.String("progress", "", "Progress output on stderr: json")
+		batch           = p.flagSet.String("batch", "", "Run operations from a JSON batch file")
+		maxRatio        = p.flagSet.Int("max-ratio", 100, "Abort zip extraction when uncompressed/compressed size exceeds this ratio (0 disables)")
+		noRecursion     = p.flagSet.Bool("no-recursion", false, "Store only the top-level entries of an input directory without descending")
+		fastGzip        = p.flagSet.Bool("fast-gzip", false, "Use the faster klauspost gzip encoder for tar.gz output")
+		emptyDirs       = p.flagSet.Bool("empty-dirs", false, "With -action=info, list directories that contain no files")
+		acls            = p.flagSet.Bool("acls", false, "Store and restore POSIX ACLs (tar.gz, Linux)")
+		stripExt        = p.flagSet.Bool("strip-extended-headers", false, "Write plain USTAR tar headers without PAX/GNU extensions")
+		exclBackups     = p.flagSet.Bool("exclude-backups", false, "Skip editor backups and OS junk (*~, .#*, #*#, *.swp, .DS_Store, Thumbs.db)")
+		exclude         = p.flagSet.String("exclude", "", "Comma-separated glob patterns of paths to skip when compressing")
+		manifest        = p.flagSet.Bool("manifest", false, "Embed a manifest of content digests (.gar-manifest) when compressing")
+		hashAlgo        = p.flagSet.String("hash", "sha256", "Digest for manifests and -update comparisons: sha256, sha512, blake2b, xxhash")
+		modTime         = p.flagSet.String("mtime", os.Getenv("SOURCE_DATE_EPOCH"), "Store every entry with this mtime: Unix seconds or RFC 3339 (default $SOURCE_DATE_EPOCH)")
+		dryRun          = p.flagSet.Bool("dry-run", false, "Show what extraction would do without writing anything")
+		jsonOut         = p.flagSet.Bool("json", false, "Machine-readable JSON output (e.g. the -dry-run plan)")
+		sparse          = p.flagSet.Bool("sparse", false, "Store zero runs as holes in tar output (files and block devices) and restore holes on extract")
+		snapshot        = p.flagSet.String("snapshot", "", "Snapshot file for incremental compress: archive only files new or changed since the last run")
+		lowMemory       = p.flagSet.Bool("low-memory", false, "Reduce per-entry memory when writing zips with very many entries")
+		encPattern      = p.flagSet.String("encrypt-pattern", "", "Encrypt only entries matching these comma-separated patterns with the password (always PBKDF2 at 100000 iterations and AES-256-GCM)")
+		signKey         = p.flagSet.String("sign-key", "", "Ed25519 private key (PEM) to write a detached <archive>.sig when compressing")
+		requireSig      = p.flagSet.Bool("require-signature", false, "Refuse to extract unless <archive>.sig verifies against -pubkey")
+		pubKey          = p.flagSet.String("pubkey", "", "Ed25519 public key (PEM) for -require-signature")
+		symOverwr       = p.flagSet.Bool("allow-symlink-overwrite", false, "Write extracted files through existing symlinks instead of replacing the links")
+		progressInt     = p.flagSet.Duration("progress-interval", progress.DefaultInterval, "How often -progress reports running totals, e.g. 200ms")
+		update          = p.flagSet.Bool("update", false, "Extract only entries missing from the output or newer than the existing file")
+		syncTree        = p.flagSet.Bool("sync", false, "Like -update, then delete files in the output that the archive does not contain")
+		index           = p.flagSet.Bool("index", false, "Append an entry index to tar.gz output for fast single-entry reads (see -action=cat)")
+		entry           = p.flagSet.String("entry", "", "Entry name for -action=cat or verify, or a name or glob for -action=contains")
+		transforms      = &stringList{}
+		outputs         = &stringList{}
+		casePolicy      = p.flagSet.String("case-policy", "", "On extract, handle entries differing only in case: error, rename, skip")
+		rawTar          = p.flagSet.Bool("raw-tar", false, "Treat the input (stdin by default) as an existing tar stream and only compress it")
+		maxDepth        = p.flagSet.Int("max-depth", 0, "Limit how many directory levels below the input are archived (0 = unlimited)")
+		savePassword    = p.flagSet.Bool("save-password", false, "Prompt for a password and store it in the OS keyring entry named by -password=keyring:service/account")
+		duplicates      = p.flagSet.Bool("duplicates", false, "With -action=info, list files whose contents are identical")
+		orderFrom       = p.flagSet.String("order-from", "", "File listing entry names in the order to write them; other entries follow sorted")
+		recoverZip      = p.flagSet.Bool("recover", false, "Extract or list a damaged zip from its local headers, stopping at the first unreadable entry")
+		parallelGzip    = p.flagSet.Bool("parallel-gzip", false, "Decompress tar.gz input with klauspost/pgzip, inflating ahead of the reader")
+		onConflict      = p.flagSet.String("on-conflict", "overwrite", "On extract, handle files that already exist: overwrite, rename")
+		renameTmpl      = p.flagSet.String("rename-template", "{name}.{n}{ext}", "Name for renamed files under -on-conflict=rename; {name}, {n} and {ext} are replaced")
+		bufferSize      = p.flagSet.String("buffer-size", "", "Size of the buffers used to copy entry data, e.g. 256K (default 32K)")
+		preserveFlags   = p.flagSet.Bool("preserve-flags", false, "Store and restore file flags such as immutable and append-only (tar.gz; Linux, macOS, BSD)")
+		textConvert     = p.flagSet.String("text-convert", "", "Convert line endings of files matching -text-pattern on compress or extract: lf, crlf")
+		textPattern     = p.flagSet.String("text-pattern", "", "Comma-separated glob patterns of text files for -text-convert, e.g. *.txt,*.md")
+		umask           = p.flagSet.String("umask", "", "Clear these octal permission bits from extracted files and directories (e.g. 022)")
+		resume          = p.flagSet.Bool("resume", false, "Compress through a journaled directory of parts and continue an interrupted run")
+		partSize        = p.flagSet.String("part-size", "", "Input bytes per part of a -resume compress (e.g. 64M)")
+		serial          = p.flagSet.Bool("serial", false, "Extract zip entries one at a time in archive order, without the worker pool")
+		preserveOrder   = p.flagSet.Bool("preserve-order", false, "Extract entries one at a time in archive order so later duplicates win (tar.gz always does)")
+		skipEmpty       = p.flagSet.Bool("skip-empty", false, "Leave zero-length files out when compressing (directories are kept)")
+		strict          = p.flagSet.Bool("strict", false, "Fail instead of warning when an archive's content does not match its extension")
+		doneMarker      = p.flagSet.Bool("done-marker", false, "Create <output>.done after a successful compress, or <output>/.gar-extracted after an extract")
+		mmap            = p.flagSet.Bool("mmap", false, "Write extracted files of 1 MiB or more through a memory mapping of the preallocated output")
+		kdfIterations   = p.flagSet.Int("kdf-iterations", 0, "PBKDF2 iterations for whole-archive encryption (0 = 100000); stored in the archive")
+		kdf             = p.flagSet.String("kdf", "", "Key derivation for whole-archive encryption: pbkdf2 (default), argon2id; stored in the archive")
+		continueDecrypt = p.flagSet.Bool("continue-on-decrypt-error", false, "With -batch, keep going after an archive fails with a wrong password")
+		passwordStdin   = p.flagSet.Bool("password-stdin", false, "Read the password from stdin (prompting without echo on a terminal)")
+		passwordEnv     = p.flagSet.String("password-env", "", "Read the password from the named environment variable")
+		cipherName      = p.flagSet.String("cipher", "", "Cipher for whole-archive encryption: aes-gcm (default), chacha20poly1305; stored in the archive")
+		attrRules       = p.flagSet.String("attr-rules", "", "File of \"pattern mode=0644 uid=0 gid=0\" lines overriding stored attributes when compressing")
+		keyfile         = p.flagSet.String("keyfile", "", "File of key material for whole-archive encryption, alone or with -password")
+		symlinkFallback = p.flagSet.String("symlink-fallback", "error", "On extract, when the filesystem cannot create a symlink: error, text (write the target path to a file), copy (copy the target file)")
+		merkle          = p.flagSet.Bool("merkle", false, "Record a Merkle root of the manifest digests so single entries can be verified with -entry")
+		merkleRoot      = p.flagSet.String("merkle-root", "", "Trusted Merkle root (hex) that verify must find in the manifest")
+		gzipLevel       = p.flagSet.Int("gzip-level", 0, "Level (1-9) tar.gz uses for -compression=normal")
+		zstdLevel       = p.flagSet.Int("zstd-level", 0, "Level (1-22) tar.zst uses for -compression=normal")
+		flateLevel      = p.flagSet.Int("flate-level", 0, "Level (1-9) zip deflate uses for -compression=normal")
+		unsafeLinks     = p.flagSet.Bool("allow-unsafe-links", false, "Allow extracting symlinks that point outside the output directory")
+		version         = p.flagSet.Bool("version", false, "Show version")
+		help            = p.flagSet.Bool("help", false, "Show help message")
+		h               = p.flagSet.Bool("h", false, "Show help message (short)")
 
 		// Unix-style single char flags
 		c = p.flagSet.Bool("c", false, "(Unix-style) Compress")
@@ -50,17 +123,44 @@ func (p *Parser) Parse(args []string) (*models.CLIArgs, error) {
 		_ = p.flagSet.Bool("f", false, "(Unix-style) File (archive path)")
 		z = p.flagSet.Bool("z", false, "(Unix-style) Force gzip/TAR.GZ")
 		j = p.flagSet.Bool("j", false, "(Unix-style) Force bzip2")
-		Z = p.flagSet.Bool("Z", false, "(Unix-style) Force 7zip")
+		Z = p.flagSet.Bool("Z", false, "(Unix-style) Force 7zip (read only)")
 	)
 
+	p.flagSet.Var(outputs, "output", "Output file or directory; repeat (or separate with commas, escaping literal ones as \\,) to write several archives in one pass")
+	p.flagSet.Var(transforms, "transform", "Rename entries with a sed-style s/regexp/replacement/[gi] rule (repeatable, applied in order)")
+
+	// Pre-process arguments to expand combined flags like -cvf to -c -v -f
+	processedArgs := p.processUnixStyleFlags(args)
+
 	// Parse the pre-processed flags
-	if err := p.flagSet.Parse(processedArgs); err != nil {
-		return nil, err
+	// Flags may follow positional arguments (gar -cf out.bin -format=tar.gz dir),
+	// so keep parsing after each positional the flag package stops at. After
+	// "--" everything is positional, even names that start with a dash.
+	var posArgs []string
+	for rest := processedArgs; ; {
+		if err := p.flagSet.Parse(rest); err != nil {
+			return nil, err
+		}
+		remaining := p.flagSet.Args()
+		if n := len(rest) - len(remaining); n > 0 && p.isTerminator(rest, n-1) {
+			posArgs = append(posArgs, remaining...)
+			break
+		}
+		if len(remaining) == 0 {
+			break
+		}
+		posArgs = append(posArgs, remaining[0])
+		rest = remaining[1:]
 	}
 
 	// Build result
-	result := &models.CLIArgs{
-		Workers: *workers,
+	result := &models.CLIArgs{}
+	if *workers == "auto" {
+		result.Workers = models.WorkersAuto
+	} else if n, err := strconv.Atoi(*workers); err == nil && n > 0 {
+		result.Workers = n
+	} else {
+		return nil, fmt.Errorf("invalid -workers value %q: want a positive number or auto", *workers)
 	}
 
 	// Handle help flags
@@ -74,9 +174,6 @@ func (p *Parser) Parse(args []string) (*models.CLIArgs, error) {
 		return result, nil
 	}
 
-	// Get remaining arguments
-	posArgs := p.flagSet.Args()
-
 	// Build options from Unix-style flags if they were used
 	unixVerbose := *v
 	unixFormat := *format
@@ -128,7 +225,7 @@ func (p *Parser) Parse(args []string) (*models.CLIArgs, error) {
 	} else {
 		result.Action = *action
 		result.Input = *input
-		result.Output = *output
+		result.Output = joinOutputs(*outputs)
 	}
 
 	if unixVerbose {
@@ -138,12 +235,135 @@ func (p *Parser) Parse(args []string) (*models.CLIArgs, error) {
 	}
 
 	result.Format = unixFormat
+	result.FormatSet = *z || *j || *Z
+	p.flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == "format" {
+			result.FormatSet = true
+		}
+	})
 	result.Password = *password
 	result.Compression = *compression
+	result.AllowUnsafeLinks = *unsafeLinks
+	result.MergePolicy = *mergePolicy
+	result.Stream = *stream
+	result.TempDir = *tempDir
+	result.PreserveBirthTime = *btime
+	result.NoFollowRoot = *noFollow
+	result.DerefDepth = *derefDepth
+	result.Progress = *progressFmt
+	result.Batch = *batch
+	result.MaxRatio = *maxRatio
+	result.NoRecursion = *noRecursion
+	result.FastGzip = *fastGzip
+	result.EmptyDirs = *emptyDirs
+	result.ACLs = *acls
+	result.StripExtendedHeaders = *stripExt
+	result.ExcludeBackups = *exclBackups
+	result.Exclude = *exclude
+	result.Manifest = *manifest
+	result.Hash = *hashAlgo
+	result.ModTime = *modTime
+	result.DryRun = *dryRun
+	result.JSON = *jsonOut
+	result.Sparse = *sparse
+	result.Snapshot = *snapshot
+	result.LowMemory = *lowMemory
+	result.EncryptPattern = *encPattern
+	result.SignKey = *signKey
+	result.RequireSignature = *requireSig
+	result.PublicKey = *pubKey
+	result.AllowSymlinkOverwrite = *symOverwr
+	result.ProgressInterval = *progressInt
+	result.Update = *update
+	result.Sync = *syncTree
+	result.Index = *index
+	result.Entry = *entry
+	result.CasePolicy = *casePolicy
+	result.RawTar = *rawTar
+	result.MaxDepth = *maxDepth
+	result.SavePassword = *savePassword
+	result.Duplicates = *duplicates
+	result.OrderFrom = *orderFrom
+	result.Recover = *recoverZip
+	result.ParallelGzip = *parallelGzip
+	result.OnConflict = *onConflict
+	result.RenameTemplate = *renameTmpl
+	result.BufferSize = *bufferSize
+	result.PreserveFlags = *preserveFlags
+	result.TextConvert = *textConvert
+	result.TextPattern = *textPattern
+	result.Umask = *umask
+	result.Resume = *resume
+	result.PartSize = *partSize
+	result.Serial = *serial
+	result.PreserveOrder = *preserveOrder
+	result.SkipEmpty = *skipEmpty
+	result.Strict = *strict
+	result.DoneMarker = *doneMarker
+	result.Mmap = *mmap
+	result.KDFIterations = *kdfIterations
+	result.KDF = *kdf
+	result.ContinueOnDecryptError = *continueDecrypt
+	result.PasswordStdin = *passwordStdin
+	result.PasswordEnv = *passwordEnv
+	result.Cipher = *cipherName
+	result.AttrRules = *attrRules
+	result.Keyfile = *keyfile
+	result.SymlinkFallback = *symlinkFallback
+	result.Merkle = *merkle
+	result.MerkleRoot = *merkleRoot
+	result.GzipLevel = *gzipLevel
+	result.ZstdLevel = *zstdLevel
+	result.FlateLevel = *flateLevel
+	result.Transform = *transforms
+
+	// A raw tar stream is read from stdin unless an input is named
+	if result.RawTar && result.Input == "" {
+		result.Input = "-"
+	}
+
+	sources := 0
+	for _, set := range []bool{result.Password != "", result.PasswordStdin, result.PasswordEnv != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("-password, -password-stdin and -password-env cannot be combined")
+	}
+	if result.PasswordStdin && result.Input == "-" {
+		return nil, fmt.Errorf("-password-stdin cannot be combined with reading the archive from stdin")
+	}
 
 	return result, nil
 }
 
+// stringList is a flag that collects every occurrence in order
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// joinOutputs combines repeated -output values into the comma-separated
+// form the archive package splits. A single value is passed on as given;
+// with several, each names one path, so commas inside them are escaped.
+func joinOutputs(values []string) string {
+	if len(values) <= 1 {
+		return strings.Join(values, "")
+	}
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = strings.ReplaceAll(v, ",", `\,`)
+	}
+	return strings.Join(escaped, ",")
+}
+
 // ProcessUnixStyleFlags converts Unix-style combined flags (like -cvf) into separate flags
 // This allows us to support tar-like commands like: gar -cvf archive.zip folder
 func (p *Parser) processUnixStyleFlags(args []string) []string {
@@ -152,6 +372,11 @@ func (p *Parser) processUnixStyleFlags(args []string) []string {
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
+		// Arguments after "--" are names, never flags
+		if p.isTerminator(args, i) {
+			return append(result, args[i:]...)
+		}
+
 		// Check if this is a combined short flag (starts with -, has multiple chars, not --)
 		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && len(arg) > 2 {
 			// This could be a combined flag like -cvf or -xvf
@@ -182,6 +407,23 @@ func (p *Parser) processUnixStyleFlags(args []string) []string {
 	return result
 }
 
+// isTerminator reports whether args[i] is the "--" that ends the flags,
+// rather than the value of the flag before it (as in -password --)
+func (p *Parser) isTerminator(args []string, i int) bool {
+	if args[i] != "--" {
+		return false
+	}
+	if i == 0 || !strings.HasPrefix(args[i-1], "-") || strings.Contains(args[i-1], "=") {
+		return true
+	}
+	f := p.flagSet.Lookup(strings.TrimLeft(args[i-1], "-"))
+	if f == nil {
+		return true
+	}
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
+
 // PrintUsage prints the usage information
 func (p *Parser) PrintUsage(version string) {
 	fmt.Println("GoArchive (gar) - High-Performance Cross-Platform Archive Manager")
@@ -197,6 +439,13 @@ func (p *Parser) PrintUsage(version string) {
 	fmt.Println("  gar -action=compress -input=<path> -output=<file> [options]")
 	fmt.Println("  gar -action=extract -input=<file> -output=<path> [options]")
 	fmt.Println("  gar -action=list -input=<file> [options]")
+	fmt.Println("  gar -action=count -input=<file>")
+	fmt.Println("  gar -action=info -input=<file> [-empty-dirs] [-duplicates]")
+	fmt.Println("  gar -action=verify -input=<file>")
+	fmt.Println("  gar -action=cat -input=<file> -entry=<name>")
+	fmt.Println("  gar -action=contains -input=<file> -entry=<name|glob>")
+	fmt.Println("  gar -action=merge -input=<a,b,...> -output=<file> [options]")
+	fmt.Println("  gar -action=repack -input=<file> [-output=<file.tar>]")
 	fmt.Println()
 	fmt.Println("Unix-style Options:")
 	fmt.Println("  c              Compress")
@@ -205,8 +454,8 @@ func (p *Parser) PrintUsage(version string) {
 	fmt.Println("  v              Verbose output")
 	fmt.Println("  f              File (archive path) - must follow other options")
 	fmt.Println("  z              Force gzip compression (TAR.GZ format)")
-	fmt.Println("  j              Force bzip2 compression")
-	fmt.Println("  Z              Force 7zip compression")
+	fmt.Println("  j              Force tar.bz2 compression")
+	fmt.Println("  Z              Force 7zip format (list and extract only)")
 	fmt.Println()
 	fmt.Println("Long-form Options:")
 	p.flagSet.PrintDefaults()
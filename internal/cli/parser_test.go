@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name                  string
+		args                  []string
+		action, input, output string
+		format                string
+		password              string
+		verbose               bool
+	}{
+		{
+			name:   "unix compress",
+			args:   []string{"-cvf", "out.zip", "dir"},
+			action: "compress", input: "dir", output: "out.zip", format: "zip", verbose: true,
+		},
+		{
+			name:   "unix extract with format",
+			args:   []string{"-xzf", "in.tar.gz", "out"},
+			action: "extract", input: "in.tar.gz", output: "out", format: "tar.gz",
+		},
+		{
+			name:   "flags after positionals",
+			args:   []string{"-cf", "out.bin", "-format=tar.gz", "dir"},
+			action: "compress", input: "dir", output: "out.bin", format: "tar.gz",
+		},
+		{
+			name:   "traditional",
+			args:   []string{"-action=list", "-input=a.zip"},
+			action: "list", input: "a.zip", format: "zip",
+		},
+		{
+			name:   "dash names after terminator",
+			args:   []string{"-cf", "out.zip", "--", "-cvx"},
+			action: "compress", input: "-cvx", output: "out.zip", format: "zip",
+		},
+		{
+			name:   "flag-like names after terminator",
+			args:   []string{"-xf", "--", "-in.zip", "-format=tar"},
+			action: "extract", input: "-in.zip", output: "-format=tar", format: "zip",
+		},
+		{
+			name:   "terminator as a flag value",
+			args:   []string{"-password", "--", "-cf", "out.zip", "dir"},
+			action: "compress", input: "dir", output: "out.zip", format: "zip", password: "--",
+		},
+		{
+			name:   "repeated outputs",
+			args:   []string{"-action=compress", "-input=dir", "-output=a,1.zip", "-output=b.tar.gz"},
+			action: "compress", input: "dir", output: `a\,1.zip,b.tar.gz`, format: "zip",
+		},
+		{
+			name:   "comma-separated outputs",
+			args:   []string{"-action=compress", "-input=dir", "-output=a.zip,b.tar.gz"},
+			action: "compress", input: "dir", output: "a.zip,b.tar.gz", format: "zip",
+		},
+		{
+			name:   "terminator after a bool flag",
+			args:   []string{"-t", "-v", "--", "-a.zip"},
+			action: "list", input: "-a.zip", format: "zip", verbose: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser()
+			p.flagSet.SetOutput(io.Discard)
+			got, err := p.Parse(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Action != tt.action || got.Input != tt.input || got.Output != tt.output {
+				t.Errorf("action %q input %q output %q, want %q %q %q", got.Action, got.Input, got.Output, tt.action, tt.input, tt.output)
+			}
+			if got.Format != tt.format || got.Password != tt.password || got.Verbose != tt.verbose {
+				t.Errorf("format %q password %q verbose %v, want %q %q %v", got.Format, got.Password, got.Verbose, tt.format, tt.password, tt.verbose)
+			}
+		})
+	}
+}
+
+func TestProcessUnixStyleFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-cvf", "a.zip"}, []string{"-c", "-v", "-f", "a.zip"}},
+		{[]string{"-xjf", "a.tar.bz2"}, []string{"-x", "-j", "-f", "a.tar.bz2"}},
+		{[]string{"-vf", "a.zip"}, []string{"-vf", "a.zip"}},
+		{[]string{"-format=zip"}, []string{"-format=zip"}},
+		{[]string{"--", "-cvf"}, []string{"--", "-cvf"}},
+		{[]string{"-cf", "a.zip", "--", "-xvf", "--"}, []string{"-c", "-f", "a.zip", "--", "-xvf", "--"}},
+	}
+
+	for _, tt := range tests {
+		p := NewParser()
+		if got := p.processUnixStyleFlags(tt.args); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("processUnixStyleFlags(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add("-cvf out.zip dir")
+	f.Add("-xf in.zip -- -out")
+	f.Add("-password -- -tf a.zip")
+	f.Fuzz(func(t *testing.T, line string) {
+		p := NewParser()
+		p.flagSet.SetOutput(io.Discard)
+		p.Parse(strings.Fields(line))
+	})
+}
+
+func TestParseTempDir(t *testing.T) {
+	tests := []struct {
+		env  string
+		args []string
+		want string
+	}{
+		{"", []string{"-tf", "a.zip"}, ""},
+		{"/env/tmp", []string{"-tf", "a.zip"}, "/env/tmp"},
+		{"/env/tmp", []string{"-temp-dir", "/flag/tmp", "-tf", "a.zip"}, "/flag/tmp"},
+	}
+	for _, tt := range tests {
+		t.Setenv("GAR_TMPDIR", tt.env)
+		p := NewParser()
+		p.flagSet.SetOutput(io.Discard)
+		got, err := p.Parse(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.TempDir != tt.want {
+			t.Errorf("GAR_TMPDIR=%q %q: TempDir = %q, want %q", tt.env, tt.args, got.TempDir, tt.want)
+		}
+	}
+}
+
+func TestParsePasswordSources(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"-password=secret", "-xf", "a.zip"}, ""},
+		{[]string{"-password-stdin", "-xf", "a.zip"}, ""},
+		{[]string{"-password-env=GAR_PASSWORD", "-xf", "a.zip"}, ""},
+		{[]string{"-password=secret", "-password-stdin", "-xf", "a.zip"}, "cannot be combined"},
+		{[]string{"-password=secret", "-password-env=GAR_PASSWORD", "-xf", "a.zip"}, "cannot be combined"},
+		{[]string{"-password-stdin", "-password-env=GAR_PASSWORD", "-xf", "a.zip"}, "cannot be combined"},
+		{[]string{"-password-stdin", "-xf", "-"}, "reading the archive from stdin"},
+	}
+	for _, tt := range tests {
+		p := NewParser()
+		p.flagSet.SetOutput(io.Discard)
+		_, err := p.Parse(tt.args)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%q: %v", tt.args, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: err = %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -2,42 +2,72 @@
 package crypto
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
-// NewEncryptedWriter creates an encrypted writer that uses AES-256-GCM
-func NewEncryptedWriter(w io.Writer, password string) (io.Writer, error) {
+// ErrNotEncrypted is returned when a stream does not start with the
+// encrypted stream header
+var ErrNotEncrypted = errors.New("not a gar-encrypted stream")
+
+// ErrWrongPassword is returned when the first frame of an encrypted stream
+// fails authentication. A wrong password and a corrupted start of the
+// stream cannot be told apart.
+var ErrWrongPassword = errors.New("incorrect password or corrupted archive")
+
+// ErrKeyfileRequired is returned when a stream encrypted with a keyfile is
+// opened without one
+var ErrKeyfileRequired = errors.New("archive is encrypted with a keyfile; one is required")
+
+// errTruncatedStream is returned when an encrypted stream ends before its
+// final frame
+var errTruncatedStream = errors.New("encrypted stream is truncated")
+
+// errTrailingData is returned when an encrypted stream goes on after its
+// final frame
+var errTrailingData = errors.New("encrypted stream has data after its final frame")
+
+// streamLengthSize is the size of the big-endian ciphertext length that
+// precedes every frame of an encrypted stream
+const streamLengthSize = 4
+
+// NewEncryptedWriter creates an encrypted writer that uses AES-256-GCM, or
+// ChaCha20-Poly1305 when opts selects it. Data is split into chunks of up
+// to 64 KiB, each sealed on its own and written as a frame: the ciphertext
+// length followed by the ciphertext. Chunk i is sealed under the stream
+// nonce combined with counter i, so no nonce repeats under a key, and the
+// final chunk is marked in the additional data so a stream cut at a frame
+// boundary is detected. Close must be called to write the final chunk.
+func NewEncryptedWriter(w io.Writer, password string, opts StreamOptions) (*EncryptedWriter, error) {
+	header, err := newStreamHeader(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// Derive key from password
 	salt := make([]byte, 32)
 	if _, err := rand.Read(salt); err != nil {
 		return nil, err
 	}
 
-	key := pbkdf2.Key([]byte(password), salt, 100000, 32, sha256.New)
-
-	block, err := aes.NewCipher(key)
+	aead, err := header.aead(header.key(password, opts.Keyfile, salt))
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
 		return nil, err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
+	// Write the header, salt and nonce first
+	if _, err := w.Write(header.encode()); err != nil {
 		return nil, err
 	}
-
-	// Write salt and nonce first
 	if _, err := w.Write(salt); err != nil {
 		return nil, err
 	}
@@ -45,79 +75,218 @@ func NewEncryptedWriter(w io.Writer, password string) (io.Writer, error) {
 		return nil, err
 	}
 
+	frame := getFrame()
 	return &EncryptedWriter{
 		writer: w,
-		gcm:    gcm,
+		aead:   aead,
 		nonce:  nonce,
+		frame:  frame,
+		buf:    (*frame)[:0:entryChunkSize],
 	}, nil
 }
 
 // EncryptedWriter wraps an io.Writer to encrypt data
 type EncryptedWriter struct {
 	writer io.Writer
-	gcm    cipher.AEAD
+	aead   cipher.AEAD
 	nonce  []byte
+	// frame is the pooled buffer behind buf, with room for the tag so
+	// chunks are sealed in place
+	frame      *[]byte
+	buf        []byte
+	length     [streamLengthSize]byte
+	chunk      uint64
+	chunkNonce [entryNonceSize]byte
 }
 
-// Write encrypts data and writes it to the underlying writer
-func (ew *EncryptedWriter) Write(p []byte) (n int, err error) {
-	encrypted := ew.gcm.Seal(nil, ew.nonce, p, nil)
-	return ew.writer.Write(encrypted)
+// Write buffers p and writes every chunk it fills
+func (ew *EncryptedWriter) Write(p []byte) (int, error) {
+	if ew.frame == nil {
+		return 0, errors.New("write to closed encrypted writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+
+		// Full chunks are sealed right away, so the final chunk is always
+		// short (possibly empty) and readers recognize it by its size
+		if len(ew.buf) == entryChunkSize {
+			if err := ew.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
 }
 
-// NewEncryptedReader creates an encrypted reader that uses AES-256-GCM
-func NewEncryptedReader(r io.Reader, password string) (io.Reader, error) {
-	// Read salt
-	salt := make([]byte, 32)
-	if _, err := io.ReadFull(r, salt); err != nil {
-		return nil, err
+// flush seals the buffered chunk and writes it as a frame
+func (ew *EncryptedWriter) flush(final bool) error {
+	nonce := chunkNonce(ew.chunkNonce[:], ew.nonce, ew.chunk)
+	sealed := ew.aead.Seal((*ew.frame)[:0], nonce, ew.buf, chunkAD(final))
+	ew.chunk++
+	ew.buf = (*ew.frame)[:0:entryChunkSize]
+
+	binary.BigEndian.PutUint32(ew.length[:], uint32(len(sealed)))
+	if _, err := ew.writer.Write(ew.length[:]); err != nil {
+		return err
+	}
+	_, err := ew.writer.Write(sealed)
+	return err
+}
+
+// Close writes the buffered data as the last frame and releases the chunk
+// buffer. It does not close the underlying writer.
+func (ew *EncryptedWriter) Close() error {
+	if ew.frame == nil {
+		return nil
 	}
 
-	key := pbkdf2.Key([]byte(password), salt, 100000, 32, sha256.New)
+	err := ew.flush(true)
+	putFrame(ew.frame)
+	ew.frame, ew.buf = nil, nil
+	return err
+}
 
-	block, err := aes.NewCipher(key)
+// NewEncryptedReader creates an encrypted reader for the cipher and key
+// derivation named in the stream header. keyfile must hold the key
+// material the stream was written with, or be nil if it used none.
+// The first frame is opened before returning, so a wrong password fails
+// here with ErrWrongPassword rather than partway through a read.
+func NewEncryptedReader(r io.Reader, password string, keyfile []byte) (io.Reader, error) {
+	header, err := readStreamHeader(r)
 	if err != nil {
 		return nil, err
 	}
+	if header.keyfile && len(keyfile) == 0 {
+		return nil, ErrKeyfileRequired
+	}
+	if !header.keyfile && len(keyfile) > 0 {
+		return nil, errors.New("archive is not encrypted with a keyfile")
+	}
+
+	// Read salt
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, err
+	}
 
-	gcm, err := cipher.NewGCM(block)
+	aead, err := header.aead(header.key(password, keyfile, salt))
 	if err != nil {
 		return nil, err
 	}
 
 	// Read nonce
-	nonce := make([]byte, gcm.NonceSize())
+	nonce := make([]byte, aead.NonceSize())
 	if _, err := io.ReadFull(r, nonce); err != nil {
 		return nil, err
 	}
 
-	return &EncryptedReader{
+	er := &EncryptedReader{
 		reader: r,
-		gcm:    gcm,
+		aead:   aead,
 		nonce:  nonce,
-	}, nil
+	}
+	if err := er.next(); err != nil {
+		return nil, err
+	}
+	return er, nil
 }
 
-// EncryptedReader wraps an io.Reader to decrypt data
+// EncryptedReader wraps an io.Reader to decrypt data. Frames are read
+// whole and opened in place, so reads of any size are served across frame
+// boundaries.
 type EncryptedReader struct {
 	reader io.Reader
-	gcm    cipher.AEAD
+	aead   cipher.AEAD
 	nonce  []byte
+	// frame is a pooled buffer, released at the end of the stream.
+	// Readers abandoned early leave it to the garbage collector.
+	frame      *[]byte
+	plain      []byte
+	length     [streamLengthSize]byte
+	chunk      uint64
+	chunkNonce [entryNonceSize]byte
+	done       bool
 }
 
 // Read decrypts data from the underlying reader
-func (er *EncryptedReader) Read(p []byte) (n int, err error) {
-	encrypted := make([]byte, len(p)+er.gcm.Overhead())
-	n, err = er.reader.Read(encrypted)
-	if err != nil && err != io.EOF {
-		return 0, fmt.Errorf("read error: %w", err)
+func (er *EncryptedReader) Read(p []byte) (int, error) {
+	for len(er.plain) == 0 {
+		if er.done {
+			if er.frame != nil {
+				putFrame(er.frame)
+				er.frame = nil
+			}
+			return 0, io.EOF
+		}
+		if err := er.next(); err != nil {
+			return 0, err
+		}
 	}
 
-	decrypted, err := er.gcm.Open(nil, er.nonce, encrypted[:n], nil)
+	n := copy(p, er.plain)
+	er.plain = er.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the following frame. Only the final frame is
+// short, and the stream must end with it.
+func (er *EncryptedReader) next() error {
+	if _, err := io.ReadFull(er.reader, er.length[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncatedStream
+		}
+		return fmt.Errorf("read error: %w", err)
+	}
+
+	size := binary.BigEndian.Uint32(er.length[:])
+	if size < uint32(er.aead.Overhead()) || size > entryChunkSize+entryTagSize {
+		return fmt.Errorf("invalid encrypted frame length %d", size)
+	}
+
+	if er.frame == nil {
+		er.frame = getFrame()
+	}
+	frame := (*er.frame)[:size]
+	if _, err := io.ReadFull(er.reader, frame); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncatedStream
+		}
+		return fmt.Errorf("read error: %w", err)
+	}
+
+	final := size < entryChunkSize+entryTagSize
+	nonce := chunkNonce(er.chunkNonce[:], er.nonce, er.chunk)
+	plain, err := er.aead.Open(frame[:0], nonce, frame, chunkAD(final))
 	if err != nil {
-		return 0, fmt.Errorf("decryption failed: %w", err)
+		if er.chunk == 0 {
+			return ErrWrongPassword
+		}
+		return fmt.Errorf("decryption failed: %w", err)
+	}
+	er.chunk++
+	er.plain = plain
+	er.done = final
+	if final {
+		return er.checkEnd()
 	}
+	return nil
+}
 
-	copy(p, decrypted)
-	return len(decrypted), nil
+// checkEnd makes sure nothing follows the final frame, so bytes appended
+// to a stream are not silently ignored
+func (er *EncryptedReader) checkEnd() error {
+	var extra [1]byte
+	n, err := io.ReadFull(er.reader, extra[:])
+	if n > 0 {
+		return errTrailingData
+	}
+	if err != io.EOF {
+		return fmt.Errorf("read error: %w", err)
+	}
+	return nil
 }
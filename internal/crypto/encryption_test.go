@@ -0,0 +1,362 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// encryptStream encrypts data with NewEncryptedWriter, writing it in
+// pieces of at most writeSize bytes
+func encryptStream(t testing.TB, data []byte, password string, opts StreamOptions, writeSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptedWriter(&buf, password, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(data) > 0 {
+		n := min(writeSize, len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decryptStream decrypts sealed with NewEncryptedReader, reading it in
+// pieces of at most readSize bytes
+func decryptStream(sealed []byte, password string, keyfile []byte, readSize int) ([]byte, error) {
+	// The underlying reader also returns short reads
+	r, err := NewEncryptedReader(iotest.HalfReader(bytes.NewReader(sealed)), password, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	// Hide WriterTo and ReaderFrom so reads go through a readSize buffer
+	_, err = io.CopyBuffer(struct{ io.Writer }{&out}, struct{ io.Reader }{r}, make([]byte, readSize))
+	return out.Bytes(), err
+}
+
+// randomBytes returns n bytes from a fixed seed
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+func TestEncryptedStreamRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, entryChunkSize - 1, entryChunkSize, entryChunkSize + 1, 5<<20 + 3}
+	buffers := []struct{ write, read int }{
+		{1000, 333},
+		{7, 4093},
+		{entryChunkSize + 5, 1},
+	}
+	for _, size := range sizes {
+		data := randomBytes(size)
+		for _, b := range buffers {
+			// One-byte reads of the multi-megabyte stream take too long
+			if size > 1<<20 && (b.write < 100 || b.read < 100) {
+				continue
+			}
+			t.Run(fmt.Sprintf("%d/write%d/read%d", size, b.write, b.read), func(t *testing.T) {
+				sealed := encryptStream(t, data, "secret", StreamOptions{}, b.write)
+				got, err := decryptStream(sealed, "secret", nil, b.read)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("decrypted %d bytes that differ from the %d written", len(got), len(data))
+				}
+			})
+		}
+	}
+}
+
+// nonceRecorder is an AEAD that fails the test when a nonce is reused
+type nonceRecorder struct {
+	cipher.AEAD
+	t    testing.TB
+	seen map[string]bool
+}
+
+func (r *nonceRecorder) Seal(dst, nonce, plaintext, ad []byte) []byte {
+	if r.seen[string(nonce)] {
+		r.t.Fatalf("nonce %x sealed twice", nonce)
+	}
+	r.seen[string(nonce)] = true
+	return r.AEAD.Seal(dst, nonce, plaintext, ad)
+}
+
+func TestEncryptedStreamUniqueNonces(t *testing.T) {
+	const chunks = 3000
+	w, err := NewEncryptedWriter(io.Discard, "secret", StreamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &nonceRecorder{AEAD: w.aead, t: t, seen: make(map[string]bool)}
+	w.aead = recorder
+
+	chunk := make([]byte, entryChunkSize)
+	for i := 0; i < chunks; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The full chunks and the empty final one
+	if len(recorder.seen) != chunks+1 {
+		t.Errorf("sealed %d chunks, want %d", len(recorder.seen), chunks+1)
+	}
+}
+
+func TestEncryptedStreamTampering(t *testing.T) {
+	data := randomBytes(3*entryChunkSize + 100)
+	sealed := encryptStream(t, data, "secret", StreamOptions{}, len(data))
+
+	// Split the stream into its prefix (header, salt and nonce) and frames
+	full := streamLengthSize + entryChunkSize + entryTagSize
+	last := streamLengthSize + 100 + entryTagSize
+	prefix := sealed[:len(sealed)-3*full-last]
+	var frames [][]byte
+	for rest := sealed[len(prefix):]; len(rest) > 0; {
+		n := min(full, len(rest))
+		frames = append(frames, rest[:n])
+		rest = rest[n:]
+	}
+	join := func(order ...int) []byte {
+		out := bytes.Clone(prefix)
+		for _, i := range order {
+			out = append(out, frames[i]...)
+		}
+		return out
+	}
+
+	if got, err := decryptStream(join(0, 1, 2, 3), "secret", nil, 4096); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("reassembled stream: err = %v, equal = %v", err, bytes.Equal(got, data))
+	}
+
+	// A nil want accepts any error
+	tests := []struct {
+		name   string
+		stream []byte
+		want   error
+	}{
+		{"first two swapped", join(1, 0, 2, 3), ErrWrongPassword},
+		{"middle swapped", join(0, 2, 1, 3), nil},
+		{"chunk dropped", join(0, 2, 3), nil},
+		{"chunk repeated", join(0, 1, 1, 2, 3), nil},
+		{"final frame dropped", join(0, 1, 2), errTruncatedStream},
+		{"cut inside a frame", join(0, 1, 2, 3)[:len(sealed)-10], errTruncatedStream},
+		{"trailing bytes", append(join(0, 1, 2, 3), 0), errTrailingData},
+		{"trailing frame", join(0, 1, 2, 3, 3), errTrailingData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decryptStream(tt.stream, "secret", nil, 4096)
+			if err == nil {
+				t.Fatal("tampered stream decrypted without error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedStreamKDFIterations(t *testing.T) {
+	data := randomBytes(entryChunkSize + 10)
+	for _, iterations := range []int{1, 2500, DefaultKDFIterations + 1} {
+		t.Run(fmt.Sprint(iterations), func(t *testing.T) {
+			sealed := encryptStream(t, data, "secret", StreamOptions{KDFIterations: iterations}, len(data))
+
+			// The count is read back from the header, not passed in
+			header, err := readStreamHeader(bytes.NewReader(sealed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.iterations != uint32(iterations) {
+				t.Errorf("header records %d iterations, want %d", header.iterations, iterations)
+			}
+			got, err := decryptStream(sealed, "secret", nil, 4096)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("decrypted data differs")
+			}
+		})
+	}
+}
+
+func TestEncryptedStreamArgon2id(t *testing.T) {
+	data := randomBytes(2*entryChunkSize + 3)
+	sealed := encryptStream(t, data, "secret", StreamOptions{KDF: KDFArgon2id}, len(data))
+
+	header, err := readStreamHeader(bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := streamHeader{alg: algArgon2idAESGCM, time: argon2Time, memory: argon2Memory, threads: argon2Threads}
+	if header != want {
+		t.Errorf("header = %+v, want %+v", header, want)
+	}
+	got, err := decryptStream(sealed, "secret", nil, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decrypted data differs")
+	}
+	if _, err := decryptStream(sealed, "wrong", nil, 4096); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("wrong password: err = %v, want ErrWrongPassword", err)
+	}
+}
+
+func TestEncryptedStreamPBKDF2Versions(t *testing.T) {
+	data := randomBytes(entryChunkSize + 1)
+	sealed := encryptStream(t, data, "secret", StreamOptions{}, len(data))
+	v2 := pbkdf2Header(DefaultKDFIterations)
+	if !bytes.HasPrefix(sealed, v2) {
+		t.Fatalf("default stream starts %x, want the version 2 PBKDF2 header %x", sealed[:len(v2)], v2)
+	}
+	// Version 1 streams have no parameters and imply the default count
+	v1 := append([]byte(StreamMagic+"\x01\x01"), sealed[len(v2):]...)
+
+	for name, stream := range map[string][]byte{"version 1": v1, "version 2": sealed} {
+		got, err := decryptStream(stream, "secret", nil, 4096)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: decrypted data differs", name)
+		}
+	}
+}
+
+func TestEncryptedReaderWrongPassword(t *testing.T) {
+	for _, opts := range []StreamOptions{{}, {Cipher: CipherChaCha20Poly1305}} {
+		sealed := encryptStream(t, randomBytes(3*entryChunkSize), "secret", opts, entryChunkSize)
+		// The first frame is checked before the reader is returned
+		r, err := NewEncryptedReader(bytes.NewReader(sealed), "Secret", nil)
+		if !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("cipher %q: err = %v, want ErrWrongPassword", opts.Cipher, err)
+		}
+		if r != nil {
+			t.Errorf("cipher %q: got a reader for a wrong password", opts.Cipher)
+		}
+	}
+}
+
+func TestEncryptedStreamChaCha20Poly1305(t *testing.T) {
+	data := randomBytes(3*entryChunkSize + 7)
+	for _, kdf := range []string{KDFPBKDF2, KDFArgon2id} {
+		t.Run(kdf, func(t *testing.T) {
+			sealed := encryptStream(t, data, "secret", StreamOptions{KDF: kdf, Cipher: CipherChaCha20Poly1305}, 1000)
+
+			header, err := readStreamHeader(bytes.NewReader(sealed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The reader picks the cipher from the header
+			if header.alg != algPBKDF2ChaCha20Poly1305 && header.alg != algArgon2idChaCha20Poly1305 {
+				t.Errorf("header algorithm %d is not ChaCha20-Poly1305", header.alg)
+			}
+			got, err := decryptStream(sealed, "secret", nil, 333)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("decrypted data differs")
+			}
+		})
+	}
+}
+
+func BenchmarkEncryptedStream(b *testing.B) {
+	data := randomBytes(4 << 20)
+	for _, name := range []string{CipherAESGCM, CipherChaCha20Poly1305} {
+		opts := StreamOptions{Cipher: name, KDFIterations: 1}
+		b.Run("encrypt/"+name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				encryptStream(b, data, "secret", opts, entryChunkSize)
+			}
+		})
+		b.Run("decrypt/"+name, func(b *testing.B) {
+			sealed := encryptStream(b, data, "secret", opts, entryChunkSize)
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r, err := NewEncryptedReader(bytes.NewReader(sealed), "secret", nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptedStreamKeyfile(t *testing.T) {
+	data := randomBytes(entryChunkSize + 100)
+	key := randomBytes(64)
+	otherKey := randomBytes(65)
+
+	tests := []struct {
+		name            string
+		password        string
+		keyfile         []byte
+		readPassword    string
+		readKeyfile     []byte
+		wantErr         error
+		wantErrContains string
+	}{
+		{name: "password only", password: "secret", readPassword: "secret"},
+		{name: "keyfile only", keyfile: key, readKeyfile: key},
+		{name: "combined", password: "secret", keyfile: key, readPassword: "secret", readKeyfile: key},
+		{name: "wrong keyfile", keyfile: key, readKeyfile: otherKey, wantErr: ErrWrongPassword},
+		{name: "combined wrong keyfile", password: "secret", keyfile: key, readPassword: "secret", readKeyfile: otherKey, wantErr: ErrWrongPassword},
+		{name: "combined wrong password", password: "secret", keyfile: key, readPassword: "other", readKeyfile: key, wantErr: ErrWrongPassword},
+		{name: "combined without keyfile", password: "secret", keyfile: key, readPassword: "secret", wantErr: ErrKeyfileRequired},
+		{name: "combined keyfile without password", password: "secret", keyfile: key, readKeyfile: key, wantErr: ErrWrongPassword},
+		{name: "keyfile for a password stream", password: "secret", readPassword: "secret", readKeyfile: key, wantErrContains: "not encrypted with a keyfile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed := encryptStream(t, data, tt.password, StreamOptions{Keyfile: tt.keyfile}, len(data))
+			got, err := decryptStream(sealed, tt.readPassword, tt.readKeyfile, 4096)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantErrContains != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErrContains)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Error("decrypted data differs")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+// Package crypto provides encryption and decryption functionality
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	entrySaltSize  = 32
+	entryNonceSize = 12
+	entryTagSize   = 16
+	entryChunkSize = 64 * 1024
+
+	// maxEntrySalts bounds the distinct salts one EntryCipher derives keys
+	// for. gar seals an archive under one salt (merges keep one per
+	// source), and each new salt costs a full key stretch, so an archive
+	// with a salt per entry is refused rather than stretched for each.
+	maxEntrySalts = 64
+	// maxCachedKeys bounds the derived ciphers kept for reuse
+	maxCachedKeys = 16
+)
+
+// ErrTooManySalts is returned when an archive's entries are sealed under
+// more distinct salts than a genuine archive would use
+var ErrTooManySalts = errors.New("encrypted entries use too many distinct salts")
+
+// frameBuffers holds chunk buffers large enough for a sealed chunk, so
+// archives with many small encrypted entries do not allocate two frames
+// per entry. Buffers are cleared before they are put back.
+var frameBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, entryChunkSize+entryTagSize)
+		return &buf
+	},
+}
+
+// getFrame takes a chunk buffer from frameBuffers
+func getFrame() *[]byte {
+	return frameBuffers.Get().(*[]byte)
+}
+
+// putFrame clears buf and returns it to frameBuffers
+func putFrame(buf *[]byte) {
+	clear(*buf)
+	frameBuffers.Put(buf)
+}
+
+// ErrTruncatedEntry is returned when a sealed entry ends before its final
+// chunk
+var ErrTruncatedEntry = errors.New("encrypted entry is truncated")
+
+// EntryCipher seals and opens individual archive entries with AES-256-GCM
+// under a PBKDF2 key of DefaultKDFIterations. Sealed entries record no
+// parameters, so the StreamOptions of whole-archive encryption do not
+// apply. Entries sealed by one EntryCipher share a salt, so the password is
+// stretched once per archive. Each entry starts with the salt and a random
+// nonce and is split into chunks sealed under a counter-derived nonce. The
+// additional data of every chunk holds the entry name, so sealed content
+// cannot be moved to another entry, and marks the final chunk so
+// truncation is detected.
+type EntryCipher struct {
+	password string
+	salt     []byte
+
+	mu    sync.Mutex
+	aeads map[string]cipher.AEAD
+	// cached lists the keys of aeads, oldest first
+	cached []string
+	// salts records every salt a key was derived for
+	salts map[string]bool
+}
+
+// NewEntryCipher creates an EntryCipher with a fresh random salt
+func NewEntryCipher(password string) (*EntryCipher, error) {
+	salt := make([]byte, entrySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &EntryCipher{password: password, salt: salt, aeads: make(map[string]cipher.AEAD), salts: make(map[string]bool)}, nil
+}
+
+// aead returns the cipher for salt, deriving the key on first use
+func (c *EntryCipher) aead(salt []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gcm, ok := c.aeads[string(salt)]; ok {
+		return gcm, nil
+	}
+	if !c.salts[string(salt)] && len(c.salts) >= maxEntrySalts {
+		return nil, ErrTooManySalts
+	}
+	c.salts[string(salt)] = true
+
+	key := pbkdf2.Key([]byte(c.password), salt, DefaultKDFIterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.cached) >= maxCachedKeys {
+		delete(c.aeads, c.cached[0])
+		c.cached = c.cached[1:]
+	}
+	c.aeads[string(salt)] = gcm
+	c.cached = append(c.cached, string(salt))
+	return gcm, nil
+}
+
+// SealedSize returns the stored size of an entry with n plaintext bytes
+func SealedSize(n int64) int64 {
+	chunks := n/entryChunkSize + 1
+	return entrySaltSize + entryNonceSize + n + chunks*entryTagSize
+}
+
+// OpenedSize returns the plaintext size of a sealed entry of n bytes, or
+// -1 if n is not a valid sealed size
+func OpenedSize(n int64) int64 {
+	body := n - entrySaltSize - entryNonceSize
+	frame := int64(entryChunkSize + entryTagSize)
+	full, rest := body/frame, body%frame
+	if body < entryTagSize || rest < entryTagSize {
+		return -1
+	}
+	return full*entryChunkSize + rest - entryTagSize
+}
+
+// chunkNonce derives the nonce of chunk i from the entry's base nonce into
+// dst
+func chunkNonce(dst, base []byte, i uint64) []byte {
+	copy(dst, base)
+	counter := binary.BigEndian.Uint64(base[4:])
+	binary.BigEndian.PutUint64(dst[4:], counter^i)
+	return dst
+}
+
+// chunkAD marks whether a chunk is the last of an encrypted stream
+func chunkAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// entryAD returns the additional data for the chunks of the entry name:
+// a flag byte, set by markFinal for the last chunk, then the name
+func entryAD(name string) []byte {
+	return append([]byte{0}, name...)
+}
+
+// markFinal flags ad as that of the final chunk
+func markFinal(ad []byte) []byte {
+	ad[0] = 1
+	return ad
+}
+
+// Seal returns a writer that encrypts the content of the entry name to w.
+// The entry must be opened under the same name. Close must be called to
+// write the final chunk.
+func (c *EntryCipher) Seal(w io.Writer, name string) (io.WriteCloser, error) {
+	gcm, err := c.aead(c.salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, entryNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(c.salt); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(nonce); err != nil {
+		return nil, err
+	}
+
+	frame := getFrame()
+	return &entrySealer{w: w, gcm: gcm, nonce: nonce, ad: entryAD(name), frame: frame, buf: (*frame)[:0:entryChunkSize]}, nil
+}
+
+type entrySealer struct {
+	w     io.Writer
+	gcm   cipher.AEAD
+	nonce []byte
+	ad    []byte
+	// frame is the pooled buffer behind buf, with room for the tag so
+	// chunks are sealed in place; nil once the sealer is closed
+	frame      *[]byte
+	buf        []byte
+	chunk      uint64
+	chunkNonce [entryNonceSize]byte
+}
+
+func (s *entrySealer) Write(p []byte) (int, error) {
+	if s.frame == nil {
+		return 0, os.ErrClosed
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+
+		// Full chunks are sealed right away, so the final chunk is always
+		// short (possibly empty) and readers recognize it by its size
+		if len(s.buf) == entryChunkSize {
+			if err := s.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (s *entrySealer) flush(final bool) error {
+	nonce := chunkNonce(s.chunkNonce[:], s.nonce, s.chunk)
+	ad := s.ad
+	if final {
+		ad = markFinal(ad)
+	}
+	sealed := s.gcm.Seal((*s.frame)[:0], nonce, s.buf, ad)
+	s.chunk++
+	s.buf = (*s.frame)[:0:entryChunkSize]
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+// Close seals the final chunk and releases the chunk buffer
+func (s *entrySealer) Close() error {
+	if s.frame == nil {
+		return nil
+	}
+	err := s.flush(true)
+	putFrame(s.frame)
+	s.frame, s.buf = nil, nil
+	return err
+}
+
+// Open returns a reader that decrypts the sealed entry name from r
+func (c *EntryCipher) Open(r io.Reader, name string) (io.Reader, error) {
+	salt := make([]byte, entrySaltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, ErrTruncatedEntry
+	}
+	nonce := make([]byte, entryNonceSize)
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, ErrTruncatedEntry
+	}
+
+	gcm, err := c.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entryOpener{r: r, gcm: gcm, nonce: nonce, ad: entryAD(name), frame: getFrame()}, nil
+}
+
+type entryOpener struct {
+	r     io.Reader
+	gcm   cipher.AEAD
+	nonce []byte
+	ad    []byte
+	// frame is a pooled buffer, released once the final chunk is read.
+	// Readers abandoned early leave it to the garbage collector.
+	frame      *[]byte
+	plain      []byte
+	chunk      uint64
+	chunkNonce [entryNonceSize]byte
+	done       bool
+}
+
+func (o *entryOpener) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		if o.done {
+			if o.frame != nil {
+				putFrame(o.frame)
+				o.frame = nil
+			}
+			return 0, io.EOF
+		}
+		if err := o.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
+
+// next opens the following chunk. Only the final chunk is short.
+func (o *entryOpener) next() error {
+	frame := *o.frame
+	n, err := io.ReadFull(o.r, frame)
+	final := false
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		final = true
+	case err == io.EOF:
+		return ErrTruncatedEntry
+	case err != nil:
+		return err
+	}
+
+	nonce := chunkNonce(o.chunkNonce[:], o.nonce, o.chunk)
+	ad := o.ad
+	if final {
+		ad = markFinal(ad)
+	}
+	plain, err := o.gcm.Open(frame[:0], nonce, frame[:n], ad)
+	if err != nil {
+		return fmt.Errorf("decrypt entry: %w", err)
+	}
+	o.chunk++
+	o.plain = plain
+	o.done = final
+	return nil
+}
@@ -0,0 +1,188 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func sealEntry(t testing.TB, c *EntryCipher, name string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := c.Seal(&buf, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEntryCipherRoundTrip(t *testing.T) {
+	c, err := NewEntryCipher("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, entryChunkSize - 1, entryChunkSize, entryChunkSize + 1, 3*entryChunkSize + 17} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			content := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+			sealed := sealEntry(t, c, "dir/file.txt", content)
+			if int64(len(sealed)) != SealedSize(int64(size)) {
+				t.Errorf("sealed %d bytes, SealedSize says %d", len(sealed), SealedSize(int64(size)))
+			}
+			if OpenedSize(int64(len(sealed))) != int64(size) {
+				t.Errorf("OpenedSize = %d, want %d", OpenedSize(int64(len(sealed))), size)
+			}
+
+			r, err := c.Open(bytes.NewReader(sealed), "dir/file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Error("opened content differs")
+			}
+		})
+	}
+}
+
+func TestEntrySealerWriteAfterClose(t *testing.T) {
+	c, err := NewEntryCipher("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := c.Seal(&buf, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sealed := buf.Len()
+
+	for _, p := range [][]byte{nil, []byte("late"), make([]byte, 2*entryChunkSize)} {
+		if n, err := w.Write(p); n != 0 || !errors.Is(err, os.ErrClosed) {
+			t.Errorf("Write(%d bytes) after Close = %d, %v; want 0, os.ErrClosed", len(p), n, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+	if buf.Len() != sealed {
+		t.Errorf("%d bytes written after Close", buf.Len()-sealed)
+	}
+}
+
+func TestEntryCipherRejects(t *testing.T) {
+	c, err := NewEntryCipher("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("x"), 2*entryChunkSize+5)
+	sealed := sealEntry(t, c, "a.txt", content)
+	other, err := NewEntryCipher("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cipher *EntryCipher
+		entry  string
+		data   []byte
+	}{
+		{"other name", c, "b.txt", sealed},
+		{"wrong password", other, "a.txt", sealed},
+		{"truncated to whole chunks", c, "a.txt", sealed[:entrySaltSize+entryNonceSize+2*(entryChunkSize+entryTagSize)]},
+		{"truncated mid chunk", c, "a.txt", sealed[:len(sealed)-3]},
+		{"flipped byte", c, "a.txt", flip(sealed, entrySaltSize+entryNonceSize+100)},
+		{"header only", c, "a.txt", sealed[:entrySaltSize+entryNonceSize]},
+		{"short header", c, "a.txt", sealed[:10]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.cipher.Open(bytes.NewReader(tt.data), tt.entry)
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if err == nil {
+				t.Fatal("opened without error")
+			}
+		})
+	}
+}
+
+func flip(data []byte, i int) []byte {
+	out := bytes.Clone(data)
+	out[i] ^= 1
+	return out
+}
+
+func TestEntryCipherSaltLimits(t *testing.T) {
+	c, err := NewEntryCipher("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the cache with placeholders: deriving one more key evicts the
+	// oldest instead of growing it
+	for i := range maxCachedKeys {
+		salt := fmt.Sprintf("%032d", i)
+		c.aeads[salt] = nil
+		c.cached = append(c.cached, salt)
+		c.salts[salt] = true
+	}
+	if _, err := c.aead(c.salt); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.aeads) != maxCachedKeys || len(c.cached) != maxCachedKeys {
+		t.Errorf("cache holds %d keys, want %d", len(c.aeads), maxCachedKeys)
+	}
+	if _, ok := c.aeads[fmt.Sprintf("%032d", 0)]; ok {
+		t.Error("oldest key was not evicted")
+	}
+
+	// Once the salt budget is spent, new salts are refused before any key
+	// is derived, while known ones still open
+	for i := len(c.salts); i < maxEntrySalts; i++ {
+		c.salts[fmt.Sprintf("%032d", i)] = true
+	}
+	sealed := sealEntry(t, c, "a", []byte("content"))
+	fresh, err := NewEntryCipher("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Open(bytes.NewReader(sealEntry(t, fresh, "a", nil)), "a"); !errors.Is(err, ErrTooManySalts) {
+		t.Errorf("new salt: err = %v, want %v", err, ErrTooManySalts)
+	}
+	if _, err := c.Open(bytes.NewReader(sealed), "a"); err != nil {
+		t.Errorf("known salt: %v", err)
+	}
+}
+
+func FuzzEntryOpen(f *testing.F) {
+	c, err := NewEntryCipher("secret")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(sealEntry(f, c, "name", []byte("fuzz seed")))
+	f.Add(sealEntry(f, c, "name", bytes.Repeat([]byte{7}, entryChunkSize+3)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := c.Open(bytes.NewReader(data), "name")
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, r)
+	})
+}
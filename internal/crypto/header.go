@@ -0,0 +1,268 @@
+// Package crypto provides encryption and decryption functionality
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// StreamMagic starts every encrypted stream. It is followed by the format
+// version, the algorithm identifier, any flags and the algorithm's
+// parameters, then the salt and nonce.
+const StreamMagic = "GARC"
+
+// Header fields of the stream format. The algorithm identifier names the
+// key derivation and the cipher together. Version 1 streams carry no
+// parameters and always use DefaultKDFIterations. From version 2 the
+// parameters follow the algorithm identifier: the PBKDF2 iteration count
+// as a big-endian uint32, or for Argon2id the passes and memory (KiB) as
+// big-endian uint32s and the parallelism as one byte. Version 3 adds a
+// flags byte before the parameters; streams without flags are still
+// written as version 2.
+const (
+	streamVersion = 3
+	// algPBKDF2AESGCM is PBKDF2-SHA256 key derivation with AES-256-GCM
+	algPBKDF2AESGCM = 1
+	// algArgon2idAESGCM is Argon2id key derivation with AES-256-GCM
+	algArgon2idAESGCM = 2
+	// algPBKDF2ChaCha20Poly1305 is PBKDF2-SHA256 key derivation with
+	// ChaCha20-Poly1305
+	algPBKDF2ChaCha20Poly1305 = 3
+	// algArgon2idChaCha20Poly1305 is Argon2id key derivation with
+	// ChaCha20-Poly1305
+	algArgon2idChaCha20Poly1305 = 4
+)
+
+// flagKeyfile marks a stream whose key is derived from a keyfile as well
+// as the password
+const flagKeyfile = 1 << 0
+
+// Key derivation functions selectable in StreamOptions
+const (
+	KDFPBKDF2   = "pbkdf2"
+	KDFArgon2id = "argon2id"
+)
+
+// Ciphers selectable in StreamOptions. ChaCha20-Poly1305 is faster than
+// AES-GCM on CPUs without AES instructions.
+const (
+	CipherAESGCM           = "aes-gcm"
+	CipherChaCha20Poly1305 = "chacha20poly1305"
+)
+
+// DefaultKDFIterations is the PBKDF2 iteration count used when none is
+// configured
+const DefaultKDFIterations = 100000
+
+// MaxKDFIterations bounds the PBKDF2 iteration count of a stream, so a
+// crafted archive cannot keep a reader deriving a key for hours. It is a
+// hundred times the default, several seconds of work.
+const MaxKDFIterations = 100 * DefaultKDFIterations
+
+// Argon2id parameters of new streams
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	// argon2MaxTime and argon2MaxMemory bound the passes and memory (in
+	// KiB) a stream header may ask for, so a crafted archive cannot tie
+	// up the CPU or exhaust memory before the password is even checked
+	argon2MaxTime   = 16
+	argon2MaxMemory = 1024 * 1024
+)
+
+// StreamOptions configures the encryption NewEncryptedWriter applies.
+// Readers take every setting from the stream header.
+type StreamOptions struct {
+	// KDF is the key derivation function, KDFPBKDF2 (the default when
+	// empty) or KDFArgon2id
+	KDF string
+	// KDFIterations is the PBKDF2 iteration count; zero uses
+	// DefaultKDFIterations
+	KDFIterations int
+	// Cipher is the AEAD, CipherAESGCM (the default when empty) or
+	// CipherChaCha20Poly1305
+	Cipher string
+	// Keyfile is key material mixed into the key derivation; readers must
+	// be given the same
+	Keyfile []byte
+}
+
+// streamHeader is the decoded header of an encrypted stream
+type streamHeader struct {
+	alg        byte
+	keyfile    bool
+	iterations uint32
+	// Argon2id parameters
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// newStreamHeader returns the header of a new stream written with opts
+func newStreamHeader(opts StreamOptions) (streamHeader, error) {
+	var chacha bool
+	switch opts.Cipher {
+	case "", CipherAESGCM:
+	case CipherChaCha20Poly1305:
+		chacha = true
+	default:
+		return streamHeader{}, fmt.Errorf("unknown cipher %q: want %s or %s", opts.Cipher, CipherAESGCM, CipherChaCha20Poly1305)
+	}
+
+	h, err := newKDFHeader(opts)
+	if err != nil {
+		return streamHeader{}, err
+	}
+	if chacha {
+		if h.alg == algArgon2idAESGCM {
+			h.alg = algArgon2idChaCha20Poly1305
+		} else {
+			h.alg = algPBKDF2ChaCha20Poly1305
+		}
+	}
+	h.keyfile = len(opts.Keyfile) > 0
+	return h, nil
+}
+
+// newKDFHeader returns the AES-GCM header for the key derivation in opts
+func newKDFHeader(opts StreamOptions) (streamHeader, error) {
+	switch opts.KDF {
+	case "", KDFPBKDF2:
+		iterations := opts.KDFIterations
+		if iterations == 0 {
+			iterations = DefaultKDFIterations
+		}
+		if iterations < 1 || iterations > MaxKDFIterations {
+			return streamHeader{}, fmt.Errorf("invalid KDF iteration count %d: want 1-%d", iterations, MaxKDFIterations)
+		}
+		return streamHeader{alg: algPBKDF2AESGCM, iterations: uint32(iterations)}, nil
+	case KDFArgon2id:
+		if opts.KDFIterations != 0 {
+			return streamHeader{}, errors.New("KDF iterations apply to pbkdf2 only")
+		}
+		return streamHeader{alg: algArgon2idAESGCM, time: argon2Time, memory: argon2Memory, threads: argon2Threads}, nil
+	default:
+		return streamHeader{}, fmt.Errorf("unknown KDF %q: want %s or %s", opts.KDF, KDFPBKDF2, KDFArgon2id)
+	}
+}
+
+// argon2 reports whether the stream key is derived with Argon2id
+func (h streamHeader) argon2() bool {
+	return h.alg == algArgon2idAESGCM || h.alg == algArgon2idChaCha20Poly1305
+}
+
+// encode returns the header as written at the start of a stream
+func (h streamHeader) encode() []byte {
+	if !h.keyfile {
+		return h.appendParams(append([]byte(StreamMagic), 2, h.alg))
+	}
+	return h.appendParams(append([]byte(StreamMagic), streamVersion, h.alg, flagKeyfile))
+}
+
+// appendParams appends the key derivation parameters to b
+func (h streamHeader) appendParams(b []byte) []byte {
+	if h.argon2() {
+		b = binary.BigEndian.AppendUint32(b, h.time)
+		b = binary.BigEndian.AppendUint32(b, h.memory)
+		return append(b, h.threads)
+	}
+	return binary.BigEndian.AppendUint32(b, h.iterations)
+}
+
+// key derives the stream key from the password, keyfile and salt
+func (h streamHeader) key(password string, keyfile, salt []byte) []byte {
+	secret := kdfInput(password, keyfile)
+	if h.argon2() {
+		return argon2.IDKey(secret, salt, h.time, h.memory, h.threads, 32)
+	}
+	return pbkdf2.Key(secret, salt, int(h.iterations), 32, sha256.New)
+}
+
+// kdfInput is the password followed by the SHA-256 digest of the keyfile,
+// if any. The digest has a fixed length, so no two pairs give the same
+// input.
+func kdfInput(password string, keyfile []byte) []byte {
+	if len(keyfile) == 0 {
+		return []byte(password)
+	}
+	digest := sha256.Sum256(keyfile)
+	return append([]byte(password), digest[:]...)
+}
+
+// aead returns the stream cipher keyed with key
+func (h streamHeader) aead(key []byte) (cipher.AEAD, error) {
+	if h.alg == algPBKDF2ChaCha20Poly1305 || h.alg == algArgon2idChaCha20Poly1305 {
+		return chacha20poly1305.New(key)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readStreamHeader reads and checks the header of an encrypted stream
+func readStreamHeader(r io.Reader) (streamHeader, error) {
+	fixed := make([]byte, len(StreamMagic)+2)
+	if _, err := io.ReadFull(r, fixed); err != nil || string(fixed[:len(StreamMagic)]) != StreamMagic {
+		return streamHeader{}, ErrNotEncrypted
+	}
+
+	version, alg := fixed[len(StreamMagic)], fixed[len(StreamMagic)+1]
+	if version < 1 || version > streamVersion {
+		return streamHeader{}, fmt.Errorf("unsupported encryption version %d", version)
+	}
+	if version == 1 {
+		if alg != algPBKDF2AESGCM {
+			return streamHeader{}, fmt.Errorf("unsupported encryption algorithm %d", alg)
+		}
+		return streamHeader{alg: alg, iterations: DefaultKDFIterations}, nil
+	}
+
+	h := streamHeader{alg: alg}
+	if version >= 3 {
+		var flags [1]byte
+		if _, err := io.ReadFull(r, flags[:]); err != nil {
+			return streamHeader{}, errTruncatedStream
+		}
+		if flags[0]&^flagKeyfile != 0 {
+			return streamHeader{}, fmt.Errorf("unsupported encryption flags %#x", flags[0])
+		}
+		h.keyfile = flags[0]&flagKeyfile != 0
+	}
+	switch alg {
+	case algPBKDF2AESGCM, algPBKDF2ChaCha20Poly1305:
+		var params [4]byte
+		if _, err := io.ReadFull(r, params[:]); err != nil {
+			return streamHeader{}, errTruncatedStream
+		}
+		if h.iterations = binary.BigEndian.Uint32(params[:]); h.iterations == 0 || h.iterations > MaxKDFIterations {
+			return streamHeader{}, fmt.Errorf("invalid KDF iteration count %d: want 1-%d", h.iterations, MaxKDFIterations)
+		}
+	case algArgon2idAESGCM, algArgon2idChaCha20Poly1305:
+		var params [9]byte
+		if _, err := io.ReadFull(r, params[:]); err != nil {
+			return streamHeader{}, errTruncatedStream
+		}
+		h.time = binary.BigEndian.Uint32(params[0:])
+		h.memory = binary.BigEndian.Uint32(params[4:])
+		h.threads = params[8]
+		if h.time == 0 || h.time > argon2MaxTime || h.threads == 0 || h.memory > argon2MaxMemory {
+			return streamHeader{}, fmt.Errorf("invalid Argon2id parameters (time %d, memory %d KiB, threads %d)", h.time, h.memory, h.threads)
+		}
+	default:
+		return streamHeader{}, fmt.Errorf("unsupported encryption algorithm %d", alg)
+	}
+	return h, nil
+}
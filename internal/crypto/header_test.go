@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNewKDFHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		opts StreamOptions
+		want string
+	}{
+		{"default", StreamOptions{}, ""},
+		{"iterations", StreamOptions{KDFIterations: 1}, ""},
+		{"max iterations", StreamOptions{KDFIterations: MaxKDFIterations}, ""},
+		{"too many iterations", StreamOptions{KDFIterations: MaxKDFIterations + 1}, "invalid KDF iteration count"},
+		{"argon2id", StreamOptions{KDF: KDFArgon2id}, ""},
+		{"negative iterations", StreamOptions{KDFIterations: -1}, "invalid KDF iteration count"},
+		{"argon2id iterations", StreamOptions{KDF: KDFArgon2id, KDFIterations: 5}, "pbkdf2 only"},
+		{"unknown kdf", StreamOptions{KDF: "scrypt"}, "unknown KDF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newKDFHeader(tt.opts)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// pbkdf2Header is a version 2 PBKDF2 header with the given iteration count
+func pbkdf2Header(iterations uint32) []byte {
+	return streamHeader{alg: algPBKDF2AESGCM, iterations: iterations}.encode()
+}
+
+// argon2Header is a version 2 Argon2id header with the given parameters
+func argon2Header(time, memory uint32, threads uint8) []byte {
+	return streamHeader{alg: algArgon2idAESGCM, time: time, memory: memory, threads: threads}.encode()
+}
+
+func TestReadStreamHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"version 1", []byte(StreamMagic + "\x01\x01"), ""},
+		{"pbkdf2", pbkdf2Header(DefaultKDFIterations), ""},
+		{"pbkdf2 max", pbkdf2Header(MaxKDFIterations), ""},
+		{"pbkdf2 zero", pbkdf2Header(0), "invalid KDF iteration count 0"},
+		{"pbkdf2 too many", pbkdf2Header(MaxKDFIterations + 1), "invalid KDF iteration count"},
+		{"pbkdf2 max uint32", pbkdf2Header(math.MaxUint32), "invalid KDF iteration count"},
+		{"argon2id", argon2Header(argon2Time, argon2Memory, argon2Threads), ""},
+		{"argon2id max", argon2Header(argon2MaxTime, argon2MaxMemory, 255), ""},
+		{"argon2id too many passes", argon2Header(argon2MaxTime+1, argon2Memory, argon2Threads), "invalid Argon2id parameters"},
+		{"argon2id too much memory", argon2Header(argon2Time, argon2MaxMemory+1, argon2Threads), "invalid Argon2id parameters"},
+		{"argon2id no passes", argon2Header(0, argon2Memory, argon2Threads), "invalid Argon2id parameters"},
+		{"argon2id no threads", argon2Header(argon2Time, argon2Memory, 0), "invalid Argon2id parameters"},
+		{"truncated", pbkdf2Header(DefaultKDFIterations)[:7], "truncated"},
+		{"unknown algorithm", []byte(StreamMagic + "\x02\x09\x00\x00\x00\x01"), "unsupported encryption algorithm"},
+		{"unknown version", []byte(StreamMagic + "\x09\x01"), "unsupported encryption version"},
+		{"unknown flags", []byte(StreamMagic + "\x03\x01\x02\x00\x00\x00\x01"), "unsupported encryption flags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readStreamHeader(bytes.NewReader(tt.header))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzReadStreamHeader(f *testing.F) {
+	f.Add(pbkdf2Header(DefaultKDFIterations))
+	f.Add(argon2Header(argon2Time, argon2Memory, argon2Threads))
+	f.Add(streamHeader{alg: algPBKDF2ChaCha20Poly1305, keyfile: true, iterations: 1}.encode())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, err := readStreamHeader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// Whatever is accepted stays within the bounds and reads back the same
+		if h.argon2() {
+			if h.time == 0 || h.time > argon2MaxTime || h.memory > argon2MaxMemory || h.threads == 0 {
+				t.Fatalf("accepted Argon2id parameters %+v", h)
+			}
+		} else if h.iterations == 0 || h.iterations > MaxKDFIterations {
+			t.Fatalf("accepted %d iterations", h.iterations)
+		}
+		again, err := readStreamHeader(bytes.NewReader(h.encode()))
+		if err != nil {
+			t.Fatalf("re-reading %+v: %v", h, err)
+		}
+		if again != h {
+			t.Fatalf("header %+v reads back as %+v", h, again)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+// Package crypto provides encryption and decryption functionality
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringPrefix marks a password value that names an OS keyring entry
+// ("keyring:service/account") instead of holding the password itself
+const KeyringPrefix = "keyring:"
+
+// KeyringRef identifies a password stored in the OS keyring
+type KeyringRef struct {
+	Service string
+	Account string
+}
+
+// ParseKeyringRef parses a "keyring:service/account" password value. ok is
+// false when value does not start with KeyringPrefix.
+func ParseKeyringRef(value string) (ref KeyringRef, ok bool, err error) {
+	rest, ok := strings.CutPrefix(value, KeyringPrefix)
+	if !ok {
+		return KeyringRef{}, false, nil
+	}
+
+	service, account, found := strings.Cut(rest, "/")
+	if !found || service == "" || account == "" {
+		return KeyringRef{}, true, fmt.Errorf("invalid keyring reference %q: want keyring:service/account", value)
+	}
+	return KeyringRef{Service: service, Account: account}, true, nil
+}
+
+// String returns the reference in its "keyring:service/account" form
+func (r KeyringRef) String() string {
+	return KeyringPrefix + r.Service + "/" + r.Account
+}
+
+// KeyringPassword fetches the password stored under ref
+func KeyringPassword(ref KeyringRef) (string, error) {
+	password, err := keyring.Get(ref.Service, ref.Account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("no password stored at %s (store one with -save-password)", ref)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read keyring %s: %w", ref, err)
+	}
+	return password, nil
+}
+
+// SaveKeyringPassword stores password under ref, replacing any previous one
+func SaveKeyringPassword(ref KeyringRef, password string) error {
+	if err := keyring.Set(ref.Service, ref.Account, password); err != nil {
+		return fmt.Errorf("write keyring %s: %w", ref, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestParseKeyringRef(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    KeyringRef
+		ok      bool
+		wantErr bool
+	}{
+		{"plain password", KeyringRef{}, false, false},
+		{"keyring:gar/backup", KeyringRef{Service: "gar", Account: "backup"}, true, false},
+		{"keyring:gar/team/ops", KeyringRef{Service: "gar", Account: "team/ops"}, true, false},
+		{"keyring:gar", KeyringRef{}, true, true},
+		{"keyring:/backup", KeyringRef{}, true, true},
+		{"keyring:gar/", KeyringRef{}, true, true},
+		{"Keyring:gar/backup", KeyringRef{}, false, false},
+	}
+	for _, tt := range tests {
+		got, ok, err := ParseKeyringRef(tt.value)
+		if got != tt.want || ok != tt.ok || (err != nil) != tt.wantErr {
+			t.Errorf("ParseKeyringRef(%q) = %+v, %v, %v; want %+v, %v, error %v", tt.value, got, ok, err, tt.want, tt.ok, tt.wantErr)
+		}
+		if err == nil && ok && got.String() != tt.value {
+			t.Errorf("%+v.String() = %q, want %q", got, got.String(), tt.value)
+		}
+	}
+}
+
+func TestKeyringPassword(t *testing.T) {
+	keyring.MockInit()
+	ref := KeyringRef{Service: "gar-test", Account: "backup"}
+
+	_, err := KeyringPassword(ref)
+	if err == nil || !strings.Contains(err.Error(), "-save-password") {
+		t.Fatalf("missing entry: err = %v, want a -save-password hint", err)
+	}
+
+	for _, password := range []string{"first secret", "replaced"} {
+		if err := SaveKeyringPassword(ref, password); err != nil {
+			t.Fatal(err)
+		}
+		got, err := KeyringPassword(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != password {
+			t.Errorf("KeyringPassword = %q, want %q", got, password)
+		}
+	}
+
+	// Backend failures are wrapped, not reported as a missing entry
+	backendErr := errors.New("keyring locked")
+	keyring.MockInitWithError(backendErr)
+	if _, err := KeyringPassword(ref); !errors.Is(err, backendErr) {
+		t.Errorf("read: err = %v, want %v", err, backendErr)
+	}
+	if err := SaveKeyringPassword(ref, "x"); !errors.Is(err, backendErr) {
+		t.Errorf("write: err = %v, want %v", err, backendErr)
+	}
+}
@@ -0,0 +1,103 @@
+// Package crypto provides encryption and decryption functionality
+package crypto
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+// SignatureExt is appended to an archive path to name its detached
+// signature
+const SignatureExt = ".sig"
+
+// ErrBadSignature is returned when a signature does not match the archive
+var ErrBadSignature = errors.New("signature does not match")
+
+// signatureOptions selects Ed25519ph, which signs a SHA-512 digest so large
+// archives can be signed and verified without holding them in memory
+var signatureOptions = &ed25519.Options{Hash: crypto.SHA512}
+
+// NewSignatureHash returns the digest that signatures are computed over
+func NewSignatureHash() hash.Hash {
+	return sha512.New()
+}
+
+// LoadSigningKey reads a PEM-encoded PKCS #8 Ed25519 private key, as
+// written by `openssl genpkey -algorithm ed25519`
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", path)
+	}
+	return edKey, nil
+}
+
+// LoadVerifyKey reads a PEM-encoded PKIX Ed25519 public key, as written by
+// `openssl pkey -pubout`
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 public key", path)
+	}
+	return edKey, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s: no PEM %q block", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// SignDigest signs a digest produced by NewSignatureHash and returns the
+// signature encoded for a .sig file
+func SignDigest(key ed25519.PrivateKey, digest []byte) ([]byte, error) {
+	sig, err := key.Sign(nil, digest, signatureOptions)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// VerifyDigest checks the contents of a .sig file against a digest produced
+// by NewSignatureHash
+func VerifyDigest(key ed25519.PublicKey, digest, encoded []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("malformed signature")
+	}
+	if err := ed25519.VerifyWithOptions(key, digest, sig, signatureOptions); err != nil {
+		return ErrBadSignature
+	}
+	return nil
+}
@@ -1,12 +1,26 @@
 // Package models contains shared data structures and types
 package models
 
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/progress"
+)
+
 // ArchiveFormat defines the type of archive format
 type ArchiveFormat int
 
 const (
 	FormatZip ArchiveFormat = iota
 	FormatTarGz
+	FormatTarBz2
+	FormatSevenZip
+	FormatTarZstd
+	FormatTarXz
+	FormatTar
 )
 
 // CompressionLevel defines the compression intensity
@@ -16,27 +30,380 @@ const (
 	LevelFastest CompressionLevel = iota
 	LevelNormal
 	LevelBest
+	// LevelStore writes entries without compression
+	LevelStore
+	// LevelHuffman uses Huffman coding only, without match searching; it
+	// is fast and suits already-compressed payloads
+	LevelHuffman
+)
+
+// Codec names a compressor whose normal level can be overridden (see
+// ArchiveOptions.NormalLevels)
+type Codec string
+
+const (
+	// CodecFlate is the deflate of zip entries
+	CodecFlate Codec = "flate"
+	// CodecGzip is the gzip stream of tar.gz
+	CodecGzip Codec = "gzip"
+	// CodecZstd is the zstd stream of tar.zst
+	CodecZstd Codec = "zstd"
 )
 
+// WorkersAuto is the Workers value (as is anything below one) that lets
+// each operation pick its worker count from a sample of its workload
+const WorkersAuto = 0
+
+// Entry describes a single archive member as seen by an EntryFilter
+type Entry struct {
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+}
+
+// EntryFilter decides whether an entry is included and under which name.
+// Returning an empty newName keeps the original name.
+type EntryFilter func(Entry) (include bool, newName string)
+
 // ArchiveOptions holds configuration for archive operations
 type ArchiveOptions struct {
-	Format           ArchiveFormat
+	Format ArchiveFormat
+	// ForceFormat makes Format apply when reading archives too, instead of
+	// detecting the format from the extension or content
+	ForceFormat      bool
 	CompressionLevel CompressionLevel
-	Password         string
+	// CodecLevel is an exact codec level (e.g. 1-9 for deflate) that
+	// overrides CompressionLevel when non-zero
+	CodecLevel int
+	// NormalLevels sets the exact level each codec uses in place of the
+	// normal preset, when neither CodecLevel nor another preset is given
+	NormalLevels map[Codec]int
+	Password     string
+	// Workers is the number of parallel extraction workers; with
+	// WorkersAuto each operation picks a count from its own workload
 	Workers          int
 	Verbose          bool
+	EntryFilter      EntryFilter
+	AllowUnsafeLinks bool
+	MergePolicy      string
+	Stream           bool
+	TempDir          string
+	// PreserveBirthTime stores and restores file creation times (tar only)
+	PreserveBirthTime bool
+	// NoFollowRoot stores a symlinked input path as a symlink entry
+	NoFollowRoot bool
+	// DerefDepth limits how many symlinks of a chain at the input path
+	// are followed; a longer chain (or a loop) is stored as the link
+	// itself. Zero is unlimited.
+	DerefDepth int
+	// Progress receives progress events; nil disables reporting
+	Progress progress.Reporter
+	// Stats accumulates counts for the end-of-run summary; nil disables
+	// counting
+	Stats *RunStats
+	// Context, once done, stops compression before the next entry; the
+	// archive written so far is finalized as <output>.partial. nil never
+	// stops.
+	Context context.Context
+	// Pool runs the parallel work of extraction and verification; a batch
+	// shares one across its operations. nil gives each operation its own.
+	Pool *WorkerPool
+	// MaxRatio aborts zip extraction when the declared uncompressed size
+	// exceeds the archive size by more than this factor; 0 disables the
+	// check
+	MaxRatio int
+	// NoRecursion stores subdirectories of the input as entries without
+	// descending into them
+	NoRecursion bool
+	// FastGzip compresses tar.gz output with
+	// github.com/klauspost/compress/gzip
+	FastGzip bool
+	// ACLs stores and restores POSIX ACLs as PAX xattr records (tar only,
+	// Linux)
+	ACLs bool
+	// StripExtendedHeaders writes plain USTAR tar headers and fails on
+	// entries that need PAX or GNU extensions
+	StripExtendedHeaders bool
+	// Exclude holds glob patterns for input paths to skip when
+	// compressing
+	Exclude []string
+	// ExcludeBackups skips editor backup and OS metadata files when
+	// compressing
+	ExcludeBackups bool
+	// Manifest embeds a .gar-manifest entry with content digests of every
+	// file
+	Manifest bool
+	// Hash names the digest algorithm used for manifests and for Update
+	// comparisons against them (see DefaultHash)
+	Hash string
+	// ModTime, when non-zero, is stored as the modification time of every
+	// entry and of the gzip header for reproducible output
+	ModTime time.Time
+	// DryRun prints the extraction plan instead of writing files
+	DryRun bool
+	// JSON selects machine-readable JSON output where supported
+	JSON bool
+	// Sparse stores holes of files and zero runs of block devices as
+	// sparse tar entries and recreates holes on extract
+	Sparse bool
+	// Snapshot is a state file for incremental compression; only entries
+	// new or changed since it was written are archived, and it is updated
+	// afterwards
+	Snapshot string
+	// LowMemory reduces what the zip writer retains per entry (MS-DOS
+	// times only)
+	LowMemory bool
+	// EncryptPattern limits password encryption to regular files matching
+	// one of these patterns; other entries stay readable without the
+	// password
+	EncryptPattern []string
+	// SignKey is the path of a PEM Ed25519 private key; when set, a detached
+	// signature is written next to the archive
+	SignKey string
+	// RequireSignature refuses extraction unless the detached signature
+	// verifies against PublicKey
+	RequireSignature bool
+	// PublicKey is the path of the PEM Ed25519 public key for RequireSignature
+	PublicKey string
+	// AllowSymlinkOverwrite writes extracted files through symlinks
+	// already at their destination instead of replacing the links
+	AllowSymlinkOverwrite bool
+	// Update extracts only entries that are missing or newer than the
+	// existing destination file, or whose content digest differs from it
+	// when the archive has a manifest
+	Update bool
+	// Sync behaves like Update and then deletes everything under the output
+	// directory that the archive does not contain
+	Sync bool
+	// Index appends an entry index to tar.gz output and splits the gzip
+	// stream into independently readable members
+	Index bool
+	// CasePolicy handles extracted files whose names differ only in case
+	// ("error", "rename" or "skip"); empty disables the check
+	CasePolicy string
+	// RawTar treats the input as an existing tar stream and compresses it
+	// as-is instead of walking a directory
+	RawTar bool
+	// MaxDepth limits how many levels below the input directory are
+	// archived; directories at the limit are stored without their
+	// contents. Zero is unlimited.
+	MaxDepth int
+	// OrderFrom names a file listing entry names in the order they are
+	// written; entries it does not list follow, sorted by name
+	OrderFrom string
+	// Recover reads a damaged or truncated zip from its local headers and
+	// stops at the first unreadable entry instead of failing
+	Recover bool
+	// ParallelGzip decompresses tar.gz input with klauspost/pgzip, which
+	// inflates ahead of the reader in its own goroutine
+	ParallelGzip bool
+	// OnConflict handles extracted files whose destination exists
+	// ("overwrite" or "rename"); empty overwrites
+	OnConflict string
+	// RenameTemplate names files renamed by OnConflict; {name}, {ext} and
+	// {n} are replaced and the first free name is used
+	RenameTemplate string
+	// PreserveFlags stores file flags (chattr/chflags, e.g. immutable) in
+	// tar.gz archives and restores them after extraction
+	PreserveFlags bool
+	// TextConvert converts the line endings of files matching TextPattern
+	// while compressing or extracting ("lf" or "crlf"); empty disables it
+	TextConvert string
+	// TextPattern lists the glob patterns of files TextConvert applies to
+	TextPattern []string
+	// Umask holds permission bits cleared from the mode of every extracted
+	// file and directory
+	Umask os.FileMode
+	// Resume compresses through a journaled directory of parts next to the
+	// output and continues the run that left one behind
+	Resume bool
+	// PartSize is the amount of input written to each part of a Resume
+	// compress; zero uses the default
+	PartSize int64
+	// Serial extracts zip entries one at a time in archive order. Small
+	// archives are extracted this way regardless.
+	Serial bool
+	// PreserveOrder applies extraction side effects in archive order, so
+	// a later entry replaces an earlier one of the same name
+	PreserveOrder bool
+	// SkipEmpty leaves zero-length regular files out when compressing
+	SkipEmpty bool
+	// Strict makes list and extract fail when an archive's content is a
+	// different format than its extension names
+	Strict bool
+	// DoneMarker creates <output>.done after a successful compress and
+	// <output>/.gar-extracted after a successful extract, for watchers
+	DoneMarker bool
+	// Mmap writes extracted files of known size through a shared memory
+	// mapping of the output file, whose disk space is allocated first so a
+	// full disk fails the allocation rather than raising SIGBUS.
+	Mmap bool
+	// KDFIterations is the PBKDF2 iteration count for whole-archive
+	// encryption; zero uses the default. Readers take it from the archive.
+	KDFIterations int
+	// KDF is the key derivation function for whole-archive encryption
+	// ("pbkdf2" or "argon2id"); empty means PBKDF2. Readers take it from the
+	// archive.
+	KDF string
+	// Cipher is the AEAD for whole-archive encryption ("aes-gcm" or
+	// "chacha20poly1305"); empty means AES-GCM. Readers take it from the
+	// stream header.
+	Cipher string
+	// AttrRules names a file of "pattern mode=0644 uid=0 gid=0" lines
+	// whose attributes replace those of matching entries when compressing
+	AttrRules string
+	// Keyfile is key material mixed into the key derivation of
+	// whole-archive encryption, read from -keyfile
+	Keyfile []byte
+	// SymlinkFallback handles symlinks the filesystem cannot create
+	// ("error", "text" or "copy"); empty fails as "error" does
+	SymlinkFallback string
+	// Merkle records a Merkle root over the manifest digests in the manifest;
+	// it implies Manifest
+	Merkle bool
+	// MerkleRoot is a trusted hex Merkle root verify requires the manifest to
+	// record
+	MerkleRoot string
+}
+
+// RunStats counts what a run did with each entry. It is safe for
+// concurrent use.
+type RunStats struct {
+	// Files counts regular files added or extracted
+	Files atomic.Int64
+	// Skipped counts entries left out by filters, excludes or up-to-date
+	// checks
+	Skipped atomic.Int64
+	// Failed counts entries that could not be processed
+	Failed atomic.Int64
+	// Bytes is the content size of the counted files
+	Bytes atomic.Int64
+}
+
+// WorkerPool is a fixed set of goroutines that run submitted tasks. It
+// bounds the parallel work of everything sharing it, and its workers are
+// reused rather than started per task.
+type WorkerPool struct {
+	tasks chan func()
+	size  int
+}
+
+// NewWorkerPool starts a pool of size workers (at least one)
+func NewWorkerPool(size int) *WorkerPool {
+	p := &WorkerPool{tasks: make(chan func()), size: max(1, size)}
+	for range p.size {
+		go func() {
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Size returns the number of workers
+func (p *WorkerPool) Size() int {
+	return p.size
+}
+
+// Submit runs task on the next free worker, waiting until one is free.
+// Tasks must not submit to the same pool, which could leave every worker
+// waiting.
+func (p *WorkerPool) Submit(task func()) {
+	p.tasks <- task
+}
+
+// Close stops the workers once the submitted tasks are done
+func (p *WorkerPool) Close() {
+	close(p.tasks)
 }
 
 // CLIArgs contains parsed command-line arguments
 type CLIArgs struct {
-	Action      string
-	Input       string
-	Output      string
-	Format      string
-	Password    string
-	Compression string
-	Workers     int
-	Verbose     bool
-	Version     bool
-	Help        bool
+	Action                 string
+	Input                  string
+	Output                 string
+	Format                 string
+	Password               string
+	Compression            string
+	Workers                int
+	Verbose                bool
+	AllowUnsafeLinks       bool
+	MergePolicy            string
+	Stream                 bool
+	TempDir                string
+	PreserveBirthTime      bool
+	NoFollowRoot           bool
+	DerefDepth             int
+	Progress               string
+	Batch                  string
+	MaxRatio               int
+	NoRecursion            bool
+	FastGzip               bool
+	EmptyDirs              bool
+	ACLs                   bool
+	StripExtendedHeaders   bool
+	ExcludeBackups         bool
+	Exclude                string
+	Manifest               bool
+	Hash                   string
+	ModTime                string
+	DryRun                 bool
+	JSON                   bool
+	Sparse                 bool
+	Snapshot               string
+	LowMemory              bool
+	FormatSet              bool
+	EncryptPattern         string
+	SignKey                string
+	RequireSignature       bool
+	PublicKey              string
+	AllowSymlinkOverwrite  bool
+	ProgressInterval       time.Duration
+	Update                 bool
+	Sync                   bool
+	Index                  bool
+	Entry                  string
+	Transform              []string
+	CasePolicy             string
+	RawTar                 bool
+	MaxDepth               int
+	SavePassword           bool
+	Duplicates             bool
+	OrderFrom              string
+	Recover                bool
+	ParallelGzip           bool
+	OnConflict             string
+	RenameTemplate         string
+	BufferSize             string
+	PreserveFlags          bool
+	TextConvert            string
+	TextPattern            string
+	Umask                  string
+	Resume                 bool
+	PartSize               string
+	Serial                 bool
+	PreserveOrder          bool
+	SkipEmpty              bool
+	Strict                 bool
+	DoneMarker             bool
+	Mmap                   bool
+	KDFIterations          int
+	KDF                    string
+	ContinueOnDecryptError bool
+	PasswordStdin          bool
+	PasswordEnv            string
+	Cipher                 string
+	AttrRules              string
+	Keyfile                string
+	SymlinkFallback        string
+	Merkle                 bool
+	MerkleRoot             string
+	GzipLevel              int
+	ZstdLevel              int
+	FlateLevel             int
+	Version                bool
+	Help                   bool
 }
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	for _, size := range []int{0, 1, 3} {
+		pool := NewWorkerPool(size)
+
+		var running, peak, done atomic.Int32
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			pool.Submit(func() {
+				defer wg.Done()
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				running.Add(-1)
+				done.Add(1)
+			})
+		}
+		wg.Wait()
+		pool.Close()
+
+		if done.Load() != 20 {
+			t.Errorf("size %d: ran %d tasks, want 20", size, done.Load())
+		}
+		if int(peak.Load()) > pool.Size() {
+			t.Errorf("size %d: %d tasks ran at once, pool has %d workers", size, peak.Load(), pool.Size())
+		}
+	}
+}
+
+func TestWorkerPoolReusedAcrossRounds(t *testing.T) {
+	pool := NewWorkerPool(2)
+	defer pool.Close()
+
+	// A second round of work runs on the same workers as the first
+	for round := range 3 {
+		var wg sync.WaitGroup
+		var count atomic.Int32
+		for range 5 {
+			wg.Add(1)
+			pool.Submit(func() {
+				defer wg.Done()
+				count.Add(1)
+			})
+		}
+		wg.Wait()
+		if count.Load() != 5 {
+			t.Errorf("round %d ran %d tasks, want 5", round, count.Load())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package progress reports the progress of archive operations
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reporter receives progress notifications from archive operations.
+// Implementations must be safe for concurrent use.
+type Reporter interface {
+	// Start is called before an entry's content is copied
+	Start(name string, size int64)
+	// Add records n more bytes copied
+	Add(n int64)
+	// Done is called after an entry's content has been copied
+	Done(name string, bytes int64)
+	// Finish is called once the operation completes
+	Finish()
+}
+
+// New creates a reporter for the given mode writing to w, sampling
+// aggregate progress every interval (DefaultInterval when not positive).
+// An empty mode disables progress reporting and returns nil.
+func New(mode string, w io.Writer, interval time.Duration) (Reporter, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "json":
+		r := NewJSON(w)
+		if interval > 0 {
+			r.interval = interval
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown progress mode: %s", mode)
+	}
+}
+
+// Event is a single machine-readable progress event
+type Event struct {
+	Event   string `json:"event"`
+	Name    string `json:"name,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Bytes   int64  `json:"bytes"`
+	Entries int64  `json:"entries,omitempty"`
+}
+
+// DefaultInterval is how often aggregate progress is sampled and reported
+const DefaultInterval = 500 * time.Millisecond
+
+// MaxEntryEvents is how many entries per interval get "start" and "done"
+// events; the rest are only counted in the totals
+const MaxEntryEvents = 10
+
+// JSONReporter writes one JSON event per line: "start" and "done" for each
+// entry, periodic "progress" events with the running totals, and a final
+// "finish". Byte and entry counts are kept in atomic counters so parallel
+// workers never contend on a lock while copying; a single goroutine samples
+// them on a ticker. Per-entry events are limited to MaxEntryEvents entries
+// per interval, so trees of small files do not flood the output; an entry
+// whose "start" was written always gets its "done".
+type JSONReporter struct {
+	mu       sync.Mutex // guards enc and the fields below
+	enc      *json.Encoder
+	bytes    atomic.Int64
+	entries  atomic.Int64
+	interval time.Duration
+
+	// window is when the current interval of per-entry events began and
+	// windowEntries how many entries were reported in it
+	window        time.Time
+	windowEntries int
+	// started counts the reported entries by name until they are done
+	started map[string]int
+
+	startTicker sync.Once
+	stopTicker  sync.Once
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+// NewJSON creates a JSON lines reporter writing to w
+func NewJSON(w io.Writer) *JSONReporter {
+	return &JSONReporter{
+		enc:      json.NewEncoder(w),
+		interval: DefaultInterval,
+		started:  make(map[string]int),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// emit writes a single event
+func (r *JSONReporter) emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(e)
+}
+
+// Start emits a "start" event for an entry, unless the interval's entries
+// were already reported, and starts the sampling ticker on first use
+func (r *JSONReporter) Start(name string, size int64) {
+	r.startTicker.Do(func() { go r.sample() })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.window) >= r.interval {
+		r.window, r.windowEntries = now, 0
+	}
+	if r.windowEntries >= MaxEntryEvents {
+		return
+	}
+	r.windowEntries++
+	r.started[name]++
+	r.enc.Encode(Event{Event: "start", Name: name, Size: size})
+}
+
+// Add accumulates copied bytes
+func (r *JSONReporter) Add(n int64) {
+	r.bytes.Add(n)
+}
+
+// Done counts an entry and emits its "done" event if its start was
+// reported
+func (r *JSONReporter) Done(name string, bytes int64) {
+	r.entries.Add(1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch n := r.started[name]; n {
+	case 0:
+		return
+	case 1:
+		delete(r.started, name)
+	default:
+		r.started[name] = n - 1
+	}
+	r.enc.Encode(Event{Event: "done", Name: name, Bytes: bytes})
+}
+
+// Finish stops the ticker and emits the final totals
+func (r *JSONReporter) Finish() {
+	r.stopTicker.Do(func() {
+		close(r.stop)
+		// Only wait when the ticker goroutine was started
+		started := true
+		r.startTicker.Do(func() { started = false })
+		if started {
+			<-r.stopped
+		}
+	})
+	r.emit(Event{Event: "finish", Bytes: r.bytes.Load(), Entries: r.entries.Load()})
+}
+
+// sample emits a "progress" event every interval until Finish, skipping
+// ticks where nothing changed
+func (r *JSONReporter) sample() {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var lastBytes, lastEntries int64 = -1, -1
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			bytes, entries := r.bytes.Load(), r.entries.Load()
+			if bytes == lastBytes && entries == lastEntries {
+				continue
+			}
+			lastBytes, lastEntries = bytes, entries
+			r.emit(Event{Event: "progress", Bytes: bytes, Entries: entries})
+		}
+	}
+}
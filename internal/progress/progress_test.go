@@ -0,0 +1,193 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// events decodes the JSON lines written by a reporter
+func events(t *testing.T, data []byte) []Event {
+	t.Helper()
+	var out []Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", scanner.Text(), err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func countEvents(evs []Event) map[string]int {
+	counts := make(map[string]int)
+	for _, e := range evs {
+		counts[e.Event]++
+	}
+	return counts
+}
+
+func TestJSONReporterThrottlesEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		entries  int
+		reported int
+	}{
+		{"few entries", time.Hour, 5, 5},
+		{"many entries", time.Hour, 1000, MaxEntryEvents},
+		{"short interval", time.Nanosecond, 50, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			r, err := New("json", &buf, tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range tt.entries {
+				name := fmt.Sprintf("file%d", i)
+				r.Start(name, 10)
+				r.Add(10)
+				r.Done(name, 10)
+			}
+			r.Finish()
+
+			evs := events(t, buf.Bytes())
+			counts := countEvents(evs)
+			if counts["start"] != tt.reported || counts["done"] != tt.reported {
+				t.Errorf("%d starts and %d dones, want %d each", counts["start"], counts["done"], tt.reported)
+			}
+			last := evs[len(evs)-1]
+			if last.Event != "finish" || last.Entries != int64(tt.entries) || last.Bytes != int64(10*tt.entries) {
+				t.Errorf("final event %+v", last)
+			}
+		})
+	}
+}
+
+func TestJSONReporterPairsEvents(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := New("json", &buf, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries still open when the budget runs out keep their "done", and
+	// entries started after it never get one
+	var wg sync.WaitGroup
+	for i := range 4 * MaxEntryEvents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("file%d", i%7)
+			r.Start(name, 1)
+			r.Done(name, 1)
+		}()
+	}
+	wg.Wait()
+	r.Finish()
+
+	open := make(map[string]int)
+	for _, e := range events(t, buf.Bytes()) {
+		switch e.Event {
+		case "start":
+			open[e.Name]++
+		case "done":
+			if open[e.Name] == 0 {
+				t.Fatalf("done for %s without a start", e.Name)
+			}
+			open[e.Name]--
+		}
+	}
+	for name, n := range open {
+		if n != 0 {
+			t.Errorf("%s: %d starts without done", name, n)
+		}
+	}
+}
+
+func TestNewUnknownMode(t *testing.T) {
+	if r, err := New("", nil, 0); r != nil || err != nil {
+		t.Errorf("empty mode = %v, %v", r, err)
+	}
+	if _, err := New("bar", nil, 0); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for the reporter's goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// TestJSONReporterConcurrentTotals drives one reporter from many workers;
+// run with -race to check the counters
+func TestJSONReporterConcurrentTotals(t *testing.T) {
+	const workers, entriesPerWorker, chunks = 32, 50, 20
+
+	var out syncBuffer
+	r := NewJSON(&out)
+	r.interval = time.Millisecond
+
+	var wg sync.WaitGroup
+	var want int64
+	for w := range workers {
+		for e := range entriesPerWorker {
+			want += int64(chunks * (w + e + 1))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range entriesPerWorker {
+				name := fmt.Sprintf("w%d/e%d", w, e)
+				size := int64(chunks * (w + e + 1))
+				r.Start(name, size)
+				for range chunks {
+					r.Add(int64(w + e + 1))
+				}
+				r.Done(name, size)
+			}
+		}()
+	}
+	wg.Wait()
+	r.Finish()
+
+	evs := events(t, out.Bytes())
+	final := evs[len(evs)-1]
+	if final.Event != "finish" || final.Bytes != want || final.Entries != workers*entriesPerWorker {
+		t.Fatalf("final event %+v, want finish with %d bytes and %d entries", final, want, workers*entriesPerWorker)
+	}
+
+	// Sampled totals only grow
+	var lastBytes, lastEntries int64
+	for _, e := range evs {
+		if e.Event != "progress" {
+			continue
+		}
+		if e.Bytes < lastBytes || e.Entries < lastEntries || e.Bytes > want {
+			t.Fatalf("progress went from %d bytes, %d entries to %+v", lastBytes, lastEntries, e)
+		}
+		lastBytes, lastEntries = e.Bytes, e.Entries
+	}
+}
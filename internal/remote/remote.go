@@ -0,0 +1,84 @@
+// Package remote uploads finished archives to object storage and WebDAV
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/cubetiqlabs/gar/pkg/version"
+)
+
+// IsRemote reports whether path names a supported remote destination
+func IsRemote(path string) bool {
+	for _, scheme := range []string{"s3://", "dav://", "davs://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Upload sends the content of file (size bytes) to the remote destination
+func Upload(ctx context.Context, dest string, file io.ReadSeeker, size int64) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return fmt.Errorf("invalid remote output %q: %w", dest, err)
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return uploadS3(ctx, u, file)
+	case "dav", "davs":
+		return uploadDAV(ctx, u, file, size)
+	default:
+		return fmt.Errorf("unsupported remote scheme: %s", u.Scheme)
+	}
+}
+
+// uploadDAV PUTs the archive to a WebDAV server. Credentials come from the
+// URL or the GAR_DAV_USER / GAR_DAV_PASSWORD environment variables.
+func uploadDAV(ctx context.Context, u *url.URL, body io.ReadSeeker, size int64) error {
+	target := *u
+	target.Scheme = "http"
+	if u.Scheme == "davs" {
+		target.Scheme = "https"
+	}
+	target.User = nil
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	} else if user := os.Getenv("GAR_DAV_USER"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("GAR_DAV_PASSWORD"))
+	}
+
+	return send(req)
+}
+
+// send performs req and converts non-2xx responses into errors
+func send(req *http.Request) error {
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload to %s failed: %s %s", req.URL.Redacted(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
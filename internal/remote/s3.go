@@ -0,0 +1,81 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/cubetiqlabs/gar/pkg/version"
+)
+
+// defaultS3Region is used when neither the environment nor the shared AWS
+// config names a region
+const defaultS3Region = "us-east-1"
+
+// newS3Client builds an S3 client with credentials and region found the
+// standard AWS way: environment variables, the shared config and
+// credentials files, then instance or container roles. GAR_S3_ENDPOINT (or
+// AWS_ENDPOINT_URL) selects an S3-compatible endpoint, addressed
+// path-style as such services expect.
+func newS3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithAppID(version.Name))
+	if err != nil {
+		return nil, fmt.Errorf("s3 upload: load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultS3Region
+	}
+
+	endpoint := firstEnv("GAR_S3_ENDPOINT", "AWS_ENDPOINT_URL")
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// uploadS3 stores the archive with the SDK's upload manager, which sends
+// archives above the part size as a multipart upload of parts sent in
+// parallel, so the size is only bounded by S3 itself
+func uploadS3(ctx context.Context, u *url.URL, body io.Reader) error {
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return fmt.Errorf("s3 output must look like s3://bucket/key")
+	}
+
+	client, err := newS3Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	uploader := manager.NewUploader(client)
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String("application/octet-stream"),
+	})
+	if err != nil {
+		return fmt.Errorf("upload to s3://%s/%s failed: %w", bucket, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package sevenzip
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Method ids of the coders this package knows by name
+var methods = []struct {
+	id   []byte
+	name string
+}{
+	{[]byte{0x00}, "Copy"},
+	{[]byte{0x03}, "Delta"},
+	{[]byte{0x21}, "LZMA2"},
+	{[]byte{0x03, 0x01, 0x01}, "LZMA"},
+	{[]byte{0x03, 0x03, 0x01, 0x03}, "BCJ"},
+	{[]byte{0x03, 0x03, 0x01, 0x1b}, "BCJ2"},
+	{[]byte{0x03, 0x03, 0x02, 0x05}, "PPC"},
+	{[]byte{0x03, 0x03, 0x04, 0x01}, "IA64"},
+	{[]byte{0x03, 0x03, 0x05, 0x01}, "ARM"},
+	{[]byte{0x03, 0x03, 0x07, 0x01}, "ARMT"},
+	{[]byte{0x03, 0x03, 0x08, 0x05}, "SPARC"},
+	{[]byte{0x03, 0x04, 0x01}, "PPMD"},
+	{[]byte{0x04, 0x01, 0x08}, "Deflate"},
+	{[]byte{0x04, 0x01, 0x09}, "Deflate64"},
+	{[]byte{0x04, 0x02, 0x02}, "BZip2"},
+	{[]byte{0x04, 0xf7, 0x11, 0x01}, "Zstandard"},
+	{[]byte{0x06, 0xf1, 0x07, 0x01}, "AES"},
+}
+
+// methodName names a coder for error messages
+func methodName(id []byte) string {
+	for _, m := range methods {
+		if bytes.Equal(m.id, id) {
+			return m.name
+		}
+	}
+	return fmt.Sprintf("%x", id)
+}
+
+// newDecoder returns a reader decoding r with c into size bytes
+func newDecoder(c coder, r io.Reader, size uint64) (io.Reader, error) {
+	switch name := methodName(c.id); name {
+	case "Copy":
+		return r, nil
+	case "LZMA":
+		return newLZMAReader(c.props, r, size)
+	case "LZMA2":
+		return newLZMA2Reader(c.props, r, size)
+	case "Deflate":
+		return flate.NewReader(r), nil
+	case "BZip2":
+		return bzip2.NewReader(r), nil
+	case "BCJ":
+		return newBCJReader(r), nil
+	case "AES":
+		return nil, ErrEncrypted
+	default:
+		return nil, fmt.Errorf("sevenzip: unsupported compression method %s", name)
+	}
+}
+
+// dictSize bounds a dictionary size taken from the archive by the size of
+// the output, which it never needs to exceed, so a damaged header cannot
+// make the decoder allocate gigabytes for a small file
+func dictSize(stored uint32, size uint64) uint32 {
+	return uint32(max(min(uint64(stored), size), lzma.MinDictCap))
+}
+
+// newLZMAReader decodes LZMA. The coder properties are the first five
+// bytes of an .lzma header, which the reader takes with the size appended.
+func newLZMAReader(props []byte, r io.Reader, size uint64) (io.Reader, error) {
+	if len(props) != 5 {
+		return nil, ErrFormat
+	}
+	header := make([]byte, lzma.HeaderLen)
+	header[0] = props[0]
+	binary.LittleEndian.PutUint32(header[1:], dictSize(binary.LittleEndian.Uint32(props[1:]), size))
+	binary.LittleEndian.PutUint64(header[5:], size)
+	return lzma.NewReader(io.MultiReader(bytes.NewReader(header), r))
+}
+
+// newLZMA2Reader decodes LZMA2. Its one property byte encodes the
+// dictionary size.
+func newLZMA2Reader(props []byte, r io.Reader, size uint64) (io.Reader, error) {
+	if len(props) != 1 || props[0] > 40 {
+		return nil, ErrFormat
+	}
+	stored := uint32(0xffffffff)
+	if p := props[0]; p < 40 {
+		stored = (2 | uint32(p)&1) << (p/2 + 11)
+	}
+	return lzma.Reader2Config{DictCap: int(dictSize(stored, size))}.NewReader2(r)
+}
+
+// bcjReader undoes the x86 BCJ filter, which makes the targets of CALL
+// and JMP instructions absolute so repeated calls compress better
+type bcjReader struct {
+	r   io.Reader
+	buf []byte
+	// ready is filtered output not yet returned; tail follows it and may
+	// hold the start of an instruction
+	ready, tail []byte
+	// pos is the stream offset of the next byte to filter
+	pos      uint32
+	prevMask uint32
+	prevPos  uint32
+	err      error
+}
+
+func newBCJReader(r io.Reader) *bcjReader {
+	return &bcjReader{r: r, buf: make([]byte, 64<<10), prevPos: ^uint32(4)}
+}
+
+func (b *bcjReader) Read(p []byte) (int, error) {
+	for len(b.ready) == 0 {
+		if b.err != nil {
+			// Bytes too close to the end to hold an instruction pass as is
+			if len(b.tail) > 0 {
+				b.ready, b.tail = b.tail, nil
+				break
+			}
+			return 0, b.err
+		}
+
+		n := copy(b.buf, b.tail)
+		m, err := io.ReadFull(b.r, b.buf[n:])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		b.err = err
+		data := b.buf[:n+m]
+		k := b.filter(data)
+		b.ready, b.tail = data[:k], data[k:]
+	}
+
+	n := copy(p, b.ready)
+	b.ready = b.ready[n:]
+	return n, nil
+}
+
+// filter converts the CALL and JMP targets in data back to relative ones,
+// as xz's x86 filter does, and returns how many bytes are final
+func (b *bcjReader) filter(data []byte) int {
+	maskAllowed := [8]bool{true, true, true, false, true, false, false, false}
+	maskBit := [8]uint32{0, 1, 2, 2, 3, 3, 3, 3}
+	isMSByte := func(c byte) bool { return c == 0 || c == 0xff }
+
+	if len(data) < 5 {
+		return 0
+	}
+	if b.pos-b.prevPos > 5 {
+		b.prevPos = b.pos - 5
+	}
+
+	limit := len(data) - 5
+	i := 0
+	for i <= limit {
+		c := data[i]
+		if c != 0xe8 && c != 0xe9 {
+			i++
+			continue
+		}
+
+		offset := b.pos + uint32(i) - b.prevPos
+		b.prevPos = b.pos + uint32(i)
+		if offset > 5 {
+			b.prevMask = 0
+		} else {
+			for range offset {
+				b.prevMask &= 0x77
+				b.prevMask <<= 1
+			}
+		}
+
+		c = data[i+4]
+		if isMSByte(c) && maskAllowed[(b.prevMask>>1)&7] && b.prevMask>>1 < 0x10 {
+			src := binary.LittleEndian.Uint32(data[i+1:])
+			var dest uint32
+			for {
+				dest = src - (b.pos + uint32(i) + 5)
+				if b.prevMask == 0 {
+					break
+				}
+				j := maskBit[b.prevMask>>1]
+				if !isMSByte(byte(dest >> (24 - j*8))) {
+					break
+				}
+				src = dest ^ (1<<(32-j*8) - 1)
+			}
+			dest &= 0x01ffffff
+			if dest&0x01000000 != 0 {
+				dest |= 0xff000000
+			}
+			binary.LittleEndian.PutUint32(data[i+1:], dest)
+			i += 5
+			b.prevMask = 0
+		} else {
+			i++
+			b.prevMask |= 1
+			if isMSByte(c) {
+				b.prevMask |= 0x10
+			}
+		}
+	}
+
+	b.pos += uint32(i)
+	if b.err != nil {
+		// At the end nothing more can follow, so everything is final
+		b.pos += uint32(len(data) - i)
+		return len(data)
+	}
+	return i
+}
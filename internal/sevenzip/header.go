@@ -0,0 +1,570 @@
+package sevenzip
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"math"
+	"time"
+	"unicode/utf16"
+)
+
+// Property ids of the header
+const (
+	idEnd                   = 0x00
+	idHeader                = 0x01
+	idArchiveProperties     = 0x02
+	idAdditionalStreamsInfo = 0x03
+	idMainStreamsInfo       = 0x04
+	idFilesInfo             = 0x05
+	idPackInfo              = 0x06
+	idUnpackInfo            = 0x07
+	idSubStreamsInfo        = 0x08
+	idSize                  = 0x09
+	idCRC                   = 0x0a
+	idFolder                = 0x0b
+	idCodersUnpackSize      = 0x0c
+	idNumUnpackStream       = 0x0d
+	idEmptyStream           = 0x0e
+	idEmptyFile             = 0x0f
+	idAnti                  = 0x10
+	idName                  = 0x11
+	idMTime                 = 0x14
+	idWinAttributes         = 0x15
+	idEncodedHeader         = 0x17
+)
+
+// headerReader decodes header fields from buf. The first error sticks:
+// once set, every read returns zero values, so fields can be read in a
+// row and err checked afterwards.
+type headerReader struct {
+	buf []byte
+	err error
+}
+
+func (h *headerReader) fail() {
+	if h.err == nil {
+		h.err = ErrFormat
+	}
+	h.buf = nil
+}
+
+func (h *headerReader) byte() byte {
+	if len(h.buf) == 0 {
+		h.fail()
+		return 0
+	}
+	b := h.buf[0]
+	h.buf = h.buf[1:]
+	return b
+}
+
+func (h *headerReader) bytes(n uint64) []byte {
+	if n > uint64(len(h.buf)) {
+		h.fail()
+		return nil
+	}
+	b := h.buf[:n]
+	h.buf = h.buf[n:]
+	return b
+}
+
+func (h *headerReader) uint32() uint32 {
+	if b := h.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (h *headerReader) uint64() uint64 {
+	if b := h.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// number reads a variable-length integer: the count of leading one bits
+// in the first byte gives the number of little-endian bytes that follow,
+// and the rest of the first byte holds the highest bits
+func (h *headerReader) number() uint64 {
+	first := h.byte()
+	var v uint64
+	mask := byte(0x80)
+	for i := range 8 {
+		if first&mask == 0 {
+			return v | uint64(first&(mask-1))<<(8*i)
+		}
+		v |= uint64(h.byte()) << (8 * i)
+		mask >>= 1
+	}
+	return v
+}
+
+// count reads the number of items that follow. Every item takes at least
+// a byte, so a count beyond the remaining header is corrupt, and refusing
+// it keeps a damaged header from allocating without bound.
+func (h *headerReader) count() int {
+	n := h.number()
+	if n > uint64(len(h.buf)) {
+		h.fail()
+		return 0
+	}
+	return int(n)
+}
+
+// bits reads a vector of n bits, most significant bit first
+func (h *headerReader) bits(n int) []bool {
+	packed := h.bytes(uint64(n+7) / 8)
+	v := make([]bool, n)
+	if packed == nil {
+		return v
+	}
+	for i := range v {
+		v[i] = packed[i/8]&(0x80>>(i%8)) != 0
+	}
+	return v
+}
+
+// optionalBits reads a vector of n bits preceded by a flag that, when set,
+// means every bit is set and the vector is left out
+func (h *headerReader) optionalBits(n int) []bool {
+	if h.byte() == 0 {
+		return h.bits(n)
+	}
+	v := make([]bool, n)
+	for i := range v {
+		v[i] = true
+	}
+	return v
+}
+
+// digests reads n optional CRC-32 values
+func (h *headerReader) digests(n int) ([]bool, []uint32) {
+	defined := h.optionalBits(n)
+	crcs := make([]uint32, n)
+	for i, ok := range defined {
+		if ok {
+			crcs[i] = h.uint32()
+		}
+	}
+	return defined, crcs
+}
+
+// streamsInfo describes the packed streams of an archive, the folders
+// that decode them and the files each folder holds
+type streamsInfo struct {
+	packPos   uint64
+	packSizes []uint64
+	folders   []*folder
+}
+
+func (h *headerReader) streamsInfo() *streamsInfo {
+	si := &streamsInfo{}
+	id := h.byte()
+	if id == idPackInfo {
+		h.packInfo(si)
+		id = h.byte()
+	}
+	if id == idUnpackInfo {
+		h.unpackInfo(si)
+		id = h.byte()
+	}
+	if id == idSubStreamsInfo {
+		h.subStreamsInfo(si)
+		id = h.byte()
+	} else {
+		for _, f := range si.folders {
+			f.streams = []subStream{{size: f.unpackSize(), crc: f.crc, hasCRC: f.hasCRC}}
+		}
+	}
+	if id != idEnd {
+		h.fail()
+	}
+
+	// Folders use the packed streams in order
+	offset, next := si.packPos, 0
+	for _, f := range si.folders {
+		f.packOffset = offset
+		for range f.packedStreams {
+			if next >= len(si.packSizes) {
+				h.fail()
+				return si
+			}
+			f.packSizes = append(f.packSizes, si.packSizes[next])
+			offset += si.packSizes[next]
+			next++
+		}
+	}
+	return si
+}
+
+func (h *headerReader) packInfo(si *streamsInfo) {
+	si.packPos = h.number()
+	n := h.count()
+	id := h.byte()
+	if id == idSize {
+		si.packSizes = make([]uint64, n)
+		for i := range si.packSizes {
+			si.packSizes[i] = h.number()
+		}
+		id = h.byte()
+	}
+	if id == idCRC {
+		h.digests(n)
+		id = h.byte()
+	}
+	if id != idEnd {
+		h.fail()
+	}
+}
+
+func (h *headerReader) unpackInfo(si *streamsInfo) {
+	if h.byte() != idFolder {
+		h.fail()
+		return
+	}
+	n := h.count()
+	// Folders stored in another stream are not supported
+	if h.byte() != 0 {
+		h.fail()
+		return
+	}
+	si.folders = make([]*folder, n)
+	for i := range si.folders {
+		si.folders[i] = h.folder()
+	}
+
+	if h.byte() != idCodersUnpackSize {
+		h.fail()
+		return
+	}
+	for _, f := range si.folders {
+		f.unpackSizes = make([]uint64, f.numOut())
+		for i := range f.unpackSizes {
+			f.unpackSizes[i] = h.number()
+		}
+	}
+
+	id := h.byte()
+	if id == idCRC {
+		defined, crcs := h.digests(n)
+		for i, f := range si.folders {
+			f.hasCRC, f.crc = defined[i], crcs[i]
+		}
+		id = h.byte()
+	}
+	if id != idEnd {
+		h.fail()
+	}
+}
+
+func (h *headerReader) folder() *folder {
+	f := &folder{}
+	f.coders = make([]coder, h.count())
+	for i := range f.coders {
+		flags := h.byte()
+		c := coder{id: h.bytes(uint64(flags & 0x0f)), numIn: 1, numOut: 1}
+		if flags&0x10 != 0 {
+			c.numIn, c.numOut = h.count(), h.count()
+		}
+		if flags&0x20 != 0 {
+			c.props = h.bytes(h.number())
+		}
+		// Alternative methods were never used by any encoder
+		if flags&0x80 != 0 {
+			h.fail()
+		}
+		f.coders[i] = c
+	}
+
+	numIn, numOut := f.numIn(), f.numOut()
+	if numOut == 0 || numIn < numOut-1 {
+		h.fail()
+		return f
+	}
+	f.bindPairs = make([]bindPair, numOut-1)
+	for i := range f.bindPairs {
+		f.bindPairs[i] = bindPair{in: h.number(), out: h.number()}
+	}
+
+	numPacked := numIn - len(f.bindPairs)
+	if numPacked == 1 {
+		for i := range numIn {
+			if f.bindPairForIn(uint64(i)) < 0 {
+				f.packedStreams = []uint64{uint64(i)}
+				break
+			}
+		}
+	} else {
+		f.packedStreams = make([]uint64, numPacked)
+		for i := range f.packedStreams {
+			f.packedStreams[i] = h.number()
+		}
+	}
+	return f
+}
+
+func (h *headerReader) subStreamsInfo(si *streamsInfo) {
+	counts := make([]int, len(si.folders))
+	for i := range counts {
+		counts[i] = 1
+	}
+
+	id := h.byte()
+	if id == idNumUnpackStream {
+		for i := range counts {
+			counts[i] = h.count()
+		}
+		id = h.byte()
+	}
+
+	// Every stream but the last of each folder has its size stored; the
+	// last one takes the rest of the folder
+	for i, f := range si.folders {
+		if counts[i] == 0 {
+			continue
+		}
+		if counts[i] > 1 && id != idSize {
+			h.fail()
+			return
+		}
+		f.streams = make([]subStream, counts[i])
+		var sum uint64
+		for j := range counts[i] - 1 {
+			f.streams[j].size = h.number()
+			sum += f.streams[j].size
+		}
+		total := f.unpackSize()
+		if sum > total {
+			h.fail()
+			return
+		}
+		f.streams[counts[i]-1].size = total - sum
+	}
+	if id == idSize {
+		id = h.byte()
+	}
+
+	// A folder holding one stream shares its CRC; the rest are listed
+	unknown := 0
+	for i, f := range si.folders {
+		if counts[i] == 1 && f.hasCRC {
+			f.streams[0].crc, f.streams[0].hasCRC = f.crc, true
+		} else {
+			unknown += counts[i]
+		}
+	}
+	for id != idEnd && h.err == nil {
+		if id == idCRC {
+			defined, crcs := h.digests(unknown)
+			k := 0
+			for i, f := range si.folders {
+				if counts[i] == 1 && f.hasCRC {
+					continue
+				}
+				for j := range f.streams {
+					f.streams[j].crc, f.streams[j].hasCRC = crcs[k], defined[k]
+					k++
+				}
+			}
+		} else {
+			h.bytes(h.number())
+		}
+		id = h.byte()
+	}
+}
+
+// files reads the file list, assigning the streams of si to the files
+// that have content
+func (h *headerReader) files(si *streamsInfo) []*File {
+	n := h.count()
+	files := make([]*File, n)
+	for i := range files {
+		files[i] = &File{folder: -1}
+	}
+
+	var emptyStream, emptyFile, anti []bool
+	var attrs []uint32
+	var hasAttr []bool
+	for h.err == nil {
+		t := h.byte()
+		if t == idEnd {
+			break
+		}
+		p := &headerReader{buf: h.bytes(h.number())}
+
+		switch t {
+		case idEmptyStream:
+			// The empty-file and anti vectors are sized by this one, so it
+			// must come first and only once
+			if emptyStream != nil {
+				p.fail()
+				break
+			}
+			emptyStream = p.bits(n)
+		case idEmptyFile, idAnti:
+			if emptyStream == nil || (t == idEmptyFile && emptyFile != nil) || (t == idAnti && anti != nil) {
+				p.fail()
+				break
+			}
+			empty := 0
+			for _, ok := range emptyStream {
+				if ok {
+					empty++
+				}
+			}
+			if t == idEmptyFile {
+				emptyFile = p.bits(empty)
+			} else {
+				anti = p.bits(empty)
+			}
+		case idName:
+			if p.byte() != 0 {
+				p.fail()
+			}
+			names := p.names(n)
+			for i, name := range names {
+				files[i].Name = name
+			}
+		case idMTime:
+			defined := p.optionalBits(n)
+			if p.byte() != 0 {
+				p.fail()
+			}
+			for i, ok := range defined {
+				if ok {
+					files[i].Modified = filetime(p.uint64())
+				}
+			}
+		case idWinAttributes:
+			hasAttr = p.optionalBits(n)
+			if p.byte() != 0 {
+				p.fail()
+			}
+			attrs = make([]uint32, n)
+			for i, ok := range hasAttr {
+				if ok {
+					attrs[i] = p.uint32()
+				}
+			}
+		}
+		if p.err != nil {
+			h.err = p.err
+		}
+	}
+	if h.err != nil {
+		return nil
+	}
+
+	var streams []streamRef
+	for i, f := range si.folders {
+		for j := range f.streams {
+			streams = append(streams, streamRef{folder: i, index: j})
+		}
+	}
+
+	kept := files[:0]
+	next, empty := 0, 0
+	for i, f := range files {
+		isDir := false
+		if emptyStream != nil && emptyStream[i] {
+			// Anti items mark deletions in update archives
+			isAnti := anti != nil && anti[empty]
+			isDir = emptyFile == nil || !emptyFile[empty]
+			empty++
+			if isAnti {
+				continue
+			}
+		} else {
+			if next >= len(streams) {
+				h.fail()
+				return nil
+			}
+			ref := streams[next]
+			s := si.folders[ref.folder].streams[ref.index]
+			if s.size > math.MaxInt64 {
+				h.fail()
+				return nil
+			}
+			f.folder, f.Size, f.crc, f.hasCRC = ref.folder, int64(s.size), s.crc, s.hasCRC
+			next++
+		}
+
+		var attr uint32
+		if hasAttr != nil && hasAttr[i] {
+			attr = attrs[i]
+		}
+		f.Mode = fileMode(attr, isDir)
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// streamRef locates one file's content
+type streamRef struct {
+	folder int
+	index  int
+}
+
+// names reads n NUL-terminated UTF-16LE names
+func (h *headerReader) names(n int) []string {
+	names := make([]string, 0, n)
+	var name []uint16
+	for len(names) < n && h.err == nil {
+		b := h.bytes(2)
+		if b == nil {
+			break
+		}
+		c := binary.LittleEndian.Uint16(b)
+		if c == 0 {
+			names = append(names, string(utf16.Decode(name)))
+			name = name[:0]
+			continue
+		}
+		name = append(name, c)
+	}
+	if len(names) < n {
+		h.fail()
+	}
+	return names
+}
+
+// Windows file attributes, with the Unix mode in the high 16 bits when
+// attrUnixExtension is set
+const (
+	attrReadOnly      = 0x01
+	attrDirectory     = 0x10
+	attrUnixExtension = 0x8000
+)
+
+// fileMode derives the mode of a file from its attributes
+func fileMode(attr uint32, isDir bool) fs.FileMode {
+	if attr&attrUnixExtension != 0 {
+		unix := attr >> 16
+		mode := fs.FileMode(unix & 0777)
+		switch unix & 0170000 {
+		case 0040000:
+			mode |= fs.ModeDir
+		case 0120000:
+			mode |= fs.ModeSymlink
+		}
+		if isDir {
+			mode |= fs.ModeDir
+		}
+		return mode
+	}
+
+	if isDir || attr&attrDirectory != 0 {
+		return fs.ModeDir | 0755
+	}
+	if attr&attrReadOnly != 0 {
+		return 0444
+	}
+	return 0644
+}
+
+// filetime converts a Windows FILETIME, in 100 ns intervals since 1601
+func filetime(ft uint64) time.Time {
+	const epochDelta = 116444736000000000
+	d := int64(ft) - epochDelta
+	return time.Unix(d/1e7, d%1e7*100).UTC()
+}
@@ -0,0 +1,440 @@
+// Package sevenzip reads 7z archives. Content stored or compressed with
+// LZMA, LZMA2, Deflate or BZip2, optionally behind the x86 BCJ filter, can
+// be read; encrypted archives and other methods are reported by name.
+// Writing is not supported.
+package sevenzip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrFormat is returned for data that is not a valid 7z archive
+	ErrFormat = errors.New("sevenzip: not a valid 7z archive")
+	// ErrChecksum is returned when content does not match its CRC
+	ErrChecksum = errors.New("sevenzip: checksum error")
+	// ErrEncrypted is returned for archives encrypted with 7-Zip's AES
+	ErrEncrypted = errors.New("sevenzip: encrypted 7z archives are not supported")
+)
+
+// Signature starts every 7z archive
+var Signature = []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}
+
+// signatureHeaderSize is the size of the fixed header holding the
+// signature and the location of the archive header
+const signatureHeaderSize = 32
+
+// maxHeaderSize bounds the decoded archive header
+const maxHeaderSize = 256 << 20
+
+// File is an entry of a 7z archive
+type File struct {
+	Name     string
+	Size     int64
+	Mode     fs.FileMode
+	Modified time.Time
+
+	// folder is the index of the folder holding the content, or -1 for
+	// directories and empty files
+	folder int
+	crc    uint32
+	hasCRC bool
+}
+
+// Reader reads the entries of a 7z archive
+type Reader struct {
+	File []*File
+
+	r       io.ReaderAt
+	size    int64
+	folders []*folder
+}
+
+// ReadCloser is a Reader over a file that must be closed
+type ReadCloser struct {
+	Reader
+	f *os.File
+}
+
+// OpenReader opens the 7z archive at name
+func OpenReader(name string) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	rc := &ReadCloser{f: f}
+	if err := rc.init(f, info.Size()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Close closes the archive file
+func (rc *ReadCloser) Close() error {
+	return rc.f.Close()
+}
+
+// NewReader reads the 7z archive of size bytes in r
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	z := &Reader{}
+	if err := z.init(r, size); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *Reader) init(r io.ReaderAt, size int64) error {
+	z.r, z.size = r, size
+
+	var sh [signatureHeaderSize]byte
+	if _, err := r.ReadAt(sh[:], 0); err != nil {
+		return ErrFormat
+	}
+	if !bytes.Equal(sh[:len(Signature)], Signature) {
+		return ErrFormat
+	}
+	if crc32.ChecksumIEEE(sh[12:]) != binary.LittleEndian.Uint32(sh[8:]) {
+		return ErrChecksum
+	}
+
+	offset := binary.LittleEndian.Uint64(sh[12:])
+	length := binary.LittleEndian.Uint64(sh[20:])
+	if length == 0 {
+		// An archive without entries
+		return nil
+	}
+	avail := uint64(size - signatureHeaderSize)
+	if offset > avail || length > avail-offset || length > maxHeaderSize {
+		return ErrFormat
+	}
+	buf := make([]byte, length)
+	if _, err := r.ReadAt(buf, signatureHeaderSize+int64(offset)); err != nil {
+		return ErrFormat
+	}
+	if crc32.ChecksumIEEE(buf) != binary.LittleEndian.Uint32(sh[28:]) {
+		return ErrChecksum
+	}
+
+	// The header is usually compressed itself, as the content of a folder
+	// described by an encoded header
+	for {
+		h := &headerReader{buf: buf}
+		switch h.byte() {
+		case idHeader:
+			return z.readHeader(h)
+		case idEncodedHeader:
+			si := h.streamsInfo()
+			if h.err != nil {
+				return h.err
+			}
+			var err error
+			if buf, err = z.decodeHeader(si); err != nil {
+				return err
+			}
+		default:
+			return ErrFormat
+		}
+	}
+}
+
+// readHeader reads the file list and the streams holding the content
+func (z *Reader) readHeader(h *headerReader) error {
+	id := h.byte()
+	if id == idArchiveProperties {
+		for h.err == nil && h.byte() != idEnd {
+			h.bytes(h.number())
+		}
+		id = h.byte()
+	}
+	if id == idAdditionalStreamsInfo {
+		h.streamsInfo()
+		id = h.byte()
+	}
+	si := &streamsInfo{}
+	if id == idMainStreamsInfo {
+		si = h.streamsInfo()
+		id = h.byte()
+	}
+	if id == idFilesInfo {
+		z.File = h.files(si)
+		id = h.byte()
+	}
+	if id != idEnd {
+		h.fail()
+	}
+	if h.err != nil {
+		return h.err
+	}
+
+	z.folders = si.folders
+	return nil
+}
+
+// decodeHeader decodes the header held in the folders of si
+func (z *Reader) decodeHeader(si *streamsInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, f := range si.folders {
+		if f.unpackSize() > maxHeaderSize-uint64(buf.Len()) {
+			return nil, ErrFormat
+		}
+		r, err := z.folderReader(f)
+		if err != nil {
+			return nil, err
+		}
+		h := crc32.NewIEEE()
+		if _, err := io.Copy(io.MultiWriter(&buf, h), r); err != nil {
+			return nil, err
+		}
+		if f.hasCRC && h.Sum32() != f.crc {
+			return nil, ErrChecksum
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Walk calls fn for every entry in archive order. r reads the content of
+// files and symlinks, and is nil for directories and empty files; it is
+// only valid during the call. Solid archives compress many files as one
+// stream, so reading them in order is much cheaper than one at a time.
+// Content fn leaves unread is skipped, and every file's CRC is checked.
+func (z *Reader) Walk(fn func(f *File, r io.Reader) error) error {
+	var folder io.Reader
+	current := -1
+	for _, f := range z.File {
+		if f.folder < 0 {
+			if err := fn(f, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if f.folder != current {
+			var err error
+			if folder, err = z.folderReader(z.folders[f.folder]); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			current = f.folder
+		}
+
+		h := crc32.NewIEEE()
+		content := &io.LimitedReader{R: io.TeeReader(namedReader{folder, f.Name}, h), N: f.Size}
+		if err := fn(f, content); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if content.N > 0 {
+			return fmt.Errorf("%s: %w", f.Name, io.ErrUnexpectedEOF)
+		}
+		if f.hasCRC && h.Sum32() != f.crc {
+			return fmt.Errorf("%s: %w", f.Name, ErrChecksum)
+		}
+	}
+	return nil
+}
+
+// Methods lists the distinct coder chains of the archive's folders, each
+// written as 7-Zip shows them, e.g. "LZMA2 BCJ"
+func (z *Reader) Methods() []string {
+	var chains []string
+	for _, f := range z.folders {
+		names := make([]string, len(f.coders))
+		for i, c := range f.coders {
+			names[i] = methodName(c.id)
+		}
+		if chain := strings.Join(names, " "); !slices.Contains(chains, chain) {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+// namedReader prefixes read errors with the name of the file being read,
+// since decoder errors alone do not say where the archive is damaged
+type namedReader struct {
+	r    io.Reader
+	name string
+}
+
+func (nr namedReader) Read(p []byte) (int, error) {
+	n, err := nr.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%s: %w", nr.name, err)
+	}
+	return n, err
+}
+
+// subStream is the content of one file within a folder
+type subStream struct {
+	size   uint64
+	crc    uint32
+	hasCRC bool
+}
+
+// coder is one decoding step of a folder
+type coder struct {
+	id            []byte
+	numIn, numOut int
+	props         []byte
+}
+
+// bindPair feeds the output stream out of one coder into the input stream
+// in of another
+type bindPair struct {
+	in, out uint64
+}
+
+// folder is a group of coders decoding packed streams into the content of
+// one or more files. Coder streams are numbered across the folder, in
+// coder order.
+type folder struct {
+	coders    []coder
+	bindPairs []bindPair
+	// packedStreams are the input streams read from the archive
+	packedStreams []uint64
+	// unpackSizes holds the size of every output stream
+	unpackSizes []uint64
+	crc         uint32
+	hasCRC      bool
+
+	// packOffset locates the first packed stream, relative to the end of
+	// the signature header
+	packOffset uint64
+	packSizes  []uint64
+	streams    []subStream
+}
+
+func (f *folder) numIn() int {
+	n := 0
+	for _, c := range f.coders {
+		n += c.numIn
+	}
+	return n
+}
+
+func (f *folder) numOut() int {
+	n := 0
+	for _, c := range f.coders {
+		n += c.numOut
+	}
+	return n
+}
+
+func (f *folder) bindPairForIn(in uint64) int {
+	for i, bp := range f.bindPairs {
+		if bp.in == in {
+			return i
+		}
+	}
+	return -1
+}
+
+// mainOut is the output stream no other coder reads: the folder's content
+func (f *folder) mainOut() int {
+	for i := range f.numOut() {
+		bound := false
+		for _, bp := range f.bindPairs {
+			if bp.out == uint64(i) {
+				bound = true
+			}
+		}
+		if !bound {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *folder) unpackSize() uint64 {
+	if out := f.mainOut(); out >= 0 && out < len(f.unpackSizes) {
+		return f.unpackSizes[out]
+	}
+	return 0
+}
+
+// folderReader returns the decoded content of f
+func (z *Reader) folderReader(f *folder) (io.Reader, error) {
+	out := f.mainOut()
+	if out < 0 || len(f.unpackSizes) != f.numOut() {
+		return nil, ErrFormat
+	}
+	r, err := z.outStream(f, out, 0)
+	if err != nil {
+		return nil, err
+	}
+	return io.LimitReader(r, int64(f.unpackSize())), nil
+}
+
+// outStream returns a reader for output stream out of f. depth guards
+// against bind pairs that form a cycle.
+func (z *Reader) outStream(f *folder, out, depth int) (io.Reader, error) {
+	if depth > len(f.coders) {
+		return nil, ErrFormat
+	}
+
+	firstIn, firstOut := 0, 0
+	for _, c := range f.coders {
+		if out < firstOut+c.numOut {
+			// Only chains of single-stream coders are supported, which
+			// rules out BCJ2
+			if c.numIn != 1 || c.numOut != 1 {
+				return nil, fmt.Errorf("sevenzip: unsupported compression method %s", methodName(c.id))
+			}
+			input, err := z.inStream(f, firstIn, depth)
+			if err != nil {
+				return nil, err
+			}
+			return newDecoder(c, input, f.unpackSizes[out])
+		}
+		firstIn += c.numIn
+		firstOut += c.numOut
+	}
+	return nil, ErrFormat
+}
+
+// inStream returns a reader for input stream in of f: the output of
+// another coder, or a packed stream read from the archive
+func (z *Reader) inStream(f *folder, in, depth int) (io.Reader, error) {
+	if bp := f.bindPairForIn(uint64(in)); bp >= 0 {
+		return z.outStream(f, int(f.bindPairs[bp].out), depth+1)
+	}
+
+	packed := -1
+	for i, s := range f.packedStreams {
+		if s == uint64(in) {
+			packed = i
+		}
+	}
+	if packed < 0 || packed >= len(f.packSizes) {
+		return nil, ErrFormat
+	}
+	offset := f.packOffset
+	for _, size := range f.packSizes[:packed] {
+		offset += size
+	}
+	size := f.packSizes[packed]
+	avail := uint64(z.size - signatureHeaderSize)
+	if offset > avail || size > avail-offset {
+		return nil, ErrFormat
+	}
+	return bufio.NewReader(io.NewSectionReader(z.r, signatureHeaderSize+int64(offset), int64(size))), nil
+}
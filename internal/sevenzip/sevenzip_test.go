@@ -0,0 +1,216 @@
+package sevenzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata were written by bsdtar 3.7 from the same tree:
+//
+//	bsdtar --format 7zip --options compression=<method> -cf <method>.7z a.txt empty.txt d link
+//
+// where d holds big.txt and the empty directory e, and link points to a.txt.
+var fixtureFiles = map[string]struct {
+	content string
+	mode    fs.FileMode
+}{
+	"a.txt":     {"hello\n", 0},
+	"empty.txt": {"", 0},
+	"d":         {"", fs.ModeDir},
+	"d/e":       {"", fs.ModeDir},
+	"d/big.txt": {strings.Repeat("x", 5000), 0},
+	"link":      {"a.txt", fs.ModeSymlink},
+}
+
+func TestReadFixtures(t *testing.T) {
+	tests := []struct {
+		file    string
+		methods string
+		// want is the error Walk fails with, if any
+		want string
+	}{
+		{"store.7z", "Copy", ""},
+		{"lzma1.7z", "LZMA", ""},
+		{"lzma2.7z", "LZMA2", ""},
+		{"bzip2.7z", "BZip2", ""},
+		{"deflate.7z", "Deflate", ""},
+		{"ppmd.7z", "PPMD", "unsupported compression method PPMD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			z, err := OpenReader(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer z.Close()
+
+			if got := strings.Join(z.Methods(), ","); got != tt.methods {
+				t.Errorf("Methods = %q, want %q", got, tt.methods)
+			}
+			if len(z.File) != len(fixtureFiles) {
+				t.Errorf("%d entries, want %d", len(z.File), len(fixtureFiles))
+			}
+
+			err = z.Walk(func(f *File, r io.Reader) error {
+				want, ok := fixtureFiles[f.Name]
+				if !ok {
+					t.Errorf("unexpected entry %q", f.Name)
+					return nil
+				}
+				if f.Mode.Type() != want.mode {
+					t.Errorf("%s: type %v, want %v", f.Name, f.Mode.Type(), want.mode)
+				}
+				if f.Size != int64(len(want.content)) {
+					t.Errorf("%s: size %d, want %d", f.Name, f.Size, len(want.content))
+				}
+				if r == nil {
+					return nil
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				if string(got) != want.content {
+					t.Errorf("%s = %q, want %q", f.Name, got, want.content)
+				}
+				return nil
+			})
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Walk error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCorrupted(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "lzma2.7z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func([]byte) []byte
+		want   error
+	}{
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }, ErrFormat},
+		{"bad signature", func(b []byte) []byte { b[0] = 'X'; return b }, ErrFormat},
+		{"start header checksum", func(b []byte) []byte { b[20]++; return b }, ErrChecksum},
+		{"header checksum", func(b []byte) []byte { b[len(b)-1]++; return b }, ErrChecksum},
+		{"short", func(b []byte) []byte { return b[:10] }, ErrFormat},
+	}
+	for _, tt := range tests {
+		b := tt.change(bytes.Clone(data))
+		if _, err := NewReader(bytes.NewReader(b), int64(len(b))); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// property encodes one file property of the header
+func property(id byte, payload ...byte) []byte {
+	return append([]byte{id, byte(len(payload))}, payload...)
+}
+
+func TestFilesPropertyOrder(t *testing.T) {
+	names := property(idName, 0, 'a', 0, 0, 0, 'b', 0, 0, 0, 'c', 0, 0, 0)
+
+	tests := []struct {
+		name  string
+		props [][]byte
+		// want is the number of entries, or -1 for a malformed header
+		want int
+	}{
+		{"empty stream first", [][]byte{property(idEmptyStream, 0xe0), property(idEmptyFile, 0x40), property(idAnti, 0x20), names}, 2},
+		{"empty file before empty stream", [][]byte{property(idEmptyFile, 0x80), property(idEmptyStream, 0xe0), names}, -1},
+		{"anti before empty stream", [][]byte{property(idAnti, 0x80), property(idEmptyStream, 0xe0), names}, -1},
+		{"empty stream twice", [][]byte{property(idEmptyStream, 0x80), property(idAnti, 0x00), property(idEmptyStream, 0xe0), names}, -1},
+		{"empty file twice", [][]byte{property(idEmptyStream, 0xe0), property(idEmptyFile, 0x00), property(idEmptyFile, 0xe0), names}, -1},
+		{"vector too short", [][]byte{property(idEmptyStream), names}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := append([]byte{3}, bytes.Join(tt.props, nil)...)
+			h := &headerReader{buf: append(buf, idEnd)}
+			files := h.files(&streamsInfo{})
+			if tt.want < 0 {
+				if !errors.Is(h.err, ErrFormat) {
+					t.Fatalf("error = %v, want ErrFormat", h.err)
+				}
+				return
+			}
+			if h.err != nil {
+				t.Fatal(h.err)
+			}
+			if len(files) != tt.want {
+				t.Errorf("%d entries, want %d", len(files), tt.want)
+			}
+		})
+	}
+}
+
+// withChecksums fixes up the checksums of the start header and the header
+// of a 7z archive, so that fuzzed headers are parsed rather than rejected
+func withChecksums(b []byte) []byte {
+	if len(b) < signatureHeaderSize || !bytes.Equal(b[:len(Signature)], Signature) {
+		return b
+	}
+	offset := binary.LittleEndian.Uint64(b[12:])
+	length := binary.LittleEndian.Uint64(b[20:])
+	avail := uint64(len(b) - signatureHeaderSize)
+	if offset <= avail && length <= avail-offset {
+		header := b[signatureHeaderSize+offset:][:length]
+		binary.LittleEndian.PutUint32(b[28:], crc32.ChecksumIEEE(header))
+	}
+	binary.LittleEndian.PutUint32(b[8:], crc32.ChecksumIEEE(b[12:signatureHeaderSize]))
+	return b
+}
+
+func FuzzNewReader(f *testing.F) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.7z"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range fixtures {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		data = withChecksums(bytes.Clone(data))
+		z, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		for _, f := range z.File {
+			// Content is bounded by the input, but a decoder may expand
+			// it to whatever size the header claims
+			if f.Size > 1<<20 {
+				return
+			}
+		}
+		z.Walk(func(f *File, r io.Reader) error {
+			if r != nil {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}
+			return nil
+		})
+	})
+}
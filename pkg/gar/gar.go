@@ -0,0 +1,159 @@
+// Package gar exposes GoArchive's compression and extraction as a library
+package gar
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/cubetiqlabs/gar/internal/archive"
+	"github.com/cubetiqlabs/gar/internal/models"
+)
+
+// Entry describes a single archive member passed to an EntryFilter
+type Entry = models.Entry
+
+// Format identifies an archive format
+type Format = models.ArchiveFormat
+
+// Supported archive formats
+const (
+	FormatZip      = models.FormatZip
+	FormatTarGz    = models.FormatTarGz
+	FormatTarBz2   = models.FormatTarBz2
+	FormatSevenZip = models.FormatSevenZip // read only
+	FormatTarZstd  = models.FormatTarZstd
+	FormatTarXz    = models.FormatTarXz
+	FormatTar      = models.FormatTar
+)
+
+// Level identifies a compression preset
+type Level = models.CompressionLevel
+
+// Supported compression presets
+const (
+	LevelFastest = models.LevelFastest
+	LevelNormal  = models.LevelNormal
+	LevelBest    = models.LevelBest
+	LevelStore   = models.LevelStore
+	LevelHuffman = models.LevelHuffman
+)
+
+// Options configures library archive operations
+type Options struct {
+	Format           Format
+	CompressionLevel Level
+	Password         string
+	Workers          int
+	Verbose          bool
+
+	// Levels sets an exact codec level per format, overriding
+	// CompressionLevel for that format: 1-9 for zip and tar.gz (deflate),
+	// tar.bz2 (block size) and tar.xz (preset), and 1-22 for tar.zst.
+	// Formats without an entry (or with 0) use the preset. Plain tar and
+	// 7z take no level. To store without compression, set
+	// CompressionLevel to LevelStore instead. Operations fail on levels
+	// outside these ranges.
+	Levels map[Format]int
+
+	// EntryFilter is consulted for every entry during compress and extract.
+	// It can drop an entry (include=false) or store/extract it under a new
+	// name. A nil filter includes everything unchanged.
+	EntryFilter func(Entry) (include bool, newName string)
+}
+
+// archiveOptions converts library options into internal archive options
+func (o Options) archiveOptions() (*models.ArchiveOptions, error) {
+	if err := archive.CheckFormatLevels(o.Levels); err != nil {
+		return nil, err
+	}
+
+	workers := o.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	return &models.ArchiveOptions{
+		Format:           o.Format,
+		CompressionLevel: o.CompressionLevel,
+		CodecLevel:       o.Levels[o.Format],
+		Password:         o.Password,
+		Workers:          workers,
+		Verbose:          o.Verbose,
+		EntryFilter:      o.EntryFilter,
+	}, nil
+}
+
+// Compress archives inputPath into outputPath
+func Compress(inputPath, outputPath string, opts Options) error {
+	o, err := opts.archiveOptions()
+	if err != nil {
+		return err
+	}
+	return archive.NewOperator(o).Compress(inputPath, outputPath)
+}
+
+// Extract extracts the archive at inputPath into outputPath
+func Extract(inputPath, outputPath string, opts Options) error {
+	o, err := opts.archiveOptions()
+	if err != nil {
+		return err
+	}
+	return archive.NewOperator(o).Extract(inputPath, outputPath)
+}
+
+// List prints the contents of the archive at inputPath
+func List(inputPath string, opts Options) error {
+	o, err := opts.archiveOptions()
+	if err != nil {
+		return err
+	}
+	return archive.NewOperator(o).List(inputPath)
+}
+
+// Errors returned by DetectFormat
+var (
+	ErrUnknownFormat    = archive.ErrUnknownFormat
+	ErrEncryptedArchive = archive.ErrEncryptedArchive
+)
+
+// DetectFormat recognizes the format of an archive from its content. An
+// archive encrypted as a whole yields ErrEncryptedArchive.
+func DetectFormat(r io.ReaderAt) (Format, error) {
+	return archive.DetectFormat(r)
+}
+
+// Writer streams an archive to an io.Writer entry by entry, such as an HTTP
+// response, without staging the content on disk
+type Writer struct {
+	sw *archive.StreamWriter
+}
+
+// NewWriter starts an archive in format on w. Password encrypts the whole
+// stream; Close must be called to complete the archive.
+func NewWriter(w io.Writer, format Format, opts Options) (*Writer, error) {
+	opts.Format = format
+	o, err := opts.archiveOptions()
+	if err != nil {
+		return nil, err
+	}
+	sw, err := archive.NewStreamWriter(w, o)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{sw: sw}, nil
+}
+
+// Add writes an entry named name with the contents of r. Pass a directory
+// mode (os.ModeDir|0755) and a nil reader to add a directory. Names are
+// slash-separated and relative; absolute names and names containing ".."
+// are rejected.
+func (w *Writer) Add(name string, r io.Reader, mode os.FileMode, modTime time.Time) error {
+	return w.sw.Add(name, r, mode, modTime)
+}
+
+// Close completes the archive. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.sw.Close()
+}
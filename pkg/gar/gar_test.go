@@ -0,0 +1,193 @@
+package gar
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels map[Format]int
+		want   string
+	}{
+		{"none", nil, ""},
+		{"preset", map[Format]int{FormatZip: 0}, ""},
+		{"in range", map[Format]int{FormatZip: 9, FormatTarGz: 1, FormatTarBz2: 9, FormatTarXz: 6, FormatTarZstd: 22}, ""},
+		{"zip too high", map[Format]int{FormatZip: 10}, "invalid zip level 10"},
+		{"zstd too high", map[Format]int{FormatTarZstd: 23}, "invalid tar.zst level 23"},
+		{"negative", map[Format]int{FormatTarGz: -1}, "invalid tar.gz level -1"},
+		{"tar", map[Format]int{FormatTar: 5}, "has no compression levels"},
+		{"7z", map[Format]int{FormatSevenZip: 1}, "has no compression levels"},
+		{"unknown format", map[Format]int{Format(99): 1}, "unknown format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Options{Levels: tt.levels}.archiveOptions()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressWithLevels(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("gar levels "), 4096)
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		format Format
+		ext    string
+		level  int
+	}{
+		{FormatZip, ".zip", 1},
+		{FormatTarGz, ".tar.gz", 9},
+		{FormatTarZstd, ".tar.zst", 19},
+	} {
+		output := filepath.Join(dir, "out"+tt.ext)
+		opts := Options{Format: tt.format, Levels: map[Format]int{tt.format: tt.level}}
+		if err := Compress(src, output, opts); err != nil {
+			t.Fatalf("%s: %v", tt.ext, err)
+		}
+		dest := filepath.Join(dir, "dest"+tt.ext)
+		if err := Extract(output, dest, Options{}); err != nil {
+			t.Fatalf("%s: %v", tt.ext, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dest, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s: a.txt differs after the round trip", tt.ext)
+		}
+	}
+
+	// A bad level fails before anything is written
+	output := filepath.Join(dir, "bad.zip")
+	err := Compress(src, output, Options{Format: FormatZip, Levels: map[Format]int{FormatZip: 12}})
+	if err == nil {
+		t.Fatal("Compress accepted zip level 12")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("output written despite the bad level (err %v)", err)
+	}
+}
+
+func TestNewWriterRejectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf, FormatTarGz, Options{Levels: map[Format]int{FormatTarGz: 10}}); err == nil {
+		t.Fatal("NewWriter accepted tar.gz level 10")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("NewWriter wrote %d bytes", buf.Len())
+	}
+}
+
+// treeFiles maps the regular files under root to their content
+func treeFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestEntryFilter(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for name, content := range map[string]string{
+		"a.txt":       "a",
+		"debug.log":   "log",
+		"old/b.txt":   "b",
+		"old/c.log":   "c",
+		"other/d.txt": "d",
+	} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Drop logs and move old/ to new/
+	filter := func(e Entry) (bool, string) {
+		if strings.HasSuffix(e.Name, ".log") {
+			return false, ""
+		}
+		if rest, ok := strings.CutPrefix(e.Name, "old/"); ok {
+			return true, "new/" + rest
+		}
+		return true, ""
+	}
+	want := map[string]string{"a.txt": "a", "new/b.txt": "b", "other/d.txt": "d"}
+
+	for _, tt := range []struct {
+		format Format
+		ext    string
+	}{
+		{FormatZip, ".zip"},
+		{FormatTarGz, ".tar.gz"},
+		{FormatTarZstd, ".tar.zst"},
+	} {
+		t.Run(tt.ext, func(t *testing.T) {
+			// Filtered while compressing
+			output := filepath.Join(t.TempDir(), "out"+tt.ext)
+			if err := Compress(src, output, Options{Format: tt.format, EntryFilter: filter}); err != nil {
+				t.Fatal(err)
+			}
+			dest := filepath.Join(t.TempDir(), "compressed")
+			if err := Extract(output, dest, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := treeFiles(t, dest); !maps.Equal(got, want) {
+				t.Errorf("filtered on compress: got %v, want %v", got, want)
+			}
+
+			// Filtered while extracting
+			output = filepath.Join(t.TempDir(), "all"+tt.ext)
+			if err := Compress(src, output, Options{Format: tt.format}); err != nil {
+				t.Fatal(err)
+			}
+			dest = filepath.Join(t.TempDir(), "extracted")
+			if err := Extract(output, dest, Options{EntryFilter: filter}); err != nil {
+				t.Fatal(err)
+			}
+			if got := treeFiles(t, dest); !maps.Equal(got, want) {
+				t.Errorf("filtered on extract: got %v, want %v", got, want)
+			}
+		})
+	}
+}